@@ -0,0 +1,615 @@
+package chain
+
+import (
+	"context"
+	"crypto/ed25519"
+	"github.com/pkg/errors"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/algorand/go-algorand-sdk/client/v2/algod"
+	"github.com/algorand/go-algorand-sdk/client/v2/common/models"
+	"github.com/algorand/go-algorand-sdk/crypto"
+	"github.com/algorand/go-algorand-sdk/future"
+	"github.com/algorand/go-algorand-sdk/types"
+	"github.com/stellar/go/strkey"
+
+	issuer "github.com/YaleOpenLab/openx/chains/xlm/issuer"
+	wallet "github.com/YaleOpenLab/openx/chains/xlm/wallet"
+
+	consts "github.com/YaleOpenLab/opensolar/consts"
+)
+
+// AlgorandName is the name of the algorand chain
+const AlgorandName = "algorand"
+
+// algorandDecimals is the number of decimals of the assets the platform creates on algorand, the same precision
+// stellar assets have
+const algorandDecimals = 7
+
+// algorandWaitRounds is the number of rounds to wait for a transaction to be confirmed
+const algorandWaitRounds = 10
+
+// algorandTimeout is how long a call to algod can take
+const algorandTimeout = 60 * time.Second
+
+// Algorand holds project assets as algorand standard assets. An asset is created by the project's issuer with its
+// whole supply, and is issued by sending it out of the issuer's account. Accounts have to opt in to an asset before
+// they can hold it, which is what trusting an asset does on algorand. Assets are referred to by their name, which
+// is the code returned by AssetID, and the address of their creator, except for the stablecoin which is referred
+// to by its asset id
+type Algorand struct {
+	Client *algod.Client
+}
+
+// NewAlgorand returns an algorand chain that talks to the algod node at address
+func NewAlgorand(address string, token string) (*Algorand, error) {
+	client, err := algod.MakeClient(address, token)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create algod client")
+	}
+	return &Algorand{Client: client}, nil
+}
+
+// Name returns the name of the algorand chain
+func (a *Algorand) Name() string {
+	return AlgorandName
+}
+
+// algorandKey returns the algorand key of a stellar seed
+func algorandKey(seed string) (ed25519.PrivateKey, types.Address, error) {
+	var address types.Address
+	raw, err := strkey.Decode(strkey.VersionByteSeed, seed)
+	if err != nil {
+		return nil, address, errors.Wrap(err, "could not decode seed")
+	}
+	key := ed25519.NewKeyFromSeed(raw)
+	copy(address[:], key.Public().(ed25519.PublicKey))
+	return key, address, nil
+}
+
+// Address returns the algorand address of a stellar public key. Algorand addresses are returned as they are
+func (a *Algorand) Address(pubkey string) (string, error) {
+	if _, err := types.DecodeAddress(pubkey); err == nil {
+		return pubkey, nil
+	}
+
+	raw, err := strkey.Decode(strkey.VersionByteAccountID, pubkey)
+	if err != nil {
+		return "", errors.Wrap(err, "could not decode public key")
+	}
+	var address types.Address
+	copy(address[:], raw)
+	return address.String(), nil
+}
+
+// PublicKey returns the algorand address of a stellar seed
+func (a *Algorand) PublicKey(seed string) (string, error) {
+	_, address, err := algorandKey(seed)
+	if err != nil {
+		return "", err
+	}
+	return address.String(), nil
+}
+
+// account returns the state of an account
+func (a *Algorand) account(address string) (models.Account, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), algorandTimeout)
+	defer cancel()
+	return a.Client.AccountInformation(address).Do(ctx)
+}
+
+// AccountExists checks whether an account holds algos, accounts on algorand exist once they've been funded
+func (a *Algorand) AccountExists(address string) bool {
+	account, err := a.account(address)
+	return err == nil && account.Amount > 0
+}
+
+// send signs a transaction with key, sends it and waits for it to be confirmed
+func (a *Algorand) send(tx types.Transaction, key ed25519.PrivateKey) (models.PendingTransactionInfoResponse, error) {
+	var info models.PendingTransactionInfoResponse
+	_, stx, err := crypto.SignTransaction(key, tx)
+	if err != nil {
+		return info, errors.Wrap(err, "could not sign transaction")
+	}
+	return a.sendRaw(stx)
+}
+
+// sendRaw sends a signed transaction and waits for it to be confirmed
+func (a *Algorand) sendRaw(stx []byte) (models.PendingTransactionInfoResponse, error) {
+	var info models.PendingTransactionInfoResponse
+	ctx, cancel := context.WithTimeout(context.Background(), algorandTimeout)
+	defer cancel()
+
+	txid, err := a.Client.SendRawTransaction(stx).Do(ctx)
+	if err != nil {
+		return info, errors.Wrap(err, "could not send transaction")
+	}
+
+	info, err = future.WaitForConfirmation(a.Client, txid, algorandWaitRounds, ctx)
+	if err != nil {
+		return info, errors.Wrap(err, "transaction "+txid+" not confirmed")
+	}
+	return info, nil
+}
+
+// params returns the parameters of a new transaction
+func (a *Algorand) params() (types.SuggestedParams, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), algorandTimeout)
+	defer cancel()
+	params, err := a.Client.SuggestedParams().Do(ctx)
+	if err != nil {
+		return params, errors.Wrap(err, "could not get transaction params")
+	}
+	return params, nil
+}
+
+// pay sends microalgos from the account of key to dest
+func (a *Algorand) pay(key ed25519.PrivateKey, from types.Address, dest string, amount uint64, note string) (string, error) {
+	params, err := a.params()
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := future.MakePaymentTxn(from.String(), dest, amount, []byte(note), "", params)
+	if err != nil {
+		return "", errors.Wrap(err, "could not build payment")
+	}
+
+	txid := crypto.GetTxID(tx)
+	_, err = a.send(tx, key)
+	return txid, err
+}
+
+// InitIssuer creates and stores the issuer's seed the same way as on stellar and funds its algorand account with
+// enough algos to create the project's assets
+func (a *Algorand) InitIssuer(path string, projIndex int, seedpwd string, funderSeed string) error {
+	err := issuer.InitIssuer(path, projIndex, seedpwd)
+	if err != nil {
+		return errors.Wrap(err, "error while initializing issuer")
+	}
+
+	address, _, err := a.IssuerSeed(path, projIndex, seedpwd)
+	if err != nil {
+		return err
+	}
+
+	key, funder, err := algorandKey(funderSeed)
+	if err != nil {
+		return err
+	}
+
+	_, err = a.pay(key, funder, address, consts.AlgorandIssuerFund, "opensolar issuer")
+	if err != nil {
+		return errors.Wrap(err, "error while funding issuer")
+	}
+	return nil
+}
+
+// IssuerSeed returns the algorand address and the seed of the issuer of a project's assets
+func (a *Algorand) IssuerSeed(path string, projIndex int, seedpwd string) (string, string, error) {
+	_, seed, err := wallet.RetrieveSeed(issuer.GetPath(path, projIndex), seedpwd)
+	if err != nil {
+		return "", "", err
+	}
+
+	address, err := a.PublicKey(seed)
+	if err != nil {
+		return "", "", err
+	}
+	return address, seed, nil
+}
+
+// FreezeIssuer rekeys the issuer to a new key that is thrown away. The issuer can't send the assets it hasn't
+// issued yet or change their parameters after this
+func (a *Algorand) FreezeIssuer(path string, projIndex int, seedpwd string) (string, error) {
+	_, seed, err := a.IssuerSeed(path, projIndex, seedpwd)
+	if err != nil {
+		return "", err
+	}
+
+	key, address, err := algorandKey(seed)
+	if err != nil {
+		return "", err
+	}
+
+	params, err := a.params()
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := future.MakePaymentTxn(address.String(), address.String(), 0, []byte("opensolar freeze"), "", params)
+	if err != nil {
+		return "", errors.Wrap(err, "could not build rekey transaction")
+	}
+
+	err = tx.Rekey(crypto.GenerateAccount().Address.String())
+	if err != nil {
+		return "", errors.Wrap(err, "could not rekey issuer")
+	}
+
+	txid := crypto.GetTxID(tx)
+	_, err = a.send(tx, key)
+	return txid, err
+}
+
+// AssetID returns the name of an asset created by the platform, which is at most 32 bytes on algorand. The stellar
+// asset id is used so that the asset has the same code on both chains
+func (a *Algorand) AssetID(name string) string {
+	return Stellar{}.AssetID(name)
+}
+
+// asset looks up the id and decimals of an asset. Assets with an issuer are looked up by name among the assets
+// the issuer has created, the stablecoin is referred to by its id
+func (a *Algorand) asset(code string, issuer string) (uint64, uint64, error) {
+	if issuer == "" {
+		index, err := strconv.ParseUint(code, 10, 64)
+		if err != nil {
+			return 0, 0, errors.New("assets without an issuer must be referred to by their id on algorand")
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), algorandTimeout)
+		defer cancel()
+		asset, err := a.Client.GetAssetByID(index).Do(ctx)
+		if err != nil {
+			return 0, 0, errors.Wrap(err, "could not retrieve asset "+code)
+		}
+		return asset.Index, asset.Params.Decimals, nil
+	}
+
+	account, err := a.account(issuer)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "could not retrieve issuer")
+	}
+
+	for _, asset := range account.CreatedAssets {
+		if asset.Params.Name == code {
+			return asset.Index, asset.Params.Decimals, nil
+		}
+	}
+	return 0, 0, errors.New("asset " + code + " hasn't been issued by " + issuer)
+}
+
+// toUnits converts an amount to the base units of an asset with the passed decimals
+func toUnits(amount float64, decimals uint64) uint64 {
+	return uint64(math.Round(amount * math.Pow10(int(decimals))))
+}
+
+// IssueAsset creates an asset with the whole supply held by the issuer. Assets the issuer has already created
+// aren't created again
+func (a *Algorand) IssueAsset(code string, supply float64, issuerSeed string) (string, error) {
+	key, address, err := algorandKey(issuerSeed)
+	if err != nil {
+		return "", err
+	}
+
+	if _, _, err := a.asset(code, address.String()); err == nil {
+		return "", nil
+	}
+
+	params, err := a.params()
+	if err != nil {
+		return "", err
+	}
+
+	unitName := code
+	if len(unitName) > 8 {
+		unitName = unitName[:8]
+	}
+
+	// the issuer stays the manager and reserve of the asset so that freezing the issuer locks the asset as well,
+	// and is its clawback so that it can take the asset back from investors who are refunded
+	tx, err := future.MakeAssetCreateTxn(address.String(), []byte("opensolar asset"), params,
+		toUnits(supply, algorandDecimals), algorandDecimals, false, address.String(), address.String(), "",
+		address.String(), unitName, code, "", "")
+	if err != nil {
+		return "", errors.Wrap(err, "could not build asset creation")
+	}
+
+	txid := crypto.GetTxID(tx)
+	_, err = a.send(tx, key)
+	if err != nil {
+		return "", errors.Wrap(err, "could not create asset")
+	}
+	return txid, nil
+}
+
+// TrustAsset opts in to an asset. Holdings on algorand don't have a limit
+func (a *Algorand) TrustAsset(code string, issuer string, limit float64, seed string) (string, error) {
+	key, address, err := algorandKey(seed)
+	if err != nil {
+		return "", err
+	}
+
+	index, _, err := a.asset(code, issuer)
+	if err != nil {
+		return "", err
+	}
+
+	account, err := a.account(address.String())
+	if err != nil {
+		return "", errors.Wrap(err, "could not retrieve account")
+	}
+	for _, holding := range account.Assets {
+		if holding.AssetId == index {
+			return "", nil
+		}
+	}
+
+	params, err := a.params()
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := future.MakeAssetAcceptanceTxn(address.String(), nil, params, index)
+	if err != nil {
+		return "", errors.Wrap(err, "could not build opt in")
+	}
+
+	txid := crypto.GetTxID(tx)
+	_, err = a.send(tx, key)
+	return txid, err
+}
+
+// SendAsset sends an asset. Sends out of the issuer's account issue the asset
+func (a *Algorand) SendAsset(code string, issuer string, dest string, amount float64, seed string, memo string) (string, error) {
+	key, address, err := algorandKey(seed)
+	if err != nil {
+		return "", err
+	}
+
+	index, decimals, err := a.asset(code, issuer)
+	if err != nil {
+		return "", err
+	}
+
+	params, err := a.params()
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := future.MakeAssetTransferTxn(address.String(), dest, toUnits(amount, decimals), []byte(memo), params, "", index)
+	if err != nil {
+		return "", errors.Wrap(err, "could not build asset transfer")
+	}
+
+	txid := crypto.GetTxID(tx)
+	_, err = a.send(tx, key)
+	return txid, err
+}
+
+// Clawback revokes amount of an asset from an account back to the issuer, which is the clawback of every asset
+// it creates
+func (a *Algorand) Clawback(code string, issuer string, from string, amount float64, issuerSeed string) (string, error) {
+	key, address, err := algorandKey(issuerSeed)
+	if err != nil {
+		return "", err
+	}
+
+	index, decimals, err := a.asset(code, issuer)
+	if err != nil {
+		return "", err
+	}
+
+	params, err := a.params()
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := future.MakeAssetRevocationTxn(address.String(), from, toUnits(amount, decimals), issuer,
+		[]byte("opensolar clawback"), params, index)
+	if err != nil {
+		return "", errors.Wrap(err, "could not build asset revocation")
+	}
+
+	txid := crypto.GetTxID(tx)
+	_, err = a.send(tx, key)
+	return txid, err
+}
+
+// Balance returns the balance of an asset held by an account
+func (a *Algorand) Balance(address string, code string, issuer string) (float64, error) {
+	index, decimals, err := a.asset(code, issuer)
+	if err != nil {
+		return 0, err
+	}
+
+	account, err := a.account(address)
+	if err != nil {
+		return 0, errors.Wrap(err, "could not retrieve account")
+	}
+
+	for _, holding := range account.Assets {
+		if holding.AssetId == index {
+			return float64(holding.Amount) / math.Pow10(int(decimals)), nil
+		}
+	}
+	return 0, errors.New("account doesn't hold asset " + code)
+}
+
+// Record sends zero algos from the account controlled by seed to itself with memo as the note
+func (a *Algorand) Record(seed string, memo string) (string, error) {
+	key, from, err := algorandKey(seed)
+	if err != nil {
+		return "", err
+	}
+	return a.pay(key, from, from.String(), 0, memo)
+}
+
+// Stablecoin returns the id of the stablecoin, which doesn't need an issuer to be looked up
+func (a *Algorand) Stablecoin() (string, string) {
+	return strconv.FormatUint(consts.AlgorandStablecoinID, 10), ""
+}
+
+// BuyStablecoin doesn't do anything since the platform doesn't run an exchange on algorand. Accounts need to
+// hold the stablecoin already
+func (a *Algorand) BuyStablecoin(seed string, amount float64) error {
+	return nil
+}
+
+// ExchangeValue returns zero since the platform doesn't run an exchange on algorand
+func (a *Algorand) ExchangeValue(address string) (float64, error) {
+	return 0, nil
+}
+
+// escrowAccount returns the 2 of 2 multisig account of the recipient and the platform
+func escrowAccount(recpAddress types.Address, platformAddress types.Address) (crypto.MultisigAccount, error) {
+	return crypto.MultisigAccountWithParams(1, 2, []types.Address{recpAddress, platformAddress})
+}
+
+// sendMultisig signs a transaction from an escrow with both keys and sends it
+func (a *Algorand) sendMultisig(tx types.Transaction, account crypto.MultisigAccount, key1 ed25519.PrivateKey,
+	key2 ed25519.PrivateKey) (string, error) {
+
+	_, stx, err := crypto.SignMultisigTransaction(key1, account, tx)
+	if err != nil {
+		return "", errors.Wrap(err, "could not sign escrow transaction")
+	}
+
+	txid, stx, err := crypto.AppendMultisigTransaction(key2, account, stx)
+	if err != nil {
+		return "", errors.Wrap(err, "could not sign escrow transaction")
+	}
+
+	_, err = a.sendRaw(stx)
+	return txid, err
+}
+
+// InitEscrow creates a 2 of 2 multisig account of the recipient and the platform, funds it and opts it in to the
+// stablecoin. Multisig accounts on algorand are derived from their signers, so there is no seed to store
+func (a *Algorand) InitEscrow(projIndex int, seedpwd string, recpSeed string, platformSeed string) (string, error) {
+	recpKey, recpAddress, err := algorandKey(recpSeed)
+	if err != nil {
+		return "", err
+	}
+
+	platformKey, platformAddress, err := algorandKey(platformSeed)
+	if err != nil {
+		return "", err
+	}
+
+	account, err := escrowAccount(recpAddress, platformAddress)
+	if err != nil {
+		return "", errors.Wrap(err, "could not create escrow")
+	}
+
+	escrowAddress, err := account.Address()
+	if err != nil {
+		return "", errors.Wrap(err, "could not create escrow")
+	}
+
+	_, err = a.pay(platformKey, platformAddress, escrowAddress.String(), consts.AlgorandEscrowFund,
+		"opensolar escrow "+strconv.Itoa(projIndex))
+	if err != nil {
+		return "", errors.Wrap(err, "could not fund escrow")
+	}
+
+	params, err := a.params()
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := future.MakeAssetAcceptanceTxn(escrowAddress.String(), nil, params, consts.AlgorandStablecoinID)
+	if err != nil {
+		return "", errors.Wrap(err, "could not build opt in")
+	}
+
+	_, err = a.sendMultisig(tx, account, recpKey, platformKey)
+	if err != nil {
+		return "", errors.Wrap(err, "could not opt escrow in to stablecoin")
+	}
+	return escrowAddress.String(), nil
+}
+
+// SendFromEscrow sends stablecoin out of an escrow. The signers' keys derive the escrow's address, so seeds that
+// don't control the escrow are caught before anything is sent
+func (a *Algorand) SendFromEscrow(escrow string, dest string, amount float64, seed1 string, seed2 string, memo string) (string, error) {
+	key1, address1, err := algorandKey(seed1)
+	if err != nil {
+		return "", err
+	}
+
+	key2, address2, err := algorandKey(seed2)
+	if err != nil {
+		return "", err
+	}
+
+	account, err := escrowAccount(address1, address2)
+	if err != nil {
+		return "", errors.Wrap(err, "could not create escrow")
+	}
+
+	escrowAddress, err := account.Address()
+	if err != nil || escrowAddress.String() != escrow {
+		return "", errors.New("seeds don't control escrow " + escrow)
+	}
+
+	code, issuer := a.Stablecoin()
+	_, decimals, err := a.asset(code, issuer)
+	if err != nil {
+		return "", err
+	}
+
+	params, err := a.params()
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := future.MakeAssetTransferTxn(escrow, dest, toUnits(amount, decimals), []byte(memo), params, "",
+		consts.AlgorandStablecoinID)
+	if err != nil {
+		return "", errors.Wrap(err, "could not build asset transfer")
+	}
+
+	return a.sendMultisig(tx, account, key1, key2)
+}
+
+// Swap sends both transfers as an atomic transaction group, which the network applies in full or not at all
+func (a *Algorand) Swap(transfer1 Transfer, transfer2 Transfer, memo string) (string, error) {
+	params, err := a.params()
+	if err != nil {
+		return "", err
+	}
+
+	var txs []types.Transaction
+	var keys []ed25519.PrivateKey
+	for _, transfer := range []Transfer{transfer1, transfer2} {
+		key, address, err := algorandKey(transfer.Seed)
+		if err != nil {
+			return "", err
+		}
+
+		index, decimals, err := a.asset(transfer.Code, transfer.Issuer)
+		if err != nil {
+			return "", err
+		}
+
+		tx, err := future.MakeAssetTransferTxn(address.String(), transfer.Dest, toUnits(transfer.Amount, decimals),
+			[]byte(memo), params, "", index)
+		if err != nil {
+			return "", errors.Wrap(err, "could not build asset transfer")
+		}
+		txs = append(txs, tx)
+		keys = append(keys, key)
+	}
+
+	gid, err := crypto.ComputeGroupID(txs)
+	if err != nil {
+		return "", errors.Wrap(err, "could not group transfers")
+	}
+
+	var group []byte
+	for i := range txs {
+		txs[i].Group = gid
+		_, stx, err := crypto.SignTransaction(keys[i], txs[i])
+		if err != nil {
+			return "", errors.Wrap(err, "could not sign transaction")
+		}
+		group = append(group, stx...)
+	}
+
+	txid := crypto.GetTxID(txs[0])
+	_, err = a.sendRaw(group)
+	return txid, err
+}
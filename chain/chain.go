@@ -0,0 +1,119 @@
+package chain
+
+import (
+	"github.com/pkg/errors"
+	"log"
+	"sync"
+
+	consts "github.com/YaleOpenLab/opensolar/consts"
+)
+
+// a project's assets, escrow and payments live on the chain picked by Project.Chain. Core talks to that chain
+// through the Chain interface so that the contract flow is the same no matter which chain a project is on.
+// Users hold stellar wallets on the platform and every chain derives the accounts of a user from the ed25519 key of
+// their stellar wallet, so seeds and public keys passed in are those of the stellar wallet while addresses passed
+// back are native to the chain.
+
+// Chain is a chain that projects can hold their assets on
+type Chain interface {
+	// Name returns the name projects refer to the chain by
+	Name() string
+	// Address returns the address on the chain of the account controlled by a user's public key
+	Address(pubkey string) (string, error)
+	// PublicKey returns the address on the chain of the account controlled by a seed
+	PublicKey(seed string) (string, error)
+	// AccountExists checks whether an account has been created on the chain
+	AccountExists(address string) bool
+
+	// InitIssuer creates the issuer of a project's assets, stores its seed at path and funds it from funderSeed
+	InitIssuer(path string, projIndex int, seedpwd string, funderSeed string) error
+	// IssuerSeed returns the address and seed of the issuer of a project's assets
+	IssuerSeed(path string, projIndex int, seedpwd string) (string, string, error)
+	// FreezeIssuer stops the issuer of a project's assets from issuing any more of them
+	FreezeIssuer(path string, projIndex int, seedpwd string) (string, error)
+
+	// AssetID returns the code of the asset identified by name
+	AssetID(name string) string
+	// IssueAsset creates an asset of which at most supply will be issued. Chains on which an asset exists as soon
+	// as someone trusts it return without doing anything
+	IssueAsset(code string, supply float64, issuerSeed string) (string, error)
+	// TrustAsset lets the account controlled by seed hold up to limit of an asset
+	TrustAsset(code string, issuer string, limit float64, seed string) (string, error)
+	// SendAsset sends amount of an asset from the account controlled by seed to dest
+	SendAsset(code string, issuer string, dest string, amount float64, seed string, memo string) (string, error)
+	// Clawback takes amount of an asset back from an account to the asset's issuer. Chains whose protocol doesn't
+	// let an issuer take its assets back revoke the account's permission to hold the asset instead, which leaves
+	// the account unable to move it
+	Clawback(code string, issuer string, from string, amount float64, issuerSeed string) (string, error)
+	// Balance returns the balance of an asset held by an account
+	Balance(address string, code string, issuer string) (float64, error)
+	// Record writes memo to the chain in a transaction from the account controlled by seed to itself
+	Record(seed string, memo string) (string, error)
+
+	// Stablecoin returns the code and issuer of the asset used as USD on the chain
+	Stablecoin() (string, string)
+	// BuyStablecoin makes sure the account controlled by seed can pay amount in stablecoin, buying it with the
+	// chain's native coin where the chain has an exchange for it
+	BuyStablecoin(seed string, amount float64) error
+	// ExchangeValue returns the value in USD of the native coin held by an account that BuyStablecoin can exchange
+	// for the stablecoin, zero where the chain has no exchange
+	ExchangeValue(address string) (float64, error)
+
+	// InitEscrow creates the escrow of a project, which takes the signatures of both the recipient and the platform
+	// to send funds out of
+	InitEscrow(projIndex int, seedpwd string, recpSeed string, platformSeed string) (string, error)
+	// SendFromEscrow sends amount of stablecoin out of an escrow to dest
+	SendFromEscrow(escrow string, dest string, amount float64, seed1 string, seed2 string, memo string) (string, error)
+
+	// Swap makes both transfers in a single transaction, so either both of them go through or neither does
+	Swap(transfer1 Transfer, transfer2 Transfer, memo string) (string, error)
+}
+
+// Transfer is a payment of an asset out of the account controlled by Seed that is made along with another one
+type Transfer struct {
+	Code   string
+	Issuer string
+	Dest   string
+	Amount float64
+	Seed   string
+}
+
+var (
+	// chains is the registry of chains keyed by name
+	chains = make(map[string]Chain)
+	// chainsLock guards chains
+	chainsLock sync.RWMutex
+)
+
+func init() {
+	Register(Stellar{})
+
+	algorand, err := NewAlgorand(consts.AlgodAddress, consts.AlgodToken)
+	if err != nil {
+		log.Println("could not set up algorand client", err)
+		return
+	}
+	Register(algorand)
+}
+
+// Register registers a chain that projects can refer to by its name, replacing any chain of the same name
+func Register(chain Chain) {
+	chainsLock.Lock()
+	defer chainsLock.Unlock()
+	chains[chain.Name()] = chain
+}
+
+// Get returns the chain registered with the passed name. Projects that don't name a chain are on stellar
+func Get(name string) (Chain, error) {
+	if name == "" {
+		name = StellarName
+	}
+
+	chainsLock.RLock()
+	defer chainsLock.RUnlock()
+	chain, exists := chains[name]
+	if !exists {
+		return nil, errors.New("chain " + name + " not supported")
+	}
+	return chain, nil
+}
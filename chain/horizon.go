@@ -0,0 +1,338 @@
+package chain
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"net/http"
+	"strconv"
+
+	"github.com/stellar/go/clients/horizonclient"
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/txnbuild"
+
+	issuer "github.com/YaleOpenLab/openx/chains/xlm/issuer"
+	wallet "github.com/YaleOpenLab/openx/chains/xlm/wallet"
+
+	consts "github.com/YaleOpenLab/opensolar/consts"
+)
+
+// Horizon holds project assets on a stellar network reached through a horizon server of our choosing, like a
+// standalone network or the simulated network of package simnet. The stellar chain goes through openx, which
+// only talks to the public horizon servers, so Horizon builds and signs transactions itself
+type Horizon struct {
+	name         string
+	client       *horizonclient.Client
+	passphrase   string
+	stablecoin   string
+	stableIssuer string
+}
+
+// NewHorizon returns a chain called name on the network with the passed passphrase whose horizon server is at
+// url. Projects on the chain use the asset with code issued by stableIssuer as USD
+func NewHorizon(name string, url string, passphrase string, code string, stableIssuer string) *Horizon {
+	return &Horizon{
+		name:         name,
+		client:       &horizonclient.Client{HorizonURL: url, HTTP: http.DefaultClient},
+		passphrase:   passphrase,
+		stablecoin:   code,
+		stableIssuer: stableIssuer,
+	}
+}
+
+// horizonAmount formats an amount with the precision of stellar
+func horizonAmount(amount float64) string {
+	return strconv.FormatFloat(amount, 'f', 7, 64)
+}
+
+// submitError adds the result codes horizon returned for a transaction that failed to its error
+func submitError(err error) error {
+	herr, ok := err.(*horizonclient.Error)
+	if !ok {
+		return errors.Wrap(err, "could not submit transaction")
+	}
+	return errors.Wrap(err, fmt.Sprint("transaction failed with ", herr.Problem.Extras["result_codes"]))
+}
+
+// submit builds a transaction out of ops from the account source, signs it with seeds and submits it
+func (h *Horizon) submit(source string, memo string, ops []txnbuild.Operation, seeds ...string) (string, error) {
+	var signers []*keypair.Full
+	signed := make(map[string]bool)
+	for _, seed := range seeds {
+		kp, err := keypair.ParseFull(seed)
+		if err != nil {
+			return "", errors.Wrap(err, "could not parse seed")
+		}
+		// an account that is the source of more than one operation signs once, the network rejects extra signatures
+		if signed[kp.Address()] {
+			continue
+		}
+		signed[kp.Address()] = true
+		signers = append(signers, kp)
+	}
+
+	account, err := h.client.AccountDetail(horizonclient.AccountRequest{AccountID: source})
+	if err != nil {
+		return "", errors.Wrap(err, "could not load account "+source)
+	}
+
+	tx := txnbuild.Transaction{
+		SourceAccount: &account,
+		Operations:    ops,
+		BaseFee:       txnbuild.MinBaseFee,
+		Timebounds:    txnbuild.NewTimeout(300),
+		Network:       h.passphrase,
+	}
+	if memo != "" {
+		tx.Memo = txnbuild.MemoText(memo)
+	}
+
+	txe, err := tx.BuildSignEncode(signers...)
+	if err != nil {
+		return "", errors.Wrap(err, "could not build transaction")
+	}
+
+	resp, err := h.client.SubmitTransactionXDR(txe)
+	if err != nil {
+		return "", submitError(err)
+	}
+	return resp.Hash, nil
+}
+
+// createAccount creates the account dest holding amount lumens out of the account controlled by seed
+func (h *Horizon) createAccount(seed string, dest string, amount float64) (string, error) {
+	funder, err := h.PublicKey(seed)
+	if err != nil {
+		return "", err
+	}
+	op := txnbuild.CreateAccount{Destination: dest, Amount: horizonAmount(amount)}
+	return h.submit(funder, "", []txnbuild.Operation{&op}, seed)
+}
+
+// Name returns the name the chain was registered with
+func (h *Horizon) Name() string {
+	return h.name
+}
+
+// Address returns the public key since users' wallets are stellar wallets
+func (h *Horizon) Address(pubkey string) (string, error) {
+	return pubkey, nil
+}
+
+// PublicKey returns the public key of a seed
+func (h *Horizon) PublicKey(seed string) (string, error) {
+	kp, err := keypair.ParseFull(seed)
+	if err != nil {
+		return "", errors.Wrap(err, "could not parse seed")
+	}
+	return kp.Address(), nil
+}
+
+// AccountExists checks whether an account has been created on the network
+func (h *Horizon) AccountExists(address string) bool {
+	_, err := h.client.AccountDetail(horizonclient.AccountRequest{AccountID: address})
+	return err == nil
+}
+
+// InitIssuer creates the issuer of a project's assets and funds it with HorizonIssuerFund
+func (h *Horizon) InitIssuer(path string, projIndex int, seedpwd string, funderSeed string) error {
+	err := issuer.InitIssuer(path, projIndex, seedpwd)
+	if err != nil {
+		return errors.Wrap(err, "error while initializing issuer")
+	}
+
+	issuerPubkey, issuerSeed, err := h.IssuerSeed(path, projIndex, seedpwd)
+	if err != nil {
+		return err
+	}
+
+	_, err = h.createAccount(funderSeed, issuerPubkey, consts.HorizonIssuerFund)
+	if err != nil {
+		return errors.Wrap(err, "error while funding issuer")
+	}
+
+	_, err = h.allowRevoke(issuerSeed)
+	if err != nil {
+		return errors.Wrap(err, "error while allowing issuer to revoke its assets")
+	}
+	return nil
+}
+
+// allowRevoke lets the issuer controlled by issuerSeed revoke its assets, which it needs to do for Clawback
+func (h *Horizon) allowRevoke(issuerSeed string) (string, error) {
+	issuerPubkey, err := h.PublicKey(issuerSeed)
+	if err != nil {
+		return "", err
+	}
+	op := txnbuild.SetOptions{SetFlags: []txnbuild.AccountFlag{txnbuild.AuthRevocable}}
+	return h.submit(issuerPubkey, "", []txnbuild.Operation{&op}, issuerSeed)
+}
+
+// IssuerSeed returns the public key and seed of the issuer of a project's assets
+func (h *Horizon) IssuerSeed(path string, projIndex int, seedpwd string) (string, string, error) {
+	return wallet.RetrieveSeed(issuer.GetPath(path, projIndex), seedpwd)
+}
+
+// FreezeIssuer sets the weight of the issuer's key to zero
+func (h *Horizon) FreezeIssuer(path string, projIndex int, seedpwd string) (string, error) {
+	issuerPubkey, issuerSeed, err := h.IssuerSeed(path, projIndex, seedpwd)
+	if err != nil {
+		return "", err
+	}
+	op := txnbuild.SetOptions{MasterWeight: txnbuild.NewThreshold(0)}
+	return h.submit(issuerPubkey, "", []txnbuild.Operation{&op}, issuerSeed)
+}
+
+// AssetID returns the same code as on stellar
+func (h *Horizon) AssetID(name string) string {
+	return Stellar{}.AssetID(name)
+}
+
+// IssueAsset doesn't do anything since stellar assets exist as soon as they're trusted
+func (h *Horizon) IssueAsset(code string, supply float64, issuerSeed string) (string, error) {
+	return "", nil
+}
+
+// TrustAsset opens a trustline towards an asset
+func (h *Horizon) TrustAsset(code string, issuer string, limit float64, seed string) (string, error) {
+	pubkey, err := h.PublicKey(seed)
+	if err != nil {
+		return "", err
+	}
+	op := txnbuild.ChangeTrust{Line: txnbuild.CreditAsset{Code: code, Issuer: issuer}, Limit: horizonAmount(limit)}
+	return h.submit(pubkey, "", []txnbuild.Operation{&op}, seed)
+}
+
+// SendAsset sends an asset. Payments out of the issuer's account issue the asset
+func (h *Horizon) SendAsset(code string, issuer string, dest string, amount float64, seed string, memo string) (string, error) {
+	pubkey, err := h.PublicKey(seed)
+	if err != nil {
+		return "", err
+	}
+	op := txnbuild.Payment{Destination: dest, Amount: horizonAmount(amount), Asset: txnbuild.CreditAsset{Code: code, Issuer: issuer}}
+	return h.submit(pubkey, memo, []txnbuild.Operation{&op}, seed)
+}
+
+// Clawback revokes the permission of an account to hold an asset since stellar doesn't let an issuer take its
+// assets back. The account keeps its balance but can't move it anymore
+func (h *Horizon) Clawback(code string, issuer string, from string, amount float64, issuerSeed string) (string, error) {
+	op := txnbuild.AllowTrust{Trustor: from, Type: txnbuild.CreditAsset{Code: code, Issuer: issuer}, Authorize: false}
+	return h.submit(issuer, "", []txnbuild.Operation{&op}, issuerSeed)
+}
+
+// Balance returns the balance of an asset held by an account
+func (h *Horizon) Balance(address string, code string, issuer string) (float64, error) {
+	account, err := h.client.AccountDetail(horizonclient.AccountRequest{AccountID: address})
+	if err != nil {
+		return 0, errors.Wrap(err, "could not load account "+address)
+	}
+
+	for _, balance := range account.Balances {
+		if balance.Asset.Code == code && balance.Asset.Issuer == issuer {
+			return strconv.ParseFloat(balance.Balance, 64)
+		}
+	}
+	return 0, errors.New("account doesn't trust " + code)
+}
+
+// Record sends the smallest amount of lumens from the account controlled by seed to itself with memo
+func (h *Horizon) Record(seed string, memo string) (string, error) {
+	pubkey, err := h.PublicKey(seed)
+	if err != nil {
+		return "", err
+	}
+	op := txnbuild.Payment{Destination: pubkey, Amount: horizonAmount(1e-7), Asset: txnbuild.NativeAsset{}}
+	return h.submit(pubkey, memo, []txnbuild.Operation{&op}, seed)
+}
+
+// Stablecoin returns the asset the chain was set up with as USD
+func (h *Horizon) Stablecoin() (string, string) {
+	return h.stablecoin, h.stableIssuer
+}
+
+// BuyStablecoin doesn't do anything since the platform doesn't run an exchange on networks of our choosing.
+// Accounts need to hold the stablecoin already
+func (h *Horizon) BuyStablecoin(seed string, amount float64) error {
+	return nil
+}
+
+// ExchangeValue returns zero since there's no exchange for the stablecoin
+func (h *Horizon) ExchangeValue(address string) (float64, error) {
+	return 0, nil
+}
+
+// InitEscrow creates an account that trusts the stablecoin and hands it over to the recipient and the platform,
+// whose signatures are both needed to send funds out of it
+func (h *Horizon) InitEscrow(projIndex int, seedpwd string, recpSeed string, platformSeed string) (string, error) {
+	recpPubkey, err := h.PublicKey(recpSeed)
+	if err != nil {
+		return "", err
+	}
+
+	platformPubkey, err := h.PublicKey(platformSeed)
+	if err != nil {
+		return "", err
+	}
+
+	// the key the escrow is created with can't sign once the escrow is set up, so it isn't stored
+	escrow, err := keypair.Random()
+	if err != nil {
+		return "", errors.Wrap(err, "could not generate escrow key")
+	}
+
+	_, err = h.createAccount(platformSeed, escrow.Address(), consts.HorizonEscrowFund)
+	if err != nil {
+		return "", errors.Wrap(err, "could not create escrow")
+	}
+
+	ops := []txnbuild.Operation{
+		&txnbuild.ChangeTrust{
+			Line:  txnbuild.CreditAsset{Code: h.stablecoin, Issuer: h.stableIssuer},
+			Limit: txnbuild.MaxTrustlineLimit,
+		},
+		&txnbuild.SetOptions{Signer: &txnbuild.Signer{Address: recpPubkey, Weight: 1}},
+		&txnbuild.SetOptions{Signer: &txnbuild.Signer{Address: platformPubkey, Weight: 1}},
+		&txnbuild.SetOptions{
+			MasterWeight:    txnbuild.NewThreshold(0),
+			LowThreshold:    txnbuild.NewThreshold(2),
+			MediumThreshold: txnbuild.NewThreshold(2),
+			HighThreshold:   txnbuild.NewThreshold(2),
+		},
+	}
+	_, err = h.submit(escrow.Address(), "", ops, escrow.Seed())
+	if err != nil {
+		return "", errors.Wrap(err, "could not set up escrow")
+	}
+	return escrow.Address(), nil
+}
+
+// SendFromEscrow sends stablecoin out of an escrow signed by both its signers
+func (h *Horizon) SendFromEscrow(escrowPubkey string, dest string, amount float64, seed1 string, seed2 string, memo string) (string, error) {
+	op := txnbuild.Payment{
+		Destination: dest,
+		Amount:      horizonAmount(amount),
+		Asset:       txnbuild.CreditAsset{Code: h.stablecoin, Issuer: h.stableIssuer},
+	}
+	return h.submit(escrowPubkey, memo, []txnbuild.Operation{&op}, seed1, seed2)
+}
+
+// Swap makes both payments in a single transaction with each payment's account as the source of its operation
+func (h *Horizon) Swap(transfer1 Transfer, transfer2 Transfer, memo string) (string, error) {
+	var source string
+	var ops []txnbuild.Operation
+	for _, transfer := range []Transfer{transfer1, transfer2} {
+		pubkey, err := h.PublicKey(transfer.Seed)
+		if err != nil {
+			return "", err
+		}
+		if source == "" {
+			source = pubkey
+		}
+		ops = append(ops, &txnbuild.Payment{
+			Destination:   transfer.Dest,
+			Amount:        horizonAmount(transfer.Amount),
+			Asset:         txnbuild.CreditAsset{Code: transfer.Code, Issuer: transfer.Issuer},
+			SourceAccount: &txnbuild.SimpleAccount{AccountID: pubkey},
+		})
+	}
+	return h.submit(source, memo, ops, transfer1.Seed, transfer2.Seed)
+}
@@ -0,0 +1,59 @@
+package chain
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stellar/go/keypair"
+
+	simnet "github.com/YaleOpenLab/opensolar/simnet"
+)
+
+func TestHorizonBalance(t *testing.T) {
+	network := simnet.New()
+	server := httptest.NewServer(network)
+	defer server.Close()
+
+	h := NewHorizon("simnet", server.URL, simnet.Passphrase, "USD", network.Root().Address())
+
+	var keys []*keypair.Full
+	for i := 0; i < 3; i++ {
+		kp, err := keypair.Random()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = network.Fund(kp.Address())
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, kp)
+	}
+	issuers, holder := keys[:2], keys[2]
+
+	// both issuers issue an asset with the same code
+	for i, issuer := range issuers {
+		_, err := h.TrustAsset("INVTEST", issuer.Address(), 1000, holder.Seed())
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = h.SendAsset("INVTEST", issuer.Address(), holder.Address(), float64(10*(i+1)), issuer.Seed(), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i, issuer := range issuers {
+		balance, err := h.Balance(holder.Address(), "INVTEST", issuer.Address())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if balance != float64(10*(i+1)) {
+			t.Fatalf("balance of the asset of issuer %d is %f, expected %d", i, balance, 10*(i+1))
+		}
+	}
+
+	_, err := h.Balance(holder.Address(), "INVTEST", holder.Address())
+	if err == nil {
+		t.Fatalf("balance of an asset the account doesn't trust read without an error")
+	}
+}
@@ -0,0 +1,437 @@
+package chain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/pkg/errors"
+	"math"
+	"strconv"
+	"sync"
+
+	"github.com/stellar/go/keypair"
+)
+
+// MockName is the name of the mock chain
+const MockName = "mock"
+
+// MockStablecoinCode is the code of the stablecoin on the mock chain
+const MockStablecoinCode = "USD"
+
+// MockStablecoinIssuer is the issuer of the stablecoin on the mock chain
+const MockStablecoinIssuer = "MOCKUSD"
+
+// MockTx is a transaction made on the mock chain
+type MockTx struct {
+	Hash   string
+	From   string
+	To     string
+	Code   string
+	Issuer string
+	Amount float64
+	Memo   string
+}
+
+// Mock is a chain kept in memory for tests. It behaves like stellar: assets exist as soon as they're trusted,
+// accounts can only hold assets they trust up to their limit and issuers issue assets by sending them. Keys are
+// stellar keys and the keys it creates are derived from a counter, so runs are repeatable. Accounts created with
+// CreateAccount hold the stablecoin, which is given out with Credit
+type Mock struct {
+	mu       sync.Mutex
+	accounts map[string]bool
+	issuers  map[string]string             // the seeds of the issuers keyed by the path they're stored at
+	frozen   map[string]bool               // issuers that have been frozen
+	escrows  map[string][]string           // the signers of escrows keyed by their address
+	trust    map[string]map[string]float64 // the limits of the trustlines of accounts keyed by asset
+	balances map[string]map[string]float64 // the balances of accounts keyed by asset
+	txs      []MockTx
+	keys     int
+}
+
+// NewMock returns an empty mock chain
+func NewMock() *Mock {
+	return &Mock{
+		accounts: make(map[string]bool),
+		issuers:  make(map[string]string),
+		frozen:   make(map[string]bool),
+		escrows:  make(map[string][]string),
+		trust:    make(map[string]map[string]float64),
+		balances: make(map[string]map[string]float64),
+	}
+}
+
+// Name returns the name of the mock chain
+func (m *Mock) Name() string {
+	return MockName
+}
+
+// mockAsset returns the key assets are stored under
+func mockAsset(code string, issuer string) string {
+	return code + ":" + issuer
+}
+
+// mockRound rounds amounts to the precision of stellar
+func mockRound(amount float64) float64 {
+	return math.Round(amount*1e7) / 1e7
+}
+
+// newKey returns the next key of the mock chain. Callers hold the lock
+func (m *Mock) newKey(label string) (*keypair.Full, error) {
+	m.keys++
+	raw := sha256.Sum256([]byte("opensolar mock " + label + " " + strconv.Itoa(m.keys)))
+	return keypair.FromRawSeed(raw)
+}
+
+// record records a transaction and returns its hash. Callers hold the lock
+func (m *Mock) record(tx MockTx) string {
+	hash := sha256.Sum256([]byte(strconv.Itoa(len(m.txs)) + tx.From + tx.To + tx.Code + tx.Memo))
+	tx.Hash = hex.EncodeToString(hash[:])
+	m.txs = append(m.txs, tx)
+	return tx.Hash
+}
+
+// openTrust opens a trustline of an account. Callers hold the lock
+func (m *Mock) openTrust(address string, asset string, limit float64) {
+	if m.trust[address] == nil {
+		m.trust[address] = make(map[string]float64)
+		m.balances[address] = make(map[string]float64)
+	}
+	m.trust[address][asset] = limit
+}
+
+// CreateAccount creates an account that trusts the stablecoin
+func (m *Mock) CreateAccount(address string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.accounts[address] = true
+	m.openTrust(address, mockAsset(MockStablecoinCode, MockStablecoinIssuer), math.MaxFloat64)
+}
+
+// Credit gives an account amount of the stablecoin
+func (m *Mock) Credit(address string, amount float64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.transfer(MockStablecoinIssuer, address, MockStablecoinCode, MockStablecoinIssuer, amount, "credit")
+}
+
+// Transactions returns the transactions made on the mock chain in the order they were made
+func (m *Mock) Transactions() []MockTx {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]MockTx(nil), m.txs...)
+}
+
+// transfer moves an asset between two accounts. Callers hold the lock
+func (m *Mock) transfer(from string, to string, code string, issuer string, amount float64, memo string) error {
+	if amount <= 0 {
+		return errors.New("amount must be positive")
+	}
+	if len(memo) > 28 {
+		return errors.New("memo longer than 28 characters")
+	}
+
+	asset := mockAsset(code, issuer)
+	if from == issuer {
+		if m.frozen[issuer] {
+			return errors.New("issuer " + issuer + " is frozen")
+		}
+	} else {
+		if !m.accounts[from] {
+			return errors.New("account " + from + " doesn't exist")
+		}
+		if m.balances[from][asset] < amount {
+			return errors.New("account " + from + " doesn't hold enough " + code)
+		}
+	}
+
+	if to != issuer {
+		if !m.accounts[to] {
+			return errors.New("account " + to + " doesn't exist")
+		}
+		limit, trusts := m.trust[to][asset]
+		if !trusts {
+			return errors.New("account " + to + " doesn't trust " + code)
+		}
+		if m.balances[to][asset]+amount > limit {
+			return errors.New("payment exceeds the trust limit of " + to)
+		}
+	}
+
+	if from != issuer {
+		m.balances[from][asset] = mockRound(m.balances[from][asset] - amount)
+	}
+	if to != issuer {
+		m.balances[to][asset] = mockRound(m.balances[to][asset] + amount)
+	}
+	m.record(MockTx{From: from, To: to, Code: code, Issuer: issuer, Amount: amount, Memo: memo})
+	return nil
+}
+
+// Address returns the public key since keys on the mock chain are stellar keys
+func (m *Mock) Address(pubkey string) (string, error) {
+	return pubkey, nil
+}
+
+// PublicKey returns the public key of a seed
+func (m *Mock) PublicKey(seed string) (string, error) {
+	kp, err := keypair.ParseFull(seed)
+	if err != nil {
+		return "", errors.Wrap(err, "could not parse seed")
+	}
+	return kp.Address(), nil
+}
+
+// AccountExists checks whether an account has been created
+func (m *Mock) AccountExists(address string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.accounts[address]
+}
+
+// InitIssuer creates the issuer of a project's assets. The issuer's seed is kept in memory
+func (m *Mock) InitIssuer(path string, projIndex int, seedpwd string, funderSeed string) error {
+	funder, err := m.PublicKey(funderSeed)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.accounts[funder] {
+		return errors.New("funder doesn't exist")
+	}
+
+	kp, err := m.newKey("issuer")
+	if err != nil {
+		return err
+	}
+	m.issuers[path+strconv.Itoa(projIndex)] = kp.Seed()
+	m.accounts[kp.Address()] = true
+	return nil
+}
+
+// IssuerSeed returns the public key and seed of the issuer of a project's assets
+func (m *Mock) IssuerSeed(path string, projIndex int, seedpwd string) (string, string, error) {
+	m.mu.Lock()
+	seed, exists := m.issuers[path+strconv.Itoa(projIndex)]
+	m.mu.Unlock()
+	if !exists {
+		return "", "", errors.New("issuer of project " + strconv.Itoa(projIndex) + " doesn't exist")
+	}
+
+	pubkey, err := m.PublicKey(seed)
+	return pubkey, seed, err
+}
+
+// FreezeIssuer stops the issuer of a project's assets from issuing any more
+func (m *Mock) FreezeIssuer(path string, projIndex int, seedpwd string) (string, error) {
+	pubkey, _, err := m.IssuerSeed(path, projIndex, seedpwd)
+	if err != nil {
+		return "", err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.frozen[pubkey] = true
+	return m.record(MockTx{From: pubkey, Memo: "freeze"}), nil
+}
+
+// AssetID returns the same code as on stellar
+func (m *Mock) AssetID(name string) string {
+	return Stellar{}.AssetID(name)
+}
+
+// IssueAsset doesn't do anything since assets on the mock chain exist as soon as they're trusted
+func (m *Mock) IssueAsset(code string, supply float64, issuerSeed string) (string, error) {
+	return "", nil
+}
+
+// TrustAsset opens a trustline towards an asset
+func (m *Mock) TrustAsset(code string, issuer string, limit float64, seed string) (string, error) {
+	pubkey, err := m.PublicKey(seed)
+	if err != nil {
+		return "", err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.accounts[pubkey] {
+		return "", errors.New("account " + pubkey + " doesn't exist")
+	}
+	m.openTrust(pubkey, mockAsset(code, issuer), limit)
+	return m.record(MockTx{From: pubkey, Code: code, Issuer: issuer, Memo: "trust"}), nil
+}
+
+// SendAsset sends an asset. Payments out of the issuer's account issue the asset
+func (m *Mock) SendAsset(code string, issuer string, dest string, amount float64, seed string, memo string) (string, error) {
+	pubkey, err := m.PublicKey(seed)
+	if err != nil {
+		return "", err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	err = m.transfer(pubkey, dest, code, issuer, amount, memo)
+	if err != nil {
+		return "", err
+	}
+	return m.txs[len(m.txs)-1].Hash, nil
+}
+
+// Clawback takes amount of an asset back from an account to the issuer controlled by issuerSeed
+func (m *Mock) Clawback(code string, issuer string, from string, amount float64, issuerSeed string) (string, error) {
+	pubkey, err := m.PublicKey(issuerSeed)
+	if err != nil {
+		return "", err
+	}
+	if pubkey != issuer {
+		return "", errors.New("only the issuer of " + code + " can take it back")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.frozen[issuer] {
+		return "", errors.New("issuer " + issuer + " is frozen")
+	}
+	err = m.transfer(from, issuer, code, issuer, amount, "clawback")
+	if err != nil {
+		return "", err
+	}
+	return m.txs[len(m.txs)-1].Hash, nil
+}
+
+// Balance returns the balance of an asset held by an account
+func (m *Mock) Balance(address string, code string, issuer string) (float64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	asset := mockAsset(code, issuer)
+	if _, trusts := m.trust[address][asset]; !trusts {
+		return 0, errors.New("account doesn't trust " + code)
+	}
+	return m.balances[address][asset], nil
+}
+
+// Record records a transaction from the account controlled by seed to itself with memo
+func (m *Mock) Record(seed string, memo string) (string, error) {
+	pubkey, err := m.PublicKey(seed)
+	if err != nil {
+		return "", err
+	}
+	if len(memo) > 28 {
+		return "", errors.New("memo longer than 28 characters")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.accounts[pubkey] {
+		return "", errors.New("account " + pubkey + " doesn't exist")
+	}
+	return m.record(MockTx{From: pubkey, To: pubkey, Memo: memo}), nil
+}
+
+// Stablecoin returns the stablecoin of the mock chain
+func (m *Mock) Stablecoin() (string, string) {
+	return MockStablecoinCode, MockStablecoinIssuer
+}
+
+// BuyStablecoin doesn't do anything, accounts are given stablecoin with Credit
+func (m *Mock) BuyStablecoin(seed string, amount float64) error {
+	return nil
+}
+
+// ExchangeValue returns zero since there's no exchange on the mock chain
+func (m *Mock) ExchangeValue(address string) (float64, error) {
+	return 0, nil
+}
+
+// InitEscrow creates an escrow controlled by the recipient and the platform that holds the stablecoin
+func (m *Mock) InitEscrow(projIndex int, seedpwd string, recpSeed string, platformSeed string) (string, error) {
+	recpPubkey, err := m.PublicKey(recpSeed)
+	if err != nil {
+		return "", err
+	}
+
+	platformPubkey, err := m.PublicKey(platformSeed)
+	if err != nil {
+		return "", err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	kp, err := m.newKey("escrow")
+	if err != nil {
+		return "", err
+	}
+
+	m.accounts[kp.Address()] = true
+	m.openTrust(kp.Address(), mockAsset(MockStablecoinCode, MockStablecoinIssuer), math.MaxFloat64)
+	m.escrows[kp.Address()] = []string{recpPubkey, platformPubkey}
+	return kp.Address(), nil
+}
+
+// SendFromEscrow sends stablecoin out of an escrow if both seeds are those of its signers
+func (m *Mock) SendFromEscrow(escrow string, dest string, amount float64, seed1 string, seed2 string, memo string) (string, error) {
+	pubkey1, err := m.PublicKey(seed1)
+	if err != nil {
+		return "", err
+	}
+
+	pubkey2, err := m.PublicKey(seed2)
+	if err != nil {
+		return "", err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	signers, exists := m.escrows[escrow]
+	if !exists {
+		return "", errors.New("escrow " + escrow + " doesn't exist")
+	}
+
+	signed := (pubkey1 == signers[0] && pubkey2 == signers[1]) || (pubkey1 == signers[1] && pubkey2 == signers[0])
+	if !signed {
+		return "", errors.New("seeds don't control escrow " + escrow)
+	}
+
+	err = m.transfer(escrow, dest, MockStablecoinCode, MockStablecoinIssuer, amount, memo)
+	if err != nil {
+		return "", err
+	}
+	return m.txs[len(m.txs)-1].Hash, nil
+}
+
+// Swap makes both transfers or neither of them
+func (m *Mock) Swap(transfer1 Transfer, transfer2 Transfer, memo string) (string, error) {
+	pubkey1, err := m.PublicKey(transfer1.Seed)
+	if err != nil {
+		return "", err
+	}
+
+	pubkey2, err := m.PublicKey(transfer2.Seed)
+	if err != nil {
+		return "", err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// keep the balances as they were so that the first transfer can be undone if the second one fails
+	balances := make(map[string]map[string]float64, len(m.balances))
+	for address, assets := range m.balances {
+		balances[address] = make(map[string]float64, len(assets))
+		for asset, balance := range assets {
+			balances[address][asset] = balance
+		}
+	}
+	txs := len(m.txs)
+
+	err = m.transfer(pubkey1, transfer1.Dest, transfer1.Code, transfer1.Issuer, transfer1.Amount, memo)
+	if err == nil {
+		err = m.transfer(pubkey2, transfer2.Dest, transfer2.Code, transfer2.Issuer, transfer2.Amount, memo)
+	}
+	if err != nil {
+		m.balances = balances
+		m.txs = m.txs[:txs]
+		return "", err
+	}
+	return m.txs[len(m.txs)-1].Hash, nil
+}
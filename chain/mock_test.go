@@ -0,0 +1,200 @@
+package chain
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/stellar/go/keypair"
+)
+
+// mockAccount creates an account on m whose key is derived from label and credits it with amount of the stablecoin
+func mockAccount(t *testing.T, m *Mock, label string, amount float64) *keypair.Full {
+	kp, err := keypair.FromRawSeed(sha256.Sum256([]byte("opensolar mock test " + label)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.CreateAccount(kp.Address())
+	if amount > 0 {
+		err = m.Credit(kp.Address(), amount)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return kp
+}
+
+// checkBalance checks the balance of an asset held by an account
+func checkBalance(t *testing.T, m *Mock, address string, code string, issuer string, expected float64) {
+	balance, err := m.Balance(address, code, issuer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance != expected {
+		t.Fatalf("balance of %s is %f, expected %f", code, balance, expected)
+	}
+}
+
+func TestMockIssue(t *testing.T) {
+	m := NewMock()
+	platform := mockAccount(t, m, "platform", 0)
+	investor := mockAccount(t, m, "investor", 0)
+
+	err := m.InitIssuer("issuers/", 1, "x", platform.Seed())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issuer, issuerSeed, err := m.IssuerSeed("issuers/", 1, "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = m.SendAsset("INVTEST", issuer, investor.Address(), 100, issuerSeed, "")
+	if err == nil {
+		t.Fatalf("accounts must trust an asset to hold it")
+	}
+
+	_, err = m.TrustAsset("INVTEST", issuer, 100, investor.Seed())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = m.SendAsset("INVTEST", issuer, investor.Address(), 100, issuerSeed, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkBalance(t, m, investor.Address(), "INVTEST", issuer, 100)
+
+	_, err = m.SendAsset("INVTEST", issuer, investor.Address(), 1, issuerSeed, "")
+	if err == nil {
+		t.Fatalf("payments must not exceed the trust limit")
+	}
+
+	// payments into the issuer's account burn the asset
+	_, err = m.SendAsset("INVTEST", issuer, issuer, 40, investor.Seed(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkBalance(t, m, investor.Address(), "INVTEST", issuer, 60)
+
+	_, err = m.FreezeIssuer("issuers/", 1, "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = m.SendAsset("INVTEST", issuer, investor.Address(), 1, issuerSeed, "")
+	if err == nil {
+		t.Fatalf("frozen issuers must not issue assets")
+	}
+}
+
+func TestMockEscrow(t *testing.T) {
+	m := NewMock()
+	recipient := mockAccount(t, m, "recipient", 0)
+	platform := mockAccount(t, m, "platform", 0)
+	investor := mockAccount(t, m, "investor", 1000)
+	outsider := mockAccount(t, m, "outsider", 0)
+
+	escrow, err := m.InitEscrow(1, "x", recipient.Seed(), platform.Seed())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = m.SendAsset(MockStablecoinCode, MockStablecoinIssuer, escrow, 1000, investor.Seed(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = m.SendFromEscrow(escrow, outsider.Address(), 100, recipient.Seed(), outsider.Seed(), "")
+	if err == nil {
+		t.Fatalf("escrow sent funds without the platform's signature")
+	}
+
+	_, err = m.SendFromEscrow(escrow, outsider.Address(), 100, platform.Seed(), recipient.Seed(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkBalance(t, m, escrow, MockStablecoinCode, MockStablecoinIssuer, 900)
+	checkBalance(t, m, outsider.Address(), MockStablecoinCode, MockStablecoinIssuer, 100)
+
+	_, err = m.SendFromEscrow(escrow, outsider.Address(), 1000, platform.Seed(), recipient.Seed(), "")
+	if err == nil {
+		t.Fatalf("escrow sent more than it holds")
+	}
+}
+
+func TestMockSwap(t *testing.T) {
+	m := NewMock()
+	platform := mockAccount(t, m, "platform", 0)
+	seller := mockAccount(t, m, "seller", 0)
+	buyer := mockAccount(t, m, "buyer", 500)
+
+	err := m.InitIssuer("issuers/", 1, "x", platform.Seed())
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer, issuerSeed, err := m.IssuerSeed("issuers/", 1, "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = m.TrustAsset("INVTEST", issuer, 100, platform.Seed())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = m.SendAsset("INVTEST", issuer, platform.Address(), 10, issuerSeed, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payment := Transfer{Code: MockStablecoinCode, Issuer: MockStablecoinIssuer, Dest: seller.Address(), Amount: 200,
+		Seed: buyer.Seed()}
+	delivery := Transfer{Code: "INVTEST", Issuer: issuer, Dest: buyer.Address(), Amount: 10, Seed: platform.Seed()}
+
+	// the buyer doesn't trust the asset yet, so the delivery fails and the payment must be undone
+	txs := len(m.Transactions())
+	_, err = m.Swap(payment, delivery, "trade")
+	if err == nil {
+		t.Fatalf("swap went through although the buyer can't receive the asset")
+	}
+	checkBalance(t, m, buyer.Address(), MockStablecoinCode, MockStablecoinIssuer, 500)
+	checkBalance(t, m, seller.Address(), MockStablecoinCode, MockStablecoinIssuer, 0)
+	checkBalance(t, m, platform.Address(), "INVTEST", issuer, 10)
+	if len(m.Transactions()) != txs {
+		t.Fatalf("failed swap left transactions behind")
+	}
+
+	_, err = m.TrustAsset("INVTEST", issuer, 100, buyer.Seed())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = m.Swap(payment, delivery, "trade")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkBalance(t, m, buyer.Address(), MockStablecoinCode, MockStablecoinIssuer, 300)
+	checkBalance(t, m, seller.Address(), MockStablecoinCode, MockStablecoinIssuer, 200)
+	checkBalance(t, m, buyer.Address(), "INVTEST", issuer, 10)
+	checkBalance(t, m, platform.Address(), "INVTEST", issuer, 0)
+}
+
+func TestMockRecord(t *testing.T) {
+	m := NewMock()
+	user := mockAccount(t, m, "user", 0)
+
+	_, err := m.Record(user.Seed(), "CONTRACTHASH9a768ace36ff3d17")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = m.Record(user.Seed(), "CONTRACTHASH9a768ace36ff3d17a")
+	if err == nil {
+		t.Fatalf("memos longer than 28 characters must be rejected")
+	}
+
+	txs := m.Transactions()
+	if len(txs) != 1 || txs[0].From != user.Address() || txs[0].To != user.Address() {
+		t.Fatalf("memo not recorded in a transaction to self")
+	}
+}
@@ -0,0 +1,193 @@
+package chain
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/stellar/go/network"
+
+	tickers "github.com/YaleOpenLab/openx/chains/exchangetickers"
+	stablecoin "github.com/YaleOpenLab/openx/chains/stablecoin"
+	xlm "github.com/YaleOpenLab/openx/chains/xlm"
+	assets "github.com/YaleOpenLab/openx/chains/xlm/assets"
+	escrow "github.com/YaleOpenLab/openx/chains/xlm/escrow"
+	issuer "github.com/YaleOpenLab/openx/chains/xlm/issuer"
+	wallet "github.com/YaleOpenLab/openx/chains/xlm/wallet"
+
+	consts "github.com/YaleOpenLab/opensolar/consts"
+)
+
+// StellarName is the name of the stellar chain
+const StellarName = "stellar"
+
+const (
+	// stellarTestnetURL is the horizon server of the stellar testnet
+	stellarTestnetURL = "https://horizon-testnet.stellar.org"
+
+	// stellarMainnetURL is the horizon server of the stellar mainnet
+	stellarMainnetURL = "https://horizon.stellar.org"
+)
+
+// Stellar holds project assets on stellar using openx. Stellar assets exist as soon as an account trusts them
+// and are issued by paying them out of the issuer's account
+type Stellar struct{}
+
+// Name returns the name of the stellar chain
+func (Stellar) Name() string {
+	return StellarName
+}
+
+// Address returns the public key since users' wallets are stellar wallets
+func (Stellar) Address(pubkey string) (string, error) {
+	return pubkey, nil
+}
+
+// PublicKey returns the public key of a seed
+func (Stellar) PublicKey(seed string) (string, error) {
+	return wallet.ReturnPubkey(seed)
+}
+
+// AccountExists checks whether an account has been created on stellar
+func (Stellar) AccountExists(address string) bool {
+	return xlm.AccountExists(address)
+}
+
+// InitIssuer creates the issuer of a project's assets and funds it
+func (s Stellar) InitIssuer(path string, projIndex int, seedpwd string, funderSeed string) error {
+	err := issuer.InitIssuer(path, projIndex, seedpwd)
+	if err != nil {
+		return errors.Wrap(err, "error while initializing issuer")
+	}
+	err = issuer.FundIssuer(path, projIndex, seedpwd, funderSeed)
+	if err != nil {
+		return errors.Wrap(err, "error while funding issuer")
+	}
+
+	_, issuerSeed, err := wallet.RetrieveSeed(issuer.GetPath(path, projIndex), seedpwd)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.horizon().allowRevoke(issuerSeed)
+	if err != nil {
+		return errors.Wrap(err, "error while allowing issuer to revoke its assets")
+	}
+	return nil
+}
+
+// IssuerSeed returns the public key and seed of the issuer of a project's assets
+func (Stellar) IssuerSeed(path string, projIndex int, seedpwd string) (string, string, error) {
+	return wallet.RetrieveSeed(issuer.GetPath(path, projIndex), seedpwd)
+}
+
+// FreezeIssuer sets the weight of the issuer's key to zero
+func (Stellar) FreezeIssuer(path string, projIndex int, seedpwd string) (string, error) {
+	return issuer.FreezeIssuer(path, projIndex, seedpwd)
+}
+
+// AssetID returns the 12 character asset code stellar allows for name
+func (Stellar) AssetID(name string) string {
+	return assets.AssetID(name)
+}
+
+// IssueAsset doesn't do anything since stellar assets exist as soon as they're trusted
+func (Stellar) IssueAsset(code string, supply float64, issuerSeed string) (string, error) {
+	return "", nil
+}
+
+// TrustAsset opens a trustline towards an asset
+func (Stellar) TrustAsset(code string, issuer string, limit float64, seed string) (string, error) {
+	return assets.TrustAsset(code, issuer, limit, seed)
+}
+
+// SendAsset sends an asset. Payments out of the issuer's account issue the asset
+func (Stellar) SendAsset(code string, issuer string, dest string, amount float64, seed string, memo string) (string, error) {
+	_, txhash, err := assets.SendAsset(code, issuer, dest, amount, seed, memo)
+	return txhash, err
+}
+
+// Clawback revokes the permission of an account to hold an asset the way Horizon does it, since openx doesn't
+// revoke assets
+func (s Stellar) Clawback(code string, issuer string, from string, amount float64, issuerSeed string) (string, error) {
+	return s.horizon().Clawback(code, issuer, from, amount, issuerSeed)
+}
+
+// Balance returns the balance of an asset held by an account. openx looks balances up by code alone, so they're
+// read off horizon the way Horizon does it to tell apart assets with the same code from different issuers
+func (s Stellar) Balance(address string, code string, issuer string) (float64, error) {
+	return s.horizon().Balance(address, code, issuer)
+}
+
+// Record sends a lumen from the account controlled by seed to itself with memo
+func (Stellar) Record(seed string, memo string) (string, error) {
+	pubkey, err := wallet.ReturnPubkey(seed)
+	if err != nil {
+		return "", errors.Wrap(err, "could not get pubkey from seed")
+	}
+	_, txhash, err := xlm.SendXLM(pubkey, 1, seed, memo)
+	return txhash, err
+}
+
+// Stablecoin returns the in house stablecoin on testnet and AnchorUSD on mainnet
+func (Stellar) Stablecoin() (string, string) {
+	if !consts.Mainnet {
+		return consts.StablecoinCode, consts.StablecoinPublicKey
+	}
+	return consts.AnchorUSDCode, consts.AnchorUSDAddress
+}
+
+// BuyStablecoin exchanges xlm for the in house stablecoin on testnet. Accounts on mainnet need to hold AnchorUSD
+func (Stellar) BuyStablecoin(seed string, amount float64) error {
+	if consts.Mainnet {
+		return nil
+	}
+
+	pubkey, err := wallet.ReturnPubkey(seed)
+	if err != nil {
+		return errors.Wrap(err, "could not get pubkey from seed")
+	}
+	return stablecoin.OfferExchange(pubkey, seed, amount)
+}
+
+// ExchangeValue returns the value of an account's lumens at the exchange rate of the tickers on testnet, where
+// the platform exchanges lumens for the stablecoin
+func (Stellar) ExchangeValue(address string) (float64, error) {
+	if consts.Mainnet {
+		return 0, nil
+	}
+
+	balance, err := xlm.GetNativeBalance(address)
+	if err != nil {
+		return 0, errors.Wrap(err, "could not get lumen balance")
+	}
+	return tickers.ExchangeXLMforUSD(balance), nil
+}
+
+// InitEscrow creates a 2 of 2 multisig account controlled by the recipient and the platform
+func (Stellar) InitEscrow(projIndex int, seedpwd string, recpSeed string, platformSeed string) (string, error) {
+	recpPubkey, err := wallet.ReturnPubkey(recpSeed)
+	if err != nil {
+		return "", errors.Wrap(err, "could not get pubkey from seed")
+	}
+	return escrow.InitEscrow(projIndex, seedpwd, recpPubkey, recpSeed, platformSeed)
+}
+
+// SendFromEscrow sends stablecoin out of the escrow signed by both its signers. openx doesn't return the hash
+// of the transaction
+func (Stellar) SendFromEscrow(escrowPubkey string, dest string, amount float64, seed1 string, seed2 string, memo string) (string, error) {
+	return "", escrow.SendFundsFromEscrow(escrowPubkey, dest, seed1, seed2, amount, memo)
+}
+
+// horizon returns the public horizon servers as a Horizon, which builds the transactions openx can't build
+func (s Stellar) horizon() *Horizon {
+	code, issuer := s.Stablecoin()
+	if consts.Mainnet {
+		return NewHorizon(StellarName, stellarMainnetURL, network.PublicNetworkPassphrase, code, issuer)
+	}
+	return NewHorizon(StellarName, stellarTestnetURL, network.TestNetworkPassphrase, code, issuer)
+}
+
+// Swap makes both payments in a single transaction. openx doesn't build transactions with more than one
+// operation, so the transaction is built and submitted the way Horizon does it
+func (s Stellar) Swap(transfer1 Transfer, transfer2 Transfer, memo string) (string, error) {
+	return s.horizon().Swap(transfer1, transfer2, memo)
+}
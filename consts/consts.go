@@ -74,6 +74,9 @@ var SeedAssetPrefix = "SeedAssets_"
 // PaybackAssetPrefix is the prefix that will be hashed to give a payback AssetID
 var PaybackAssetPrefix = "PaybackAssets_"
 
+// EquityAssetPrefix is the prefix that will be hashed to give the AssetID of an equity project's shares
+var EquityAssetPrefix = "EquityAssets_"
+
 // IssuerSeedPwd is the password of the issuer's seed
 var IssuerSeedPwd = "blah"
 
@@ -89,6 +92,116 @@ var DefaultRpcPort = 8081
 // LockInterval is the time a recipient is given to unlock the project and redeem investment, right now at 3 days
 var LockInterval = int64(1 * 60 * 60 * 24 * 3)
 
+// FundingInterval is the time a project has to raise its total value from its first investment before investors are refunded, right now at 60 days
+var FundingInterval = int64(1 * 60 * 60 * 24 * 60)
+
+// UnlockPollInterval is the time in seconds after which we check again whether a recipient has unlocked a funded project
+var UnlockPollInterval = int64(10)
+
+// PaybackCheckInterval is the time in seconds between two checks on whether a recipient is paying back, right now at one week
+var PaybackCheckInterval = int64(1 * 60 * 60 * 24 * 7)
+
+// SchedulerPollInterval is the frequency at which we check for jobs that are due
+var SchedulerPollInterval = time.Duration(10 * time.Second)
+
+// JobRetryInterval is the time in seconds after which a job that failed is run again, right now at one hour
+var JobRetryInterval = int64(1 * 60 * 60)
+
+// InvoiceDueInterval is the time in seconds a recipient has to pay an invoice after the billing period ends, right now at two weeks
+var InvoiceDueInterval = int64(1 * 60 * 60 * 24 * 14)
+
+// MaxMeterPower is the highest average power in kW a meter can report between two readings, anything above is rejected
+var MaxMeterPower = float64(1000)
+
+// MeterClockSkew is how far in seconds a meter reading's timestamp can be ahead of the platform's clock
+var MeterClockSkew = int64(5 * 60)
+
+// IdempotencyPendingTimeout is the time in seconds after which the idempotency key of a request that never finished
+// is reported as stale and needs to be reconciled by hand, right now at 1 hour
+var IdempotencyPendingTimeout = int64(1 * 60 * 60)
+
+// MaxMeterBatch is the maximum number of meter readings that can be posted in a single batch
+var MaxMeterBatch = 1000
+
+// RECAssetPrefix is the prefix that will be hashed to give the AssetID of a project's renewable energy certificates
+var RECAssetPrefix = "RECAssets_"
+
+// RECUnit is the generation in kWh that one renewable energy certificate stands for
+var RECUnit = float64(1000)
+
+// RECInterval is the time in seconds between two checks for generation that can be issued as RECs, right now at 1 day
+var RECInterval = int64(1 * 60 * 60 * 24)
+
+// MeterSettleInterval is the time in seconds a meter reading has to have been received before it counts towards
+// RECs and avoided carbon, so that readings that arrive out of order can still be placed between it and the reading
+// before it. Readings that arrive later are counted in a later run, right now at 3 days
+var MeterSettleInterval = int64(1 * 60 * 60 * 24 * 3)
+
+// RECTrustLimit is the limit of the trustline investors open towards the RECs of a project
+var RECTrustLimit = float64(1000000)
+
+// CarbonInterval is the time in seconds between two updates of the carbon avoided by a project, right now at 1 day
+var CarbonInterval = int64(1 * 60 * 60 * 24)
+
+// MaxDocumentSize is the maximum size in bytes of a project document added to the content store, right now at 10MB
+var MaxDocumentSize = 10 * 1024 * 1024
+
+// AlgodAddress is the address of the algod node used for projects on algorand
+var AlgodAddress = "http://localhost:4001"
+
+// AlgodToken is the api token of the algod node used for projects on algorand
+var AlgodToken = ""
+
+// AlgorandStablecoinID is the id of the algorand standard asset used as USD on algorand, USDC on testnet by default
+var AlgorandStablecoinID = uint64(10458941)
+
+// AlgorandIssuerFund is the amount of microalgos the platform sends to a project's issuer on algorand to cover the
+// minimum balance of the assets it creates and its fees
+var AlgorandIssuerFund = uint64(2000000)
+
+// AlgorandEscrowFund is the amount of microalgos the platform sends to a project's escrow on algorand to cover its
+// minimum balance and fees
+var AlgorandEscrowFund = uint64(500000)
+
+// HorizonIssuerFund is the amount of lumens the platform sends to a project's issuer on stellar networks reached
+// through a horizon server of our choosing to cover the reserve of its account and its fees
+var HorizonIssuerFund = float64(10)
+
+// HorizonEscrowFund is the amount of lumens the platform sends to a project's escrow on stellar networks reached
+// through a horizon server of our choosing to cover the reserve of its account, trustline and signers and its fees
+var HorizonEscrowFund = float64(10)
+
+// BlockWait is the time we wait for a payment to make it into a block before checking the balance of its destination
+var BlockWait = time.Duration(5 * time.Second)
+
+// AuctionRoundInterval is the time in seconds that a round of an english or dutch auction stays open for, right now at 1 day
+var AuctionRoundInterval = int64(1 * 60 * 60 * 24)
+
+// EnglishAuctionDecrement is the minimum fraction by which a new english auction bid must undercut the best standing bid
+var EnglishAuctionDecrement = 0.01
+
+// DutchAuctionIncrement is the fraction of the start price by which the offered price in a dutch auction rises each round
+var DutchAuctionIncrement = 0.05
+
+// DutchAuctionMaxRounds is the number of rounds after which a dutch auction with no takers closes without a winner
+var DutchAuctionMaxRounds = 10
+
+// SealedBidCommitInterval is the default time in seconds that contractors have to commit to bids in a sealed auction, right now at 7 days
+var SealedBidCommitInterval = int64(1 * 60 * 60 * 24 * 7)
+
+// SealedBidRevealInterval is the time in seconds after the commit phase that contractors have to reveal their sealed bids, right now at 2 days
+var SealedBidRevealInterval = int64(1 * 60 * 60 * 24 * 2)
+
+// SealedBidSaltLength is the minimum number of random bytes in the salt of a sealed bid, so that the price can't be found by
+// hashing guesses against the commitment
+var SealedBidSaltLength = 16
+
+// AuctionDuration is the default time in seconds that an auction on an originated project stays open for bids, right now at 14 days
+var AuctionDuration = int64(1 * 60 * 60 * 24 * 14)
+
+// DefaultPaybackPeriod is the payback period in weeks used to build a project's payment schedule when the project doesn't define one
+var DefaultPaybackPeriod = 4
+
 // OneHour is one hour in seconds
 var OneHour = time.Duration(1 * 60 * 60)
 
@@ -116,6 +229,12 @@ var TellerMaxLocalStorageSize = 2000
 // TellerPollInterval is the frequency at which we poll the interval
 var TellerPollInterval = time.Duration(30000 * time.Second)
 
+// TellerQueueRetryInterval is the time the teller waits before sending a queued request that failed again
+var TellerQueueRetryInterval = time.Duration(30 * time.Second)
+
+// TellerQueueMaxBackoff is the longest time the teller waits between two attempts at sending a queued request
+var TellerQueueMaxBackoff = time.Duration(1 * time.Hour)
+
 // LoginRefreshInterval is the frequency at which the teller's credentials are updated (ie if you change your password, wait 5 minutes for the teller to disconnect)
 var LoginRefreshInterval = time.Duration(5 * 60 * time.Second)
 
@@ -133,4 +252,5 @@ func SetMnConsts() {
 	DbDir = HomeDir + "/database/"                   // the directory where the database is stored (project info, user info, etc)
 	OpenSolarIssuerDir = HomeDir + "/projects/"      // the directory where we store opensolar projects' issuer seeds
 	PlatformSeedFile = HomeDir + "/platformseed.hex" // where the platform's seed is stored
+	AlgorandStablecoinID = 31566704                  // USDC on algorand mainnet
 }
@@ -2,6 +2,10 @@ package core
 
 import (
 	"github.com/pkg/errors"
+
+	utils "github.com/Varunram/essentials/utils"
+
+	consts "github.com/YaleOpenLab/opensolar/consts"
 )
 
 // handlers for auctions in the event someone decides to do auction for their projects
@@ -25,6 +29,15 @@ func SelectContractBlind(arr []Project) (Project, error) {
 
 // SelectContractVickrey selects the winning bid based on vickrey auction rules (in a vickrey auction, the bid with the second highest price wins)
 func SelectContractVickrey(arr []Project) (Project, error) {
+	winningContract, err := vickreyContract(arr)
+	if err != nil {
+		return winningContract, err
+	}
+	return winningContract, winningContract.Save()
+}
+
+// vickreyContract returns the lowest bid from the passed contracts with its price set to that of the second lowest bid
+func vickreyContract(arr []Project) (Project, error) {
 	var winningContract Project
 	if len(arr) == 0 {
 		return winningContract, errors.New("Empty array passed!")
@@ -56,7 +69,7 @@ func SelectContractVickrey(arr []Project) (Project, error) {
 	// we have the winner, who's elem and we have the price which is vickreyPrice
 	// overwrite the winning contractor's contract
 	winningContract.TotalValue = vickreyPrice
-	return winningContract, winningContract.Save()
+	return winningContract, nil
 }
 
 // SelectContractTime selects the winning contract based on the least time proposed for completion
@@ -92,3 +105,219 @@ func (project *Project) SetAuctionType(auctionType string) error {
 	}
 	return project.Save()
 }
+
+// OpenBid is a bid placed by a contractor in an english or dutch auction. Since contractors
+// compete to install a project, a lower price is a better bid.
+type OpenBid struct {
+	ContractorIndex int     // the index of the contractor who placed the bid
+	Price           float64 // the price at which the contractor is willing to install the project
+	Round           int     // the auction round in which the bid was placed
+	Timestamp       int64   // unix time at which the bid was recorded
+}
+
+// StartOpenAuction starts an english or dutch auction on a stage 2 project. In an english auction
+// contractors place descending bids starting from startPrice, in a dutch auction the price offered
+// starts at startPrice and rises every round until a contractor accepts it.
+func (project *Project) StartOpenAuction(startPrice float64) error {
+	if project.Stage != 2 {
+		return errors.New("auctions can only be started on stage 2 projects")
+	}
+	if project.AuctionType != "english" && project.AuctionType != "dutch" {
+		return errors.New("project auction type not english or dutch, quitting")
+	}
+	if project.AuctionRound != 0 {
+		return errors.New("auction already started on project")
+	}
+	if startPrice <= 0 {
+		return errors.New("start price must be positive")
+	}
+
+	project.OpenBids = nil
+	project.AuctionStartPrice = startPrice
+	project.AuctionRound = 1
+	project.AuctionRoundEnd = utils.Unix() + consts.AuctionRoundInterval
+	return project.Save()
+}
+
+// auctionOpen checks whether the current round of an english or dutch auction is still open
+func (project Project) auctionOpen() bool {
+	return project.AuctionRound != 0 && utils.Unix() < project.AuctionRoundEnd
+}
+
+// bestOpenBid returns the lowest bid placed on the project
+func (project Project) bestOpenBid() (OpenBid, error) {
+	var best OpenBid
+	if len(project.OpenBids) == 0 {
+		return best, errors.New("no bids placed on project")
+	}
+	best = project.OpenBids[0]
+	for _, bid := range project.OpenBids {
+		if bid.Price < best.Price {
+			best = bid
+		}
+	}
+	return best, nil
+}
+
+// updateDutchRound moves a dutch auction forward by as many rounds as have elapsed since the
+// current round was opened
+func (project *Project) updateDutchRound() {
+	now := utils.Unix()
+	for project.AuctionRound < consts.DutchAuctionMaxRounds && now >= project.AuctionRoundEnd {
+		project.AuctionRound++
+		project.AuctionRoundEnd += consts.AuctionRoundInterval
+	}
+}
+
+// DutchPrice returns the price offered to contractors in the current round of a dutch auction
+func (project Project) DutchPrice() float64 {
+	return project.AuctionStartPrice * (1 + consts.DutchAuctionIncrement*float64(project.AuctionRound-1))
+}
+
+// PlaceEnglishBid records a bid from a contractor on a project with an english auction. The bid
+// must undercut the best standing bid and each accepted bid opens a new round, so the auction
+// closes once a full round passes without anyone undercutting the best bid.
+func PlaceEnglishBid(projIndex int, contrIndex int, price float64) error {
+	project, err := RetrieveProject(projIndex)
+	if err != nil {
+		return errors.Wrap(err, "couldn't retrieve project")
+	}
+	if project.Stage != 2 {
+		return errors.New("bids can only be placed on stage 2 projects")
+	}
+	if project.AuctionType != "english" {
+		return errors.New("project does not have an english auction")
+	}
+	if !project.auctionOpen() {
+		return errors.New("auction not open for bids")
+	}
+
+	contractor, err := RetrieveEntity(contrIndex)
+	if err != nil {
+		return errors.Wrap(err, "couldn't retrieve contractor")
+	}
+	if !contractor.Contractor {
+		return errors.New("only contractors can bid on projects")
+	}
+
+	maxPrice := project.AuctionStartPrice
+	best, err := project.bestOpenBid()
+	if err == nil {
+		maxPrice = best.Price * (1 - consts.EnglishAuctionDecrement)
+	}
+	if price <= 0 || price > maxPrice {
+		return errors.New("bid must undercut the best standing bid")
+	}
+
+	now := utils.Unix()
+	project.OpenBids = append(project.OpenBids, OpenBid{
+		ContractorIndex: contrIndex,
+		Price:           price,
+		Round:           project.AuctionRound,
+		Timestamp:       now,
+	})
+	project.AuctionRound++
+	project.AuctionRoundEnd = now + consts.AuctionRoundInterval
+	return project.Save()
+}
+
+// AcceptDutchPrice records a contractor accepting the current price of a dutch auction. The first
+// contractor to accept wins and the auction is closed immediately.
+func AcceptDutchPrice(projIndex int, contrIndex int) error {
+	project, err := RetrieveProject(projIndex)
+	if err != nil {
+		return errors.Wrap(err, "couldn't retrieve project")
+	}
+	if project.Stage != 2 {
+		return errors.New("bids can only be placed on stage 2 projects")
+	}
+	if project.AuctionType != "dutch" {
+		return errors.New("project does not have a dutch auction")
+	}
+	if project.AuctionRound == 0 || len(project.OpenBids) != 0 {
+		return errors.New("auction not open for bids")
+	}
+
+	project.updateDutchRound()
+	if !project.auctionOpen() {
+		return errors.New("auction not open for bids")
+	}
+
+	contractor, err := RetrieveEntity(contrIndex)
+	if err != nil {
+		return errors.Wrap(err, "couldn't retrieve contractor")
+	}
+	if !contractor.Contractor {
+		return errors.New("only contractors can bid on projects")
+	}
+
+	now := utils.Unix()
+	project.OpenBids = append(project.OpenBids, OpenBid{
+		ContractorIndex: contrIndex,
+		Price:           project.DutchPrice(),
+		Round:           project.AuctionRound,
+		Timestamp:       now,
+	})
+	project.AuctionRoundEnd = now // close the auction
+	return project.Save()
+}
+
+// SelectContractEnglish closes an english auction once its last round has expired and assigns
+// the lowest bidder as the project's contractor
+func SelectContractEnglish(projIndex int) (Project, error) {
+	project, err := RetrieveProject(projIndex)
+	if err != nil {
+		return project, errors.Wrap(err, "couldn't retrieve project")
+	}
+	if project.Stage != 2 {
+		return project, errors.New("contracts can only be selected on stage 2 projects")
+	}
+	if project.AuctionType != "english" {
+		return project, errors.New("project does not have an english auction")
+	}
+	if project.AuctionRound == 0 {
+		return project, errors.New("auction not started on project")
+	}
+	if project.auctionOpen() {
+		return project, errors.New("auction still open for bids")
+	}
+
+	best, err := project.bestOpenBid()
+	if err != nil {
+		return project, err
+	}
+	project.ContractorIndex = best.ContractorIndex
+	project.TotalValue = best.Price
+	return project, project.Save()
+}
+
+// SelectContractDutch assigns the contractor who accepted the price in a dutch auction as the
+// project's contractor
+func SelectContractDutch(projIndex int) (Project, error) {
+	project, err := RetrieveProject(projIndex)
+	if err != nil {
+		return project, errors.Wrap(err, "couldn't retrieve project")
+	}
+	if project.Stage != 2 {
+		return project, errors.New("contracts can only be selected on stage 2 projects")
+	}
+	if project.AuctionType != "dutch" {
+		return project, errors.New("project does not have a dutch auction")
+	}
+	if project.AuctionRound == 0 {
+		return project, errors.New("auction not started on project")
+	}
+
+	if len(project.OpenBids) == 0 {
+		project.updateDutchRound()
+		if project.auctionOpen() {
+			return project, errors.New("auction still open for bids")
+		}
+		return project, errors.New("dutch auction closed without any contractor accepting the price")
+	}
+
+	winner := project.OpenBids[0]
+	project.ContractorIndex = winner.ContractorIndex
+	project.TotalValue = winner.Price
+	return project, project.Save()
+}
@@ -0,0 +1,166 @@
+package core
+
+import (
+	"testing"
+
+	consts "github.com/YaleOpenLab/opensolar/consts"
+)
+
+func TestSelectContractStage(t *testing.T) {
+	teardown := setupPlatform(t)
+	defer teardown()
+
+	english := Project{Index: 1, Stage: 3, AuctionType: "english", AuctionRound: 2, AuctionRoundEnd: 1,
+		OpenBids: []OpenBid{{ContractorIndex: 5, Price: 1000}, {ContractorIndex: 6, Price: 900}}}
+	dutch := Project{Index: 2, Stage: 3, AuctionType: "dutch", AuctionRound: 1, AuctionRoundEnd: 1,
+		OpenBids: []OpenBid{{ContractorIndex: 7, Price: 1100}}}
+
+	cases := []struct {
+		name       string
+		project    Project
+		selectFn   func(int) (Project, error)
+		contractor int
+		price      float64
+	}{
+		{"english", english, SelectContractEnglish, 6, 900},
+		{"dutch", dutch, SelectContractDutch, 7, 1100},
+	}
+
+	for _, c := range cases {
+		err := c.project.Save()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = c.selectFn(c.project.Index)
+		if err == nil {
+			t.Fatalf("%s: contract selected on a stage 3 project", c.name)
+		}
+
+		c.project.Stage = 2
+		err = c.project.Save()
+		if err != nil {
+			t.Fatal(err)
+		}
+		project, err := c.selectFn(c.project.Index)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if project.ContractorIndex != c.contractor || project.TotalValue != c.price {
+			t.Fatalf("%s: contractor %d selected at %f, expected %d at %f", c.name, project.ContractorIndex,
+				project.TotalValue, c.contractor, c.price)
+		}
+	}
+
+	// bids are only taken while the project is at stage 2, even if a round is still open
+	english.AuctionRoundEnd = 1 << 62
+	err := english.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = PlaceEnglishBid(english.Index, 6, 800)
+	if err == nil {
+		t.Fatalf("bid placed on a stage 3 project")
+	}
+}
+
+// expireRound moves the end of the current round of an open auction back by seconds
+func expireRound(t *testing.T, projIndex int, seconds int64) {
+	project, err := RetrieveProject(projIndex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	project.AuctionRoundEnd -= seconds
+	err = project.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEnglishAuction(t *testing.T) {
+	teardown := setupPlatform(t)
+	defer teardown()
+
+	project := Project{Index: 1, Stage: 2, AuctionType: "english"}
+	err := project.StartOpenAuction(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = project.StartOpenAuction(1000)
+	if err == nil {
+		t.Fatalf("auction started twice")
+	}
+
+	contractor1, contractor2 := testContractor(t, "contractor1"), testContractor(t, "contractor2")
+	err = PlaceEnglishBid(project.Index, contractor1.U.Index, 1100)
+	if err == nil {
+		t.Fatalf("bid above the start price accepted")
+	}
+	err = PlaceEnglishBid(project.Index, contractor1.U.Index, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// bids have to undercut the best standing bid by the decrement
+	err = PlaceEnglishBid(project.Index, contractor2.U.Index, 995)
+	if err == nil {
+		t.Fatalf("bid that doesn't undercut the best bid by the decrement accepted")
+	}
+	err = PlaceEnglishBid(project.Index, contractor2.U.Index, 900)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = SelectContractEnglish(project.Index)
+	if err == nil {
+		t.Fatalf("contract selected while the round is open")
+	}
+
+	expireRound(t, project.Index, consts.AuctionRoundInterval)
+	err = PlaceEnglishBid(project.Index, contractor1.U.Index, 800)
+	if err == nil {
+		t.Fatalf("bid placed after the auction closed")
+	}
+	project, err = SelectContractEnglish(project.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if project.ContractorIndex != contractor2.U.Index || project.TotalValue != 900 {
+		t.Fatalf("contractor %d selected at %f, expected the lowest bid", project.ContractorIndex, project.TotalValue)
+	}
+}
+
+func TestDutchAuction(t *testing.T) {
+	teardown := setupPlatform(t)
+	defer teardown()
+
+	project := Project{Index: 1, Stage: 2, AuctionType: "dutch"}
+	err := project.StartOpenAuction(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = SelectContractDutch(project.Index)
+	if err == nil {
+		t.Fatalf("contract selected before any contractor accepted the price")
+	}
+
+	// the price offered rises every round until a contractor accepts it
+	expireRound(t, project.Index, consts.AuctionRoundInterval)
+	contractor1, contractor2 := testContractor(t, "contractor1"), testContractor(t, "contractor2")
+	err = AcceptDutchPrice(project.Index, contractor1.U.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = AcceptDutchPrice(project.Index, contractor2.U.Index)
+	if err == nil {
+		t.Fatalf("price accepted after the auction was won")
+	}
+
+	project, err = SelectContractDutch(project.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if project.ContractorIndex != contractor1.U.Index || project.TotalValue != 1050 {
+		t.Fatalf("contractor %d selected at %f, expected the first to accept the second round's price",
+			project.ContractorIndex, project.TotalValue)
+	}
+}
@@ -0,0 +1,397 @@
+package core
+
+import (
+	"github.com/pkg/errors"
+	"log"
+	"strconv"
+
+	utils "github.com/Varunram/essentials/utils"
+
+	consts "github.com/YaleOpenLab/opensolar/consts"
+	notif "github.com/YaleOpenLab/opensolar/notif"
+)
+
+// an Auction runs for a fixed window on an originated project. Contractors place bids on the auction
+// instead of proposing separate stage 2 projects, and can amend or withdraw their bids until the auction
+// closes. In a sealed auction contractors only commit to their bids while the auction is open and reveal them once
+// it has closed. Opening an auction schedules a job that closes it once its window is over, picks the winning bid using
+// the auction's selection rule and copies it onto the originated project.
+
+// Auction defines an auction held on an originated project
+type Auction struct {
+	Index          int    // the index of the auction
+	ProjectIndex   int    // the index of the originated project that is being auctioned
+	RecipientIndex int    // the index of the recipient of the project
+	Rule           string // the rule used to select the winning bid - blind, vickrey, time or score
+	OpenTime       int64  // unix time at which the auction opened
+	CloseTime      int64  // unix time at which the auction closes
+	Closed         bool   // set once the auction has been closed by the closer
+	WinningBid     int    // the index of the winning bid, 0 if there was no winner
+	Sealed         bool   // set if bids are committed as hashes while the auction is open and revealed after it closes
+	RevealTime     int64  // unix time until which the bids of a sealed auction can be revealed
+	Failed         bool   // set if the auction was closed without a winner since none could be selected
+	FailureReason  string // the reason no winner could be selected, if the auction failed
+}
+
+// Bid defines a bid placed by a contractor on an auction
+type Bid struct {
+	Index           int     // the index of the bid
+	AuctionIndex    int     // the index of the auction the bid was placed on
+	ProjectIndex    int     // the index of the project being auctioned
+	ContractorIndex int     // the index of the contractor who placed the bid
+	Price           float64 // the price at which the contractor is willing to install the project
+	Years           int     // the number of years the contractor needs to complete the project
+	Metadata        string  // other details about the bid
+	Timestamp       int64   // unix time at which the bid was last placed or amended
+	Withdrawn       bool    // set if the contractor withdrew the bid before the auction closed
+	Commitment      string  // the hash of the price, timeline and salt of a sealed bid. The price is hidden until the bid is revealed
+	Revealed        bool    // set once a sealed bid has been opened and checked against its commitment
+	Disqualified    bool    // set if a sealed bid was revealed late or did not match its commitment
+}
+
+// OpenAuction opens an auction on an originated project. Bids can be placed on the auction for the
+// passed duration in seconds after which it is closed automatically using rule to pick the winner
+func OpenAuction(projIndex int, rule string, duration int64) (Auction, error) {
+	if duration <= 0 {
+		duration = consts.AuctionDuration
+	}
+	return openAuction(projIndex, rule, duration, false)
+}
+
+// openAuction opens an auction that takes bids for duration seconds on an originated project
+func openAuction(projIndex int, rule string, duration int64, sealed bool) (Auction, error) {
+	var auction Auction
+
+	switch rule {
+	case "blind", "vickrey", "time", "score":
+	default:
+		return auction, errors.New("selection rule not supported, quitting")
+	}
+
+	project, err := RetrieveProject(projIndex)
+	if err != nil {
+		return auction, errors.Wrap(err, "couldn't retrieve project")
+	}
+	if project.Stage != 1 {
+		return auction, errors.New("auctions can only be opened on originated projects")
+	}
+
+	_, err = RetrieveProjectAuction(projIndex)
+	if err == nil {
+		return auction, errors.New("auction already open on project")
+	}
+
+	allAuctions, err := RetrieveAllAuctions()
+	if err != nil {
+		return auction, errors.Wrap(err, "couldn't retrieve auctions")
+	}
+
+	auction.Index = len(allAuctions) + 1
+	auction.ProjectIndex = projIndex
+	auction.RecipientIndex = project.RecipientIndex
+	auction.Rule = rule
+	auction.OpenTime = utils.Unix()
+	auction.CloseTime = auction.OpenTime + duration
+	if sealed {
+		auction.Sealed = true
+		auction.RevealTime = auction.CloseTime + consts.SealedBidRevealInterval
+	}
+
+	// the job is scheduled first so that a saved auction is always closed. A job whose auction couldn't be
+	// saved finds no auction to close and finishes
+	_, err = ScheduleJob(JobAuction, projIndex, auction.over(), 0)
+	if err != nil {
+		return auction, errors.Wrap(err, "couldn't schedule closing of auction")
+	}
+	return auction, auction.Save()
+}
+
+// open checks whether bids can still be placed on the auction
+func (auction Auction) open() bool {
+	return !auction.Closed && utils.Unix() < auction.CloseTime
+}
+
+// over returns the unix time after which the auction can be closed. Sealed auctions are closed once their
+// bids can't be revealed anymore
+func (auction Auction) over() int64 {
+	if auction.Sealed {
+		return auction.RevealTime
+	}
+	return auction.CloseTime
+}
+
+// newBid returns a new bid of the contractor on an open auction. Each contractor can have only one active bid
+// on an auction
+func (contractor *Entity) newBid(auction Auction) (Bid, error) {
+	var bid Bid
+
+	if !contractor.Contractor {
+		return bid, errors.New("only contractors can bid on projects")
+	}
+	if !auction.open() {
+		return bid, errors.New("auction not open for bids")
+	}
+
+	bids, err := RetrieveAuctionBids(auction.Index)
+	if err != nil {
+		return bid, errors.Wrap(err, "couldn't retrieve bids")
+	}
+	for _, elem := range bids {
+		if elem.ContractorIndex == contractor.U.Index && !elem.Withdrawn {
+			return bid, errors.New("contractor already has a bid on this auction")
+		}
+	}
+
+	allBids, err := RetrieveAllBids()
+	if err != nil {
+		return bid, errors.Wrap(err, "couldn't retrieve bids")
+	}
+
+	bid.Index = len(allBids) + 1
+	bid.AuctionIndex = auction.Index
+	bid.ProjectIndex = auction.ProjectIndex
+	bid.ContractorIndex = contractor.U.Index
+	bid.Timestamp = utils.Unix()
+	return bid, nil
+}
+
+// valid checks whether a bid takes part in selecting the winner of its auction. Sealed bids only do so once they
+// have been revealed
+func (bid Bid) valid() bool {
+	if bid.Withdrawn {
+		return false
+	}
+	return bid.Commitment == "" || (bid.Revealed && !bid.Disqualified)
+}
+
+// PlaceBid places a contractor's bid on an open auction. Each contractor can have only one active bid
+// on an auction, which can be amended until the auction closes.
+func (contractor *Entity) PlaceBid(auctionIndex int, price float64, years int, metadata string) (Bid, error) {
+	if price <= 0 || years <= 0 {
+		return Bid{}, errors.New("price and years must be positive")
+	}
+
+	auction, err := RetrieveAuction(auctionIndex)
+	if err != nil {
+		return Bid{}, errors.Wrap(err, "couldn't retrieve auction")
+	}
+	if auction.Sealed {
+		return Bid{}, errors.New("sealed auctions only take commitments to bids")
+	}
+
+	bid, err := contractor.newBid(auction)
+	if err != nil {
+		return bid, err
+	}
+
+	bid.Price = price
+	bid.Years = years
+	bid.Metadata = metadata
+	return bid, bid.Save()
+}
+
+// retrieveOpenBid retrieves a contractor's active bid on an auction that is still open
+func retrieveOpenBid(bidIndex int, contrIndex int) (Bid, error) {
+	bid, err := RetrieveBid(bidIndex)
+	if err != nil {
+		return bid, errors.Wrap(err, "couldn't retrieve bid")
+	}
+	if bid.ContractorIndex != contrIndex {
+		return bid, errors.New("bid does not belong to contractor")
+	}
+	if bid.Withdrawn {
+		return bid, errors.New("bid has been withdrawn")
+	}
+
+	auction, err := RetrieveAuction(bid.AuctionIndex)
+	if err != nil {
+		return bid, errors.Wrap(err, "couldn't retrieve auction")
+	}
+	if !auction.open() {
+		return bid, errors.New("auction is closed")
+	}
+	return bid, nil
+}
+
+// AmendBid changes the price and timeline of a bid before the auction closes
+func AmendBid(bidIndex int, contrIndex int, price float64, years int) (Bid, error) {
+	if price <= 0 || years <= 0 {
+		return Bid{}, errors.New("price and years must be positive")
+	}
+
+	bid, err := retrieveOpenBid(bidIndex, contrIndex)
+	if err != nil {
+		return bid, err
+	}
+	if bid.Commitment != "" {
+		return bid, errors.New("sealed bids can't be amended, withdraw the bid and commit to a new one")
+	}
+
+	bid.Price = price
+	bid.Years = years
+	bid.Timestamp = utils.Unix()
+	return bid, bid.Save()
+}
+
+// WithdrawBid withdraws a bid before the auction closes. Withdrawn bids are not considered while
+// selecting the winner.
+func WithdrawBid(bidIndex int, contrIndex int) error {
+	bid, err := retrieveOpenBid(bidIndex, contrIndex)
+	if err != nil {
+		return err
+	}
+
+	bid.Withdrawn = true
+	bid.Timestamp = utils.Unix()
+	return bid.Save()
+}
+
+// contract converts a bid to a contract so that it can be passed to the regular selectors. The contract
+// carries the index of the bid and not that of the project being auctioned.
+func (bid Bid) contract(project Project) Project {
+	var pc Project
+	pc.Index = bid.Index
+	pc.PanelSize = project.PanelSize
+	pc.State = project.State
+	pc.Metadata = bid.Metadata
+	pc.RecipientIndex = project.RecipientIndex
+	pc.Stage = 2
+	pc.ContractorIndex = bid.ContractorIndex
+	pc.TotalValue = bid.Price
+	pc.EstimatedAcquisition = bid.Years
+	return pc
+}
+
+// selectWinner selects the winning contract using the auction's rule
+func (auction Auction) selectWinner(arr []Project) (Project, error) {
+	switch auction.Rule {
+	case "vickrey":
+		return vickreyContract(arr)
+	case "time":
+		return SelectContractTime(arr)
+	case "score":
+		result, err := SelectContractScore(auction.ProjectIndex, arr)
+		return result.WinningContract, err
+	default:
+		return SelectContractBlind(arr)
+	}
+}
+
+// CloseAuction closes an auction whose window is over, selects the winning bid and assigns its
+// contractor, price and timeline to the auctioned project. The project is updated before the auction is
+// marked as closed so that an auction that fails in between is closed again. If no winner can be selected,
+// the auction is closed as failed and the project stays originated. All contractors who bid on the auction
+// are notified of the result.
+func CloseAuction(auctionIndex int) error {
+	auction, err := RetrieveAuction(auctionIndex)
+	if err != nil {
+		return errors.Wrap(err, "couldn't retrieve auction")
+	}
+	if auction.Closed {
+		return errors.New("auction already closed")
+	}
+	if utils.Unix() < auction.over() {
+		return errors.New("auction still open for bids")
+	}
+
+	project, err := RetrieveProject(auction.ProjectIndex)
+	if err != nil {
+		return errors.Wrap(err, "couldn't retrieve project")
+	}
+
+	bids, err := RetrieveAuctionBids(auctionIndex)
+	if err != nil {
+		return errors.Wrap(err, "couldn't retrieve bids")
+	}
+
+	var active []Bid
+	var arr []Project
+	for _, bid := range bids {
+		if bid.valid() {
+			active = append(active, bid)
+			arr = append(arr, bid.contract(project))
+		}
+	}
+
+	auction.Closed = true
+	if len(arr) == 0 {
+		log.Println("auction", auction.Index, "closed without any bids")
+		return auction.Save()
+	}
+
+	winner, err := auction.selectWinner(arr)
+	if err != nil {
+		log.Println("couldn't select winning bid of auction", auction.Index, err)
+		auction.Failed = true
+		auction.FailureReason = err.Error()
+		return auction.Save()
+	}
+
+	// a project at stage 4 has been updated by an earlier attempt that couldn't mark the auction as closed
+	switch project.Stage {
+	case 1:
+		project.ContractorIndex = winner.ContractorIndex
+		project.TotalValue = winner.TotalValue
+		project.EstimatedAcquisition = winner.EstimatedAcquisition
+		project.AuctionType = auction.Rule
+		err = project.SetStage(4)
+		if err != nil {
+			return errors.Wrap(err, "couldn't set stage of auctioned project")
+		}
+	case 4:
+	default:
+		auction.Failed = true
+		auction.FailureReason = "project moved to stage " + strconv.Itoa(project.Stage) + " while being auctioned"
+		return auction.Save()
+	}
+
+	auction.WinningBid = winner.Index
+	err = auction.Save()
+	if err != nil {
+		return errors.Wrap(err, "couldn't save auction")
+	}
+
+	for _, bid := range active {
+		contractor, err := RetrieveEntity(bid.ContractorIndex)
+		if err != nil {
+			log.Println("couldn't retrieve contractor", err)
+			continue
+		}
+		if bid.Index == winner.Index {
+			err = notif.SendAuctionWonEmail(project.Index, contractor.U.Email)
+		} else {
+			err = notif.SendAuctionLostEmail(project.Index, contractor.U.Email)
+		}
+		if err != nil {
+			log.Println("couldn't send auction result to contractor", err)
+		}
+	}
+
+	return nil
+}
+
+// runAuctionJob closes the auction running on the job's project once its window is over. Auctions that
+// couldn't be closed are tried again, while the job is done once the auction has been closed
+func runAuctionJob(job *Job) error {
+	auctions, err := RetrieveAllAuctions()
+	if err != nil {
+		return errors.Wrap(err, "couldn't retrieve auctions")
+	}
+
+	for _, auction := range auctions {
+		if auction.ProjectIndex != job.ProjectIndex || auction.Closed {
+			continue
+		}
+		if utils.Unix() < auction.over() {
+			job.NextRun = auction.over()
+			return nil
+		}
+		err = CloseAuction(auction.Index)
+		if err != nil {
+			return err
+		}
+	}
+
+	job.Status = JobDone
+	return nil
+}
@@ -0,0 +1,168 @@
+package core
+
+import (
+	"testing"
+
+	utils "github.com/Varunram/essentials/utils"
+	openx "github.com/YaleOpenLab/openx/database"
+)
+
+// testContractor saves a contractor for the tests to bid with
+func testContractor(t *testing.T, name string) Entity {
+	user, err := NewUser(name, utils.SHA3hash(testPwd), testSeedPwd, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contractor := Entity{U: &user, Contractor: true}
+	err = contractor.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return contractor
+}
+
+// auctionJob retrieves the job that closes the auction on a project
+func auctionJob(t *testing.T, projIndex int) Job {
+	jobs, err := RetrieveProjectJobs(projIndex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, job := range jobs {
+		if job.Type == JobAuction {
+			return job
+		}
+	}
+	t.Fatalf("no job scheduled to close the auction on project %d", projIndex)
+	return Job{}
+}
+
+// endAuction moves the close time of an auction into the past
+func endAuction(t *testing.T, auction Auction) {
+	auction.CloseTime = utils.Unix() - 1
+	err := auction.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCloseAuction(t *testing.T) {
+	teardown := setupPlatform(t)
+	defer teardown()
+
+	project := Project{Index: 1, Stage: 1, TotalValue: 1000}
+	err := project.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	auction, err := OpenAuction(project.Index, "blind", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := auctionJob(t, project.Index)
+	if job.NextRun != auction.CloseTime {
+		t.Fatalf("auction closing at %d scheduled for %d", auction.CloseTime, job.NextRun)
+	}
+
+	contractor1, contractor2 := testContractor(t, "contractor1"), testContractor(t, "contractor2")
+	_, err = contractor1.PlaceBid(auction.Index, 1000, 5, "bid 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bid, err := contractor2.PlaceBid(auction.Index, 900, 6, "bid 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a job that runs before the window is over waits for it
+	err = runAuctionJob(&job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != JobScheduled || job.NextRun != auction.CloseTime {
+		t.Fatalf("job closed an auction that is still open %v", job)
+	}
+
+	endAuction(t, auction)
+	err = runAuctionJob(&job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != JobDone {
+		t.Fatalf("job not done after closing the auction %v", job)
+	}
+
+	auction, err = RetrieveAuction(auction.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !auction.Closed || auction.Failed || auction.WinningBid != bid.Index {
+		t.Fatalf("unexpected auction %v", auction)
+	}
+	project, err = RetrieveProject(project.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if project.Stage != 4 || project.ContractorIndex != contractor2.U.Index || project.TotalValue != 900 {
+		t.Fatalf("winning bid not assigned to project %v", project)
+	}
+
+	err = CloseAuction(auction.Index)
+	if err == nil {
+		t.Fatalf("auction closed twice")
+	}
+}
+
+func TestCloseAuctionFailed(t *testing.T) {
+	teardown := setupPlatform(t)
+	defer teardown()
+
+	project := Project{Index: 1, Stage: 1, TotalValue: 1000}
+	err := project.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	auction, err := OpenAuction(project.Index, "score", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// scoring needs the contractor's details, which a contractor who isn't on the platform doesn't have
+	contractor := Entity{U: &openx.User{Index: 99}, Contractor: true}
+	_, err = contractor.PlaceBid(auction.Index, 900, 6, "bid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	endAuction(t, auction)
+	job := auctionJob(t, project.Index)
+	err = runAuctionJob(&job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != JobDone {
+		t.Fatalf("job of a failed auction is retried %v", job)
+	}
+
+	auction, err = RetrieveAuction(auction.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !auction.Closed || !auction.Failed || auction.FailureReason == "" || auction.WinningBid != 0 {
+		t.Fatalf("failure of auction not recorded %v", auction)
+	}
+	project, err = RetrieveProject(project.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if project.Stage != 1 {
+		t.Fatalf("project of a failed auction moved to stage %d", project.Stage)
+	}
+
+	// the project can be auctioned again
+	_, err = OpenAuction(project.Index, "blind", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
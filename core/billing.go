@@ -0,0 +1,442 @@
+package core
+
+import (
+	"bytes"
+	"encoding/csv"
+	"github.com/pkg/errors"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	utils "github.com/Varunram/essentials/utils"
+
+	consts "github.com/YaleOpenLab/opensolar/consts"
+	notif "github.com/YaleOpenLab/opensolar/notif"
+	oracle "github.com/YaleOpenLab/opensolar/oracle"
+)
+
+// recipients are billed for the energy they use. The teller reports energy readings for a project as they
+// come in and the billing job closes the project's billing period once every payback period. Closing a period
+// prices the readings in it at the tariff of the project's location, rolls the energy for the period into the
+// project's total and issues an invoice. Paybacks also go towards the project's payment schedule, so an invoice
+// bills at least the installments that fall due in its period. A recipient who pays their invoices then keeps
+// up with the schedule that the breach policy checks. Paybacks settle the oldest invoices first and each payment
+// is recorded on the invoices it went towards by the hash of the transaction that carried it.
+
+// EnergyReading is an energy reading reported for a project
+type EnergyReading struct {
+	Index        int     // the index of the reading
+	ProjectIndex int     // the index of the project the reading was reported for
+	Timestamp    int64   // unix time at which the energy was used
+	Energy       float64 // the energy used in kWh
+}
+
+const (
+	// InvoiceOpen is the status of an invoice that nothing has been paid towards yet
+	InvoiceOpen = "open"
+
+	// InvoicePartial is the status of an invoice that has been paid in part
+	InvoicePartial = "partial"
+
+	// InvoicePaid is the status of an invoice that has been paid in full
+	InvoicePaid = "paid"
+
+	// InvoiceOverdue is the status of an invoice that hasn't been paid in full by its due date
+	InvoiceOverdue = "overdue"
+)
+
+// Invoice is the bill for the energy used by a project in a billing period
+type Invoice struct {
+	Index          int              // the index of the invoice
+	ProjectIndex   int              // the index of the project that was billed
+	RecipientIndex int              // the index of the recipient who has to pay the invoice
+	PeriodStart    int64            // unix time at which the billing period started
+	PeriodEnd      int64            // unix time at which the billing period ended
+	Energy         float64          // the energy used in the billing period in kWh
+	Tariff         oracle.Tariff    // the tariff the energy was billed at
+	EnergyCharge   float64          // the amount charged for the energy used at the tariff
+	Installment    float64          // the amount due on the project's schedule that wasn't billed on earlier invoices
+	Amount         float64          // the amount billed, the larger of the energy charge and the installment
+	IssuedAt       int64            // unix time at which the invoice was issued
+	DueDate        int64            // unix time by which the invoice has to be paid
+	Paid           float64          // the amount that has been paid towards the invoice
+	Status         string           // one of open, partial, paid or overdue
+	Payments       []InvoicePayment // the payments made towards the invoice
+}
+
+// InvoicePayment is a payment made towards an invoice
+type InvoicePayment struct {
+	TxHash    string  // the hash of the transaction that carried the payment
+	Amount    float64 // the amount of the payment that went towards the invoice
+	Timestamp int64   // unix time at which the payment was made
+}
+
+// Due returns the amount left to pay on the invoice
+func (invoice Invoice) Due() float64 {
+	if invoice.Paid >= invoice.Amount {
+		return 0
+	}
+	return invoice.Amount - invoice.Paid
+}
+
+// UpdateStatus sets the status of the invoice from the amount paid towards it and returns whether it changed
+func (invoice *Invoice) UpdateStatus(now int64) bool {
+	status := InvoiceOpen
+	switch {
+	case invoice.Due() == 0:
+		status = InvoicePaid
+	case now > invoice.DueDate:
+		status = InvoiceOverdue
+	case invoice.Paid > 0:
+		status = InvoicePartial
+	}
+
+	changed := invoice.Status != status
+	invoice.Status = status
+	return changed
+}
+
+// paidWith returns the amount of a payment with the given transaction hash that has been applied to the invoice
+func (invoice Invoice) paidWith(txhash string) float64 {
+	var amount float64
+	for _, payment := range invoice.Payments {
+		if payment.TxHash == txhash {
+			amount += payment.Amount
+		}
+	}
+	return amount
+}
+
+// billingPeriod returns the length of the project's billing period in seconds
+func (project Project) billingPeriod() int64 {
+	period := project.PaybackPeriod
+	if period <= 0 {
+		period = consts.DefaultPaybackPeriod
+	}
+	return int64(period) * int64(consts.OneWeekInSecond/time.Second)
+}
+
+// ReportEnergy records energy used by a project in its current billing period
+func ReportEnergy(projIndex int, recpIndex int, energy float64, timestamp int64) (EnergyReading, error) {
+	var reading EnergyReading
+	if energy < 0 {
+		return reading, errors.New("energy readings can't be negative")
+	}
+
+	project, err := RetrieveProject(projIndex)
+	if err != nil {
+		return reading, errors.Wrap(err, "couldn't retrieve project")
+	}
+
+	if project.RecipientIndex != recpIndex {
+		return reading, errors.New("recipient not associated with project")
+	}
+
+	if project.BillingPeriodStart == 0 {
+		return reading, errors.New("project is not being billed yet")
+	}
+
+	if project.Disconnected {
+		return reading, errors.New("project is disconnected, energy isn't billed while power goes to the grid")
+	}
+
+	// meter readings are accepted up to MeterClockSkew ahead of the platform's clock, so energy reported from them is too
+	if timestamp < project.BillingPeriodStart || timestamp > utils.Unix()+consts.MeterClockSkew {
+		return reading, errors.New("reading doesn't fall in the current billing period")
+	}
+
+	existing, err := RetrieveProjectEnergyReadings(projIndex, timestamp, timestamp+1)
+	if err != nil {
+		return reading, errors.Wrap(err, "couldn't retrieve energy readings")
+	}
+
+	if len(existing) != 0 {
+		return reading, errors.New("energy has already been reported at this time")
+	}
+
+	recipient, err := RetrieveRecipient(recpIndex)
+	if err != nil {
+		return reading, errors.Wrap(err, "couldn't retrieve recipient")
+	}
+
+	readings, err := RetrieveAllEnergyReadings()
+	if err != nil {
+		return reading, errors.Wrap(err, "couldn't retrieve energy readings")
+	}
+
+	reading.Index = len(readings) + 1
+	reading.ProjectIndex = projIndex
+	reading.Timestamp = timestamp
+	reading.Energy = energy
+	err = reading.Save()
+	if err != nil {
+		return reading, errors.Wrap(err, "couldn't save energy reading")
+	}
+
+	project.EnergyCP += energy
+	err = project.Save()
+	if err != nil {
+		return reading, errors.Wrap(err, "couldn't save project")
+	}
+
+	recipient.TotalEnergyCP += energy
+	return reading, recipient.Save()
+}
+
+// CloseBillingPeriod closes the project's current billing period at end and issues an invoice for the energy
+// used in it. The next billing period starts at end
+func CloseBillingPeriod(projIndex int, end int64) (Invoice, error) {
+	var invoice Invoice
+	project, err := RetrieveProject(projIndex)
+	if err != nil {
+		return invoice, errors.Wrap(err, "couldn't retrieve project")
+	}
+
+	if project.BillingPeriodStart == 0 || end <= project.BillingPeriodStart {
+		return invoice, errors.New("billing period hasn't started yet")
+	}
+
+	readings, err := RetrieveProjectEnergyReadings(projIndex, project.BillingPeriodStart, end)
+	if err != nil {
+		return invoice, errors.Wrap(err, "couldn't retrieve energy readings")
+	}
+
+	var energy float64
+	var arr []oracle.Reading
+	for _, reading := range readings {
+		energy += reading.Energy
+		arr = append(arr, oracle.Reading{Timestamp: reading.Timestamp, Energy: reading.Energy})
+	}
+
+	// the tariff in effect at the start of the period is used for the whole period
+	tariff, err := oracle.TariffAt(project.State, project.BillingPeriodStart)
+	if err != nil {
+		return invoice, errors.Wrap(err, "couldn't fetch tariff")
+	}
+
+	energyCharge, err := tariff.Bill(arr)
+	if err != nil {
+		return invoice, errors.Wrap(err, "couldn't compute bill")
+	}
+
+	// installments due by the end of the period that are billed on invoices still open aren't billed again
+	scheduleDue, _ := project.AmountDue(end)
+	billed, err := AmountInvoiced(projIndex)
+	if err != nil {
+		return invoice, errors.Wrap(err, "couldn't retrieve invoices")
+	}
+	installment := math.Max(scheduleDue-billed, 0)
+	amount := math.Max(energyCharge, installment)
+
+	recipient, err := RetrieveRecipient(project.RecipientIndex)
+	if err != nil {
+		return invoice, errors.Wrap(err, "couldn't retrieve recipient")
+	}
+
+	invoices, err := RetrieveAllInvoices()
+	if err != nil {
+		return invoice, errors.Wrap(err, "couldn't retrieve invoices")
+	}
+
+	invoice.Index = len(invoices) + 1
+	invoice.ProjectIndex = projIndex
+	invoice.RecipientIndex = project.RecipientIndex
+	invoice.PeriodStart = project.BillingPeriodStart
+	invoice.PeriodEnd = end
+	invoice.Energy = energy
+	invoice.Tariff = tariff
+	invoice.EnergyCharge = energyCharge
+	invoice.Installment = installment
+	invoice.Amount = amount
+	invoice.IssuedAt = utils.Unix()
+	invoice.DueDate = end + consts.InvoiceDueInterval
+	invoice.UpdateStatus(invoice.IssuedAt)
+	err = invoice.Save()
+	if err != nil {
+		return invoice, errors.Wrap(err, "couldn't save invoice")
+	}
+
+	// roll the energy of the period into the totals. Energy reported after end belongs to the next period and
+	// the recipient's counters cover all of their projects, so only the energy billed here is rolled over
+	recipient.TotalEnergy += energy
+	recipient.TotalEnergyCP = math.Max(recipient.TotalEnergyCP-energy, 0)
+	err = recipient.Save()
+	if err != nil {
+		return invoice, errors.Wrap(err, "couldn't save recipient")
+	}
+
+	project.TotalEnergy += energy
+	project.EnergyCP = math.Max(project.EnergyCP-energy, 0)
+	project.BillingPeriodStart = end
+	err = project.Save()
+	if err != nil {
+		return invoice, errors.Wrap(err, "couldn't save project")
+	}
+
+	if invoice.Status != InvoicePaid {
+		notif.SendInvoiceEmail(projIndex, recipient.U.Email, amount)
+	}
+	return invoice, nil
+}
+
+// AmountInvoiced returns the amount due on the invoices of a project that haven't been settled
+func AmountInvoiced(projIndex int) (float64, error) {
+	invoices, err := RetrieveProjectInvoices(projIndex)
+	if err != nil {
+		return 0, err
+	}
+
+	var due float64
+	for _, invoice := range invoices {
+		due += invoice.Due()
+	}
+	return due, nil
+}
+
+// RetrieveRecipientInvoices retrieves the invoices of a project issued to a specific recipient with their status
+// brought up to date
+func RetrieveRecipientInvoices(projIndex int, recpIndex int) ([]Invoice, error) {
+	var arr []Invoice
+	invoices, err := RetrieveProjectInvoices(projIndex)
+	if err != nil {
+		return arr, err
+	}
+
+	now := utils.Unix()
+	for _, invoice := range invoices {
+		if invoice.RecipientIndex != recpIndex {
+			continue
+		}
+		if invoice.UpdateStatus(now) {
+			err = invoice.Save()
+			if err != nil {
+				return arr, errors.Wrap(err, "couldn't save invoice")
+			}
+		}
+		arr = append(arr, invoice)
+	}
+
+	sort.Slice(arr, func(i, j int) bool {
+		return arr[i].PeriodStart < arr[j].PeriodStart
+	})
+	return arr, nil
+}
+
+// settleInvoices applies a payback with transaction hash txhash towards the project's invoices, oldest first, and
+// returns the amount that was left over after all invoices were settled
+func settleInvoices(projIndex int, amount float64, txhash string) (float64, error) {
+	invoices, err := RetrieveProjectInvoices(projIndex)
+	if err != nil {
+		return amount, err
+	}
+
+	sort.Slice(invoices, func(i, j int) bool {
+		return invoices[i].PeriodStart < invoices[j].PeriodStart
+	})
+
+	now := utils.Unix()
+	for _, invoice := range invoices {
+		if amount <= 0 {
+			break
+		}
+		if invoice.Due() == 0 {
+			continue
+		}
+
+		pay := invoice.Due()
+		if amount < pay {
+			pay = amount
+		}
+		invoice.Paid += pay
+		invoice.Payments = append(invoice.Payments, InvoicePayment{TxHash: txhash, Amount: pay, Timestamp: now})
+		invoice.UpdateStatus(now)
+		amount -= pay
+
+		err = invoice.Save()
+		if err != nil {
+			return amount, errors.Wrap(err, "couldn't save invoice")
+		}
+	}
+	return amount, nil
+}
+
+// formatFloat formats an amount for a statement
+func formatFloat(x float64) string {
+	return strconv.FormatFloat(x, 'f', 2, 64)
+}
+
+// Statement returns the billing statement of a recipient for a project in CSV format. There is a row for every
+// invoice followed by a row for each payment made towards it
+func Statement(projIndex int, recpIndex int) ([]byte, error) {
+	invoices, err := RetrieveRecipientInvoices(projIndex, recpIndex)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't retrieve invoices")
+	}
+
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	err = writer.Write([]string{"invoice", "periodstart", "periodend", "energy", "rate", "amount", "duedate",
+		"status", "txhash", "paid", "paidat"})
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't write statement")
+	}
+
+	for _, invoice := range invoices {
+		index := strconv.Itoa(invoice.Index)
+		err = writer.Write([]string{index,
+			strconv.FormatInt(invoice.PeriodStart, 10), strconv.FormatInt(invoice.PeriodEnd, 10),
+			strconv.FormatFloat(invoice.Energy, 'f', -1, 64), strconv.FormatFloat(invoice.Tariff.Rate, 'f', -1, 64),
+			formatFloat(invoice.Amount), strconv.FormatInt(invoice.DueDate, 10), invoice.Status, "", "", ""})
+		if err != nil {
+			return nil, errors.Wrap(err, "couldn't write statement")
+		}
+
+		for _, payment := range invoice.Payments {
+			err = writer.Write([]string{index, "", "", "", "", "", "", "", payment.TxHash,
+				formatFloat(payment.Amount), strconv.FormatInt(payment.Timestamp, 10)})
+			if err != nil {
+				return nil, errors.Wrap(err, "couldn't write statement")
+			}
+		}
+	}
+
+	writer.Flush()
+	return buf.Bytes(), writer.Error()
+}
+
+// runBillingJob closes the project's billing period once it is over and runs again at the end of the next one
+func runBillingJob(job *Job) error {
+	project, err := RetrieveProject(job.ProjectIndex)
+	if err != nil {
+		return errors.Wrap(err, "couldn't retrieve project")
+	}
+
+	if project.Stage == 9 || project.OwnershipShift >= 1 {
+		job.Status = JobDone
+		return nil
+	}
+
+	end := project.BillingPeriodStart + project.billingPeriod()
+	if utils.Unix() < end {
+		job.NextRun = end
+		return nil
+	}
+
+	invoice, err := CloseBillingPeriod(job.ProjectIndex, end)
+	if err != nil {
+		return err
+	}
+
+	log.Println("issued invoice", invoice.Index, "of", invoice.Amount, "for project", job.ProjectIndex)
+
+	// payments made before the invoice was issued are applied to it
+	err = processPayments(job.ProjectIndex, "")
+	if err != nil {
+		log.Println("couldn't process payments towards project", job.ProjectIndex, err)
+	}
+
+	job.NextRun = end + project.billingPeriod()
+	return nil
+}
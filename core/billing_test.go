@@ -0,0 +1,179 @@
+package core
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+
+	utils "github.com/Varunram/essentials/utils"
+)
+
+func TestMeteredBilling(t *testing.T) {
+	teardown := setupPlatform(t)
+	defer teardown()
+
+	recipient, err := NewRecipient("recipient", testPwd, testSeedPwd, "Recipient")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := utils.Unix()
+	project := Project{
+		Index:              1,
+		RecipientIndex:     recipient.U.Index,
+		BillingPeriodStart: now - 1000,
+		Schedule:           []Installment{{Number: 1, DueDate: now - 10, Payment: 30}},
+	}
+	err = project.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = ReportEnergy(project.Index, recipient.U.Index, 100, now-500)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ReportEnergy(project.Index, recipient.U.Index, 100, now-500)
+	if err == nil {
+		t.Fatalf("energy reported twice at the same time")
+	}
+	_, err = ReportEnergy(project.Index, recipient.U.Index, 100, now-2000)
+	if err == nil {
+		t.Fatalf("energy reported before the billing period")
+	}
+	_, err = ReportEnergy(project.Index, recipient.U.Index+1, 100, now-400)
+	if err == nil {
+		t.Fatalf("energy reported by a recipient not associated with the project")
+	}
+
+	// the installment due is billed when the energy used costs less
+	invoice1, err := CloseBillingPeriod(project.Index, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if invoice1.Energy != 100 || invoice1.EnergyCharge != 20 || invoice1.Installment != 30 || invoice1.Amount != 30 {
+		t.Fatalf("unexpected invoice %v", invoice1)
+	}
+	project, err = RetrieveProject(project.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if project.BillingPeriodStart != now || project.TotalEnergy != 100 || project.EnergyCP != 0 {
+		t.Fatalf("billed energy not rolled over %v", project)
+	}
+
+	// the installment billed on an open invoice isn't billed again
+	_, err = ReportEnergy(project.Index, recipient.U.Index, 200, now+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	invoice2, err := CloseBillingPeriod(project.Index, now+2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if invoice2.EnergyCharge != 40 || invoice2.Installment != 0 || invoice2.Amount != 40 {
+		t.Fatalf("unexpected invoice %v", invoice2)
+	}
+
+	// paybacks settle the oldest invoice first
+	left, err := settleInvoices(project.Index, 50, "tx1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if left != 0 {
+		t.Fatalf("%f left over from a payback that doesn't cover the invoices", left)
+	}
+	invoices, err := RetrieveRecipientInvoices(project.Index, recipient.U.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(invoices) != 2 || invoices[0].Status != InvoicePaid || invoices[1].Status != InvoicePartial ||
+		invoices[1].paidWith("tx1") != 20 {
+		t.Fatalf("payback not applied to the oldest invoice first %v", invoices)
+	}
+
+	left, err = settleInvoices(project.Index, 30, "tx2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if left != 10 {
+		t.Fatalf("%f left over after settling the invoices, expected 10", left)
+	}
+	due, err := AmountInvoiced(project.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if due != 0 {
+		t.Fatalf("%f still due on settled invoices", due)
+	}
+}
+
+func TestStatement(t *testing.T) {
+	teardown := setupPlatform(t)
+	defer teardown()
+
+	recipient, err := NewRecipient("recipient", testPwd, testSeedPwd, "Recipient")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a period that closed three weeks ago was due a week ago
+	now := utils.Unix()
+	start, end := now-28*24*60*60, now-21*24*60*60
+	project := Project{Index: 1, RecipientIndex: recipient.U.Index, BillingPeriodStart: start}
+	err = project.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ReportEnergy(project.Index, recipient.U.Index, 100, start+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = CloseBillingPeriod(project.Index, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = settleInvoices(project.Index, 5, "tx1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	invoices, err := RetrieveRecipientInvoices(project.Index, recipient.U.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(invoices) != 1 || invoices[0].Status != InvoiceOverdue {
+		t.Fatalf("invoice paid in part after its due date not overdue %v", invoices)
+	}
+	invoices, err = RetrieveRecipientInvoices(project.Index, recipient.U.Index+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(invoices) != 0 {
+		t.Fatalf("invoices of a project shown to another recipient")
+	}
+
+	_, err = settleInvoices(project.Index, 15, "tx2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	statement, err := Statement(project.Index, recipient.U.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(bytes.NewReader(statement)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a header, the invoice and a row for each payment towards it
+	if len(rows) != 4 {
+		t.Fatalf("statement has %d rows, expected 4", len(rows))
+	}
+	if rows[1][0] != "1" || rows[1][3] != "100" || rows[1][5] != "20.00" || rows[1][7] != InvoicePaid {
+		t.Fatalf("unexpected invoice row %v", rows[1])
+	}
+	if rows[2][8] != "tx1" || rows[2][9] != "5.00" || rows[3][8] != "tx2" || rows[3][9] != "15.00" {
+		t.Fatalf("unexpected payment rows %v %v", rows[2], rows[3])
+	}
+}
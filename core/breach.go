@@ -0,0 +1,317 @@
+package core
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	"log"
+	"strings"
+
+	utils "github.com/Varunram/essentials/utils"
+
+	notif "github.com/YaleOpenLab/opensolar/notif"
+)
+
+// a breach policy lays out what the platform does when the recipient of a project misses payments. Each
+// rule in the policy names the number of missed payment periods at which it kicks in and the action that is
+// taken. The payback job evaluates the project's policy on every check and records each action it takes so
+// that the parties involved can look back at how a breach was handled. Projects that don't define a policy
+// of their own follow DefaultBreachPolicy.
+
+const (
+	// BreachRemind sends a gentle reminder to the recipient
+	BreachRemind = "remind"
+
+	// BreachWarn warns the recipient, investors and guarantor that power will be redirected to the grid
+	BreachWarn = "warn"
+
+	// BreachLateFee adds a late fee to the amount due on the project's schedule
+	BreachLateFee = "latefee"
+
+	// BreachFirstLoss asks the guarantor to cover the amount owed to investors
+	BreachFirstLoss = "firstloss"
+
+	// BreachDisconnect redirects power from the project towards the grid
+	BreachDisconnect = "disconnect"
+
+	// BreachDefault declares the project in default
+	BreachDefault = "default"
+
+	// BreachReconnect is recorded when a disconnected recipient catches up on their payments. It can't be
+	// used in a policy
+	BreachReconnect = "reconnect"
+)
+
+// BreachRule is a single rule in a project's breach policy
+type BreachRule struct {
+	MissedPeriods int     // the number of missed payment periods at which the rule kicks in
+	Action        string  // the action that is taken once the rule kicks in
+	Amount        float64 // the late fee as a fraction of the amount owed, only used by late fee rules
+	Repeat        bool    // run the action on every check while the breach lasts instead of only once
+	Condition     string  // the breach condition that the rule enforces, stage breach conditions are used if empty
+}
+
+// BreachRecord is a record of an action taken by the breach policy
+type BreachRecord struct {
+	Index         int     // the index of the record
+	ProjectIndex  int     // the index of the project in breach
+	Action        string  // the action that was taken
+	Condition     string  // the breach condition that led to the action
+	MissedPeriods int     // the number of payment periods the recipient had missed
+	AmountOwed    float64 // the amount owed by the recipient at the time
+	Amount        float64 // the late fee charged or first loss covered, if any
+	Timestamp     int64   // unix time at which the action was taken
+	Error         string  // the error that stopped the action from going through, if any
+}
+
+// DefaultBreachPolicy is the escalation ladder used by projects that don't define their own policy
+var DefaultBreachPolicy = []BreachRule{
+	{MissedPeriods: AlertThreshold, Action: BreachRemind},
+	{MissedPeriods: SternAlertThreshold, Action: BreachWarn},
+	{MissedPeriods: DisconnectionThreshold, Action: BreachDisconnect},
+	{MissedPeriods: DisconnectionThreshold, Action: BreachFirstLoss},
+}
+
+// validate checks whether a breach rule can be added to a policy
+func (rule BreachRule) validate() error {
+	if rule.MissedPeriods <= NormalThreshold {
+		return errors.New("rules must kick in after more than one missed payment period")
+	}
+
+	switch rule.Action {
+	case BreachRemind, BreachWarn, BreachFirstLoss, BreachDisconnect, BreachDefault:
+	case BreachLateFee:
+		if rule.Amount <= 0 {
+			return errors.New("late fee must be positive")
+		}
+	default:
+		return errors.New("breach action " + rule.Action + " not supported")
+	}
+	return nil
+}
+
+// SetBreachPolicy sets the breach policy of a project. The policy can be set by the project's originator
+// or guarantor and is passed as a json encoded list of rules. An empty policy reverts to the default one
+func SetBreachPolicy(projIndex int, entityIndex int, policyString string) ([]BreachRule, error) {
+	var policy []BreachRule
+	project, err := RetrieveProject(projIndex)
+	if err != nil {
+		return policy, errors.Wrap(err, "couldn't retrieve project")
+	}
+
+	if project.OriginatorIndex != entityIndex && project.GuarantorIndex != entityIndex {
+		return policy, errors.New("only the project's originator or guarantor can set its breach policy")
+	}
+
+	if policyString != "" {
+		err = json.Unmarshal([]byte(policyString), &policy)
+		if err != nil {
+			return policy, errors.Wrap(err, "couldn't parse breach policy")
+		}
+	}
+
+	for _, rule := range policy {
+		err = rule.validate()
+		if err != nil {
+			return policy, err
+		}
+	}
+
+	project.BreachPolicy = policy
+	project.BreachRulesApplied = nil
+	return policy, project.Save()
+}
+
+// breachPolicy returns the breach policy that the project follows
+func (project Project) breachPolicy() []BreachRule {
+	if len(project.BreachPolicy) == 0 {
+		return DefaultBreachPolicy
+	}
+	return project.BreachPolicy
+}
+
+// breachCondition returns the breach condition enforced by a rule. Rules that don't describe their condition
+// enforce the breach conditions of the stage the project is at
+func (project Project) breachCondition(rule BreachRule) string {
+	if rule.Condition != "" {
+		return rule.Condition
+	}
+	if project.Stage >= 0 && project.Stage < len(stages) && len(stages[project.Stage].BreachCondition) != 0 {
+		return strings.Join(stages[project.Stage].BreachCondition, " ")
+	}
+	return "[Offtaker] fails to make payments for the given number of payment periods"
+}
+
+// breachRuleApplied checks whether a rule of the policy has already run during the current breach
+func (project Project) breachRuleApplied(rule int) bool {
+	for _, i := range project.BreachRulesApplied {
+		if i == rule {
+			return true
+		}
+	}
+	return false
+}
+
+// EvaluateBreachPolicy runs the rules of the project's breach policy that apply to the number of payment
+// periods missed by the recipient. Rules that have run don't run again until the recipient catches up on
+// their payments unless they are marked Repeat. Rules that fail are retried on the next check
+func (project *Project) EvaluateBreachPolicy(missed int) error {
+	if missed <= NormalThreshold {
+		if len(project.BreachRulesApplied) == 0 && !project.Disconnected {
+			return nil
+		}
+		// the recipient has caught up, start over on the next breach
+		if project.Disconnected {
+			project.Disconnected = false
+			project.recordBreach(BreachRule{Action: BreachReconnect}, missed, 0, nil)
+		}
+		project.BreachRulesApplied = nil
+		return project.Save()
+	}
+
+	for i, rule := range project.breachPolicy() {
+		if missed < rule.MissedPeriods || (!rule.Repeat && project.breachRuleApplied(i)) {
+			continue
+		}
+
+		amount, err := project.applyBreachAction(rule)
+		project.recordBreach(rule, missed, amount, err)
+		if err != nil {
+			log.Println("couldn't run breach action", rule.Action, "on project", project.Index, err)
+			continue
+		}
+		if !project.breachRuleApplied(i) {
+			project.BreachRulesApplied = append(project.BreachRulesApplied, i)
+		}
+
+		err = project.Save()
+		if err != nil {
+			return errors.Wrap(err, "couldn't save project")
+		}
+	}
+
+	return nil
+}
+
+// recordBreach stores a record of an action taken by the breach policy
+func (project Project) recordBreach(rule BreachRule, missed int, amount float64, actionErr error) {
+	records, err := RetrieveAllBreachRecords()
+	if err != nil {
+		log.Println("couldn't retrieve breach records", err)
+		return
+	}
+
+	var record BreachRecord
+	record.Index = len(records) + 1
+	record.ProjectIndex = project.Index
+	record.Action = rule.Action
+	record.Condition = project.breachCondition(rule)
+	record.MissedPeriods = missed
+	record.AmountOwed = project.AmountOwed
+	record.Amount = amount
+	record.Timestamp = utils.Unix()
+	if actionErr != nil {
+		record.Error = actionErr.Error()
+	}
+
+	err = record.Save()
+	if err != nil {
+		log.Println("couldn't save breach record", err)
+	}
+}
+
+// applyBreachAction takes the action of a breach rule and returns the amount charged or covered, if any
+func (project *Project) applyBreachAction(rule BreachRule) (float64, error) {
+	switch rule.Action {
+	case BreachRemind:
+		return 0, project.notifyRecipient(notif.SendNicePaybackAlertEmail)
+	case BreachWarn:
+		project.notifyInvestors(notif.SendSternPaybackAlertEmailI)
+		project.notifyGuarantor(notif.SendSternPaybackAlertEmailG)
+		return 0, project.notifyRecipient(notif.SendSternPaybackAlertEmail)
+	case BreachLateFee:
+		fee := rule.Amount * project.AmountOwed
+		err := project.chargeLateFee(fee, utils.Unix())
+		if err != nil {
+			return 0, err
+		}
+		recipient, err := RetrieveRecipient(project.RecipientIndex)
+		if err != nil {
+			log.Println("couldn't retrieve recipient", err)
+			return fee, nil
+		}
+		notif.SendLateFeeEmail(project.Index, recipient.U.Email, fee)
+		return fee, nil
+	case BreachFirstLoss:
+		guarantor, err := RetrieveEntity(project.GuarantorIndex)
+		if err != nil {
+			return 0, errors.Wrap(err, "couldn't retrieve guarantor")
+		}
+		amount := project.AmountOwed
+		if guarantor.FirstLossGuaranteeAmt < amount {
+			amount = guarantor.FirstLossGuaranteeAmt
+		}
+		return amount, CoverFirstLoss(project.Index, guarantor.U.Index, amount)
+	case BreachDisconnect:
+		project.Disconnected = true
+		project.notifyInvestors(notif.SendDisconnectionEmailI)
+		project.notifyGuarantor(notif.SendDisconnectionEmailG)
+		return 0, project.notifyRecipient(notif.SendDisconnectionEmail)
+	case BreachDefault:
+		project.Defaulted = true
+		project.notifyInvestors(notif.SendDefaultEmail)
+		project.notifyGuarantor(notif.SendDefaultEmail)
+		return 0, project.notifyRecipient(notif.SendDefaultEmail)
+	}
+	return 0, errors.New("breach action " + rule.Action + " not supported")
+}
+
+// chargeLateFee adds a late fee to the earliest installment on the project's schedule that is due and hasn't
+// been paid in full
+func (project *Project) chargeLateFee(fee float64, now int64) error {
+	for i := range project.Schedule {
+		installment := &project.Schedule[i]
+		if installment.DueDate > now {
+			break
+		}
+		if installment.Payment+installment.LateFee-installment.Paid >= scheduleEpsilon {
+			installment.LateFee += fee
+			project.AmountOwed += fee
+			return nil
+		}
+	}
+	return errors.New("no installment due to charge a late fee on")
+}
+
+// notifyRecipient sends a notification to the project's recipient
+func (project Project) notifyRecipient(send func(int, string) error) error {
+	recipient, err := RetrieveRecipient(project.RecipientIndex)
+	if err != nil {
+		return errors.Wrap(err, "couldn't retrieve recipient")
+	}
+	send(project.Index, recipient.U.Email)
+	return nil
+}
+
+// notifyInvestors sends a notification to the project's investors who have opted in to notifications
+func (project Project) notifyInvestors(send func(int, string) error) {
+	for _, i := range uniqueIndices(project.InvestorIndices) {
+		investor, err := RetrieveInvestor(i)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		if investor.U.Notification {
+			send(project.Index, investor.U.Email)
+		}
+	}
+}
+
+// notifyGuarantor sends a notification to the project's guarantor
+func (project Project) notifyGuarantor(send func(int, string) error) {
+	guarantor, err := RetrieveEntity(project.GuarantorIndex)
+	if err != nil {
+		log.Println("couldn't retrieve guarantor", err)
+		return
+	}
+	send(project.Index, guarantor.U.Email)
+}
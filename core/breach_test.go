@@ -0,0 +1,116 @@
+package core
+
+import (
+	"testing"
+)
+
+// checkBreachRecords checks the actions the breach policy of project 1 has taken so far
+func checkBreachRecords(t *testing.T, actions ...string) {
+	records, err := RetrieveProjectBreachRecords(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != len(actions) {
+		t.Fatalf("breach policy took %d actions, expected %v", len(records), actions)
+	}
+	for i, record := range records {
+		if record.Action != actions[i] || record.Error != "" {
+			t.Fatalf("unexpected breach record %v, expected action %s", record, actions[i])
+		}
+	}
+}
+
+func TestBreachPolicy(t *testing.T) {
+	teardown := setupPlatform(t)
+	defer teardown()
+
+	recipient, err := NewRecipient("recipient", testPwd, testSeedPwd, "Recipient")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	project := Project{
+		Index:           1,
+		RecipientIndex:  recipient.U.Index,
+		OriginatorIndex: 5,
+		AmountOwed:      100,
+		Schedule:        []Installment{{Number: 1, DueDate: 1, Payment: 100}},
+	}
+	err = project.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policy := `[{"MissedPeriods": 2, "Action": "remind"}, {"MissedPeriods": 3, "Action": "latefee", "Amount": 0.1},
+		{"MissedPeriods": 4, "Action": "disconnect"}]`
+	_, err = SetBreachPolicy(project.Index, 6, policy)
+	if err == nil {
+		t.Fatalf("breach policy set by an entity that isn't party to the project")
+	}
+	_, err = SetBreachPolicy(project.Index, 5, `[{"MissedPeriods": 1, "Action": "remind"}]`)
+	if err == nil {
+		t.Fatalf("rule that kicks in before a payment is missed accepted")
+	}
+	_, err = SetBreachPolicy(project.Index, 5, `[{"MissedPeriods": 2, "Action": "latefee"}]`)
+	if err == nil {
+		t.Fatalf("late fee rule without a fee accepted")
+	}
+	_, err = SetBreachPolicy(project.Index, 5, policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	project, err = RetrieveProject(project.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// rules run once as the breach escalates
+	err = project.EvaluateBreachPolicy(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = project.EvaluateBreachPolicy(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkBreachRecords(t, BreachRemind)
+
+	err = project.EvaluateBreachPolicy(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkBreachRecords(t, BreachRemind, BreachLateFee)
+	if project.AmountOwed != 110 || project.Schedule[0].LateFee != 10 {
+		t.Fatalf("late fee of 10 not charged, owed %f", project.AmountOwed)
+	}
+
+	err = project.EvaluateBreachPolicy(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkBreachRecords(t, BreachRemind, BreachLateFee, BreachDisconnect)
+	project, err = RetrieveProject(project.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !project.Disconnected {
+		t.Fatalf("project not disconnected")
+	}
+
+	// catching up reconnects the project and the policy starts over on the next breach
+	err = project.EvaluateBreachPolicy(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkBreachRecords(t, BreachRemind, BreachLateFee, BreachDisconnect, BreachReconnect)
+	if project.Disconnected || len(project.BreachRulesApplied) != 0 {
+		t.Fatalf("project not reconnected %v", project.BreachRulesApplied)
+	}
+
+	err = project.EvaluateBreachPolicy(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkBreachRecords(t, BreachRemind, BreachLateFee, BreachDisconnect, BreachReconnect, BreachRemind)
+}
@@ -0,0 +1,196 @@
+package core
+
+import (
+	"github.com/pkg/errors"
+	"log"
+	"strconv"
+
+	utils "github.com/Varunram/essentials/utils"
+
+	consts "github.com/YaleOpenLab/opensolar/consts"
+	oracle "github.com/YaleOpenLab/opensolar/oracle"
+)
+
+// the carbon job adds up the generation a project's meters have reported once the readings have settled and
+// multiplies it by the emission factor of the grid at the project's location to get the carbon the project has
+// avoided. The avoided carbon is attributed to investors by their share of the project at the time and the
+// sustainability metrics shown in the project's executive summary are updated.
+
+// investorShare is the share of a project held by an investor
+type investorShare struct {
+	Index     int
+	PublicKey string
+	Share     float64 // the investor's part of InvestorMap, the shares of all investors add up to 1
+}
+
+// investorShares returns the investors of a project along with their share of it
+func (project Project) investorShares() ([]investorShare, error) {
+	var arr []investorShare
+	var total float64
+	for _, share := range project.InvestorMap {
+		if share > 0 {
+			total += share
+		}
+	}
+	if total <= 0 {
+		return arr, errors.New("project doesn't have investors")
+	}
+
+	for _, invIndex := range uniqueIndices(project.InvestorIndices) {
+		investor, err := RetrieveInvestor(invIndex)
+		if err != nil {
+			return arr, errors.Wrap(err, "couldn't retrieve investor")
+		}
+		pubkey := investor.U.StellarWallet.PublicKey
+		share := project.InvestorMap[pubkey]
+		if share <= 0 {
+			continue
+		}
+		arr = append(arr, investorShare{Index: invIndex, PublicKey: pubkey, Share: share / total})
+	}
+	return arr, nil
+}
+
+// CarbonReport is the carbon a project has avoided
+type CarbonReport struct {
+	ProjectIndex   int
+	Location       string
+	EmissionFactor float64            // the current emission factor in tCO2e per MWh of the grid at the project's location
+	Generation     float64            // the generation in kWh counted so far
+	Avoided        float64            // the carbon in tCO2e avoided so far
+	Investors      map[string]float64 // publicKey: the avoided carbon in tCO2e attributed to the investor
+}
+
+// InvestorCarbon is the carbon avoided by a project attributed to an investor
+type InvestorCarbon struct {
+	ProjectIndex int
+	Avoided      float64 // tCO2e
+}
+
+// updateSustainabilityMetrics shows the carbon the project has avoided in its executive summary
+func (project *Project) updateSustainabilityMetrics(factor float64) {
+	if project.ExecutiveSummary.SustainabilityMetrics == nil {
+		project.ExecutiveSummary.SustainabilityMetrics = make(map[string]string)
+	}
+	metrics := project.ExecutiveSummary.SustainabilityMetrics
+	metrics["Carbon Drawdown"] = strconv.FormatFloat(project.CarbonAvoided, 'f', 3, 64) + " tCO2e"
+	metrics["Generation"] = strconv.FormatFloat(project.CarbonGeneration/1000, 'f', 3, 64) + " MWh"
+	metrics["Grid Emission Factor"] = strconv.FormatFloat(factor, 'f', 3, 64) + " tCO2e/MWh"
+}
+
+// AccountCarbon adds the carbon avoided by the generation of the readings the platform received before end to
+// the project and to its investors. It returns the carbon in tCO2e added
+func AccountCarbon(projIndex int, end int64) (float64, error) {
+	project, err := RetrieveProject(projIndex)
+	if err != nil {
+		return 0, errors.Wrap(err, "couldn't retrieve project")
+	}
+
+	if end <= project.CarbonCursor {
+		return 0, nil
+	}
+
+	readings, err := RetrieveReceivedMeterReadings(projIndex, project.CarbonCursor, end)
+	if err != nil {
+		return 0, errors.Wrap(err, "couldn't retrieve meter readings")
+	}
+
+	var generation float64
+	for _, reading := range readings {
+		if reading.GeneratedInterval > 0 {
+			generation += reading.GeneratedInterval
+		}
+	}
+
+	factor := oracle.EmissionFactor(project.State)
+	avoided := oracle.AvoidedEmissions(project.State, generation)
+
+	var investors []investorShare
+	if avoided > 0 {
+		investors, err = project.investorShares()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if project.CarbonAttribution == nil {
+		project.CarbonAttribution = make(map[string]float64)
+	}
+	for _, investor := range investors {
+		project.CarbonAttribution[investor.PublicKey] += avoided * investor.Share
+	}
+
+	project.CarbonCursor = end
+	project.CarbonGeneration += generation
+	project.CarbonAvoided += avoided
+	project.updateSustainabilityMetrics(factor)
+
+	// save the project first so that a failure can't count the same generation twice
+	err = project.Save()
+	if err != nil {
+		return 0, errors.Wrap(err, "couldn't save project")
+	}
+
+	for _, share := range investors {
+		investor, err := RetrieveInvestor(share.Index)
+		if err != nil {
+			log.Println("couldn't retrieve investor", share.Index, err)
+			continue
+		}
+		investor.CarbonAvoided += avoided * share.Share
+		err = investor.Save()
+		if err != nil {
+			log.Println("couldn't save avoided carbon of investor", share.Index, err)
+		}
+	}
+	return avoided, nil
+}
+
+// runCarbonJob adds up the carbon avoided by a project whose readings have settled
+func runCarbonJob(job *Job) error {
+	now := utils.Unix()
+	_, err := AccountCarbon(job.ProjectIndex, now-consts.MeterSettleInterval)
+	if err != nil {
+		return err
+	}
+	job.NextRun = now + consts.CarbonInterval
+	return nil
+}
+
+// RetrieveCarbonReport returns the carbon a project has avoided
+func RetrieveCarbonReport(projIndex int) (CarbonReport, error) {
+	var report CarbonReport
+	project, err := RetrieveProject(projIndex)
+	if err != nil {
+		return report, errors.Wrap(err, "couldn't retrieve project")
+	}
+
+	report.ProjectIndex = projIndex
+	report.Location = project.State
+	report.EmissionFactor = oracle.EmissionFactor(project.State)
+	report.Generation = project.CarbonGeneration
+	report.Avoided = project.CarbonAvoided
+	report.Investors = project.CarbonAttribution
+	return report, nil
+}
+
+// RetrieveInvestorCarbon returns the carbon attributed to an investor for each project
+func RetrieveInvestorCarbon(invIndex int) ([]InvestorCarbon, error) {
+	var arr []InvestorCarbon
+	investor, err := RetrieveInvestor(invIndex)
+	if err != nil {
+		return arr, errors.Wrap(err, "couldn't retrieve investor")
+	}
+
+	projects, err := RetrieveAllProjects()
+	if err != nil {
+		return arr, errors.Wrap(err, "couldn't retrieve projects")
+	}
+
+	for _, project := range projects {
+		if avoided, exists := project.CarbonAttribution[investor.U.StellarWallet.PublicKey]; exists {
+			arr = append(arr, InvestorCarbon{ProjectIndex: project.Index, Avoided: avoided})
+		}
+	}
+	return arr, nil
+}
@@ -0,0 +1,90 @@
+package core
+
+import (
+	"math"
+	"testing"
+
+	utils "github.com/Varunram/essentials/utils"
+)
+
+// checkCarbon checks an amount of avoided carbon up to rounding errors
+func checkCarbon(t *testing.T, name string, avoided float64, expected float64) {
+	if math.Abs(avoided-expected) > 1e-9 {
+		t.Fatalf("%s avoided %f tCO2e, expected %f", name, avoided, expected)
+	}
+}
+
+func TestAccountCarbon(t *testing.T) {
+	teardown := setupPlatform(t)
+	defer teardown()
+
+	recipient, privkey := meterProject(t)
+	investor2, err := NewInvestor("investor2", testPwd, testSeedPwd, "Investor 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	project, err := RetrieveProject(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	investor1, err := RetrieveInvestor(project.InvestorIndices[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	project.State = "Puerto Rico"
+	project.InvestorIndices = append(project.InvestorIndices, investor2.U.Index)
+	project.InvestorMap = map[string]float64{
+		investor1.U.StellarWallet.PublicKey: 300,
+		investor2.U.StellarWallet.PublicKey: 100,
+	}
+	err = project.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 2 MWh generated on a grid that emits 0.741 tCO2e per MWh
+	start := utils.Unix() - 4*3600
+	postReadings(t, privkey, recipient.U.Index, []MeterReading{
+		{Timestamp: start},
+		{Timestamp: start + 7200, Generated: 2000},
+	})
+
+	avoided, err := AccountCarbon(1, utils.Unix()+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkCarbon(t, "project", avoided, 1.482)
+	avoided, err = AccountCarbon(1, utils.Unix()+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkCarbon(t, "project counted twice", avoided, 0)
+
+	report, err := RetrieveCarbonReport(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Generation != 2000 || report.EmissionFactor != 0.741 {
+		t.Fatalf("unexpected carbon report %v", report)
+	}
+	checkCarbon(t, "project", report.Avoided, 1.482)
+
+	// the carbon is attributed to the investors pro rata to their share of the project
+	checkCarbon(t, "investor 1", report.Investors[investor1.U.StellarWallet.PublicKey], 1.1115)
+	checkCarbon(t, "investor 2", report.Investors[investor2.U.StellarWallet.PublicKey], 0.3705)
+
+	investor1, err = RetrieveInvestor(investor1.U.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkCarbon(t, "investor 1", investor1.CarbonAvoided, 1.1115)
+	carbon, err := RetrieveInvestorCarbon(investor2.U.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(carbon) != 1 || carbon[0].ProjectIndex != 1 {
+		t.Fatalf("unexpected carbon of investor 2 %v", carbon)
+	}
+	checkCarbon(t, "investor 2", carbon[0].Avoided, 0.3705)
+}
@@ -6,15 +6,10 @@ import (
 	"time"
 
 	utils "github.com/Varunram/essentials/utils"
-	xlm "github.com/YaleOpenLab/openx/chains/xlm"
-	assets "github.com/YaleOpenLab/openx/chains/xlm/assets"
-	escrow "github.com/YaleOpenLab/openx/chains/xlm/escrow"
-	issuer "github.com/YaleOpenLab/openx/chains/xlm/issuer"
 	wallet "github.com/YaleOpenLab/openx/chains/xlm/wallet"
 
 	consts "github.com/YaleOpenLab/opensolar/consts"
 	notif "github.com/YaleOpenLab/opensolar/notif"
-	oracle "github.com/YaleOpenLab/opensolar/oracle"
 )
 
 // contains one of the two main contracts behind opensolar
@@ -119,16 +114,21 @@ func preInvestmentCheck(projIndex int, invIndex int, invAmount float64, seed str
 		return project, errors.Wrap(err, "couldn't retrieve investor")
 	}
 
-	if !investor.CanInvest(invAmount) {
+	c, err := project.chain()
+	if err != nil {
+		return project, err
+	}
+
+	if !investor.CanInvest(c, invAmount) {
 		return project, errors.New("Investor has less balance than what is required to invest in this project")
 	}
 
-	pubkey, err := wallet.ReturnPubkey(seed)
+	pubkey, err := c.PublicKey(seed)
 	if err != nil {
 		return project, errors.Wrap(err, "could not get pubkey from seed")
 	}
 
-	if !xlm.AccountExists(pubkey) {
+	if !c.AccountExists(pubkey) {
 		return project, errors.New("account doesn't exist yet, quitting")
 	}
 	// check if investment amount is greater than or equal to the project requirements
@@ -136,31 +136,25 @@ func preInvestmentCheck(projIndex int, invIndex int, invAmount float64, seed str
 		return project, errors.New("Investment amount greater than what is required! Adjust your investment")
 	}
 
-	// the checks till here are common for all chains. The stuff following this is exclusive to stellar.
-	if project.Chain == "stellar" || project.Chain == "" {
-		if project.SeedAssetCode == "" && project.InvestorAssetCode == "" {
-			// this project does not have an asset issuer associated with it yet since there has been
-			// no seed round nor investment round
-			project.InvestorAssetCode = assets.AssetID(consts.InvestorAssetPrefix + project.Metadata) // creat investor asset
-			err = project.Save()
-			if err != nil {
-				return project, errors.Wrap(err, "couldn't save project")
-			}
-			err = issuer.InitIssuer(consts.OpenSolarIssuerDir, projIndex, consts.IssuerSeedPwd) // start an issuer with the projIndex
-			if err != nil {
-				return project, errors.Wrap(err, "error while initializing issuer")
-			}
-			err = issuer.FundIssuer(consts.OpenSolarIssuerDir, projIndex, consts.IssuerSeedPwd, consts.PlatformSeed) // fund the issuer since it needs to issue assets
-			if err != nil {
-				return project, errors.Wrap(err, "error while funding issuer")
-			}
+	if project.SeedAssetCode == "" && project.InvestorAssetCode == "" {
+		// this project does not have an asset issuer associated with it yet since there has been
+		// no seed round nor investment round
+		if project.InvestmentType == "equity" {
+			project.InvestorAssetCode = c.AssetID(project.roundName(consts.EquityAssetPrefix + project.Metadata)) // create share asset
+		} else {
+			project.InvestorAssetCode = c.AssetID(project.roundName(consts.InvestorAssetPrefix + project.Metadata)) // creat investor asset
+		}
+		err = project.Save()
+		if err != nil {
+			return project, errors.Wrap(err, "couldn't save project")
+		}
+		// start an issuer with the projIndex and fund it since it needs to issue assets
+		err = c.InitIssuer(consts.OpenSolarIssuerDir, projIndex, consts.IssuerSeedPwd, consts.PlatformSeed)
+		if err != nil {
+			return project, errors.Wrap(err, "error while initializing issuer")
 		}
-		return project, nil
-	} else if project.Chain == "algorand" {
-		return project, errors.Wrap(err, "algorand investments not supported yet, quitting")
-	} else {
-		return project, errors.Wrap(err, "chain not supported, quitting")
 	}
+	return project, nil
 }
 
 // SeedInvest is the seed investment function of the opensolar platform
@@ -175,34 +169,26 @@ func SeedInvest(projIndex int, invIndex int, invAmount float64, invSeed string)
 		return errors.New("project stage not at 1, you either have passed the seed stage or project is not at seed stage yet")
 	}
 
-	if project.InvestmentType != "munibond" {
-		return errors.New("investment models other than munibonds are not supported right now, quitting")
+	model, err := RetrieveInvestmentModel(project.InvestmentType)
+	if err != nil {
+		return err
 	}
 
 	if project.SeedInvestmentCap < invAmount {
 		return errors.New("you can't invest more than what the seed investment cap permits you to, quitting")
 	}
 
-	if project.Chain == "stellar" || project.Chain == "" {
-		if project.SeedAssetCode == "" {
-			log.Println("assigning a seed asset code")
-			project.SeedAssetCode = "SEEDASSET" // set this to a constant asset for now
-		}
-		err = MunibondInvest(consts.OpenSolarIssuerDir, invIndex, invSeed, invAmount, projIndex,
-			project.SeedAssetCode, project.TotalValue, project.SeedInvestmentFactor, true)
-		if err != nil {
-			return errors.Wrap(err, "error while investing")
-		}
-
-		err = project.updateAfterInvestment(invAmount, invIndex, true)
-		if err != nil {
-			return errors.Wrap(err, "couldn't update project after investment")
-		}
+	err = model.Invest(&project, invIndex, invSeed, invAmount, true)
+	if err != nil {
+		return errors.Wrap(err, "error while investing")
+	}
 
-		return err
+	err = project.updateAfterInvestment(invAmount, invIndex, true)
+	if err != nil {
+		return errors.Wrap(err, "couldn't update project after investment")
 	}
 
-	return errors.New("other chain investments not supported  yet")
+	return err
 }
 
 // Invest is the main invest function of the opensolar platform
@@ -215,34 +201,30 @@ func Invest(projIndex int, invIndex int, invAmount float64, invSeed string) erro
 		return errors.Wrap(err, "pre investment check failed")
 	}
 
-	if project.InvestmentType != "munibond" {
-		return errors.New("other investment models are not supported right now, quitting")
+	model, err := RetrieveInvestmentModel(project.InvestmentType)
+	if err != nil {
+		return err
 	}
 
-	if project.Chain == "stellar" || project.Chain == "" {
-		if project.Stage != 4 {
-			if project.Stage == 1 || project.Stage == 2 {
-				// investment is in seed stage
-				return SeedInvest(projIndex, invIndex, invAmount, invSeed)
-			}
-			return errors.New("project not at stage where it can solicit investment, quitting")
-		}
-
-		err = MunibondInvest(consts.OpenSolarIssuerDir, invIndex, invSeed, invAmount, projIndex,
-			project.InvestorAssetCode, project.TotalValue, 1, false)
-		if err != nil {
-			return errors.Wrap(err, "error while investing")
+	if project.Stage != 4 {
+		if project.Stage == 1 || project.Stage == 2 {
+			// investment is in seed stage
+			return SeedInvest(projIndex, invIndex, invAmount, invSeed)
 		}
+		return errors.New("project not at stage where it can solicit investment, quitting")
+	}
 
-		// once the investment is complete, update the project and store in the database
-		err = project.updateAfterInvestment(invAmount, invIndex, false)
-		if err != nil {
-			return errors.Wrap(err, "failed to update project after investment")
-		}
-		return err
+	err = model.Invest(&project, invIndex, invSeed, invAmount, false)
+	if err != nil {
+		return errors.Wrap(err, "error while investing")
 	}
 
-	return errors.New("other chain investments not supported right now")
+	// once the investment is complete, update the project and store in the database
+	err = project.updateAfterInvestment(invAmount, invIndex, false)
+	if err != nil {
+		return errors.Wrap(err, "failed to update project after investment")
+	}
+	return err
 }
 
 // updateAfterInvestment updates project db params after investment
@@ -254,11 +236,24 @@ func (project *Project) updateAfterInvestment(invAmount float64, invIndex int, s
 	}
 	project.InvestorIndices = append(project.InvestorIndices, invIndex)
 
+	startedRound := project.FundingDeadline == 0
+	if startedRound {
+		project.FundingDeadline = utils.Unix() + consts.FundingInterval
+	}
+
 	err = project.Save()
 	if err != nil {
 		return errors.Wrap(err, "couldn't save project")
 	}
 
+	if startedRound {
+		// schedule a job that refunds investors if the project isn't funded in time
+		_, err = ScheduleJob(JobFunding, project.Index, project.FundingDeadline, project.FundingDeadline)
+		if err != nil {
+			return errors.Wrap(err, "couldn't schedule funding job")
+		}
+	}
+
 	if project.MoneyRaised == project.TotalValue {
 		// project has raised the entire amount that it needs. Set lock to true and wait for recipient's response
 		project.Lock = true
@@ -273,14 +268,28 @@ func (project *Project) updateAfterInvestment(invAmount float64, invIndex int, s
 			return errors.Wrap(err, "error while sending notifications to recipient")
 		}
 
-		// start a goroutine that waits for the recipient to unlock the project
-		go sendRecipientAssets(project.Index)
+		// schedule a job that waits for the recipient to unlock the project
+		now := utils.Unix()
+		_, err = ScheduleJob(JobUnlock, project.Index, now, now+consts.LockInterval)
+		if err != nil {
+			return errors.Wrap(err, "couldn't schedule unlock job")
+		}
 	}
 
 	if len(project.InvestorMap) == 0 {
 		project.InvestorMap = make(map[string]float64)
 	}
 
+	c, err := project.chain()
+	if err != nil {
+		return err
+	}
+
+	issuerPubkey, _, err := c.IssuerSeed(consts.OpenSolarIssuerDir, project.Index, consts.IssuerSeedPwd)
+	if err != nil {
+		return errors.Wrap(err, "couldn't retrieve issuer")
+	}
+
 	log.Println("INVESTOR INDICES: ", project.InvestorIndices)
 	for i := range project.InvestorIndices {
 		investor, err := RetrieveInvestor(project.InvestorIndices[i])
@@ -290,24 +299,45 @@ func (project *Project) updateAfterInvestment(invAmount float64, invIndex int, s
 
 		log.Println(investor.U.StellarWallet.PublicKey, project.InvestorAssetCode)
 
+		address, err := c.Address(investor.U.StellarWallet.PublicKey)
+		if err != nil {
+			return errors.Wrap(err, "couldn't get address of investor")
+		}
+
 		var balance1 float64
 		var balance2 float64
 
-		balance1, err = xlm.GetAssetBalance(investor.U.StellarWallet.PublicKey, project.InvestorAssetCode)
+		balance1, err = c.Balance(address, project.InvestorAssetCode, issuerPubkey)
 		if err != nil {
 			balance1 = 0
 		}
 
-		balance2, err = xlm.GetAssetBalance(investor.U.StellarWallet.PublicKey, project.SeedAssetCode)
+		balance2, err = c.Balance(address, project.SeedAssetCode, issuerPubkey)
 		if err != nil {
 			balance2 = 0
 		}
 
 		balance := balance1 + balance2
 		percentageInvestment := balance / project.TotalValue
+		if project.InvestmentType == "equity" {
+			// equity investors hold shares and not investment assets worth their investment
+			percentageInvestment = balance / project.ShareCount
+		}
 		project.InvestorMap[investor.U.StellarWallet.PublicKey] = percentageInvestment
 	}
 
+	if seed {
+		investor, err := RetrieveInvestor(invIndex)
+		if err != nil {
+			return errors.Wrap(err, "error while retrieving investor, quitting")
+		}
+		if len(project.SeedInvestorMap) == 0 {
+			project.SeedInvestorMap = make(map[string]float64)
+		}
+		project.SeedInvestorIndices = append(project.SeedInvestorIndices, invIndex)
+		project.SeedInvestorMap[investor.U.StellarWallet.PublicKey] += invAmount / project.TotalValue
+	}
+
 	err = project.Save()
 	log.Println("INVESTOR MAP: ", project.InvestorMap)
 	if err != nil {
@@ -381,34 +411,51 @@ func UnlockProject(username string, pwhash string, projIndex int, seedpwd string
 	return nil
 }
 
-// sendRecipientAssets sends a recipient the debt asset and the payback asset associated with
-// the opensolar platform
-func sendRecipientAssets(projIndex int) error {
-	startTime := utils.Unix()
-	project, err := RetrieveProject(projIndex)
+// runUnlockJob checks whether the recipient has unlocked a funded project. Once the project is unlocked
+// the recipient is sent their assets, and if the job's deadline passes without the project being unlocked
+// investors are refunded
+func runUnlockJob(job *Job) error {
+	project, err := RetrieveProject(job.ProjectIndex)
 	if err != nil {
 		return errors.Wrap(err, "Couldn't retrieve project")
 	}
 
-	for utils.Unix()-startTime < consts.LockInterval {
-		log.Printf("WAITING FOR PROJECT %d TO BE UNLOCKED", projIndex)
-		project, err = RetrieveProject(projIndex)
-		if err != nil {
-			return errors.Wrap(err, "Couldn't retrieve project")
+	if project.Lock {
+		if utils.Unix() < job.Deadline {
+			log.Printf("WAITING FOR PROJECT %d TO BE UNLOCKED", job.ProjectIndex)
+			job.NextRun = utils.Unix() + consts.UnlockPollInterval
+			return nil
 		}
-		if !project.Lock {
-			log.Println("Project UNLOCKED IN LOOP")
-			break
+
+		log.Printf("PROJECT %d NOT UNLOCKED IN TIME, REFUNDING INVESTORS", job.ProjectIndex)
+		err = RefundProject(job.ProjectIndex, "the recipient did not accept the investment in time")
+		if err != nil {
+			return err
 		}
-		time.Sleep(10 * time.Second)
+		job.Status = JobDone
+		return nil
 	}
 
-	// lock is open, retrieve project and transfer assets
-	project, err = RetrieveProject(projIndex)
+	err = sendRecipientAssets(job.ProjectIndex)
+	if err != nil {
+		return err
+	}
+	job.Status = JobDone
+	return nil
+}
+
+// sendRecipientAssets sends a recipient the debt asset and the payback asset associated with
+// the opensolar platform once they have unlocked the project
+func sendRecipientAssets(projIndex int) error {
+	project, err := RetrieveProject(projIndex)
 	if err != nil {
 		return errors.Wrap(err, "Couldn't retrieve project")
 	}
 
+	if project.Lock {
+		return errors.New("project not unlocked yet")
+	}
+
 	recipient, err := RetrieveRecipient(project.RecipientIndex)
 	if err != nil {
 		return errors.Wrap(err, "couldn't retrieve recipienrt")
@@ -419,7 +466,12 @@ func sendRecipientAssets(projIndex int) error {
 		return errors.Wrap(err, "couldn't decrypt seed")
 	}
 
-	escrowPubkey, err := escrow.InitEscrow(project.Index, consts.EscrowPwd, recipient.U.StellarWallet.PublicKey, recpSeed, consts.PlatformSeed)
+	c, err := project.chain()
+	if err != nil {
+		return err
+	}
+
+	escrowPubkey, err := c.InitEscrow(project.Index, consts.EscrowPwd, recpSeed, consts.PlatformSeed)
 	if err != nil {
 		return errors.Wrap(err, "error while initializing issuer")
 	}
@@ -427,7 +479,14 @@ func sendRecipientAssets(projIndex int) error {
 	log.Println("successfully setup escrow")
 	project.EscrowPubkey = escrowPubkey
 	// transfer totalValue to the escrow, don't account for SeedMoneyRaised here
-	err = escrow.TransferFundsToEscrow(project.TotalValue, project.Index, project.EscrowPubkey, consts.PlatformSeed)
+	projIndexString, err := utils.ToString(project.Index)
+	if err != nil {
+		return err
+	}
+
+	code, issuer := c.Stablecoin()
+	_, err = c.SendAsset(code, issuer, project.EscrowPubkey, project.TotalValue, consts.PlatformSeed,
+		"Opensolar escrow: "+projIndexString)
 	if err != nil {
 		log.Println(err)
 		return errors.Wrap(err, "could not transfer funds to the escrow, quitting!")
@@ -436,14 +495,14 @@ func sendRecipientAssets(projIndex int) error {
 	log.Println("Transferred funds to escrow!")
 	project.LockPwd = "" // set lockpwd to nil immediately after retrieving seed
 
-	project.DebtAssetCode = assets.AssetID(consts.DebtAssetPrefix + project.Metadata)
-	project.PaybackAssetCode = assets.AssetID(consts.PaybackAssetPrefix + project.Metadata)
+	model, err := RetrieveInvestmentModel(project.InvestmentType)
+	if err != nil {
+		return err
+	}
 
-	// when sending debt and payback assets, account for SeedMoneyRaised
-	err = MunibondReceive(consts.OpenSolarIssuerDir, project.RecipientIndex, projIndex, project.DebtAssetCode,
-		project.PaybackAssetCode, project.EstimatedAcquisition, recpSeed, project.TotalValue+project.SeedMoneyRaised, project.PaybackPeriod)
+	err = model.Receive(&project, recpSeed)
 	if err != nil {
-		return errors.Wrap(err, "error while receiving assets from issuer on recipient's end")
+		return errors.Wrap(err, "error while handing over project to recipient")
 	}
 
 	err = project.updateProjectAfterAcceptance()
@@ -457,79 +516,118 @@ func sendRecipientAssets(projIndex int) error {
 // updateProjectAfterAcceptance updates the project after the recipient accepts investment into the project
 func (project *Project) updateProjectAfterAcceptance() error {
 
-	// update balleft with SeedMoneyRaised
-	project.BalLeft = project.TotalValue + project.SeedMoneyRaised // to carry over the extra returns that seed investors get
-	project.Stage = Stage5.Number                                  // set to stage 5 (after the raise is done, we need to wait for people to construct the solar panels)
+	project.Stage = Stage5.Number // set to stage 5 (after the raise is done, we need to wait for people to construct the solar panels)
+	if len(project.Schedule) != 0 {
+		project.BillingPeriodStart = utils.Unix()
+	}
 
 	err := project.Save()
 	if err != nil {
 		return errors.Wrap(err, "couldn't save project")
 	}
 
-	go monitorPaybacks(project.RecipientIndex, project.Index)
+	// every project earns RECs and avoids carbon for the energy it generates
+	_, err = ScheduleJob(JobREC, project.Index, utils.Unix()+consts.RECInterval, 0)
+	if err != nil {
+		return errors.Wrap(err, "couldn't schedule REC job")
+	}
+	_, err = ScheduleJob(JobCarbon, project.Index, utils.Unix()+consts.CarbonInterval, 0)
+	if err != nil {
+		return errors.Wrap(err, "couldn't schedule carbon job")
+	}
+
+	if len(project.Schedule) != 0 {
+		// only models with scheduled payments need to be monitored for missed paybacks and billed for energy
+		_, err = ScheduleJob(JobPayback, project.Index, utils.Unix(), 0)
+		if err != nil {
+			return errors.Wrap(err, "couldn't schedule payback job")
+		}
+		_, err = ScheduleJob(JobBilling, project.Index, project.BillingPeriodStart+project.billingPeriod(), 0)
+		if err != nil {
+			return errors.Wrap(err, "couldn't schedule billing job")
+		}
+	}
 	return nil
 }
 
 // Payback pays the platform back in STABLEUSD and DebtAsset and receives PaybackAssets
 // in return. Price to be paid per month depends on the electricity consumed by the recipient
-// in the particular time frame.
+// in the particular time frame, which is billed in the project's invoices.
 
-// Payback is called by the recipient when they choose to pay towards the project according to the payback interval
+// Payback is called by the recipient when they choose to pay towards the project according to the payback interval.
+// An error means that the recipient's funds haven't moved, once the payment goes through the payback is recorded
+// and the steps after it are carried out again later if they fail
 func Payback(recpIndex int, projIndex int, assetName string, amount float64, recipientSeed string) error {
+	return payback(recpIndex, projIndex, assetName, amount, recipientSeed, "")
+}
 
-	project, err := RetrieveProject(projIndex)
-	if err != nil {
-		return errors.Wrap(err, "Couldn't retrieve project")
+// PaybackWithKey pays back for a request that carries an idempotency key claimed with ClaimIdempotencyKey. The key
+// is marked done along with the hash of the payment as soon as the payment goes through, so that the payback isn't
+// carried out again even if the platform goes down before it has been distributed
+func PaybackWithKey(recpIndex int, projIndex int, assetName string, amount float64, recipientSeed string, key string) error {
+	if key == "" {
+		return errors.New("idempotency key can't be empty")
 	}
+	return payback(recpIndex, projIndex, assetName, amount, recipientSeed, key)
+}
 
-	if project.InvestmentType != "munibond" {
-		return errors.New("other investment models are not supported right now, quitting")
+// payback pays back towards a project and marks the idempotency key of the request done once the payment has
+// gone through, if there is one
+func payback(recpIndex int, projIndex int, assetName string, amount float64, recipientSeed string, key string) error {
+	// payments whose distribution failed earlier are distributed now that the recipient's seed is around
+	err := processPayments(projIndex, recipientSeed)
+	if err != nil {
+		log.Println("couldn't process earlier payments towards project", projIndex, err)
 	}
 
-	pct, err := MunibondPayback(consts.OpenSolarIssuerDir, recpIndex, amount,
-		recipientSeed, projIndex, assetName, project.InvestorIndices, project.TotalValue, project.EscrowPubkey)
+	project, err := RetrieveProject(projIndex)
 	if err != nil {
-		return errors.Wrap(err, "Error while paying back the issuer")
+		return errors.Wrap(err, "Couldn't retrieve project")
 	}
 
-	project.BalLeft -= (1 - pct) * amount // the balance left should be the percenteage paid towards the asset, which is the monthly bill. THe re st goes into  ownership
-	project.AmountOwed -= amount          // subtract the amount owed so we can track progress of payments in the monitorPaybacks loop
-	project.OwnershipShift += pct
-	project.DateLastPaid = utils.Unix()
+	model, err := RetrieveInvestmentModel(project.InvestmentType)
+	if err != nil {
+		return err
+	}
 
-	if project.BalLeft == 0 {
-		log.Println("YOU HAVE PAID OFF THIS ASSET's LOAN, TRANSFERRING FUTURE PAYMENTS AS OWNERSHIP ASSETS OWNERSHIP OF ASSET TO YOU")
-		project.Stage = 9
+	distributable, txhash, err := model.Payback(&project, recpIndex, assetName, amount, recipientSeed)
+	if err != nil {
+		return errors.Wrap(err, "Error while paying back towards project")
 	}
 
-	if project.OwnershipShift == 1 {
-		// the recipient has paid off the asset completely
-		log.Println("You now own the asset completely, there is no need to pay money in the future towards this particular project")
-		project.BalLeft = 0
-		project.AmountOwed = 0
+	// the recipient's payment has gone through, nothing after this point may fail the payback since the
+	// recipient would then be asked to pay again
+	if key != "" {
+		err = CompleteIdempotencyKey(recpIndex, key, txhash)
+		if err != nil {
+			log.Println("couldn't complete idempotency key", key, "of payment", txhash, err)
+		}
 	}
 
 	err = project.Save()
 	if err != nil {
-		return errors.Wrap(err, "coudln't save project")
+		log.Println("couldn't save project", projIndex, "after payment", txhash, err)
 	}
 
-	// TODO: we need to distribute funds which were paid back to all the parties involved, but we do so only for the investor here
-	err = DistributePayments(recipientSeed, project.EscrowPubkey, projIndex, amount)
+	payment, err := recordPayment(projIndex, recpIndex, txhash, amount, distributable)
 	if err != nil {
-		return errors.Wrap(err, "error while distributing payments")
+		log.Println("couldn't record payment", txhash, "towards project", projIndex, err)
 	}
 
+	// settle the invoices issued for the energy used by the recipient and distribute the payback to all the
+	// parties involved, investors are paid what the investment model wants to give them
+	payment.process(recipientSeed)
 	return nil
 }
 
-// DistributePayments distributes the return promised as part of the project back to investors and pays the other entities involved in the project
+// DistributePayments distributes the return promised as part of the project back to investors. The other entities
+// involved in the project are paid by the waterfall before investors
 func DistributePayments(recipientSeed string, escrowPubkey string, projIndex int, amount float64) error {
 	// this should act as the service which redistributes payments received out to the parties involved
-	// amount is the amount that we want to give back to the investors and other entities involved
+	// amount is the amount the project's investment model wants to give back to the investors
 	project, err := RetrieveProject(projIndex)
 	if err != nil {
-		errors.Wrap(err, "couldn't retrieve project, quitting!")
+		return errors.Wrap(err, "couldn't retrieve project, quitting!")
 	}
 
 	if project.EscrowLock {
@@ -537,24 +635,35 @@ func DistributePayments(recipientSeed string, escrowPubkey string, projIndex int
 		return errors.New("project escrow locked, can't send funds")
 	}
 
-	var fixedRate float64
-	if project.InterestRate != 0 {
-		fixedRate = project.InterestRate
-	} else {
-		fixedRate = 0.05 // 5 % interest rate if rate not defined
+	model, err := RetrieveInvestmentModel(project.InvestmentType)
+	if err != nil {
+		return err
+	}
+
+	return model.Distribute(&project, recipientSeed, amount)
+}
+
+// PayDividends is called by the recipient of an equity project to pay out net revenue earned by the
+// project to its shareholders
+func PayDividends(recpIndex int, projIndex int, netRevenue float64, recipientSeed string) error {
+	project, err := RetrieveProject(projIndex)
+	if err != nil {
+		return errors.Wrap(err, "couldn't retrieve project")
 	}
 
-	amountGivenBack := fixedRate * amount
-	for pubkey, percentage := range project.InvestorMap {
-		txAmount := percentage * amountGivenBack
-		// here we send funds from the 2of2 multisig. Platform signs by default
-		err = escrow.SendFundsFromEscrow(project.EscrowPubkey, pubkey, recipientSeed, consts.PlatformSeed, txAmount, "returns")
-		if err != nil {
-			log.Println("Error with payback to pubkey: ", pubkey, err) // if there is an error with one payback, doesn't mean we should stop and wait for the others
-			continue
-		}
+	if project.InvestmentType != "equity" {
+		return errors.New("dividends can only be paid on equity projects")
 	}
-	return nil
+
+	if project.RecipientIndex != recpIndex {
+		return errors.New("recipient not associated with project")
+	}
+
+	if project.Stage < Stage5.Number {
+		return errors.New("project has not been funded yet")
+	}
+
+	return Payback(recpIndex, projIndex, "", netRevenue, recipientSeed)
 }
 
 // CalculatePayback calculates the amount of payback assets that must be issued in relation
@@ -564,91 +673,56 @@ func (project Project) CalculatePayback(amount float64) float64 {
 	return amountPB
 }
 
-// monitorPaybacks monitors whether the user is paying back regularly towards the given project
-// thread has to be isolated since if this fails, we stop tracking paybacks by the recipient.
-func monitorPaybacks(recpIndex int, projIndex int) {
-	for {
-		project, err := RetrieveProject(projIndex)
-		if err != nil {
-			log.Println("Couldn't retrieve project")
-			time.Sleep(consts.OneWeekInSecond)
-		}
+// runPaybackJob checks whether the recipient is paying back regularly towards the project and runs again
+// after PaybackCheckInterval. The job is done once the project has been paid off
+func runPaybackJob(job *Job) error {
+	project, err := RetrieveProject(job.ProjectIndex)
+	if err != nil {
+		return errors.Wrap(err, "Couldn't retrieve project")
+	}
 
-		recipient, err := RetrieveRecipient(recpIndex)
-		if err != nil {
-			log.Println("Couldn't retrieve recipient")
-			time.Sleep(consts.OneWeekInSecond)
-		}
+	if project.Stage == 9 || project.OwnershipShift >= 1 {
+		job.Status = JobDone
+		return nil
+	}
 
-		guarantor, err := RetrieveEntity(project.GuarantorIndex)
-		if err != nil {
-			log.Println("couldn't retrieve guarantor")
-			time.Sleep(consts.OneWeekInSecond)
-		}
+	// payments that couldn't be applied to invoices when they were made are applied now
+	err = processPayments(job.ProjectIndex, "")
+	if err != nil {
+		log.Println("couldn't process payments towards project", job.ProjectIndex, err)
+	}
 
-		period := float64(time.Duration(project.PaybackPeriod) * consts.OneWeekInSecond) // in seconds due to the const
-		if period == 0 {
-			period = 1 // for the test suite
-		}
-		timeElapsed := utils.Unix() - project.DateLastPaid // this would be in seconds (unix time)
-		factor := float64(timeElapsed) / period
-		project.AmountOwed += factor * oracle.MonthlyBill() // add the amount owed only if the time elapsed is more than one payback period
-		// Reputation adjustments based on payback history:
-		if factor <= 1 {
-			// don't do anything since the user has been paying back regularly
-			log.Println("User: ", recipient.U.Email, "is on track paying towards order: ", projIndex)
-			// maybe even update reputation here on a fractional basis depending on a user's timely payments
-		} else if factor > NormalThreshold && factor < AlertThreshold {
-			// person has not paid back for one-two consecutive period, send gentle reminder
-			notif.SendNicePaybackAlertEmail(projIndex, recipient.U.Email)
-			time.Sleep(consts.OneWeekInSecond)
-		} else if factor >= SternAlertThreshold && factor < DisconnectionThreshold {
-			// person has not paid back for four consecutive cycles, send reminder
-			notif.SendSternPaybackAlertEmail(projIndex, recipient.U.Email)
-			for _, i := range project.InvestorIndices {
-				// send an email to recipients to assure them that we're on the issue and will be acting
-				// soon if the recipient fails to pay again.
-				investor, err := RetrieveInvestor(i)
-				if err != nil {
-					log.Println(err)
-					continue
-				}
-				if investor.U.Notification {
-					notif.SendSternPaybackAlertEmailI(projIndex, investor.U.Email)
-				}
-			}
-			notif.SendSternPaybackAlertEmailG(projIndex, guarantor.U.Email)
-			time.Sleep(consts.OneWeekInSecond)
-		} else if factor >= DisconnectionThreshold {
-			// send a disconnection notice to the recipient and let them know we have redirected
-			// power towards the grid.
-			for _, i := range project.InvestorIndices {
-				// send an email to investors on teller disconnection
-				investor, err := RetrieveInvestor(i)
-				if err != nil {
-					log.Println(err)
-					time.Sleep(consts.OneWeekInSecond)
-					continue
-				}
-				if investor.U.Notification {
-					notif.SendDisconnectionEmailI(projIndex, investor.U.Email)
-				}
-			}
-			// we have sent out emails to investors, send an email to the guarantor and cover first losses of investors
-			notif.SendDisconnectionEmailG(projIndex, guarantor.U.Email)
-			err = CoverFirstLoss(project.Index, guarantor.U.Index, project.AmountOwed)
-			if err != nil {
-				log.Println(err)
-				time.Sleep(consts.OneWeekInSecond)
-				continue
-			}
-		}
+	err = checkPaybacks(project)
+	if err != nil {
+		return err
+	}
+
+	job.NextRun = utils.Unix() + consts.PaybackCheckInterval // check every week to check progress on payments
+	return nil
+}
+
+// checkPaybacks checks whether the user is paying back regularly towards the given project and runs the
+// project's breach policy depending on the number of installments that they have missed
+func checkPaybacks(project Project) error {
+	// factor is the number of installments on the project's schedule that are due and haven't been paid in full
+	var factor int
+	project.AmountOwed, factor = project.AmountDue(utils.Unix())
+	err := project.Save()
+	if err != nil {
+		return errors.Wrap(err, "couldn't save project")
+	}
 
-		time.Sleep(consts.OneWeekInSecond) // poll every week to check progress on payments
+	if factor <= NormalThreshold {
+		// don't do anything since the user has been paying back regularly
+		log.Println("Recipient: ", project.RecipientIndex, "is on track paying towards order: ", project.Index)
+		// maybe even update reputation here on a fractional basis depending on a user's timely payments
 	}
+
+	return project.EvaluateBreachPolicy(factor)
 }
 
-// addWaterfallAccount adds a waterfall account that the recipient must payback towards
+// addWaterfallAccount adds a waterfall account that the recipient must payback towards. Waterfall accounts hold
+// operations and insurance costs and are paid before anyone else
 func addWaterfallAccount(projIndex int, pubkey string, amount float64) error {
 	project, err := RetrieveProject(projIndex)
 	if err != nil {
@@ -688,18 +762,16 @@ func CoverFirstLoss(projIndex int, entityIndex int, amount float64) error {
 		return errors.Wrap(err, "could not decrypt seed, quitting!")
 	}
 
-	var txhash string
+	c, err := project.chain()
+	if err != nil {
+		return err
+	}
+
 	// we have the escrow's pubkey, transfer funds to the escrow
-	if !consts.Mainnet {
-		_, txhash, err = assets.SendAsset(consts.StablecoinCode, consts.StablecoinPublicKey, project.EscrowPubkey, amount, seed, "first loss guarantee")
-		if err != nil {
-			return errors.Wrap(err, "could not transfer asset to escrow, quitting")
-		}
-	} else {
-		_, txhash, err = assets.SendAsset(consts.AnchorUSDCode, consts.AnchorUSDAddress, project.EscrowPubkey, amount, seed, "first loss guarantee")
-		if err != nil {
-			return errors.Wrap(err, "could not transfer asset to escrow, quitting")
-		}
+	code, issuer := c.Stablecoin()
+	txhash, err := c.SendAsset(code, issuer, project.EscrowPubkey, amount, seed, "first loss guarantee")
+	if err != nil {
+		return errors.Wrap(err, "could not transfer asset to escrow, quitting")
 	}
 
 	log.Println("txhash of guarantor kick in:", txhash)
@@ -12,6 +12,12 @@ func (contractor *Entity) Propose(panelSize string, totalValue float64, location
 	var pc Project
 	var err error
 
+	// projects that are being auctioned only take bids on their auction
+	_, err = RetrieveProjectAuction(projectIndex)
+	if err == nil {
+		return pc, errors.New("project is being auctioned, bid on its auction instead")
+	}
+
 	indexCheck, err := RetrieveAllProjects()
 	if err != nil {
 		return pc, errors.New("Projects could not be retrieved!")
@@ -31,6 +37,7 @@ func (contractor *Entity) Propose(panelSize string, totalValue float64, location
 	pc.Stage = 2
 	pc.AuctionType = auctionType
 	pc.ContractorIndex = contractor.U.Index
+	pc.ProposedTo = projectIndex
 	err = pc.Save()
 	return pc, err
 }
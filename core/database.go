@@ -21,11 +21,59 @@ var ProjectsBucket = []byte("Projects")
 // ContractorBucket is the contractor bucket
 var ContractorBucket = []byte("Contractors")
 
+// AuctionBucket is the bucket where contract auctions are stored
+var AuctionBucket = []byte("Auctions")
+
+// OpenAuctionBucket is the bucket where auctions with a bidding window are stored
+var OpenAuctionBucket = []byte("OpenAuctions")
+
+// BidBucket is the bucket where bids placed on auctions are stored
+var BidBucket = []byte("Bids")
+
+// JobBucket is the bucket where scheduled jobs are stored
+var JobBucket = []byte("Jobs")
+
+// BreachBucket is the bucket where actions taken by breach policies are recorded
+var BreachBucket = []byte("Breaches")
+
+// DistributionBucket is the bucket where the distributions of paybacks are stored
+var DistributionBucket = []byte("Distributions")
+
+// PaymentBucket is the bucket where paybacks that have gone through are stored
+var PaymentBucket = []byte("Payments")
+
+// ReadingBucket is the bucket where energy readings reported for projects are stored
+var ReadingBucket = []byte("Readings")
+
+// InvoiceBucket is the bucket where invoices issued to recipients are stored
+var InvoiceBucket = []byte("Invoices")
+
+// MeterBucket is the bucket where meter readings are stored as a time series, with a nested bucket for every
+// project and device
+var MeterBucket = []byte("MeterReadings")
+
+// IdempotencyBucket is the bucket where the idempotency keys of requests made by tellers are stored
+var IdempotencyBucket = []byte("IdempotencyKeys")
+
+// RECBucket is the bucket where renewable energy certificates issued for projects are stored
+var RECBucket = []byte("RECs")
+
+// RetirementBucket is the bucket where retirements of renewable energy certificates are stored
+var RetirementBucket = []byte("RECRetirements")
+
+// OfferBucket is the bucket where offers to sell investor assets on the secondary market are stored
+var OfferBucket = []byte("MarketOffers")
+
+// TradeBucket is the bucket where trades made on the secondary market are stored
+var TradeBucket = []byte("MarketTrades")
+
 // CreateHomeDir creates a home directory
 func CreateHomeDir() {
 	edb.CreateDirs(consts.HomeDir, consts.DbDir, consts.OpenSolarIssuerDir)
 	log.Println("creating db at: ", consts.DbDir+consts.DbName)
-	db, err := edb.CreateDB(consts.DbDir+consts.DbName, ProjectsBucket, InvestorBucket, RecipientBucket, ContractorBucket)
+	db, err := edb.CreateDB(consts.DbDir+consts.DbName, ProjectsBucket, InvestorBucket, RecipientBucket, ContractorBucket, AuctionBucket,
+		OpenAuctionBucket, BidBucket, JobBucket, BreachBucket, DistributionBucket, PaymentBucket, ReadingBucket, InvoiceBucket,
+		MeterBucket, IdempotencyBucket, RECBucket, RetirementBucket, OfferBucket, TradeBucket)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -1,10 +1,13 @@
 package core
 
 import (
+	"bytes"
 	"encoding/json"
 	"github.com/pkg/errors"
+	"sort"
 
 	edb "github.com/Varunram/essentials/database"
+	"github.com/boltdb/bolt"
 
 	consts "github.com/YaleOpenLab/opensolar/consts"
 )
@@ -53,6 +56,71 @@ func (a *Entity) Save() error {
 	return edb.Save(consts.DbDir+consts.DbName, ContractorBucket, a, a.U.Index)
 }
 
+// Save saves a ContractAuction's details
+func (a *ContractAuction) Save() error {
+	return edb.Save(consts.DbDir+consts.DbName, AuctionBucket, a, a.Index)
+}
+
+// Save saves an Auction's details
+func (a *Auction) Save() error {
+	return edb.Save(consts.DbDir+consts.DbName, OpenAuctionBucket, a, a.Index)
+}
+
+// Save saves a Bid's details
+func (a *Bid) Save() error {
+	return edb.Save(consts.DbDir+consts.DbName, BidBucket, a, a.Index)
+}
+
+// Save saves a job in the database
+func (a *Job) Save() error {
+	return edb.Save(consts.DbDir+consts.DbName, JobBucket, a, a.Index)
+}
+
+// Save saves a breach record in the database
+func (a *BreachRecord) Save() error {
+	return edb.Save(consts.DbDir+consts.DbName, BreachBucket, a, a.Index)
+}
+
+// Save saves a distribution in the database
+func (a *Distribution) Save() error {
+	return edb.Save(consts.DbDir+consts.DbName, DistributionBucket, a, a.Index)
+}
+
+// Save saves a payment in the database
+func (a *Payment) Save() error {
+	return edb.Save(consts.DbDir+consts.DbName, PaymentBucket, a, a.Index)
+}
+
+// Save saves an energy reading in the database
+func (a *EnergyReading) Save() error {
+	return edb.Save(consts.DbDir+consts.DbName, ReadingBucket, a, a.Index)
+}
+
+// Save saves an invoice in the database
+func (a *Invoice) Save() error {
+	return edb.Save(consts.DbDir+consts.DbName, InvoiceBucket, a, a.Index)
+}
+
+// Save saves a REC issuance in the database
+func (a *RECIssuance) Save() error {
+	return edb.Save(consts.DbDir+consts.DbName, RECBucket, a, a.Index)
+}
+
+// Save saves a REC retirement in the database
+func (a *RECRetirement) Save() error {
+	return edb.Save(consts.DbDir+consts.DbName, RetirementBucket, a, a.Index)
+}
+
+// Save saves an offer of the secondary market in the database
+func (a *Offer) Save() error {
+	return edb.Save(consts.DbDir+consts.DbName, OfferBucket, a, a.Index)
+}
+
+// Save saves a trade of the secondary market in the database
+func (a *Trade) Save() error {
+	return edb.Save(consts.DbDir+consts.DbName, TradeBucket, a, a.Index)
+}
+
 // RetrieveInvestor retrieves an investor from the database
 func RetrieveInvestor(key int) (Investor, error) {
 	var inv Investor
@@ -372,3 +440,657 @@ func SaveRecPlatformContract(projIndex int, hash string) error {
 	a.StageData = append(a.StageData, hash)
 	return a.Save()
 }
+
+// RetrieveContractAuction retrieves the auction held for the project at key from the database
+func RetrieveContractAuction(key int) (ContractAuction, error) {
+	var auction ContractAuction
+	x, err := edb.Retrieve(consts.DbDir+consts.DbName, AuctionBucket, key)
+	if err != nil {
+		return auction, errors.Wrap(err, "error while retrieving key from bucket")
+	}
+
+	err = json.Unmarshal(x, &auction)
+	return auction, err
+}
+
+// RetrieveAuction retrieves an auction from the database
+func RetrieveAuction(key int) (Auction, error) {
+	var auction Auction
+	x, err := edb.Retrieve(consts.DbDir+consts.DbName, OpenAuctionBucket, key)
+	if err != nil {
+		return auction, errors.Wrap(err, "error while retrieving key from bucket")
+	}
+
+	err = json.Unmarshal(x, &auction)
+	return auction, err
+}
+
+// RetrieveAllAuctions retrieves all auctions from the database
+func RetrieveAllAuctions() ([]Auction, error) {
+	var arr []Auction
+	x, err := edb.RetrieveAllKeys(consts.DbDir+consts.DbName, OpenAuctionBucket)
+	if err != nil {
+		return arr, errors.Wrap(err, "error while retrieving all keys")
+	}
+
+	for _, value := range x {
+		var temp Auction
+		err = json.Unmarshal(value, &temp)
+		if err != nil {
+			return arr, errors.New("could not unmarshal json")
+		}
+		arr = append(arr, temp)
+	}
+
+	return arr, nil
+}
+
+// RetrieveProjectAuction retrieves the auction that is still running on a specific project
+func RetrieveProjectAuction(projIndex int) (Auction, error) {
+	var auction Auction
+	auctions, err := RetrieveAllAuctions()
+	if err != nil {
+		return auction, err
+	}
+
+	for _, elem := range auctions {
+		if elem.ProjectIndex == projIndex && !elem.Closed {
+			return elem, nil
+		}
+	}
+
+	return auction, errors.New("no running auction on project")
+}
+
+// RetrieveBid retrieves a bid from the database
+func RetrieveBid(key int) (Bid, error) {
+	var bid Bid
+	x, err := edb.Retrieve(consts.DbDir+consts.DbName, BidBucket, key)
+	if err != nil {
+		return bid, errors.Wrap(err, "error while retrieving key from bucket")
+	}
+
+	err = json.Unmarshal(x, &bid)
+	return bid, err
+}
+
+// RetrieveAllBids retrieves all bids from the database
+func RetrieveAllBids() ([]Bid, error) {
+	var arr []Bid
+	x, err := edb.RetrieveAllKeys(consts.DbDir+consts.DbName, BidBucket)
+	if err != nil {
+		return arr, errors.Wrap(err, "error while retrieving all keys")
+	}
+
+	for _, value := range x {
+		var temp Bid
+		err = json.Unmarshal(value, &temp)
+		if err != nil {
+			return arr, errors.New("could not unmarshal json")
+		}
+		arr = append(arr, temp)
+	}
+
+	return arr, nil
+}
+
+// RetrieveAuctionBids retrieves all bids placed on a specific auction
+func RetrieveAuctionBids(auctionIndex int) ([]Bid, error) {
+	var arr []Bid
+	bids, err := RetrieveAllBids()
+	if err != nil {
+		return arr, err
+	}
+
+	for _, bid := range bids {
+		if bid.AuctionIndex == auctionIndex {
+			arr = append(arr, bid)
+		}
+	}
+
+	return arr, nil
+}
+
+// RetrieveJob retrieves a job from the database
+func RetrieveJob(key int) (Job, error) {
+	var job Job
+	x, err := edb.Retrieve(consts.DbDir+consts.DbName, JobBucket, key)
+	if err != nil {
+		return job, errors.Wrap(err, "error while retrieving key from bucket")
+	}
+
+	err = json.Unmarshal(x, &job)
+	return job, err
+}
+
+// RetrieveAllJobs retrieves all jobs from the database
+func RetrieveAllJobs() ([]Job, error) {
+	var arr []Job
+	x, err := edb.RetrieveAllKeys(consts.DbDir+consts.DbName, JobBucket)
+	if err != nil {
+		return arr, errors.Wrap(err, "error while retrieving all keys")
+	}
+
+	for _, value := range x {
+		var temp Job
+		err = json.Unmarshal(value, &temp)
+		if err != nil {
+			return arr, errors.New("could not unmarshal json")
+		}
+		arr = append(arr, temp)
+	}
+
+	return arr, nil
+}
+
+// RetrieveProjectJobs retrieves all jobs that have been scheduled for a specific project
+func RetrieveProjectJobs(projIndex int) ([]Job, error) {
+	var arr []Job
+	jobs, err := RetrieveAllJobs()
+	if err != nil {
+		return arr, err
+	}
+
+	for _, job := range jobs {
+		if job.ProjectIndex == projIndex {
+			arr = append(arr, job)
+		}
+	}
+
+	return arr, nil
+}
+
+// RetrieveAllBreachRecords retrieves all breach records from the database
+func RetrieveAllBreachRecords() ([]BreachRecord, error) {
+	var arr []BreachRecord
+	x, err := edb.RetrieveAllKeys(consts.DbDir+consts.DbName, BreachBucket)
+	if err != nil {
+		return arr, errors.Wrap(err, "error while retrieving all keys")
+	}
+
+	for _, value := range x {
+		var temp BreachRecord
+		err = json.Unmarshal(value, &temp)
+		if err != nil {
+			return arr, errors.New("could not unmarshal json")
+		}
+		arr = append(arr, temp)
+	}
+
+	return arr, nil
+}
+
+// RetrieveProjectBreachRecords retrieves the actions taken by the breach policy of a specific project
+func RetrieveProjectBreachRecords(projIndex int) ([]BreachRecord, error) {
+	var arr []BreachRecord
+	records, err := RetrieveAllBreachRecords()
+	if err != nil {
+		return arr, err
+	}
+
+	for _, record := range records {
+		if record.ProjectIndex == projIndex {
+			arr = append(arr, record)
+		}
+	}
+
+	return arr, nil
+}
+
+// RetrieveAllDistributions retrieves all distributions from the database
+func RetrieveAllDistributions() ([]Distribution, error) {
+	var arr []Distribution
+	x, err := edb.RetrieveAllKeys(consts.DbDir+consts.DbName, DistributionBucket)
+	if err != nil {
+		return arr, errors.Wrap(err, "error while retrieving all keys")
+	}
+
+	for _, value := range x {
+		var temp Distribution
+		err = json.Unmarshal(value, &temp)
+		if err != nil {
+			return arr, errors.New("could not unmarshal json")
+		}
+		arr = append(arr, temp)
+	}
+
+	return arr, nil
+}
+
+// RetrieveProjectDistributions retrieves the distributions of all paybacks towards a specific project
+func RetrieveProjectDistributions(projIndex int) ([]Distribution, error) {
+	var arr []Distribution
+	distributions, err := RetrieveAllDistributions()
+	if err != nil {
+		return arr, err
+	}
+
+	for _, distribution := range distributions {
+		if distribution.ProjectIndex == projIndex {
+			arr = append(arr, distribution)
+		}
+	}
+
+	return arr, nil
+}
+
+// RetrieveAllPayments retrieves all payments from the database
+func RetrieveAllPayments() ([]Payment, error) {
+	var arr []Payment
+	x, err := edb.RetrieveAllKeys(consts.DbDir+consts.DbName, PaymentBucket)
+	if err != nil {
+		return arr, errors.Wrap(err, "error while retrieving all keys")
+	}
+
+	for _, value := range x {
+		var temp Payment
+		err = json.Unmarshal(value, &temp)
+		if err != nil {
+			return arr, errors.New("could not unmarshal json")
+		}
+		arr = append(arr, temp)
+	}
+
+	return arr, nil
+}
+
+// RetrieveProjectPayments retrieves the payments made towards a specific project
+func RetrieveProjectPayments(projIndex int) ([]Payment, error) {
+	var arr []Payment
+	payments, err := RetrieveAllPayments()
+	if err != nil {
+		return arr, err
+	}
+
+	for _, payment := range payments {
+		if payment.ProjectIndex == projIndex {
+			arr = append(arr, payment)
+		}
+	}
+
+	return arr, nil
+}
+
+// RetrieveAllEnergyReadings retrieves all energy readings from the database
+func RetrieveAllEnergyReadings() ([]EnergyReading, error) {
+	var arr []EnergyReading
+	x, err := edb.RetrieveAllKeys(consts.DbDir+consts.DbName, ReadingBucket)
+	if err != nil {
+		return arr, errors.Wrap(err, "error while retrieving all keys")
+	}
+
+	for _, value := range x {
+		var temp EnergyReading
+		err = json.Unmarshal(value, &temp)
+		if err != nil {
+			return arr, errors.New("could not unmarshal json")
+		}
+		arr = append(arr, temp)
+	}
+
+	return arr, nil
+}
+
+// RetrieveProjectEnergyReadings retrieves the energy readings of a specific project between start and end
+func RetrieveProjectEnergyReadings(projIndex int, start int64, end int64) ([]EnergyReading, error) {
+	var arr []EnergyReading
+	readings, err := RetrieveAllEnergyReadings()
+	if err != nil {
+		return arr, err
+	}
+
+	for _, reading := range readings {
+		if reading.ProjectIndex == projIndex && reading.Timestamp >= start && reading.Timestamp < end {
+			arr = append(arr, reading)
+		}
+	}
+
+	return arr, nil
+}
+
+// RetrieveInvoice retrieves a specific invoice from the database
+func RetrieveInvoice(key int) (Invoice, error) {
+	var invoice Invoice
+	x, err := edb.Retrieve(consts.DbDir+consts.DbName, InvoiceBucket, key)
+	if err != nil {
+		return invoice, errors.Wrap(err, "error while retrieving key from bucket")
+	}
+
+	err = json.Unmarshal(x, &invoice)
+	return invoice, err
+}
+
+// RetrieveAllInvoices retrieves all invoices from the database
+func RetrieveAllInvoices() ([]Invoice, error) {
+	var arr []Invoice
+	x, err := edb.RetrieveAllKeys(consts.DbDir+consts.DbName, InvoiceBucket)
+	if err != nil {
+		return arr, errors.Wrap(err, "error while retrieving all keys")
+	}
+
+	for _, value := range x {
+		var temp Invoice
+		err = json.Unmarshal(value, &temp)
+		if err != nil {
+			return arr, errors.New("could not unmarshal json")
+		}
+		arr = append(arr, temp)
+	}
+
+	return arr, nil
+}
+
+// RetrieveProjectInvoices retrieves the invoices issued for a specific project
+func RetrieveProjectInvoices(projIndex int) ([]Invoice, error) {
+	var arr []Invoice
+	invoices, err := RetrieveAllInvoices()
+	if err != nil {
+		return arr, err
+	}
+
+	for _, invoice := range invoices {
+		if invoice.ProjectIndex == projIndex {
+			arr = append(arr, invoice)
+		}
+	}
+
+	return arr, nil
+}
+
+// RetrieveInvoicesByTxHash retrieves the invoices that a payment with a specific transaction hash was applied to
+func RetrieveInvoicesByTxHash(txhash string) ([]Invoice, error) {
+	var arr []Invoice
+	invoices, err := RetrieveAllInvoices()
+	if err != nil {
+		return arr, err
+	}
+
+	for _, invoice := range invoices {
+		for _, payment := range invoice.Payments {
+			if payment.TxHash == txhash {
+				arr = append(arr, invoice)
+				break
+			}
+		}
+	}
+
+	return arr, nil
+}
+
+// RetrieveMeterReadings retrieves the readings of a device of a project taken between start and end
+func RetrieveMeterReadings(projIndex int, deviceId string, start int64, end int64) ([]MeterReading, error) {
+	var arr []MeterReading
+	seriesKey, err := meterSeriesKey(projIndex, deviceId)
+	if err != nil {
+		return arr, err
+	}
+
+	db, err := OpenDB()
+	if err != nil {
+		return arr, errors.Wrap(err, "couldn't open database")
+	}
+	defer db.Close()
+
+	err = db.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket(MeterBucket)
+		if root == nil {
+			return nil
+		}
+		series := root.Bucket(seriesKey)
+		if series == nil {
+			return nil
+		}
+		arr, err = meterReadingsBetween(series, start, end)
+		return err
+	})
+	return arr, err
+}
+
+// RetrieveProjectMeterReadings retrieves the readings of all devices of a project taken between start and end
+func RetrieveProjectMeterReadings(projIndex int, start int64, end int64) ([]MeterReading, error) {
+	return retrieveProjectMeterReadings(projIndex, start, end, meterReadingsBetween)
+}
+
+// RetrieveReceivedMeterReadings retrieves the readings of all devices of a project that the platform received
+// between start and end, whenever they were taken
+func RetrieveReceivedMeterReadings(projIndex int, start int64, end int64) ([]MeterReading, error) {
+	return retrieveProjectMeterReadings(projIndex, start, end, meterReadingsReceived)
+}
+
+// retrieveProjectMeterReadings retrieves the readings between start and end from every series of a project
+// using between to pick the readings of a series
+func retrieveProjectMeterReadings(projIndex int, start int64, end int64,
+	between func(*bolt.Bucket, int64, int64) ([]MeterReading, error)) ([]MeterReading, error) {
+	var arr []MeterReading
+	prefix, err := meterSeriesKey(projIndex, "")
+	if err != nil {
+		return arr, err
+	}
+
+	db, err := OpenDB()
+	if err != nil {
+		return arr, errors.Wrap(err, "couldn't open database")
+	}
+	defer db.Close()
+
+	err = db.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket(MeterBucket)
+		if root == nil {
+			return nil
+		}
+		c := root.Cursor()
+		for key, _ := c.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, _ = c.Next() {
+			series := root.Bucket(key)
+			if series == nil {
+				continue
+			}
+			readings, err := between(series, start, end)
+			if err != nil {
+				return err
+			}
+			arr = append(arr, readings...)
+		}
+		return nil
+	})
+
+	sort.SliceStable(arr, func(i, j int) bool {
+		return arr[i].Timestamp < arr[j].Timestamp
+	})
+	return arr, err
+}
+
+// meterReadingsBetween returns the readings in a series taken between start and end
+func meterReadingsBetween(series *bolt.Bucket, start int64, end int64) ([]MeterReading, error) {
+	var arr []MeterReading
+	if start < 0 {
+		start = 0
+	}
+
+	c := series.Cursor()
+	endKey := meterTimestampKey(end)
+	for key, value := c.Seek(meterTimestampKey(start)); key != nil && bytes.Compare(key, endKey) < 0; key, value = c.Next() {
+		reading, err := decodeMeterReading(value)
+		if err != nil {
+			return arr, err
+		}
+		arr = append(arr, reading)
+	}
+	return arr, nil
+}
+
+// meterReadingsReceived returns the readings in a series that the platform received between start and end.
+// Readings can arrive in any order, so the whole series is searched
+func meterReadingsReceived(series *bolt.Bucket, start int64, end int64) ([]MeterReading, error) {
+	var arr []MeterReading
+	err := series.ForEach(func(key []byte, value []byte) error {
+		reading, err := decodeMeterReading(value)
+		if err != nil {
+			return err
+		}
+		if reading.ReceivedAt >= start && reading.ReceivedAt < end {
+			arr = append(arr, reading)
+		}
+		return nil
+	})
+	return arr, err
+}
+
+// RetrieveAllRECIssuances retrieves all REC issuances from the database
+func RetrieveAllRECIssuances() ([]RECIssuance, error) {
+	var arr []RECIssuance
+	x, err := edb.RetrieveAllKeys(consts.DbDir+consts.DbName, RECBucket)
+	if err != nil {
+		return arr, errors.Wrap(err, "error while retrieving all keys")
+	}
+
+	for _, value := range x {
+		var temp RECIssuance
+		err = json.Unmarshal(value, &temp)
+		if err != nil {
+			return arr, errors.New("could not unmarshal json")
+		}
+		arr = append(arr, temp)
+	}
+
+	return arr, nil
+}
+
+// RetrieveProjectRECIssuances retrieves the RECs issued for a specific project in the order they were issued
+func RetrieveProjectRECIssuances(projIndex int) ([]RECIssuance, error) {
+	var arr []RECIssuance
+	issuances, err := RetrieveAllRECIssuances()
+	if err != nil {
+		return arr, err
+	}
+
+	for _, issuance := range issuances {
+		if issuance.ProjectIndex == projIndex {
+			arr = append(arr, issuance)
+		}
+	}
+
+	return arr, nil
+}
+
+// RetrieveAllRECRetirements retrieves all REC retirements from the database
+func RetrieveAllRECRetirements() ([]RECRetirement, error) {
+	var arr []RECRetirement
+	x, err := edb.RetrieveAllKeys(consts.DbDir+consts.DbName, RetirementBucket)
+	if err != nil {
+		return arr, errors.Wrap(err, "error while retrieving all keys")
+	}
+
+	for _, value := range x {
+		var temp RECRetirement
+		err = json.Unmarshal(value, &temp)
+		if err != nil {
+			return arr, errors.New("could not unmarshal json")
+		}
+		arr = append(arr, temp)
+	}
+
+	return arr, nil
+}
+
+// RetrieveProjectRECRetirements retrieves the retirements of the RECs of a specific project
+func RetrieveProjectRECRetirements(projIndex int) ([]RECRetirement, error) {
+	var arr []RECRetirement
+	retirements, err := RetrieveAllRECRetirements()
+	if err != nil {
+		return arr, err
+	}
+
+	for _, retirement := range retirements {
+		if retirement.ProjectIndex == projIndex {
+			arr = append(arr, retirement)
+		}
+	}
+
+	return arr, nil
+}
+
+// RetrieveOffer retrieves an offer of the secondary market from the database
+func RetrieveOffer(key int) (Offer, error) {
+	var offer Offer
+	x, err := edb.Retrieve(consts.DbDir+consts.DbName, OfferBucket, key)
+	if err != nil {
+		return offer, errors.Wrap(err, "error while retrieving key from bucket")
+	}
+
+	err = json.Unmarshal(x, &offer)
+	return offer, err
+}
+
+// RetrieveAllOffers retrieves all offers of the secondary market from the database
+func RetrieveAllOffers() ([]Offer, error) {
+	var arr []Offer
+	x, err := edb.RetrieveAllKeys(consts.DbDir+consts.DbName, OfferBucket)
+	if err != nil {
+		return arr, errors.Wrap(err, "error while retrieving all keys")
+	}
+
+	for _, value := range x {
+		var temp Offer
+		err = json.Unmarshal(value, &temp)
+		if err != nil {
+			return arr, errors.New("could not unmarshal json")
+		}
+		arr = append(arr, temp)
+	}
+
+	return arr, nil
+}
+
+// RetrieveProjectOffers retrieves the offers to sell the investor assets of a specific project
+func RetrieveProjectOffers(projIndex int) ([]Offer, error) {
+	var arr []Offer
+	offers, err := RetrieveAllOffers()
+	if err != nil {
+		return arr, err
+	}
+
+	for _, offer := range offers {
+		if offer.ProjectIndex == projIndex {
+			arr = append(arr, offer)
+		}
+	}
+
+	return arr, nil
+}
+
+// RetrieveAllTrades retrieves all trades of the secondary market from the database
+func RetrieveAllTrades() ([]Trade, error) {
+	var arr []Trade
+	x, err := edb.RetrieveAllKeys(consts.DbDir+consts.DbName, TradeBucket)
+	if err != nil {
+		return arr, errors.Wrap(err, "error while retrieving all keys")
+	}
+
+	for _, value := range x {
+		var temp Trade
+		err = json.Unmarshal(value, &temp)
+		if err != nil {
+			return arr, errors.New("could not unmarshal json")
+		}
+		arr = append(arr, temp)
+	}
+
+	return arr, nil
+}
+
+// RetrieveProjectTrades retrieves the trades of the investor assets of a specific project
+func RetrieveProjectTrades(projIndex int) ([]Trade, error) {
+	var arr []Trade
+	trades, err := RetrieveAllTrades()
+	if err != nil {
+		return arr, err
+	}
+
+	for _, trade := range trades {
+		if trade.ProjectIndex == projIndex {
+			arr = append(arr, trade)
+		}
+	}
+
+	return arr, nil
+}
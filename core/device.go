@@ -0,0 +1,151 @@
+package core
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"github.com/pkg/errors"
+	"strings"
+
+	utils "github.com/Varunram/essentials/utils"
+
+	consts "github.com/YaleOpenLab/opensolar/consts"
+)
+
+// every teller generates an ed25519 keypair along with its device id and registers the public key with the
+// platform. Since anyone who knows the recipient's password can register a key, the first key registered for
+// a recipient is only trusted once a platform admin has approved it. After that the key can only be rotated by
+// a request signed with it or revoked by an admin, so data and payments signed with it can be told apart from
+// ones made up with the credentials in the teller's config.
+
+// DeviceMessage returns the message a device signs for a request, made up of the request's parameters
+func DeviceMessage(params ...string) []byte {
+	return []byte(strings.Join(params, ","))
+}
+
+// checkDevice checks that a device id and public key can be registered
+func checkDevice(deviceId string, pubkey string) error {
+	if deviceId == "" {
+		return errors.New("device id can't be empty")
+	}
+
+	key, err := hex.DecodeString(pubkey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return errors.New("device public key is not a hex encoded ed25519 key")
+	}
+	return nil
+}
+
+// RegisterDevice registers a device and its public key with the recipient. The first device registered is kept
+// pending until a platform admin approves it with ApproveDevice. Once a key is approved only devices holding
+// the same key can be registered
+func (a *Recipient) RegisterDevice(deviceId string, pubkey string) error {
+	err := checkDevice(deviceId, pubkey)
+	if err != nil {
+		return err
+	}
+
+	if a.DevicePubkey != "" {
+		if a.DevicePubkey != pubkey {
+			return errors.New("a different device key is already registered for the recipient")
+		}
+		a.DeviceId = deviceId
+		return a.Save()
+	}
+
+	a.PendingDeviceId = deviceId
+	a.PendingDevicePubkey = pubkey
+	return a.Save()
+}
+
+// ApproveDevice approves the device that is pending on a recipient so that its signatures are trusted. The
+// admin passes the key they expect the device to hold, which they should have received from the installer of
+// the device and not through the platform
+func ApproveDevice(recpIndex int, pubkey string) (Recipient, error) {
+	recipient, err := RetrieveRecipient(recpIndex)
+	if err != nil {
+		return recipient, errors.Wrap(err, "couldn't retrieve recipient")
+	}
+
+	if recipient.PendingDevicePubkey == "" {
+		return recipient, errors.New("no device pending approval on recipient")
+	}
+	if recipient.PendingDevicePubkey != pubkey {
+		return recipient, errors.New("pending device key doesn't match the key being approved")
+	}
+
+	recipient.DeviceId = recipient.PendingDeviceId
+	recipient.DevicePubkey = recipient.PendingDevicePubkey
+	recipient.PendingDeviceId = ""
+	recipient.PendingDevicePubkey = ""
+	return recipient, recipient.Save()
+}
+
+// RotateDevice replaces the recipient's device key with a new one. The request has to be signed at unix time
+// timestamp by the device that holds the key being replaced
+func (a *Recipient) RotateDevice(deviceId string, pubkey string, timestamp int64, signature string) error {
+	err := checkDevice(deviceId, pubkey)
+	if err != nil {
+		return err
+	}
+
+	err = a.VerifyDeviceRequest(a.DeviceId, timestamp, signature, "rotate", deviceId, pubkey)
+	if err != nil {
+		return errors.Wrap(err, "rotation not signed by the registered device")
+	}
+
+	a.DeviceId = deviceId
+	a.DevicePubkey = pubkey
+	return a.Save()
+}
+
+// RevokeDevice revokes the recipient's device key along with any device pending approval, eg when the device
+// has been lost or stolen. A new device has to be approved again before its signatures are trusted
+func RevokeDevice(recpIndex int) (Recipient, error) {
+	recipient, err := RetrieveRecipient(recpIndex)
+	if err != nil {
+		return recipient, errors.Wrap(err, "couldn't retrieve recipient")
+	}
+
+	recipient.DeviceId = ""
+	recipient.DevicePubkey = ""
+	recipient.PendingDeviceId = ""
+	recipient.PendingDevicePubkey = ""
+	return recipient, recipient.Save()
+}
+
+// VerifyDeviceSignature checks whether signature is a signature of message by the recipient's registered device
+func (a Recipient) VerifyDeviceSignature(deviceId string, message []byte, signature string) error {
+	if a.DevicePubkey == "" || a.DeviceId != deviceId {
+		return errors.New("device not registered to recipient")
+	}
+
+	key, err := hex.DecodeString(a.DevicePubkey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return errors.New("registered device key is invalid")
+	}
+
+	sig, err := hex.DecodeString(signature)
+	if err != nil {
+		return errors.Wrap(err, "signature is not hex encoded")
+	}
+
+	if !ed25519.Verify(ed25519.PublicKey(key), message, sig) {
+		return errors.New("signature doesn't match the registered device key")
+	}
+	return nil
+}
+
+// VerifyDeviceRequest checks the signature of a request the device made at unix time timestamp. Requests that
+// are too old are rejected so that a signed request can't be replayed later on
+func (a Recipient) VerifyDeviceRequest(deviceId string, timestamp int64, signature string, params ...string) error {
+	now := utils.Unix()
+	if timestamp < now-consts.MeterClockSkew || timestamp > now+consts.MeterClockSkew {
+		return errors.New("request timestamp is too far from the platform's clock")
+	}
+
+	timestampString, err := utils.ToString(timestamp)
+	if err != nil {
+		return err
+	}
+	return a.VerifyDeviceSignature(deviceId, DeviceMessage(append(params, timestampString)...), signature)
+}
@@ -0,0 +1,114 @@
+package core
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"testing"
+
+	utils "github.com/Varunram/essentials/utils"
+)
+
+// deviceKey generates a device keypair and returns it along with the hex encoded public key
+func deviceKey(t *testing.T) (ed25519.PrivateKey, string) {
+	pubkey, privkey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return privkey, hex.EncodeToString(pubkey)
+}
+
+// signDeviceRequest signs the params of a request made now with a device key
+func signDeviceRequest(t *testing.T, privkey ed25519.PrivateKey, params ...string) (int64, string) {
+	timestamp := utils.Unix()
+	timestampString, err := utils.ToString(timestamp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return timestamp, hex.EncodeToString(ed25519.Sign(privkey, DeviceMessage(append(params, timestampString)...)))
+}
+
+func TestDeviceApproval(t *testing.T) {
+	teardown := setupPlatform(t)
+	defer teardown()
+
+	recipient, err := NewRecipient("recipient", testPwd, testSeedPwd, "Recipient")
+	if err != nil {
+		t.Fatal(err)
+	}
+	privkey, pubkey := deviceKey(t)
+	message := DeviceMessage("reading")
+	signature := hex.EncodeToString(ed25519.Sign(privkey, message))
+
+	// a key registered with only the recipient's password isn't trusted until an admin approves it
+	err = recipient.RegisterDevice("device1", pubkey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = recipient.VerifyDeviceSignature("device1", message, signature)
+	if err == nil {
+		t.Fatalf("signature of a device pending approval accepted")
+	}
+
+	_, otherPubkey := deviceKey(t)
+	_, err = ApproveDevice(recipient.U.Index, otherPubkey)
+	if err == nil {
+		t.Fatalf("approved a key that isn't pending")
+	}
+	recipient, err = ApproveDevice(recipient.U.Index, pubkey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = recipient.VerifyDeviceSignature("device1", message, signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = recipient.RegisterDevice("device2", otherPubkey)
+	if err == nil {
+		t.Fatalf("approved device key replaced with only the recipient's password")
+	}
+
+	// the key can only be rotated by a request signed with it
+	newPrivkey, newPubkey := deviceKey(t)
+	timestamp, rotation := signDeviceRequest(t, newPrivkey, "rotate", "device2", newPubkey)
+	err = recipient.RotateDevice("device2", newPubkey, timestamp, rotation)
+	if err == nil {
+		t.Fatalf("device key rotated by a request signed with the new key")
+	}
+	timestamp, rotation = signDeviceRequest(t, privkey, "rotate", "device2", newPubkey)
+	err = recipient.RotateDevice("device2", newPubkey, timestamp, rotation)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recipient, err = RetrieveRecipient(recipient.U.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = recipient.VerifyDeviceSignature("device2", message, hex.EncodeToString(ed25519.Sign(newPrivkey, message)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = recipient.VerifyDeviceSignature("device1", message, signature)
+	if err == nil {
+		t.Fatalf("signature of the rotated out key accepted")
+	}
+
+	// a revoked device isn't trusted and the next device needs to be approved again
+	recipient, err = RevokeDevice(recipient.U.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = recipient.VerifyDeviceSignature("device2", message, hex.EncodeToString(ed25519.Sign(newPrivkey, message)))
+	if err == nil {
+		t.Fatalf("signature of a revoked device accepted")
+	}
+	err = recipient.RegisterDevice("device3", otherPubkey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recipient.DevicePubkey != "" || recipient.PendingDevicePubkey != otherPubkey {
+		t.Fatalf("device registered after revocation trusted without approval %v", recipient.DevicePubkey)
+	}
+}
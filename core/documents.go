@@ -0,0 +1,95 @@
+package core
+
+import (
+	"github.com/pkg/errors"
+	"strconv"
+
+	consts "github.com/YaleOpenLab/opensolar/consts"
+	store "github.com/YaleOpenLab/opensolar/store"
+)
+
+// the documents of a project, like its PPA or REC agreement, are added to the content store and their hashes
+// are shown on the project documents page. Since the hashes are CIDs, anyone can fetch a document from ipfs
+// and check that it is the one the parties agreed upon.
+
+// DocumentKinds are the kinds of documents a project has, in the order they appear on the documents page
+var DocumentKinds = []string{"overview", "ppa", "recagreement", "guarantor", "contractor", "stakeholder",
+	"communityenergy", "financial"}
+
+// field returns the hash of a kind of document
+func (h *HashHelper) field(kind string) (*string, error) {
+	switch kind {
+	case "overview":
+		return &h.LegalProjectOverviewHash, nil
+	case "ppa":
+		return &h.LegalPPAHash, nil
+	case "recagreement":
+		return &h.LegalRECAgreementHash, nil
+	case "guarantor":
+		return &h.GuarantorAgreementHash, nil
+	case "contractor":
+		return &h.ContractorAgreementHash, nil
+	case "stakeholder":
+		return &h.StakeholderAgreementHash, nil
+	case "communityenergy":
+		return &h.CommunityEnergyHash, nil
+	case "financial":
+		return &h.FinancialReportingHash, nil
+	default:
+		return nil, errors.New("document kind " + kind + " not supported")
+	}
+}
+
+// AddProjectDocument adds a document to the content store and records its hash on the project. Only the
+// originator, guarantor, contractor and main developer of the project can add documents
+func AddProjectDocument(projIndex int, entityIndex int, kind string, data []byte) (string, error) {
+	project, err := RetrieveProject(projIndex)
+	if err != nil {
+		return "", errors.Wrap(err, "couldn't retrieve project")
+	}
+
+	if entityIndex != project.OriginatorIndex && entityIndex != project.GuarantorIndex &&
+		entityIndex != project.ContractorIndex && entityIndex != project.MainDeveloperIndex {
+		return "", errors.New("entity isn't part of the project, can't add documents")
+	}
+
+	field, err := project.Hashes.field(kind)
+	if err != nil {
+		return "", err
+	}
+
+	if len(data) == 0 || len(data) > consts.MaxDocumentSize {
+		return "", errors.New("document must be between 1 and " + strconv.Itoa(consts.MaxDocumentSize) + " bytes")
+	}
+
+	hash, err := store.Add(data)
+	if err != nil {
+		return "", errors.Wrap(err, "couldn't add document to store")
+	}
+
+	*field = hash
+	return hash, project.Save()
+}
+
+// RetrieveProjectDocument returns a document of a project and its hash
+func RetrieveProjectDocument(projIndex int, kind string) ([]byte, string, error) {
+	project, err := RetrieveProject(projIndex)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "couldn't retrieve project")
+	}
+
+	field, err := project.Hashes.field(kind)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if *field == "" {
+		return nil, "", errors.New("project doesn't have a " + kind + " document")
+	}
+
+	data, err := store.Get(*field)
+	if err != nil {
+		return nil, *field, errors.Wrap(err, "couldn't get document from store")
+	}
+	return data, *field, nil
+}
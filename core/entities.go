@@ -3,14 +3,15 @@ package core
 import (
 	"encoding/json"
 	"github.com/pkg/errors"
+	"strconv"
 	"strings"
 
 	edb "github.com/Varunram/essentials/database"
 	utils "github.com/Varunram/essentials/utils"
-	xlm "github.com/YaleOpenLab/openx/chains/xlm"
 	wallet "github.com/YaleOpenLab/openx/chains/xlm/wallet"
 	openx "github.com/YaleOpenLab/openx/database"
 
+	chain "github.com/YaleOpenLab/opensolar/chain"
 	consts "github.com/YaleOpenLab/opensolar/consts"
 	notif "github.com/YaleOpenLab/opensolar/notif"
 )
@@ -242,41 +243,23 @@ func AgreeToContractConditions(contractHash string, projIndex string,
 	}
 
 	messageHash := "CONTRACTHASH" + strings.ToUpper(utils.SHA3hash(message))
-	firstPart := messageHash[:28] // higher limit is not included in the slice
-	secondPart := messageHash[28:56]
-	thirdPart := messageHash[56:84]
-	fourthPart := messageHash[84:112]
-	fifthPart := messageHash[112:140]
 
-	timestamp := float64(utils.Unix())
-
-	_, firstHash, err := xlm.SendXLM(user.StellarWallet.PublicKey, timestamp, seed, firstPart)
-	if err != nil {
-		return errors.Wrap(err, "couldn't send tx 1")
-	}
-
-	_, secondHash, err := xlm.SendXLM(user.StellarWallet.PublicKey, timestamp, seed, secondPart)
-	if err != nil {
-		return errors.Wrap(err, "couldn't send tx 2")
-	}
-
-	_, thirdHash, err := xlm.SendXLM(user.StellarWallet.PublicKey, timestamp, seed, thirdPart)
+	c, err := chain.Get(chain.StellarName)
 	if err != nil {
-		return errors.Wrap(err, "couldn't send tx 3")
+		return err
 	}
 
-	_, fourthHash, err := xlm.SendXLM(user.StellarWallet.PublicKey, timestamp, seed, fourthPart)
-	if err != nil {
-		return errors.Wrap(err, "couldn't send tx 4")
-	}
-
-	_, fifthHash, err := xlm.SendXLM(user.StellarWallet.PublicKey, timestamp, seed, fifthPart)
-	if err != nil {
-		return errors.Wrap(err, "couldn't send tx 5")
+	// each 28 character part of the hash is recorded in a transaction of its own
+	var hashes [5]string
+	for i := range hashes {
+		hashes[i], err = c.Record(seed, messageHash[i*28:(i+1)*28])
+		if err != nil {
+			return errors.Wrap(err, "couldn't send tx "+strconv.Itoa(i+1))
+		}
 	}
 
 	if user.Notification {
-		notif.SendContractNotification(firstHash, secondHash, thirdHash, fourthHash, fifthHash, user.Email)
+		notif.SendContractNotification(hashes[0], hashes[1], hashes[2], hashes[3], hashes[4], user.Email)
 	}
 
 	return nil
@@ -0,0 +1,148 @@
+package core
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+
+	utils "github.com/Varunram/essentials/utils"
+	"github.com/boltdb/bolt"
+
+	consts "github.com/YaleOpenLab/opensolar/consts"
+)
+
+// tellers that lose connectivity queue their requests and send them again once they're back online. A request
+// that changes state, like a payback, carries an idempotency key so that a request whose response got lost on
+// the way back to the teller isn't carried out twice. Keys are claimed before the request is carried out and
+// marked done as soon as the request can't be undone anymore, eg once a payback's payment has gone through, or
+// released if it fails before that so that it can be retried. A key that stays pending for longer than
+// IdempotencyPendingTimeout belongs to a request that never finished, eg since the platform went down while
+// carrying it out. Whether its funds moved isn't known, so it is reported as stale and never carried out again.
+
+const (
+	// IdempotencyPending is the status of a key whose request is being carried out
+	IdempotencyPending = "pending"
+
+	// IdempotencyDone is the status of a key whose request has been carried out
+	IdempotencyDone = "done"
+
+	// IdempotencyStale is the status of a key whose request has been pending for longer than
+	// IdempotencyPendingTimeout and needs to be reconciled by hand
+	IdempotencyStale = "stale"
+)
+
+// idempotencyRecord is what is stored for a claimed key
+type idempotencyRecord struct {
+	Status  string // the status of the key
+	Claimed int64  // unix time at which the key was last claimed
+	TxHash  string // the hash of the transaction that carried out the request, if any
+}
+
+// idempotencyKey returns the key a recipient's idempotency key is stored under
+func idempotencyKey(recpIndex int, key string) ([]byte, error) {
+	if key == "" {
+		return nil, errors.New("idempotency key can't be empty")
+	}
+	recpIndexString, err := utils.ToString(recpIndex)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(recpIndexString + "/" + key), nil
+}
+
+// parseIdempotencyRecord parses a stored record. Keys used to be stored as their bare status, those records are
+// treated as claimed a long time ago
+func parseIdempotencyRecord(x []byte) idempotencyRecord {
+	var record idempotencyRecord
+	err := json.Unmarshal(x, &record)
+	if err != nil || record.Status == "" {
+		return idempotencyRecord{Status: string(x)}
+	}
+	return record
+}
+
+// putIdempotencyRecord stores the record of a key
+func putIdempotencyRecord(b *bolt.Bucket, dbKey []byte, status string, txhash string) error {
+	x, err := json.Marshal(idempotencyRecord{Status: status, Claimed: utils.Unix(), TxHash: txhash})
+	if err != nil {
+		return err
+	}
+	return b.Put(dbKey, x)
+}
+
+// ClaimIdempotencyKey claims a recipient's idempotency key before the request it belongs to is carried out. It
+// returns an empty status if the key was claimed and the status of the key if it has been claimed before. Keys
+// that have been pending for longer than IdempotencyPendingTimeout are returned as stale
+func ClaimIdempotencyKey(recpIndex int, key string) (string, error) {
+	dbKey, err := idempotencyKey(recpIndex, key)
+	if err != nil {
+		return "", err
+	}
+
+	db, err := OpenDB()
+	if err != nil {
+		return "", errors.Wrap(err, "couldn't open database")
+	}
+	defer db.Close()
+
+	var status string
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(IdempotencyBucket)
+		if err != nil {
+			return err
+		}
+		if x := b.Get(dbKey); x != nil {
+			record := parseIdempotencyRecord(x)
+			status = record.Status
+			if record.Status == IdempotencyPending && utils.Unix()-record.Claimed > consts.IdempotencyPendingTimeout {
+				status = IdempotencyStale
+			}
+			return nil
+		}
+		return putIdempotencyRecord(b, dbKey, IdempotencyPending, "")
+	})
+	return status, err
+}
+
+// CompleteIdempotencyKey marks the request of a claimed key as carried out by the transaction with the passed hash
+func CompleteIdempotencyKey(recpIndex int, key string, txhash string) error {
+	dbKey, err := idempotencyKey(recpIndex, key)
+	if err != nil {
+		return err
+	}
+
+	db, err := OpenDB()
+	if err != nil {
+		return errors.Wrap(err, "couldn't open database")
+	}
+	defer db.Close()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(IdempotencyBucket)
+		if err != nil {
+			return err
+		}
+		return putIdempotencyRecord(b, dbKey, IdempotencyDone, txhash)
+	})
+}
+
+// ReleaseIdempotencyKey releases a claimed key whose request failed so that it can be retried
+func ReleaseIdempotencyKey(recpIndex int, key string) error {
+	dbKey, err := idempotencyKey(recpIndex, key)
+	if err != nil {
+		return err
+	}
+
+	db, err := OpenDB()
+	if err != nil {
+		return errors.Wrap(err, "couldn't open database")
+	}
+	defer db.Close()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(IdempotencyBucket)
+		if b == nil {
+			return nil
+		}
+		return b.Delete(dbKey)
+	})
+}
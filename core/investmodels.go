@@ -0,0 +1,230 @@
+package core
+
+import (
+	"github.com/pkg/errors"
+	"log"
+
+	utils "github.com/Varunram/essentials/utils"
+
+	consts "github.com/YaleOpenLab/opensolar/consts"
+)
+
+// the contract flow doesn't call into a specific investment model. Instead it looks up the model registered
+// for the project's InvestmentType and calls it at each point where money changes hands. New models can be
+// added by implementing InvestmentModel and registering it with RegisterInvestmentModel.
+
+// InvestmentModel defines the handlers that an investment model needs to provide
+type InvestmentModel interface {
+	// Invest sends the model's assets to an investor who invests invAmount in the project
+	Invest(project *Project, invIndex int, invSeed string, invAmount float64, seed bool) error
+	// Receive hands over a funded project to its recipient
+	Receive(project *Project, recpSeed string) error
+	// Payback takes a payment from the recipient and returns the amount that should be distributed along with
+	// the hash of the transaction that carried the payment. It must not return an error once the payment has
+	// gone through, since the recipient would then be asked to pay again
+	Payback(project *Project, recpIndex int, assetName string, amount float64, recipientSeed string) (float64, string, error)
+	// Distribute pays out an amount that has been paid towards the project to the parties involved
+	Distribute(project *Project, recipientSeed string, amount float64) error
+}
+
+// investmentModels is the registry of investment models keyed by the project's InvestmentType
+var investmentModels = make(map[string]InvestmentModel)
+
+// RegisterInvestmentModel registers an investment model that projects can refer to by name
+func RegisterInvestmentModel(name string, model InvestmentModel) {
+	investmentModels[name] = model
+}
+
+// RetrieveInvestmentModel returns the investment model registered with the passed name
+func RetrieveInvestmentModel(name string) (InvestmentModel, error) {
+	model, ok := investmentModels[name]
+	if !ok {
+		return nil, errors.New("investment model " + name + " not supported, quitting")
+	}
+	return model, nil
+}
+
+func init() {
+	RegisterInvestmentModel("munibond", munibondModel{})
+	RegisterInvestmentModel("equity", equityModel{})
+}
+
+// munibondModel is a municipal bond. Investors are paid back their principal along with interest
+// according to the project's payment schedule
+type munibondModel struct{}
+
+// Invest invests in a munibond project. Seed investors receive the seed asset
+func (munibondModel) Invest(project *Project, invIndex int, invSeed string, invAmount float64, seed bool) error {
+	c, err := project.chain()
+	if err != nil {
+		return err
+	}
+
+	if seed {
+		if project.SeedAssetCode == "" {
+			log.Println("assigning a seed asset code")
+			project.SeedAssetCode = project.roundName("SEEDASSET") // set this to a constant asset for now
+		}
+		return MunibondInvest(c, consts.OpenSolarIssuerDir, invIndex, invSeed, invAmount, project.Index,
+			project.SeedAssetCode, project.TotalValue, project.SeedInvestmentFactor, true)
+	}
+	return MunibondInvest(c, consts.OpenSolarIssuerDir, invIndex, invSeed, invAmount, project.Index,
+		project.InvestorAssetCode, project.TotalValue, 1, false)
+}
+
+// Receive sends the debt and payback assets to the recipient and sets up the payment schedule
+func (munibondModel) Receive(project *Project, recpSeed string) error {
+	c, err := project.chain()
+	if err != nil {
+		return err
+	}
+
+	project.DebtAssetCode = c.AssetID(consts.DebtAssetPrefix + project.Metadata)
+	project.PaybackAssetCode = c.AssetID(consts.PaybackAssetPrefix + project.Metadata)
+
+	// when sending debt and payback assets, account for SeedMoneyRaised
+	err = MunibondReceive(c, consts.OpenSolarIssuerDir, project.RecipientIndex, project.Index, project.DebtAssetCode,
+		project.PaybackAssetCode, project.EstimatedAcquisition, recpSeed, project.TotalValue+project.SeedMoneyRaised, project.PaybackPeriod)
+	if err != nil {
+		return errors.Wrap(err, "error while receiving assets from issuer on recipient's end")
+	}
+
+	// update balleft with SeedMoneyRaised
+	project.BalLeft = project.TotalValue + project.SeedMoneyRaised // to carry over the extra returns that seed investors get
+	project.Schedule, err = project.GenerateSchedule(utils.Unix())
+	if err != nil {
+		return errors.Wrap(err, "couldn't generate payment schedule")
+	}
+	return nil
+}
+
+// Payback pays towards the munibond and applies the payment to the project's schedule. The principal and
+// interest paid are distributed to investors, while late fees are paid to the platform by the waterfall
+func (munibondModel) Payback(project *Project, recpIndex int, assetName string, amount float64, recipientSeed string) (float64, string, error) {
+	c, err := project.chain()
+	if err != nil {
+		return -1, "", err
+	}
+
+	if len(project.Schedule) == 0 {
+		// projects funded before schedules were introduced get one starting from their last payment. It is
+		// generated before the payment is made since nothing may fail once the recipient's funds have moved
+		start := project.DateLastPaid
+		if start == 0 {
+			start = utils.Unix()
+		}
+		project.Schedule, err = project.GenerateSchedule(start)
+		if err != nil {
+			return -1, "", errors.Wrap(err, "couldn't generate payment schedule")
+		}
+	}
+
+	pct, txhash, err := MunibondPayback(c, consts.OpenSolarIssuerDir, recpIndex, amount,
+		recipientSeed, project.Index, assetName, project.InvestorIndices, project.TotalValue, project.EscrowPubkey)
+	if err != nil {
+		return -1, "", errors.Wrap(err, "Error while paying back the issuer")
+	}
+
+	principal, interest, lateFees := project.applySchedulePayment(amount)
+	project.LateFees += lateFees
+
+	project.BalLeft -= (1 - pct) * amount // the balance left should be the percenteage paid towards the asset, which is the monthly bill. THe re st goes into  ownership
+	project.OwnershipShift += pct
+	project.DateLastPaid = utils.Unix()
+	project.AmountOwed, _ = project.AmountDue(project.DateLastPaid) // track progress of payments in the payback job
+
+	if project.BalLeft == 0 {
+		log.Println("YOU HAVE PAID OFF THIS ASSET's LOAN, TRANSFERRING FUTURE PAYMENTS AS OWNERSHIP ASSETS OWNERSHIP OF ASSET TO YOU")
+		project.Stage = 9
+	}
+
+	if project.OwnershipShift == 1 {
+		// the recipient has paid off the asset completely
+		log.Println("You now own the asset completely, there is no need to pay money in the future towards this particular project")
+		project.BalLeft = 0
+		project.AmountOwed = 0
+	}
+
+	return principal + interest, txhash, nil
+}
+
+// Distribute pays investors out of the project escrow in proportion to their investment
+func (munibondModel) Distribute(project *Project, recipientSeed string, amount float64) error {
+	c, err := project.chain()
+	if err != nil {
+		return err
+	}
+
+	for pubkey, percentage := range project.InvestorMap {
+		txAmount := percentage * amount
+		address, err := c.Address(pubkey)
+		if err != nil {
+			log.Println("Error with address of pubkey: ", pubkey, err)
+			continue
+		}
+		// here we send funds from the 2of2 multisig. Platform signs by default
+		_, err = c.SendFromEscrow(project.EscrowPubkey, address, txAmount, recipientSeed, consts.PlatformSeed, "returns")
+		if err != nil {
+			log.Println("Error with payback to pubkey: ", pubkey, err) // if there is an error with one payback, doesn't mean we should stop and wait for the others
+			continue
+		}
+	}
+	return nil
+}
+
+// equityModel is community equity. Investors hold a fixed number of shares and are paid dividends out of
+// the project's net revenue. Shares are never redeemed
+type equityModel struct{}
+
+// Invest issues shares to the investor. Seed investors receive the same shares as other investors so that
+// dividends are split pro rata
+func (equityModel) Invest(project *Project, invIndex int, invSeed string, invAmount float64, seed bool) error {
+	c, err := project.chain()
+	if err != nil {
+		return err
+	}
+
+	return EquityInvest(c, consts.OpenSolarIssuerDir, invIndex, invSeed, invAmount, project.Index,
+		project.InvestorAssetCode, project.TotalValue, project.ShareCount, seed)
+}
+
+// Receive hands over the project to the recipient without issuing any debt
+func (equityModel) Receive(project *Project, recpSeed string) error {
+	c, err := project.chain()
+	if err != nil {
+		return err
+	}
+
+	err = EquityReceive(c, consts.OpenSolarIssuerDir, project.RecipientIndex, project.Index)
+	if err != nil {
+		return errors.Wrap(err, "error while handing over equity project to recipient")
+	}
+	return nil
+}
+
+// Payback takes net revenue from the recipient. All of it is paid out as dividends
+func (equityModel) Payback(project *Project, recpIndex int, assetName string, amount float64, recipientSeed string) (float64, string, error) {
+	c, err := project.chain()
+	if err != nil {
+		return -1, "", err
+	}
+
+	txhash, err := EquityPayback(c, recpIndex, project.Index, amount, recipientSeed, project.EscrowPubkey)
+	if err != nil {
+		return -1, "", err
+	}
+	project.DividendsPaid += amount
+	project.DateLastPaid = utils.Unix()
+	return amount, txhash, nil
+}
+
+// Distribute pays dividends to shareholders in proportion to the shares they hold
+func (equityModel) Distribute(project *Project, recipientSeed string, amount float64) error {
+	c, err := project.chain()
+	if err != nil {
+		return err
+	}
+
+	return EquityDistribute(c, project.Index, amount, recipientSeed, project.EscrowPubkey,
+		project.InvestorAssetCode, project.ShareCount, project.InvestorIndices)
+}
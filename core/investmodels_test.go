@@ -0,0 +1,255 @@
+package core
+
+import (
+	"math"
+	"testing"
+
+	chain "github.com/YaleOpenLab/opensolar/chain"
+	consts "github.com/YaleOpenLab/opensolar/consts"
+)
+
+// modelProject sets up a project of investmentType on the mock chain with a recipient, two investors and an
+// escrow holding escrowAmount of the stablecoin
+func modelProject(t *testing.T, m *chain.Mock, investmentType string, escrowAmount float64) (Project, Recipient, []Investor) {
+	recipient, err := NewRecipient("recipient", testPwd, testSeedPwd, "Recipient")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.CreateAccount(recipient.U.StellarWallet.PublicKey)
+
+	var investors []Investor
+	for _, name := range []string{"investor1", "investor2"} {
+		investor, err := NewInvestor(name, testPwd, testSeedPwd, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.CreateAccount(investor.U.StellarWallet.PublicKey)
+		investors = append(investors, investor)
+	}
+
+	escrow, err := m.InitEscrow(1, testSeedPwd, testKey("recipient").Seed(), consts.PlatformSeed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if escrowAmount > 0 {
+		err = m.Credit(escrow, escrowAmount)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = m.InitIssuer(consts.OpenSolarIssuerDir, 1, consts.IssuerSeedPwd, consts.PlatformSeed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	project := Project{
+		Index:                1,
+		Chain:                chain.MockName,
+		InvestmentType:       investmentType,
+		RecipientIndex:       recipient.U.Index,
+		EscrowPubkey:         escrow,
+		TotalValue:           1000,
+		BalLeft:              1000,
+		EstimatedAcquisition: 1,
+		InvestorAssetCode:    "INVTEST",
+		DebtAssetCode:        "DEBTTEST",
+		ShareCount:           100,
+	}
+	err = project.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return project, recipient, investors
+}
+
+// modelAsset sends amount of an asset issued by the project's issuer to the account with the passed seed
+func modelAsset(t *testing.T, m *chain.Mock, code string, amount float64, seed string) {
+	issuer, issuerSeed, err := m.IssuerSeed(consts.OpenSolarIssuerDir, 1, consts.IssuerSeedPwd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	address, err := m.PublicKey(seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = m.TrustAsset(code, issuer, 1000, seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = m.SendAsset(code, issuer, address, amount, issuerSeed, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// checkStablecoin checks the stablecoin balance of an account on the mock chain
+func checkStablecoin(t *testing.T, m *chain.Mock, address string, expected float64) {
+	balance, err := m.Balance(address, chain.MockStablecoinCode, chain.MockStablecoinIssuer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance != expected {
+		t.Fatalf("stablecoin balance of %s is %f, expected %f", address, balance, expected)
+	}
+}
+
+func TestMunibondPayback(t *testing.T) {
+	m, teardown := setupMock(t)
+	defer teardown()
+
+	project, recipient, _ := modelProject(t, m, "munibond", 0)
+	recpSeed := testKey("recipient").Seed()
+	recpAddress := recipient.U.StellarWallet.PublicKey
+	modelAsset(t, m, project.DebtAssetCode, 1000, recpSeed)
+
+	model, err := RetrieveInvestmentModel("munibond")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = model.Payback(&project, recipient.U.Index, project.DebtAssetCode, 100, recpSeed)
+	if err == nil {
+		t.Fatalf("payback went through without the stablecoin to pay for it")
+	}
+
+	err = m.Credit(recpAddress, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	amount, txhash, err := model.Payback(&project, recipient.U.Index, project.DebtAssetCode, 100, recpSeed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if amount != 100 {
+		t.Fatalf("payback of 100 distributes %f", amount)
+	}
+	if txhash == "" {
+		t.Fatalf("payback didn't return the hash of the payment")
+	}
+
+	checkStablecoin(t, m, recpAddress, 0)
+	checkStablecoin(t, m, project.EscrowPubkey, 100)
+
+	issuer, _, err := m.IssuerSeed(consts.OpenSolarIssuerDir, 1, consts.IssuerSeedPwd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	debt, err := m.Balance(recpAddress, project.DebtAssetCode, issuer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if debt != 900 {
+		t.Fatalf("recipient holds %f of the debt asset after paying back 100, expected 900", debt)
+	}
+
+	var paid float64
+	for _, installment := range project.Schedule {
+		paid += installment.Paid
+	}
+	if math.Abs(paid-100) > scheduleEpsilon {
+		t.Fatalf("%f of the payback applied to the project's schedule, expected 100", paid)
+	}
+	if project.DateLastPaid == 0 {
+		t.Fatalf("payback date not recorded")
+	}
+}
+
+func TestMunibondDistribute(t *testing.T) {
+	m, teardown := setupMock(t)
+	defer teardown()
+
+	project, _, investors := modelProject(t, m, "munibond", 100)
+	project.InvestorMap = map[string]float64{
+		investors[0].U.StellarWallet.PublicKey: 0.6,
+		investors[1].U.StellarWallet.PublicKey: 0.4,
+	}
+
+	model, err := RetrieveInvestmentModel("munibond")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = model.Distribute(&project, testKey("recipient").Seed(), 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkStablecoin(t, m, investors[0].U.StellarWallet.PublicKey, 30)
+	checkStablecoin(t, m, investors[1].U.StellarWallet.PublicKey, 20)
+	checkStablecoin(t, m, project.EscrowPubkey, 50)
+}
+
+func TestEquityPayback(t *testing.T) {
+	m, teardown := setupMock(t)
+	defer teardown()
+
+	project, recipient, _ := modelProject(t, m, "equity", 0)
+	recpSeed := testKey("recipient").Seed()
+	err := m.Credit(recipient.U.StellarWallet.PublicKey, 150)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	model, err := RetrieveInvestmentModel("equity")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = model.Payback(&project, recipient.U.Index, "", 0, recpSeed)
+	if err == nil {
+		t.Fatalf("dividends paid without any net revenue")
+	}
+
+	_, _, err = model.Payback(&project, recipient.U.Index, "", 200, recpSeed)
+	if err == nil {
+		t.Fatalf("dividends paid with more net revenue than the recipient holds")
+	}
+
+	amount, txhash, err := model.Payback(&project, recipient.U.Index, "", 100, recpSeed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if amount != 100 || txhash == "" {
+		t.Fatalf("net revenue of 100 distributes %f with hash %q", amount, txhash)
+	}
+
+	checkStablecoin(t, m, recipient.U.StellarWallet.PublicKey, 50)
+	checkStablecoin(t, m, project.EscrowPubkey, 100)
+	if project.DividendsPaid != 100 || project.DateLastPaid == 0 {
+		t.Fatalf("dividends paid not recorded on the project")
+	}
+}
+
+func TestEquityDistribute(t *testing.T) {
+	m, teardown := setupMock(t)
+	defer teardown()
+
+	project, _, investors := modelProject(t, m, "equity", 100)
+	modelAsset(t, m, project.InvestorAssetCode, 60, testKey("investor1").Seed())
+	modelAsset(t, m, project.InvestorAssetCode, 30, testKey("investor2").Seed())
+	// the first investor invested twice but must only be paid once for the shares they hold
+	project.InvestorIndices = []int{investors[0].U.Index, investors[1].U.Index, investors[0].U.Index}
+
+	model, err := RetrieveInvestmentModel("equity")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = model.Distribute(&project, testKey("recipient").Seed(), 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// unsold shares aren't paid dividends, so part of the amount stays in the escrow
+	checkStablecoin(t, m, investors[0].U.StellarWallet.PublicKey, 30)
+	checkStablecoin(t, m, investors[1].U.StellarWallet.PublicKey, 15)
+	checkStablecoin(t, m, project.EscrowPubkey, 55)
+
+	project.ShareCount = 0
+	err = model.Distribute(&project, testKey("recipient").Seed(), 50)
+	if err == nil {
+		t.Fatalf("dividends paid out of a project without a share count")
+	}
+}
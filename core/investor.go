@@ -5,12 +5,9 @@ import (
 	"github.com/pkg/errors"
 
 	utils "github.com/Varunram/essentials/utils"
-	tickers "github.com/YaleOpenLab/openx/chains/exchangetickers"
-	xlm "github.com/YaleOpenLab/openx/chains/xlm"
-	openxconsts "github.com/YaleOpenLab/openx/consts"
 	openx "github.com/YaleOpenLab/openx/database"
 
-	consts "github.com/YaleOpenLab/opensolar/consts"
+	chain "github.com/YaleOpenLab/opensolar/chain"
 )
 
 // Investor defines the investor structure
@@ -42,8 +39,14 @@ type Investor struct {
 	// AllTimeReturns is the all time returns the investor has realized from his investments
 	AllTimeReturns []float64
 
-	// ReceivedRECs is a list of the RECs the recipient has invested in
-	ReceivedRECs string
+	// RECsReceived is the number of RECs the investor has claimed across all projects
+	RECsReceived float64
+
+	// RECsRetired is the number of RECs the investor has retired across all projects
+	RECsRetired float64
+
+	// CarbonAvoided is the carbon in tCO2e avoided by projects the investor has invested in attributed to the investor
+	CarbonAvoided float64
 
 	// Prorata is the pro rata in all the projects that the investor has invested in
 	Prorata string
@@ -74,34 +77,25 @@ func (a *Investor) ChangeVotingBalance(votes float64) error {
 	return a.Save()
 }
 
-// CanInvest checks whether an investor has the required funds to invest in a project
-func (a *Investor) CanInvest(targetBalance float64) bool {
-	if !consts.Mainnet {
-		// testnet
-		usdBalance, err := xlm.GetAssetBalance(a.U.StellarWallet.PublicKey, "STABLEUSD")
-		if err != nil {
-			usdBalance = 0
-		}
-
-		xlmBalance, err := xlm.GetNativeBalance(a.U.StellarWallet.PublicKey)
-		if err != nil {
-			xlmBalance = 0
-		}
-
-		// need to fetch the oracle price here for the order
-		oraclePrice := tickers.ExchangeXLMforUSD(xlmBalance)
-		if usdBalance > targetBalance || oraclePrice > targetBalance {
-			// return true since the user has enough USD balance to pay for the order
-			return true
-		}
+// CanInvest checks whether an investor has the required funds to invest in a project on chain c. Investors on
+// chains where the platform runs an exchange can also pay with the native coin they hold
+func (a *Investor) CanInvest(c chain.Chain, targetBalance float64) bool {
+	address, err := c.Address(a.U.StellarWallet.PublicKey)
+	if err != nil {
 		return false
 	}
 
-	// mainnet
-	usdBalance, err := xlm.GetAssetBalance(a.U.StellarWallet.PublicKey, openxconsts.AnchorUSDCode)
+	code, issuer := c.Stablecoin()
+	usdBalance, err := c.Balance(address, code, issuer)
 	if err != nil {
 		usdBalance = 0
 	}
 
-	return usdBalance > targetBalance
+	exchangeValue, err := c.ExchangeValue(address)
+	if err != nil {
+		exchangeValue = 0
+	}
+
+	// the investor needs to be able to pay for the order either in stablecoin or with their native coin
+	return usdBalance >= targetBalance || exchangeValue >= targetBalance
 }
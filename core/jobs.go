@@ -0,0 +1,152 @@
+package core
+
+import (
+	"github.com/pkg/errors"
+	"log"
+	"time"
+
+	utils "github.com/Varunram/essentials/utils"
+
+	consts "github.com/YaleOpenLab/opensolar/consts"
+)
+
+// jobs are per project tasks that need to run at a later point in time, like waiting for the recipient to
+// unlock a funded project or checking every week whether the recipient is paying back. They are stored in
+// the database along with the time they are due next so that they survive restarts of the platform.
+// RunScheduler picks up due jobs and hands them to the handler registered for their type.
+
+const (
+	// JobUnlock waits for the recipient to unlock a funded project and refunds investors if they don't
+	JobUnlock = "unlock"
+
+	// JobFunding refunds investors if a project doesn't raise its total value before its funding deadline
+	JobFunding = "funding"
+
+	// JobPayback checks whether the recipient is paying back and escalates if they aren't
+	JobPayback = "payback"
+
+	// JobBilling closes the billing period of a project and invoices the recipient for the energy used
+	JobBilling = "billing"
+
+	// JobREC issues renewable energy certificates for the energy a project has generated
+	JobREC = "rec"
+
+	// JobCarbon adds up the carbon a project has avoided and attributes it to its investors
+	JobCarbon = "carbon"
+
+	// JobRekey updates the investors of a project with trades settled on the secondary market whose re-keying failed
+	JobRekey = "rekey"
+
+	// JobAuction closes the auction on an originated project once its bidding window is over
+	JobAuction = "auction"
+)
+
+const (
+	// JobScheduled denotes a job that is waiting to run
+	JobScheduled = "scheduled"
+
+	// JobDone denotes a job that has finished and won't run again
+	JobDone = "done"
+)
+
+// Job is a task that is run by the scheduler on behalf of a project
+type Job struct {
+	Index        int    // the index of the job
+	ProjectIndex int    // the index of the project the job runs for
+	Type         string // the type of the job, decides which handler runs it
+	Status       string // whether the job is scheduled or done
+	NextRun      int64  // unix time at which the job runs next
+	Deadline     int64  // unix time by which the job must have finished, if any
+	LastRun      int64  // unix time at which the job last ran
+	Runs         int    // the number of times the job has run
+	LastError    string // the error returned by the last run, if any
+}
+
+// jobHandlers maps job types to the functions that run them. A handler either marks the job as done or
+// sets the time of its next run
+var jobHandlers = make(map[string]func(job *Job) error)
+
+func init() {
+	jobHandlers[JobUnlock] = runUnlockJob
+	jobHandlers[JobFunding] = runFundingJob
+	jobHandlers[JobPayback] = runPaybackJob
+	jobHandlers[JobBilling] = runBillingJob
+	jobHandlers[JobREC] = runRECJob
+	jobHandlers[JobCarbon] = runCarbonJob
+	jobHandlers[JobRekey] = runRekeyJob
+	jobHandlers[JobAuction] = runAuctionJob
+}
+
+// ScheduleJob schedules a job of the passed type for a project. If the project already has a scheduled
+// job of the same type, that job is rescheduled instead of creating a new one
+func ScheduleJob(jobType string, projIndex int, nextRun int64, deadline int64) (Job, error) {
+	var job Job
+	if _, exists := jobHandlers[jobType]; !exists {
+		return job, errors.New("job type " + jobType + " not supported")
+	}
+
+	jobs, err := RetrieveAllJobs()
+	if err != nil {
+		return job, errors.Wrap(err, "couldn't retrieve jobs")
+	}
+
+	job.Index = len(jobs) + 1
+	for _, elem := range jobs {
+		if elem.ProjectIndex == projIndex && elem.Type == jobType && elem.Status == JobScheduled {
+			job = elem
+			break
+		}
+	}
+
+	job.ProjectIndex = projIndex
+	job.Type = jobType
+	job.Status = JobScheduled
+	job.NextRun = nextRun
+	job.Deadline = deadline
+	return job, job.Save()
+}
+
+// runJob runs a single job and stores its result. Jobs that fail are retried after JobRetryInterval
+func runJob(job Job) {
+	handler := jobHandlers[job.Type]
+	if handler == nil {
+		log.Println("no handler for job type", job.Type)
+		return
+	}
+
+	job.LastRun = utils.Unix()
+	job.Runs++
+	err := handler(&job)
+	if err != nil {
+		log.Println("job", job.Index, "of type", job.Type, "failed", err)
+		job.LastError = err.Error()
+		job.NextRun = job.LastRun + consts.JobRetryInterval
+	} else {
+		job.LastError = ""
+	}
+
+	err = job.Save()
+	if err != nil {
+		log.Println("couldn't save job", job.Index, err)
+	}
+}
+
+// RunScheduler polls the database for jobs that are due and runs them. Since jobs are stored in the
+// database, jobs that were due while the platform was down are run as soon as it is started again
+func RunScheduler() {
+	for {
+		jobs, err := RetrieveAllJobs()
+		if err != nil {
+			log.Println("couldn't retrieve jobs", err)
+		}
+
+		now := utils.Unix()
+		for _, job := range jobs {
+			if job.Status == JobScheduled && job.NextRun <= now {
+				runJob(job)
+			}
+		}
+
+		time.Sleep(consts.SchedulerPollInterval)
+	}
+}
@@ -0,0 +1,101 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+
+	utils "github.com/Varunram/essentials/utils"
+
+	consts "github.com/YaleOpenLab/opensolar/consts"
+)
+
+func TestScheduleJob(t *testing.T) {
+	teardown := setupPlatform(t)
+	defer teardown()
+
+	_, err := ScheduleJob("unknown", 1, 0, 0)
+	if err == nil {
+		t.Fatalf("job of an unknown type scheduled")
+	}
+
+	job, err := ScheduleJob(JobPayback, 1, 100, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ScheduleJob(JobPayback, 2, 100, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// scheduling a job the project already has moves it instead of running it twice
+	rescheduled, err := ScheduleJob(JobPayback, 1, 200, 300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rescheduled.Index != job.Index || rescheduled.NextRun != 200 || rescheduled.Deadline != 300 {
+		t.Fatalf("job not rescheduled %v", rescheduled)
+	}
+	jobs, err := RetrieveAllJobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 2 {
+		t.Fatalf("%d jobs scheduled, expected 2", len(jobs))
+	}
+
+	// once the job is done the project can be scheduled again
+	rescheduled.Status = JobDone
+	err = rescheduled.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, err := ScheduleJob(JobPayback, 1, 400, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.Index != 3 {
+		t.Fatalf("done job rescheduled %v", next)
+	}
+}
+
+func TestRunJob(t *testing.T) {
+	teardown := setupPlatform(t)
+	defer teardown()
+
+	fail := true
+	jobHandlers["test"] = func(job *Job) error {
+		if fail {
+			return errors.New("failed")
+		}
+		job.Status = JobDone
+		return nil
+	}
+	defer delete(jobHandlers, "test")
+
+	job, err := ScheduleJob("test", 1, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a failed job is stored with its error and retried later
+	runJob(job)
+	job, err = RetrieveJob(job.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != JobScheduled || job.Runs != 1 || job.LastError == "" ||
+		job.NextRun != job.LastRun+consts.JobRetryInterval || job.NextRun <= utils.Unix() {
+		t.Fatalf("failed job not scheduled for a retry %v", job)
+	}
+
+	fail = false
+	runJob(job)
+	job, err = RetrieveJob(job.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != JobDone || job.Runs != 2 || job.LastError != "" {
+		t.Fatalf("unexpected job %v", job)
+	}
+}
@@ -0,0 +1,389 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+
+	aes "github.com/Varunram/essentials/aes"
+	utils "github.com/Varunram/essentials/utils"
+	openx "github.com/YaleOpenLab/openx/database"
+	"github.com/stellar/go/keypair"
+
+	chain "github.com/YaleOpenLab/opensolar/chain"
+	consts "github.com/YaleOpenLab/opensolar/consts"
+	simnet "github.com/YaleOpenLab/opensolar/simnet"
+)
+
+// the lifecycle test runs a munibond project from origination to the distribution of the recipient's first
+// payback on the simulated network of package simnet. Users are kept by a stand-in for openx's user endpoints,
+// so the test runs in process without testnet, friendbot or openx
+
+const (
+	testChain      = "simnet"
+	testStablecoin = "STABLEUSD"
+	testPwd        = "password"
+	testSeedPwd    = "x"
+)
+
+// testKey returns a key derived from label so that accounts are the same on every run
+func testKey(label string) *keypair.Full {
+	kp, err := keypair.FromRawSeed(sha256.Sum256([]byte("opensolar lifecycle " + label)))
+	if err != nil {
+		panic(err)
+	}
+	return kp
+}
+
+// openxUsers is a stand-in for the user endpoints of openx. Users are kept in memory and their wallets are
+// derived from their username with testKey
+type openxUsers struct {
+	mu    sync.Mutex
+	users []openx.User
+}
+
+func (o *openxUsers) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	query := r.URL.Query()
+	if query.Get("code") != consts.TopSecretCode {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/platform/user/new":
+		var user openx.User
+		user.Index = len(o.users) + 1
+		user.Username = query.Get("name")
+		user.Pwhash = query.Get("pwhash")
+		user.Name = query.Get("realname")
+
+		kp := testKey(user.Username)
+		encryptedSeed, err := aes.Encrypt([]byte(kp.Seed()), query.Get("seedpwd"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		user.StellarWallet.PublicKey = kp.Address()
+		user.StellarWallet.EncryptedSeed = encryptedSeed
+
+		o.users = append(o.users, user)
+		json.NewEncoder(w).Encode(user)
+	case "/platform/user/retrieve":
+		index, err := strconv.Atoi(query.Get("key"))
+		if err != nil || index < 1 || index > len(o.users) {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(o.users[index-1])
+	case "/platform/user/validate":
+		for _, user := range o.users {
+			if user.Username == query.Get("name") && user.Pwhash == query.Get("pwhash") {
+				json.NewEncoder(w).Encode(user)
+				return
+			}
+		}
+		http.NotFound(w, r)
+	case "/platform/user/collision":
+		for _, user := range o.users {
+			if user.Username == query.Get("name") {
+				w.Write([]byte{1})
+				return
+			}
+		}
+		w.Write([]byte{0})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// lifecycle holds what the lifecycle test runs against
+type lifecycle struct {
+	network      *simnet.Network
+	c            chain.Chain
+	stableIssuer *keypair.Full
+}
+
+// fundAccount creates the account controlled by seed on the network and gives it usd of the stablecoin
+func (l lifecycle) fundAccount(t *testing.T, seed string, usd float64) {
+	pubkey, err := l.c.PublicKey(seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = l.network.Fund(pubkey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = l.c.TrustAsset(testStablecoin, l.stableIssuer.Address(), 1000000, seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if usd > 0 {
+		_, err = l.c.SendAsset(testStablecoin, l.stableIssuer.Address(), pubkey, usd, l.stableIssuer.Seed(), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// balance returns the balance of an asset held by an account on the network
+func (l lifecycle) balance(t *testing.T, address string, code string, issuer string) float64 {
+	balance, err := l.c.Balance(address, code, issuer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return balance
+}
+
+// setupPlatform points the platform at a new database and the openx stand-in and sets up the platform's key.
+// The returned function closes the stand-in and restores the platform's settings
+func setupPlatform(t *testing.T) func() {
+	homeDir, dbDir, issuerDir := consts.HomeDir, consts.DbDir, consts.OpenSolarIssuerDir
+	openxURL, platformSeed, platformPubkey, blockWait := consts.OpenxURL, consts.PlatformSeed, consts.PlatformPublicKey, consts.BlockWait
+
+	home, err := ioutil.TempDir("", "opensolar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	consts.HomeDir = home
+	consts.DbDir = home + "/database/"
+	consts.OpenSolarIssuerDir = home + "/projects/"
+	CreateHomeDir()
+
+	openxServer := httptest.NewServer(&openxUsers{})
+	consts.OpenxURL = openxServer.URL
+
+	platform := testKey("platform")
+	consts.PlatformSeed = platform.Seed()
+	consts.PlatformPublicKey = platform.Address()
+
+	return func() {
+		openxServer.Close()
+		os.RemoveAll(home)
+		consts.HomeDir, consts.DbDir, consts.OpenSolarIssuerDir = homeDir, dbDir, issuerDir
+		consts.OpenxURL, consts.PlatformSeed, consts.PlatformPublicKey, consts.BlockWait = openxURL, platformSeed, platformPubkey, blockWait
+	}
+}
+
+// setupLifecycle sets up the platform to run against the simulated network. The returned function closes the
+// servers and restores the platform's settings
+func setupLifecycle(t *testing.T) (lifecycle, func()) {
+	var l lifecycle
+	teardownPlatform := setupPlatform(t)
+
+	l.network = simnet.New()
+	horizonServer := httptest.NewServer(l.network)
+	l.stableIssuer = testKey("stablecoin")
+	l.c = chain.NewHorizon(testChain, horizonServer.URL, simnet.Passphrase, testStablecoin, l.stableIssuer.Address())
+	chain.Register(l.c)
+
+	// the simulated network applies transactions as soon as they're submitted
+	consts.BlockWait = 0
+
+	teardown := func() {
+		horizonServer.Close()
+		teardownPlatform()
+	}
+
+	_, err := l.network.Fund(l.stableIssuer.Address())
+	if err != nil {
+		teardown()
+		t.Fatal(err)
+	}
+
+	l.fundAccount(t, consts.PlatformSeed, 0)
+	return l, teardown
+}
+
+// setupMock sets up the platform to run against a new mock chain that holds an account for the platform
+func setupMock(t *testing.T) (*chain.Mock, func()) {
+	teardown := setupPlatform(t)
+	m := chain.NewMock()
+	chain.Register(m)
+	m.CreateAccount(consts.PlatformPublicKey)
+	return m, teardown
+}
+
+func TestProjectLifecycle(t *testing.T) {
+	l, teardown := setupLifecycle(t)
+	defer teardown()
+
+	recipient, err := NewRecipient("recipient", testPwd, testSeedPwd, "Recipient")
+	if err != nil {
+		t.Fatal(err)
+	}
+	investor1, err := NewInvestor("investor1", testPwd, testSeedPwd, "Investor 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	investor2, err := NewInvestor("investor2", testPwd, testSeedPwd, "Investor 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// new entities are saved in openx's own database as well, which the stand-in doesn't have
+	user, err := NewUser("originator", utils.SHA3hash(testPwd), testSeedPwd, "Originator")
+	if err != nil {
+		t.Fatal(err)
+	}
+	originator := Entity{U: &user, Originator: true}
+	err = originator.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recpSeed := testKey("recipient").Seed()
+	inv1Seed := testKey("investor1").Seed()
+	inv2Seed := testKey("investor2").Seed()
+	l.fundAccount(t, recpSeed, 100)
+	l.fundAccount(t, inv1Seed, 1000)
+	l.fundAccount(t, inv2Seed, 1000)
+
+	// originate, the project is paid back in yearly installments of 100 over ten years
+	project, err := originator.Originate("100 1000 sq.ft homes", 1000, "Puerto Rico", 10, "lifecycle", recipient.U.Index, "blind")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the stages before the raise are moved through by the parties' checklists, so the project starts at the raise
+	project.Stage = 4
+	project.Chain = testChain
+	project.InvestmentType = "munibond"
+	project.PaybackPeriod = 52
+	err = project.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// invest
+	err = Invest(project.Index, investor1.U.Index, 600, inv1Seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Invest(project.Index, investor2.U.Index, 400, inv2Seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	project, err = RetrieveProject(project.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !project.Lock || project.MoneyRaised != 1000 {
+		t.Fatalf("project not locked after raising %f", project.MoneyRaised)
+	}
+	if project.InvestorMap[investor1.U.StellarWallet.PublicKey] != 0.6 || project.InvestorMap[investor2.U.StellarWallet.PublicKey] != 0.4 {
+		t.Fatalf("investor map %v doesn't match investments", project.InvestorMap)
+	}
+
+	// unlock, the escrow is set up by the unlock job
+	err = UnlockProject("recipient", utils.SHA3hash(testPwd), project.Index, testSeedPwd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jobs, err := RetrieveAllJobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, job := range jobs {
+		if job.Type == JobUnlock && job.ProjectIndex == project.Index {
+			runJob(job)
+			job, err = RetrieveJob(job.Index)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if job.Status != JobDone {
+				t.Fatalf("unlock job not done: %s", job.LastError)
+			}
+		}
+	}
+
+	project, err = RetrieveProject(project.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if project.Stage != Stage5.Number || project.EscrowPubkey == "" {
+		t.Fatalf("project at stage %d with escrow %q after unlocking", project.Stage, project.EscrowPubkey)
+	}
+
+	issuerPubkey, issuerSeed, err := l.c.IssuerSeed(consts.OpenSolarIssuerDir, project.Index, consts.IssuerSeedPwd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.balance(t, recipient.U.StellarWallet.PublicKey, project.DebtAssetCode, issuerPubkey) != 1000 {
+		t.Fatal("recipient didn't receive the debt asset")
+	}
+
+	// the issuer is frozen once the recipient has received their assets
+	_, err = l.c.SendAsset(project.InvestorAssetCode, issuerPubkey, investor1.U.StellarWallet.PublicKey, 1, issuerSeed, "")
+	if err == nil {
+		t.Fatal("frozen issuer could issue assets")
+	}
+
+	// payback, which is distributed to investors out of the escrow
+	err = Payback(recipient.U.Index, project.Index, project.DebtAssetCode, 100, recpSeed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	distributions, err := RetrieveProjectDistributions(project.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(distributions) != 1 || len(distributions[0].Items) != 1 {
+		t.Fatalf("expected a single distribution with a single item, got %v", distributions)
+	}
+	if item := distributions[0].Items[0]; item.Tier != TierCoupon || item.Amount != 100 || item.Error != "" {
+		t.Fatalf("unexpected distribution %v", item)
+	}
+
+	stablecoin := map[string]float64{
+		investor1.U.StellarWallet.PublicKey: 460,
+		investor2.U.StellarWallet.PublicKey: 640,
+		recipient.U.StellarWallet.PublicKey: 0,
+		project.EscrowPubkey:                1000,
+		consts.PlatformPublicKey:            0,
+	}
+	for address, expected := range stablecoin {
+		if balance := l.balance(t, address, testStablecoin, l.stableIssuer.Address()); balance != expected {
+			t.Fatalf("%s holds %f %s, expected %f", address, balance, testStablecoin, expected)
+		}
+	}
+
+	investorAssets := map[string]float64{
+		investor1.U.StellarWallet.PublicKey: 600,
+		investor2.U.StellarWallet.PublicKey: 400,
+	}
+	for address, expected := range investorAssets {
+		if balance := l.balance(t, address, project.InvestorAssetCode, issuerPubkey); balance != expected {
+			t.Fatalf("%s holds %f investor assets, expected %f", address, balance, expected)
+		}
+	}
+	if l.balance(t, recipient.U.StellarWallet.PublicKey, project.DebtAssetCode, issuerPubkey) != 900 {
+		t.Fatal("debt asset paid back wasn't burnt")
+	}
+
+	// payments to the platform and the escrow carry the project in their memo
+	memos := make(map[string]int)
+	for _, tx := range l.network.Transactions() {
+		if tx.Successful && tx.Memo != "" {
+			memos[tx.Memo]++
+		}
+	}
+	if memos["Opensolar investment: 1"] != 2 || memos["Opensolar escrow: 1"] != 1 || memos["Opensolar payback: 1"] != 1 ||
+		memos["returns"] != 2 {
+		t.Fatalf("unexpected memos %v", memos)
+	}
+}
@@ -0,0 +1,591 @@
+package core
+
+import (
+	"github.com/pkg/errors"
+	"log"
+	"math"
+	"sync"
+
+	utils "github.com/Varunram/essentials/utils"
+
+	chain "github.com/YaleOpenLab/opensolar/chain"
+	consts "github.com/YaleOpenLab/opensolar/consts"
+)
+
+// the secondary market lets investors sell the investor assets of a funded project before it matures. A seller
+// lists an offer by moving the assets they want to sell into the platform's custody, which keeps them until a
+// buyer comes along or the offer is cancelled. A trade settles in a single transaction signed by the buyer and
+// the platform, in which the buyer pays the seller in stablecoin and the platform sends the bought assets on to
+// the buyer, so the buyer can't pay without receiving the assets. Once a trade settles the project is re-keyed
+// so that future coupons and dividends go to the buyer. Re-keying is retried by the rekey job if it fails.
+
+const (
+	// OfferOpen is the status of an offer that can be bought from
+	OfferOpen = "open"
+
+	// OfferFilled is the status of an offer whose assets have all been sold
+	OfferFilled = "filled"
+
+	// OfferCancelled is the status of an offer the seller has taken back
+	OfferCancelled = "cancelled"
+)
+
+const (
+	// TradePending is the status of a trade that is being settled
+	TradePending = "pending"
+
+	// TradeSettled is the status of a trade whose payment and assets have changed hands
+	TradeSettled = "settled"
+
+	// TradeFailed is the status of a trade whose settlement didn't go through
+	TradeFailed = "failed"
+)
+
+// Offer is an offer to sell investor assets of a project
+type Offer struct {
+	Index        int
+	ProjectIndex int
+	SellerIndex  int
+	AssetCode    string
+	Units        float64 // the number of assets offered
+	Sold         float64 // the number of assets sold so far
+	Price        float64 // the price of an asset in USD
+	Status       string
+	CustodyTx    string // the hash of the transaction that moved the assets into the platform's custody
+	ReturnTx     string // the hash of the transaction that returned unsold assets to the seller
+	CreatedAt    int64
+}
+
+// Trade is a purchase of assets from an offer
+type Trade struct {
+	Index        int
+	OfferIndex   int
+	ProjectIndex int
+	SellerIndex  int
+	BuyerIndex   int
+	AssetCode    string
+	Units        float64
+	Price        float64
+	Total        float64 // the amount in USD paid by the buyer
+	Status       string
+	SettlementTx string // the hash of the transaction that paid the seller and delivered the assets to the buyer
+	Rekeyed      bool   // whether the project's investors have been updated with the trade
+	Error        string // the error that stopped the trade from settling, if any
+	CreatedAt    int64
+	SettledAt    int64
+}
+
+// marketLock guards offers while they're read and saved again and trades while they're given an index, so that
+// buyers and sellers acting on the same offer at the same time don't overwrite each other
+var marketLock sync.Mutex
+
+// updateOffer retrieves an offer, applies update to it and saves it without anyone else changing the offer in
+// between. The offer isn't saved if update returns an error
+func updateOffer(offerIndex int, update func(offer *Offer) error) (Offer, error) {
+	marketLock.Lock()
+	defer marketLock.Unlock()
+
+	offer, err := RetrieveOffer(offerIndex)
+	if err != nil {
+		return offer, errors.Wrap(err, "couldn't retrieve offer")
+	}
+
+	err = update(&offer)
+	if err != nil {
+		return offer, err
+	}
+	return offer, offer.Save()
+}
+
+// Remaining returns the number of assets of the offer that can still be bought
+func (a Offer) Remaining() float64 {
+	return a.Units - a.Sold
+}
+
+// marketMemo returns the memo of a transaction made on behalf of the market, stellar memos hold 28 characters
+func marketMemo(kind string, index int) string {
+	indexString, err := utils.ToString(index)
+	if err != nil {
+		return "opensolar " + kind
+	}
+	return "opensolar " + kind + " " + indexString
+}
+
+// projectIssuer returns the address of the issuer of the project's assets
+func projectIssuer(c chain.Chain, projIndex int) (string, error) {
+	issuerPubkey, _, err := c.IssuerSeed(consts.OpenSolarIssuerDir, projIndex, consts.IssuerSeedPwd)
+	if err != nil {
+		return "", errors.Wrap(err, "couldn't retrieve issuer seed")
+	}
+	return issuerPubkey, nil
+}
+
+// investorAddress returns the address of an investor on the chain
+func investorAddress(c chain.Chain, invIndex int) (string, error) {
+	investor, err := RetrieveInvestor(invIndex)
+	if err != nil {
+		return "", errors.Wrap(err, "couldn't retrieve investor")
+	}
+	return c.Address(investor.U.StellarWallet.PublicKey)
+}
+
+// unitsPerShare returns the number of investor assets that make up the whole of a project
+func (project Project) unitsPerShare() float64 {
+	if project.InvestmentType == "equity" {
+		return project.ShareCount
+	}
+	return project.TotalValue
+}
+
+// ListOffer lists investor assets of a project for sale at price USD each and moves them into the platform's custody
+func ListOffer(projIndex int, sellerIndex int, sellerSeed string, units float64, price float64) (Offer, error) {
+	var offer Offer
+	if units <= 0 || price <= 0 {
+		return offer, errors.New("units and price must be positive")
+	}
+
+	project, err := RetrieveProject(projIndex)
+	if err != nil {
+		return offer, errors.Wrap(err, "couldn't retrieve project")
+	}
+
+	if project.Stage < Stage5.Number || project.Stage == 9 || project.InvestorAssetCode == "" {
+		return offer, errors.New("only assets of funded projects that haven't matured can be sold")
+	}
+
+	c, err := project.chain()
+	if err != nil {
+		return offer, err
+	}
+
+	issuerPubkey, err := projectIssuer(c, projIndex)
+	if err != nil {
+		return offer, err
+	}
+
+	sellerAddress, err := investorAddress(c, sellerIndex)
+	if err != nil {
+		return offer, err
+	}
+
+	balance, err := c.Balance(sellerAddress, project.InvestorAssetCode, issuerPubkey)
+	if err != nil || balance < units {
+		return offer, errors.New("seller doesn't hold enough investor assets")
+	}
+
+	platformAddress, err := c.Address(consts.PlatformPublicKey)
+	if err != nil {
+		return offer, errors.Wrap(err, "couldn't get address of platform")
+	}
+
+	offers, err := RetrieveAllOffers()
+	if err != nil {
+		return offer, errors.Wrap(err, "couldn't retrieve offers")
+	}
+
+	offer = Offer{
+		Index:        len(offers) + 1,
+		ProjectIndex: projIndex,
+		SellerIndex:  sellerIndex,
+		AssetCode:    project.InvestorAssetCode,
+		Units:        units,
+		Price:        price,
+		Status:       OfferOpen,
+		CreatedAt:    utils.Unix(),
+	}
+
+	_, err = c.TrustAsset(project.InvestorAssetCode, issuerPubkey, project.unitsPerShare(), consts.PlatformSeed)
+	if err != nil {
+		return offer, errors.Wrap(err, "platform couldn't trust investor asset")
+	}
+
+	offer.CustodyTx, err = c.SendAsset(project.InvestorAssetCode, issuerPubkey, platformAddress, units,
+		sellerSeed, marketMemo("offer", offer.Index))
+	if err != nil {
+		return offer, errors.Wrap(err, "couldn't move investor assets into custody")
+	}
+
+	return offer, offer.Save()
+}
+
+// CancelOffer takes back an open offer and returns the assets that haven't been sold to the seller
+func CancelOffer(offerIndex int, sellerIndex int) (Offer, error) {
+	offer, err := RetrieveOffer(offerIndex)
+	if err != nil {
+		return offer, errors.Wrap(err, "couldn't retrieve offer")
+	}
+
+	if offer.SellerIndex != sellerIndex {
+		return offer, errors.New("only the seller can cancel an offer")
+	}
+
+	project, err := RetrieveProject(offer.ProjectIndex)
+	if err != nil {
+		return offer, errors.Wrap(err, "couldn't retrieve project")
+	}
+
+	c, err := project.chain()
+	if err != nil {
+		return offer, err
+	}
+
+	issuerPubkey, err := projectIssuer(c, offer.ProjectIndex)
+	if err != nil {
+		return offer, err
+	}
+
+	sellerAddress, err := investorAddress(c, sellerIndex)
+	if err != nil {
+		return offer, err
+	}
+
+	// close the offer before returning the assets so that they can't be bought in the meantime. Units reserved
+	// by trades that are being settled aren't returned, they go back to the seller if the trade fails
+	offer, err = updateOffer(offerIndex, func(offer *Offer) error {
+		if offer.Status != OfferOpen {
+			return errors.New("offer isn't open")
+		}
+		offer.Status = OfferCancelled
+		return nil
+	})
+	if err != nil {
+		return offer, err
+	}
+
+	returnTx, err := c.SendAsset(offer.AssetCode, issuerPubkey, sellerAddress, offer.Remaining(),
+		consts.PlatformSeed, marketMemo("cancel", offer.Index))
+	if err != nil {
+		_, serr := updateOffer(offerIndex, func(offer *Offer) error {
+			offer.Status = OfferOpen
+			return nil
+		})
+		if serr != nil {
+			log.Println("couldn't reopen offer", offer.Index, serr)
+		}
+		return offer, errors.Wrap(err, "couldn't return investor assets to seller")
+	}
+
+	return updateOffer(offerIndex, func(offer *Offer) error {
+		offer.ReturnTx = returnTx
+		return nil
+	})
+}
+
+// BuyOffer buys units of the assets of an open offer. The buyer's payment to the seller and the delivery of the
+// assets out of the platform's custody are made in the same transaction
+func BuyOffer(offerIndex int, buyerIndex int, buyerSeed string, units float64) (Trade, error) {
+	var trade Trade
+	offer, err := RetrieveOffer(offerIndex)
+	if err != nil {
+		return trade, errors.Wrap(err, "couldn't retrieve offer")
+	}
+
+	if offer.SellerIndex == buyerIndex {
+		return trade, errors.New("seller can't buy their own offer")
+	}
+
+	project, err := RetrieveProject(offer.ProjectIndex)
+	if err != nil {
+		return trade, errors.Wrap(err, "couldn't retrieve project")
+	}
+
+	c, err := project.chain()
+	if err != nil {
+		return trade, err
+	}
+
+	issuerPubkey, err := projectIssuer(c, offer.ProjectIndex)
+	if err != nil {
+		return trade, err
+	}
+
+	sellerAddress, err := investorAddress(c, offer.SellerIndex)
+	if err != nil {
+		return trade, err
+	}
+
+	buyerAddress, err := investorAddress(c, buyerIndex)
+	if err != nil {
+		return trade, err
+	}
+
+	// reserve the units before settling so that two buyers can't buy the same assets
+	offer, err = updateOffer(offerIndex, func(offer *Offer) error {
+		if offer.Status != OfferOpen {
+			return errors.New("offer isn't open")
+		}
+		if units <= 0 || units > offer.Remaining() {
+			return errors.New("units must be positive and at most the units left on the offer")
+		}
+		offer.Sold += units
+		if offer.Remaining() <= 0 {
+			offer.Status = OfferFilled
+		}
+		return nil
+	})
+	if err != nil {
+		return trade, err
+	}
+
+	trade = Trade{
+		OfferIndex:   offer.Index,
+		ProjectIndex: offer.ProjectIndex,
+		SellerIndex:  offer.SellerIndex,
+		BuyerIndex:   buyerIndex,
+		AssetCode:    offer.AssetCode,
+		Units:        units,
+		Price:        offer.Price,
+		Total:        math.Round(units*offer.Price*1e7) / 1e7,
+		Status:       TradePending,
+		CreatedAt:    utils.Unix(),
+	}
+
+	fail := func(err error) (Trade, error) {
+		releaseUnits(c, offerIndex, units, issuerPubkey, sellerAddress)
+		trade.Status = TradeFailed
+		trade.Error = err.Error()
+		if trade.Index == 0 {
+			// the trade never made it on record
+			return trade, err
+		}
+		if serr := trade.Save(); serr != nil {
+			log.Println("couldn't save failed trade", trade.Index, serr)
+		}
+		return trade, err
+	}
+
+	// the trade is on record before anything moves so that it can be looked up whatever happens to the settlement
+	err = trade.create()
+	if err != nil {
+		return fail(errors.Wrap(err, "couldn't save trade"))
+	}
+
+	// the buyer needs a trustline to receive the assets
+	_, err = c.TrustAsset(offer.AssetCode, issuerPubkey, project.unitsPerShare(), buyerSeed)
+	if err != nil {
+		return fail(errors.Wrap(err, "buyer couldn't trust investor asset"))
+	}
+
+	code, issuer := c.Stablecoin()
+	payment := chain.Transfer{Code: code, Issuer: issuer, Dest: sellerAddress, Amount: trade.Total, Seed: buyerSeed}
+	delivery := chain.Transfer{Code: offer.AssetCode, Issuer: issuerPubkey, Dest: buyerAddress, Amount: units, Seed: consts.PlatformSeed}
+	trade.SettlementTx, err = c.Swap(payment, delivery, marketMemo("trade", trade.Index))
+	if err != nil {
+		return fail(errors.Wrap(err, "couldn't settle trade"))
+	}
+
+	trade.Status = TradeSettled
+	trade.SettledAt = utils.Unix()
+	err = trade.Save()
+	if err != nil {
+		log.Println("couldn't save settled trade", trade.Index, err)
+	}
+
+	err = rekeyTrade(&trade)
+	if err != nil {
+		// the trade has settled, so keep trying to update the project's investors
+		_, serr := ScheduleJob(JobRekey, trade.ProjectIndex, utils.Unix()+consts.JobRetryInterval, 0)
+		if serr != nil {
+			log.Println("couldn't schedule rekeying of trade", trade.Index, serr)
+		}
+		return trade, errors.Wrap(err, "trade settled but project not re-keyed yet, it will be retried")
+	}
+	return trade, nil
+}
+
+// create gives a new trade the next index and saves it
+func (trade *Trade) create() error {
+	marketLock.Lock()
+	defer marketLock.Unlock()
+
+	trades, err := RetrieveAllTrades()
+	if err != nil {
+		return errors.Wrap(err, "couldn't retrieve trades")
+	}
+	trade.Index = len(trades) + 1
+	return trade.Save()
+}
+
+// releaseUnits releases units reserved on an offer by a trade that didn't settle. If the offer has been cancelled
+// in the meantime the units are returned to the seller instead
+func releaseUnits(c chain.Chain, offerIndex int, units float64, issuerPubkey string, sellerAddress string) {
+	offer, err := updateOffer(offerIndex, func(offer *Offer) error {
+		offer.Sold -= units
+		if offer.Status == OfferFilled {
+			offer.Status = OfferOpen
+		}
+		return nil
+	})
+	if err != nil {
+		log.Println("couldn't release units of offer", offerIndex, err)
+		return
+	}
+
+	if offer.Status != OfferCancelled {
+		return
+	}
+
+	_, err = c.SendAsset(offer.AssetCode, issuerPubkey, sellerAddress, units, consts.PlatformSeed,
+		marketMemo("cancel", offer.Index))
+	if err != nil {
+		log.Println("couldn't return units of cancelled offer", offer.Index, "to seller", err)
+	}
+}
+
+// rekeyTrade moves the holding bought in a settled trade from the seller to the buyer
+func rekeyTrade(trade *Trade) error {
+	if trade.Status != TradeSettled || trade.Rekeyed {
+		return errors.New("trade isn't waiting to be re-keyed")
+	}
+
+	err := transferHolding(trade.ProjectIndex, trade.SellerIndex, trade.BuyerIndex, trade.Units)
+	if err != nil {
+		return err
+	}
+
+	trade.Rekeyed = true
+	return trade.Save()
+}
+
+// transferHolding moves units of a project's investor assets from the seller to the buyer in the project's
+// InvestorMap and InvestorIndices and in both investors' lists of projects
+func transferHolding(projIndex int, sellerIndex int, buyerIndex int, units float64) error {
+	project, err := RetrieveProject(projIndex)
+	if err != nil {
+		return errors.Wrap(err, "couldn't retrieve project")
+	}
+
+	seller, err := RetrieveInvestor(sellerIndex)
+	if err != nil {
+		return errors.Wrap(err, "couldn't retrieve seller")
+	}
+
+	buyer, err := RetrieveInvestor(buyerIndex)
+	if err != nil {
+		return errors.Wrap(err, "couldn't retrieve buyer")
+	}
+
+	sellerPubkey := seller.U.StellarWallet.PublicKey
+	buyerPubkey := buyer.U.StellarWallet.PublicKey
+	share := units / project.unitsPerShare()
+	if project.InvestorMap == nil {
+		project.InvestorMap = make(map[string]float64)
+	}
+	if share > project.InvestorMap[sellerPubkey] {
+		share = project.InvestorMap[sellerPubkey]
+	}
+
+	project.InvestorMap[sellerPubkey] -= share
+	project.InvestorMap[buyerPubkey] += share
+
+	// sellers that have sold everything aren't investors of the project anymore
+	exited := project.InvestorMap[sellerPubkey] < 1e-9 && !seller.holdsOffers(projIndex)
+	if exited {
+		delete(project.InvestorMap, sellerPubkey)
+		project.InvestorIndices = removeIndex(project.InvestorIndices, sellerIndex)
+	}
+
+	if !containsIndex(project.InvestorIndices, buyerIndex) {
+		project.InvestorIndices = append(project.InvestorIndices, buyerIndex)
+	}
+
+	err = project.Save()
+	if err != nil {
+		return errors.Wrap(err, "couldn't save project")
+	}
+
+	if exited {
+		for i := len(seller.InvestedSolarProjectsIndices) - 1; i >= 0; i-- {
+			if seller.InvestedSolarProjectsIndices[i] != projIndex {
+				continue
+			}
+			seller.InvestedSolarProjectsIndices = append(seller.InvestedSolarProjectsIndices[:i],
+				seller.InvestedSolarProjectsIndices[i+1:]...)
+			if i < len(seller.InvestedSolarProjects) {
+				seller.InvestedSolarProjects = append(seller.InvestedSolarProjects[:i], seller.InvestedSolarProjects[i+1:]...)
+			}
+		}
+		err = seller.Save()
+		if err != nil {
+			return errors.Wrap(err, "couldn't save seller")
+		}
+	}
+
+	if containsIndex(buyer.InvestedSolarProjectsIndices, projIndex) {
+		return nil
+	}
+	buyer.InvestedSolarProjects = append(buyer.InvestedSolarProjects, project.InvestorAssetCode)
+	buyer.InvestedSolarProjectsIndices = append(buyer.InvestedSolarProjectsIndices, projIndex)
+	return buyer.Save()
+}
+
+// holdsOffers checks whether the investor has assets of a project listed on an open offer
+func (a Investor) holdsOffers(projIndex int) bool {
+	return ListedUnits(projIndex, a.U.Index) > 0
+}
+
+// ListedUnits returns the number of a project's investor assets an investor has listed on open offers. The
+// assets are in the platform's custody but still belong to the investor
+func ListedUnits(projIndex int, invIndex int) float64 {
+	offers, err := RetrieveProjectOffers(projIndex)
+	if err != nil {
+		log.Println("couldn't retrieve offers of project", projIndex, err)
+		return 0
+	}
+
+	var units float64
+	for _, offer := range offers {
+		if offer.SellerIndex == invIndex && offer.Status == OfferOpen {
+			units += offer.Remaining()
+		}
+	}
+	return units
+}
+
+// containsIndex checks whether arr contains index
+func containsIndex(arr []int, index int) bool {
+	for _, elem := range arr {
+		if elem == index {
+			return true
+		}
+	}
+	return false
+}
+
+// removeIndex returns arr without any occurrence of index
+func removeIndex(arr []int, index int) []int {
+	var result []int
+	for _, elem := range arr {
+		if elem != index {
+			result = append(result, elem)
+		}
+	}
+	return result
+}
+
+// runRekeyJob retries re-keying the project for its settled trades
+func runRekeyJob(job *Job) error {
+	trades, err := RetrieveProjectTrades(job.ProjectIndex)
+	if err != nil {
+		return errors.Wrap(err, "couldn't retrieve trades")
+	}
+
+	pending := false
+	for i := range trades {
+		if trades[i].Status != TradeSettled || trades[i].Rekeyed {
+			continue
+		}
+		err = rekeyTrade(&trades[i])
+		if err != nil {
+			log.Println("couldn't re-key trade", trades[i].Index, err)
+			pending = true
+		}
+	}
+
+	if pending {
+		job.NextRun = utils.Unix() + consts.JobRetryInterval
+		return nil
+	}
+	job.Status = JobDone
+	return nil
+}
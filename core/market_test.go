@@ -0,0 +1,254 @@
+package core
+
+import (
+	"math"
+	"testing"
+
+	chain "github.com/YaleOpenLab/opensolar/chain"
+	consts "github.com/YaleOpenLab/opensolar/consts"
+)
+
+// marketProject sets up a funded project on the mock chain whose first investor holds 100 of its investor assets
+// and returns the project along with its investors
+func marketProject(t *testing.T, m *chain.Mock) (Project, []Investor) {
+	project, _, investors := modelProject(t, m, "munibond", 0)
+	seller := investors[0]
+	project.Stage = 5
+	project.InvestorMap = map[string]float64{seller.U.StellarWallet.PublicKey: 0.1}
+	project.InvestorIndices = []int{seller.U.Index}
+	err := project.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	modelAsset(t, m, project.InvestorAssetCode, 100, testKey("investor1").Seed())
+	return project, investors
+}
+
+// checkAsset checks the balance of the project's investor asset held by an account on the mock chain
+func checkAsset(t *testing.T, m *chain.Mock, project Project, address string, expected float64) {
+	issuer, _, err := m.IssuerSeed(consts.OpenSolarIssuerDir, project.Index, consts.IssuerSeedPwd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	balance, err := m.Balance(address, project.InvestorAssetCode, issuer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance != expected {
+		t.Fatalf("%s holds %f of the investor asset, expected %f", address, balance, expected)
+	}
+}
+
+func TestMarketTrade(t *testing.T) {
+	m, teardown := setupMock(t)
+	defer teardown()
+
+	project, investors := marketProject(t, m)
+	seller, buyer := investors[0], investors[1]
+	sellerSeed, buyerSeed := testKey("investor1").Seed(), testKey("investor2").Seed()
+	err := m.Credit(buyer.U.StellarWallet.PublicKey, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = ListOffer(project.Index, seller.U.Index, sellerSeed, 200, 2)
+	if err == nil {
+		t.Fatalf("offer listed with more assets than the seller holds")
+	}
+
+	offer, err := ListOffer(project.Index, seller.U.Index, sellerSeed, 50, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkAsset(t, m, project, seller.U.StellarWallet.PublicKey, 50)
+	checkAsset(t, m, project, consts.PlatformPublicKey, 50)
+
+	_, err = BuyOffer(offer.Index, seller.U.Index, sellerSeed, 10)
+	if err == nil {
+		t.Fatalf("seller bought their own offer")
+	}
+	_, err = BuyOffer(offer.Index, buyer.U.Index, buyerSeed, 60)
+	if err == nil {
+		t.Fatalf("bought more units than the offer has left")
+	}
+
+	trade, err := BuyOffer(offer.Index, buyer.U.Index, buyerSeed, 25)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trade.Status != TradeSettled || !trade.Rekeyed || trade.Total != 50 {
+		t.Fatalf("unexpected trade %v", trade)
+	}
+	checkAsset(t, m, project, buyer.U.StellarWallet.PublicKey, 25)
+	checkStablecoin(t, m, buyer.U.StellarWallet.PublicKey, 10)
+	checkStablecoin(t, m, seller.U.StellarWallet.PublicKey, 50)
+
+	project, err = RetrieveProject(project.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(project.InvestorMap[seller.U.StellarWallet.PublicKey]-0.075) > 1e-9 ||
+		math.Abs(project.InvestorMap[buyer.U.StellarWallet.PublicKey]-0.025) > 1e-9 {
+		t.Fatalf("investor map after the trade is %v", project.InvestorMap)
+	}
+
+	// a trade that the buyer can't pay for releases the units it reserved
+	trade, err = BuyOffer(offer.Index, buyer.U.Index, buyerSeed, 10)
+	if err == nil || trade.Status != TradeFailed {
+		t.Fatalf("trade settled without the buyer paying for it")
+	}
+	offer, err = RetrieveOffer(offer.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offer.Sold != 25 || offer.Status != OfferOpen {
+		t.Fatalf("units of a failed trade not released, offer %v", offer)
+	}
+
+	// only one of two buyers of the last units gets them
+	err = m.Credit(buyer.U.StellarWallet.PublicKey, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	investor3, err := NewInvestor("investor3", testPwd, testSeedPwd, "investor3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.CreateAccount(investor3.U.StellarWallet.PublicKey)
+	err = m.Credit(investor3.U.StellarWallet.PublicKey, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errs := make(chan error)
+	go func() {
+		_, err := BuyOffer(offer.Index, buyer.U.Index, buyerSeed, 25)
+		errs <- err
+	}()
+	go func() {
+		_, err := BuyOffer(offer.Index, investor3.U.Index, testKey("investor3").Seed(), 25)
+		errs <- err
+	}()
+	var bought int
+	for i := 0; i < 2; i++ {
+		if <-errs == nil {
+			bought++
+		}
+	}
+	if bought != 1 {
+		t.Fatalf("%d buyers bought the last units of the offer", bought)
+	}
+
+	offer, err = RetrieveOffer(offer.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offer.Sold != 50 || offer.Status != OfferFilled {
+		t.Fatalf("offer not filled %v", offer)
+	}
+	checkAsset(t, m, project, consts.PlatformPublicKey, 0)
+}
+
+func TestCancelOffer(t *testing.T) {
+	m, teardown := setupMock(t)
+	defer teardown()
+
+	project, investors := marketProject(t, m)
+	seller, buyer := investors[0], investors[1]
+	err := m.Credit(buyer.U.StellarWallet.PublicKey, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	offer, err := ListOffer(project.Index, seller.U.Index, testKey("investor1").Seed(), 40, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = BuyOffer(offer.Index, buyer.U.Index, testKey("investor2").Seed(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = CancelOffer(offer.Index, buyer.U.Index)
+	if err == nil {
+		t.Fatalf("offer cancelled by someone other than the seller")
+	}
+
+	offer, err = CancelOffer(offer.Index, seller.U.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offer.Status != OfferCancelled || offer.ReturnTx == "" {
+		t.Fatalf("unexpected offer %v", offer)
+	}
+	checkAsset(t, m, project, seller.U.StellarWallet.PublicKey, 90)
+	checkAsset(t, m, project, consts.PlatformPublicKey, 0)
+
+	_, err = CancelOffer(offer.Index, seller.U.Index)
+	if err == nil {
+		t.Fatalf("offer cancelled twice")
+	}
+	_, err = BuyOffer(offer.Index, buyer.U.Index, testKey("investor2").Seed(), 10)
+	if err == nil {
+		t.Fatalf("bought from a cancelled offer")
+	}
+}
+
+func TestTransferHolding(t *testing.T) {
+	m, teardown := setupMock(t)
+	defer teardown()
+
+	project, investors := marketProject(t, m)
+	seller, buyer := investors[0], investors[1]
+	seller.InvestedSolarProjects = []string{project.InvestorAssetCode}
+	seller.InvestedSolarProjectsIndices = []int{project.Index}
+	err := seller.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = transferHolding(project.Index, seller.U.Index, buyer.U.Index, 40)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	project, err = RetrieveProject(project.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(project.InvestorMap[seller.U.StellarWallet.PublicKey]-0.06) > 1e-9 ||
+		math.Abs(project.InvestorMap[buyer.U.StellarWallet.PublicKey]-0.04) > 1e-9 ||
+		len(project.InvestorIndices) != 2 {
+		t.Fatalf("unexpected holdings %v of investors %v", project.InvestorMap, project.InvestorIndices)
+	}
+
+	// a seller who sells everything isn't an investor of the project anymore
+	err = transferHolding(project.Index, seller.U.Index, buyer.U.Index, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	project, err = RetrieveProject(project.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := project.InvestorMap[seller.U.StellarWallet.PublicKey]; exists ||
+		math.Abs(project.InvestorMap[buyer.U.StellarWallet.PublicKey]-0.1) > 1e-9 ||
+		len(project.InvestorIndices) != 1 || project.InvestorIndices[0] != buyer.U.Index {
+		t.Fatalf("seller still holds %v of investors %v", project.InvestorMap, project.InvestorIndices)
+	}
+
+	seller, err = RetrieveInvestor(seller.U.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buyer, err = RetrieveInvestor(buyer.U.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seller.InvestedSolarProjectsIndices) != 0 || len(buyer.InvestedSolarProjectsIndices) != 1 {
+		t.Fatalf("seller invested in %v and buyer in %v", seller.InvestedSolarProjectsIndices,
+			buyer.InvestedSolarProjectsIndices)
+	}
+}
@@ -0,0 +1,291 @@
+package core
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+
+	utils "github.com/Varunram/essentials/utils"
+	"github.com/boltdb/bolt"
+
+	consts "github.com/YaleOpenLab/opensolar/consts"
+)
+
+// tellers post the readings of a project's meter in batches signed with their device key. A reading carries
+// the meter's counters of energy generated, consumed and exported, and the platform derives the energy of the
+// interval since the previous reading from them. Readings are stored as a time series in MeterBucket, with a
+// bucket for every project and device keyed by the timestamp of the reading, so that duplicates and counters
+// going backwards can be caught by looking at the readings next to a new one. RECs and avoided carbon are
+// counted by the time the platform received a reading, so that the backlog of a teller that was offline for a
+// long time is still counted.
+
+// MeterReading is a reading of a project's meter
+type MeterReading struct {
+	ProjectIndex      int     // the index of the project the meter belongs to
+	DeviceId          string  // the id of the device that took the reading
+	Timestamp         int64   // unix time at which the reading was taken
+	Generated         float64 // the meter's counter of energy generated in kWh
+	Consumed          float64 // the meter's counter of energy consumed in kWh
+	Exported          float64 // the meter's counter of energy exported to the grid in kWh
+	GeneratedInterval float64 // the energy generated since the previous reading in kWh
+	ConsumedInterval  float64 // the energy consumed since the previous reading in kWh
+	ExportedInterval  float64 // the energy exported since the previous reading in kWh
+	ReceivedAt        int64   // unix time at which the platform received the reading
+}
+
+// RejectedReading is a reading that was not accepted along with the reason why
+type RejectedReading struct {
+	Timestamp int64  // the timestamp of the reading
+	Reason    string // why the reading was rejected
+}
+
+// MeterIngestResult lists which readings of a batch were accepted and which were rejected
+type MeterIngestResult struct {
+	Accepted     []MeterReading
+	Rejected     []RejectedReading
+	Disconnected bool // set while the project is disconnected, the teller switches the recipient to the grid then
+}
+
+// meterSeriesKey returns the key of the bucket that stores the readings of a device of a project
+func meterSeriesKey(projIndex int, deviceId string) ([]byte, error) {
+	projIndexString, err := utils.ToString(projIndex)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(projIndexString + "/" + deviceId), nil
+}
+
+// meterTimestampKey returns the key a reading is stored at. Keys sort in the order of the readings' timestamps
+func meterTimestampKey(timestamp int64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(timestamp))
+	return key
+}
+
+// validCounter checks whether a meter counter holds a usable value
+func validCounter(x float64) bool {
+	return !math.IsNaN(x) && !math.IsInf(x, 0) && x >= 0
+}
+
+// validate checks the values of a reading on their own
+func (reading MeterReading) validate(now int64) error {
+	if reading.Timestamp <= 0 {
+		return errors.New("timestamp must be positive")
+	}
+	if reading.Timestamp > now+consts.MeterClockSkew {
+		return errors.New("timestamp is in the future")
+	}
+	if !validCounter(reading.Generated) || !validCounter(reading.Consumed) || !validCounter(reading.Exported) {
+		return errors.New("counters must be non negative numbers")
+	}
+	return nil
+}
+
+// setInterval computes the energy of the interval since prev and checks that the counters haven't gone
+// backwards and that the average power over the interval is within range
+func (reading *MeterReading) setInterval(prev MeterReading) error {
+	reading.GeneratedInterval = reading.Generated - prev.Generated
+	reading.ConsumedInterval = reading.Consumed - prev.Consumed
+	reading.ExportedInterval = reading.Exported - prev.Exported
+	if reading.GeneratedInterval < 0 || reading.ConsumedInterval < 0 || reading.ExportedInterval < 0 {
+		return errors.New("counters can't decrease between readings")
+	}
+
+	hours := float64(reading.Timestamp-prev.Timestamp) / 3600
+	maxEnergy := consts.MaxMeterPower * hours
+	if reading.GeneratedInterval > maxEnergy || reading.ConsumedInterval > maxEnergy || reading.ExportedInterval > maxEnergy {
+		return errors.New("energy in interval exceeds what the meter can measure")
+	}
+	return nil
+}
+
+// decodeMeterReading decodes a stored reading
+func decodeMeterReading(value []byte) (MeterReading, error) {
+	var reading MeterReading
+	err := json.Unmarshal(value, &reading)
+	if err != nil {
+		return reading, errors.New("could not unmarshal json")
+	}
+	return reading, nil
+}
+
+// storeMeterReading validates a reading against the readings next to it in series and stores it. A reading
+// that would split the interval of a reading received before counted is rejected, since the energy of that
+// interval has been counted towards RECs and carbon already. It returns whether the reading is the latest
+// one in the series
+func storeMeterReading(series *bolt.Bucket, reading *MeterReading, counted int64) (bool, error) {
+	key := meterTimestampKey(reading.Timestamp)
+	if series.Get(key) != nil {
+		return false, errors.New("duplicate reading")
+	}
+
+	c := series.Cursor()
+	nextKey, nextValue := c.Seek(key)
+	var prevKey, prevValue []byte
+	if nextKey == nil {
+		prevKey, prevValue = c.Last()
+	} else {
+		prevKey, prevValue = c.Prev()
+	}
+
+	if prevKey != nil {
+		prev, err := decodeMeterReading(prevValue)
+		if err != nil {
+			return false, err
+		}
+		err = reading.setInterval(prev)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	if nextKey != nil {
+		// the reading arrived late, the interval of the reading after it now starts at this one
+		next, err := decodeMeterReading(nextValue)
+		if err != nil {
+			return false, err
+		}
+		if next.ReceivedAt < counted {
+			return false, errors.New("reading falls inside an interval that was counted towards RECs and carbon")
+		}
+		err = next.setInterval(*reading)
+		if err != nil {
+			return false, err
+		}
+		value, err := json.Marshal(next)
+		if err != nil {
+			return false, err
+		}
+		err = series.Put(nextKey, value)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	value, err := json.Marshal(reading)
+	if err != nil {
+		return false, err
+	}
+	return nextKey == nil, series.Put(key, value)
+}
+
+// IngestMeterReadings stores a batch of readings posted for a device of a project. The batch is the json encoded
+// list of readings and has to be signed by the device. Readings that are invalid, duplicates or inconsistent
+// with the readings already stored are rejected without affecting the rest of the batch. The energy consumed
+// since the latest reading is reported for billing unless the project is disconnected
+func IngestMeterReadings(projIndex int, recpIndex int, deviceId string, batch []byte, signature string) (MeterIngestResult, error) {
+	var result MeterIngestResult
+	project, err := RetrieveProject(projIndex)
+	if err != nil {
+		return result, errors.Wrap(err, "couldn't retrieve project")
+	}
+
+	if project.RecipientIndex != recpIndex {
+		return result, errors.New("recipient not associated with project")
+	}
+
+	recipient, err := RetrieveRecipient(recpIndex)
+	if err != nil {
+		return result, errors.Wrap(err, "couldn't retrieve recipient")
+	}
+
+	err = recipient.VerifyDeviceSignature(deviceId, batch, signature)
+	if err != nil {
+		return result, errors.Wrap(err, "couldn't verify meter readings")
+	}
+
+	var readings []MeterReading
+	err = json.Unmarshal(batch, &readings)
+	if err != nil {
+		return result, errors.New("could not unmarshal json")
+	}
+
+	if len(readings) == 0 || len(readings) > consts.MaxMeterBatch {
+		return result, errors.New("batch must contain between 1 and " + strconv.Itoa(consts.MaxMeterBatch) + " readings")
+	}
+
+	seriesKey, err := meterSeriesKey(projIndex, deviceId)
+	if err != nil {
+		return result, err
+	}
+
+	sort.SliceStable(readings, func(i, j int) bool {
+		return readings[i].Timestamp < readings[j].Timestamp
+	})
+
+	db, err := OpenDB()
+	if err != nil {
+		return result, errors.Wrap(err, "couldn't open database")
+	}
+	defer db.Close()
+
+	// readings received before the cursors have been counted towards RECs and avoided carbon already
+	counted := project.RECCursor
+	if project.CarbonCursor > counted {
+		counted = project.CarbonCursor
+	}
+
+	var billable []MeterReading
+	now := utils.Unix()
+	err = db.Update(func(tx *bolt.Tx) error {
+		root, err := tx.CreateBucketIfNotExists(MeterBucket)
+		if err != nil {
+			return err
+		}
+		series, err := root.CreateBucketIfNotExists(seriesKey)
+		if err != nil {
+			return err
+		}
+
+		for _, reading := range readings {
+			reading.ProjectIndex = projIndex
+			reading.DeviceId = deviceId
+			reading.GeneratedInterval, reading.ConsumedInterval, reading.ExportedInterval = 0, 0, 0
+			reading.ReceivedAt = now
+
+			err := reading.validate(now)
+			if err != nil {
+				result.Rejected = append(result.Rejected, RejectedReading{Timestamp: reading.Timestamp, Reason: err.Error()})
+				continue
+			}
+
+			latest, err := storeMeterReading(series, &reading, counted)
+			if err != nil {
+				result.Rejected = append(result.Rejected, RejectedReading{Timestamp: reading.Timestamp, Reason: err.Error()})
+				continue
+			}
+
+			result.Accepted = append(result.Accepted, reading)
+			if latest {
+				// late readings split an interval that has already been reported, so only new ones are billed
+				billable = append(billable, reading)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return result, errors.Wrap(err, "couldn't store meter readings")
+	}
+
+	// the recipient is supplied by the grid while the project is disconnected, so there is no energy to bill
+	result.Disconnected = project.Disconnected
+	if project.Disconnected {
+		return result, nil
+	}
+
+	for _, reading := range billable {
+		if project.BillingPeriodStart == 0 || reading.Timestamp < project.BillingPeriodStart || reading.ConsumedInterval == 0 {
+			continue
+		}
+		_, err = ReportEnergy(projIndex, recpIndex, reading.ConsumedInterval, reading.Timestamp)
+		if err != nil {
+			log.Println("couldn't report energy of meter reading for billing", err)
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,232 @@
+package core
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+
+	utils "github.com/Varunram/essentials/utils"
+	"github.com/boltdb/bolt"
+)
+
+// meterProject saves project 1 with an investor and a recipient whose teller has an approved device
+func meterProject(t *testing.T) (Recipient, ed25519.PrivateKey) {
+	recipient, err := NewRecipient("recipient", testPwd, testSeedPwd, "Recipient")
+	if err != nil {
+		t.Fatal(err)
+	}
+	investor, err := NewInvestor("investor", testPwd, testSeedPwd, "Investor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	privkey, pubkey := deviceKey(t)
+	err = recipient.RegisterDevice("device1", pubkey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipient, err = ApproveDevice(recipient.U.Index, pubkey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	project := Project{
+		Index:           1,
+		RecipientIndex:  recipient.U.Index,
+		InvestorIndices: []int{investor.U.Index},
+		InvestorMap:     map[string]float64{investor.U.StellarWallet.PublicKey: 1},
+	}
+	err = project.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return recipient, privkey
+}
+
+// postReadings signs a batch of readings with the device key and ingests it
+func postReadings(t *testing.T, privkey ed25519.PrivateKey, recpIndex int, readings []MeterReading) MeterIngestResult {
+	batch, err := json.Marshal(readings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := IngestMeterReadings(1, recpIndex, "device1", batch, hex.EncodeToString(ed25519.Sign(privkey, batch)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+// ageMeterReadings moves the time at which the platform received the stored readings of a project back by
+// seconds, as if they had been received that long ago
+func ageMeterReadings(t *testing.T, seconds int64) {
+	db, err := OpenDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		series := tx.Bucket(MeterBucket).Bucket([]byte("1/device1"))
+		var readings []MeterReading
+		err := series.ForEach(func(key []byte, value []byte) error {
+			reading, err := decodeMeterReading(value)
+			readings = append(readings, reading)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, reading := range readings {
+			reading.ReceivedAt -= seconds
+			value, err := json.Marshal(reading)
+			if err != nil {
+				return err
+			}
+			err = series.Put(meterTimestampKey(reading.Timestamp), value)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// countGeneration counts the readings received before end towards RECs and carbon and checks the generation
+// counted so far
+func countGeneration(t *testing.T, end int64, expected float64) {
+	_, err := IssueRECs(1, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = AccountCarbon(1, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	project, err := RetrieveProject(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if project.RECPending != expected || project.CarbonGeneration != expected {
+		t.Fatalf("%f kWh pending as RECs and %f counted towards carbon, expected %f", project.RECPending,
+			project.CarbonGeneration, expected)
+	}
+}
+
+func TestLateMeterReadings(t *testing.T) {
+	teardown := setupPlatform(t)
+	defer teardown()
+
+	recipient, privkey := meterProject(t)
+
+	// readings taken ten days ago that reached the platform two days ago are counted
+	start := utils.Unix() - 10*24*60*60
+	result := postReadings(t, privkey, recipient.U.Index, []MeterReading{
+		{Timestamp: start, Generated: 0},
+		{Timestamp: start + 3600, Generated: 1},
+	})
+	if len(result.Accepted) != 2 {
+		t.Fatalf("readings rejected %v", result.Rejected)
+	}
+	ageMeterReadings(t, 2*24*60*60)
+	countGeneration(t, utils.Unix()-24*60*60, 1)
+
+	// the backlog of a teller that was offline since then is accepted and counted in the next run
+	result = postReadings(t, privkey, recipient.U.Index, []MeterReading{
+		{Timestamp: start + 7200, Generated: 3},
+	})
+	if len(result.Accepted) != 1 {
+		t.Fatalf("backlog of an offline teller rejected %v", result.Rejected)
+	}
+
+	// a reading that splits an interval that has been counted would count its energy twice
+	result = postReadings(t, privkey, recipient.U.Index, []MeterReading{
+		{Timestamp: start + 1800, Generated: 0.5},
+	})
+	if len(result.Rejected) != 1 {
+		t.Fatalf("reading inside a counted interval accepted %v", result.Accepted)
+	}
+
+	countGeneration(t, utils.Unix()+1, 3)
+}
+
+func TestIngestMeterReadings(t *testing.T) {
+	teardown := setupPlatform(t)
+	defer teardown()
+
+	recipient, privkey := meterProject(t)
+	now := utils.Unix()
+	start := now - 5*3600
+	project, err := RetrieveProject(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	project.BillingPeriodStart = start
+	err = project.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	batch := []byte(`[{"Timestamp": 1}]`)
+	_, err = IngestMeterReadings(1, recipient.U.Index, "device1", batch, hex.EncodeToString(ed25519.Sign(privkey, []byte("batch"))))
+	if err == nil {
+		t.Fatalf("batch with a signature over other data accepted")
+	}
+	batch = []byte(`[]`)
+	_, err = IngestMeterReadings(1, recipient.U.Index, "device1", batch, hex.EncodeToString(ed25519.Sign(privkey, batch)))
+	if err == nil {
+		t.Fatalf("empty batch accepted")
+	}
+
+	// invalid readings are rejected without affecting the rest of the batch
+	result := postReadings(t, privkey, recipient.U.Index, []MeterReading{
+		{Timestamp: start},
+		{Timestamp: start + 3600, Generated: 1, Consumed: 2},
+		{Timestamp: start + 3600, Generated: 1, Consumed: 2},
+		{Timestamp: start + 7200, Generated: 0.5},
+		{Timestamp: start + 10800, Generated: 5000},
+		{Timestamp: start + 14400, Generated: -1},
+		{Timestamp: now + 3600, Generated: 2},
+	})
+	if len(result.Accepted) != 2 || len(result.Rejected) != 5 {
+		t.Fatalf("accepted %v and rejected %v", result.Accepted, result.Rejected)
+	}
+	if result.Accepted[1].GeneratedInterval != 1 || result.Accepted[1].ConsumedInterval != 2 {
+		t.Fatalf("unexpected interval %v", result.Accepted[1])
+	}
+
+	// the energy consumed since the latest reading is billed
+	project, err = RetrieveProject(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if project.EnergyCP != 2 {
+		t.Fatalf("%f kWh billed, expected 2", project.EnergyCP)
+	}
+
+	// a late reading splits the interval of the reading after it without being billed again
+	result = postReadings(t, privkey, recipient.U.Index, []MeterReading{
+		{Timestamp: start + 1800, Generated: 0.25, Consumed: 1},
+	})
+	if len(result.Accepted) != 1 {
+		t.Fatalf("late reading rejected %v", result.Rejected)
+	}
+	readings, err := RetrieveProjectMeterReadings(1, start, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(readings) != 3 || readings[2].GeneratedInterval != 0.75 || readings[2].ConsumedInterval != 1 {
+		t.Fatalf("interval after a late reading not split %v", readings)
+	}
+	project, err = RetrieveProject(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if project.EnergyCP != 2 {
+		t.Fatalf("late reading billed again, %f kWh billed", project.EnergyCP)
+	}
+}
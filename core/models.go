@@ -7,19 +7,13 @@ import (
 
 	utils "github.com/Varunram/essentials/utils"
 
-	stablecoin "github.com/YaleOpenLab/openx/chains/stablecoin"
-	xlm "github.com/YaleOpenLab/openx/chains/xlm"
-	assets "github.com/YaleOpenLab/openx/chains/xlm/assets"
-	issuer "github.com/YaleOpenLab/openx/chains/xlm/issuer"
-	wallet "github.com/YaleOpenLab/openx/chains/xlm/wallet"
-
+	chain "github.com/YaleOpenLab/opensolar/chain"
 	consts "github.com/YaleOpenLab/opensolar/consts"
 	notif "github.com/YaleOpenLab/opensolar/notif"
-	oracle "github.com/YaleOpenLab/opensolar/oracle"
 )
 
 // MunibondInvest invests in a specific munibond
-func MunibondInvest(issuerPath string, invIndex int, invSeed string, invAmount float64,
+func MunibondInvest(c chain.Chain, issuerPath string, invIndex int, invSeed string, invAmount float64,
 	projIndex int, invAssetCode string, totalValue float64, seedInvestmentFactor float64, seed bool) error {
 
 	var err error
@@ -29,11 +23,9 @@ func MunibondInvest(issuerPath string, invIndex int, invSeed string, invAmount f
 		return errors.Wrap(err, "Unable to retrieve investor from database")
 	}
 
-	if !consts.Mainnet {
-		err = stablecoin.OfferExchange(investor.U.StellarWallet.PublicKey, invSeed, invAmount)
-		if err != nil {
-			return errors.Wrap(err, "Unable to offer xlm to STABLEUSD excahnge for investor")
-		}
+	err = c.BuyStablecoin(invSeed, invAmount)
+	if err != nil {
+		return errors.Wrap(err, "Unable to offer xlm to STABLEUSD excahnge for investor")
 	}
 
 	projIndexString, err := utils.ToString(projIndex)
@@ -41,38 +33,46 @@ func MunibondInvest(issuerPath string, invIndex int, invSeed string, invAmount f
 		return err
 	}
 
-	stableTxHash, err := SendUSDToPlatform(invSeed, invAmount, "Opensolar investment: "+projIndexString)
+	stableTxHash, err := SendUSDToPlatform(c, invSeed, invAmount, "Opensolar investment: "+projIndexString)
 	if err != nil {
 		return errors.Wrap(err, "Unable to send STABLEUSD to platform")
 	}
 
-	issuerPubkey, issuerSeed, err := wallet.RetrieveSeed(issuer.GetPath(issuerPath, projIndex), consts.IssuerSeedPwd)
+	issuerPubkey, issuerSeed, err := c.IssuerSeed(issuerPath, projIndex, consts.IssuerSeedPwd)
 	if err != nil {
 		return errors.Wrap(err, "Unable to retrieve seed")
 	}
 
-	InvestorAsset := assets.CreateAsset(invAssetCode, issuerPubkey)
+	investorAddress, err := c.Address(investor.U.StellarWallet.PublicKey)
+	if err != nil {
+		return errors.Wrap(err, "Unable to get address of investor")
+	}
 
-	invTrustTxHash, err := assets.TrustAsset(InvestorAsset.GetCode(), issuerPubkey, totalValue, invSeed)
+	_, err = c.IssueAsset(invAssetCode, totalValue, issuerSeed)
+	if err != nil {
+		return errors.Wrap(err, "Error while issuing investor asset")
+	}
+
+	invTrustTxHash, err := c.TrustAsset(invAssetCode, issuerPubkey, totalValue, invSeed)
 	if err != nil {
 		return errors.Wrap(err, "Error while trusting investor asset")
 	}
 
-	log.Printf("Investor trusts InvAsset %s with txhash %s", InvestorAsset.GetCode(), invTrustTxHash)
-	_, invAssetTxHash, err := assets.SendAssetFromIssuer(InvestorAsset.GetCode(), investor.U.StellarWallet.PublicKey, invAmount, issuerSeed, issuerPubkey)
+	log.Printf("Investor trusts InvAsset %s with txhash %s", invAssetCode, invTrustTxHash)
+	invAssetTxHash, err := c.SendAsset(invAssetCode, issuerPubkey, investorAddress, invAmount, issuerSeed, "")
 	if err != nil {
 		return errors.Wrap(err, "Error while sending out investor asset")
 	}
 
-	log.Printf("Sent InvAsset %s to investor %s with txhash %s", InvestorAsset.GetCode(), investor.U.StellarWallet.PublicKey, invAssetTxHash)
+	log.Printf("Sent InvAsset %s to investor %s with txhash %s", invAssetCode, investorAddress, invAssetTxHash)
 
 	investor.AmountInvested += invAmount
 
 	if seed {
-		investor.SeedInvestedSolarProjects = append(investor.InvestedSolarProjects, InvestorAsset.GetCode())
+		investor.SeedInvestedSolarProjects = append(investor.InvestedSolarProjects, invAssetCode)
 		investor.SeedInvestedSolarProjectsIndices = append(investor.InvestedSolarProjectsIndices, projIndex)
 	} else {
-		investor.InvestedSolarProjects = append(investor.InvestedSolarProjects, InvestorAsset.GetCode())
+		investor.InvestedSolarProjects = append(investor.InvestedSolarProjects, invAssetCode)
 		investor.InvestedSolarProjectsIndices = append(investor.InvestedSolarProjectsIndices, projIndex)
 	}
 
@@ -88,7 +88,7 @@ func MunibondInvest(issuerPath string, invIndex int, invSeed string, invAmount f
 }
 
 // MunibondReceive sends assets to the recipient
-func MunibondReceive(issuerPath string, recpIndex int, projIndex int, debtAssetId string,
+func MunibondReceive(c chain.Chain, issuerPath string, recpIndex int, projIndex int, debtAssetId string,
 	paybackAssetId string, years int, recpSeed string, totalValue float64, paybackPeriod int) error {
 
 	log.Println("Retrieving recipient")
@@ -98,13 +98,15 @@ func MunibondReceive(issuerPath string, recpIndex int, projIndex int, debtAssetI
 	}
 
 	log.Println("Retrieving issuer")
-	issuerPubkey, issuerSeed, err := wallet.RetrieveSeed(issuer.GetPath(issuerPath, projIndex), consts.IssuerSeedPwd)
+	issuerPubkey, issuerSeed, err := c.IssuerSeed(issuerPath, projIndex, consts.IssuerSeedPwd)
 	if err != nil {
 		return errors.Wrap(err, "Unable to retrieve issuer seed")
 	}
 
-	DebtAsset := assets.CreateAsset(debtAssetId, issuerPubkey)
-	PaybackAsset := assets.CreateAsset(paybackAssetId, issuerPubkey)
+	recipientAddress, err := c.Address(recipient.U.StellarWallet.PublicKey)
+	if err != nil {
+		return errors.Wrap(err, "Unable to get address of recipient")
+	}
 
 	if years == 0 {
 		years = 1
@@ -112,39 +114,49 @@ func MunibondReceive(issuerPath string, recpIndex int, projIndex int, debtAssetI
 
 	pbAmtTrust := float64(years * 12 * 2)
 
-	paybackTrustHash, err := assets.TrustAsset(PaybackAsset.GetCode(), issuerPubkey, pbAmtTrust, recpSeed)
+	_, err = c.IssueAsset(paybackAssetId, pbAmtTrust, issuerSeed)
+	if err != nil {
+		return errors.Wrap(err, "Error while issuing payback asset")
+	}
+
+	paybackTrustHash, err := c.TrustAsset(paybackAssetId, issuerPubkey, pbAmtTrust, recpSeed)
 	if err != nil {
 		return errors.Wrap(err, "Error while trusting Payback Asset")
 	}
-	log.Printf("Recipient Trusts Payback asset %s with txhash %s", PaybackAsset.GetCode(), paybackTrustHash)
+	log.Printf("Recipient Trusts Payback asset %s with txhash %s", paybackAssetId, paybackTrustHash)
 
-	_, paybackAssetHash, err := assets.SendAssetFromIssuer(PaybackAsset.GetCode(), recipient.U.StellarWallet.PublicKey, pbAmtTrust, issuerSeed, issuerPubkey) // same amount as debt
+	paybackAssetHash, err := c.SendAsset(paybackAssetId, issuerPubkey, recipientAddress, pbAmtTrust, issuerSeed, "") // same amount as debt
 	if err != nil {
 		return errors.Wrap(err, "Error while sending payback asset from issue")
 	}
 
-	log.Printf("Sent PaybackAsset to recipient %s with txhash %s", recipient.U.StellarWallet.PublicKey, paybackAssetHash)
+	log.Printf("Sent PaybackAsset to recipient %s with txhash %s", recipientAddress, paybackAssetHash)
+
+	_, err = c.IssueAsset(debtAssetId, totalValue*2, issuerSeed)
+	if err != nil {
+		return errors.Wrap(err, "Error while issuing debt asset")
+	}
 
-	debtTrustHash, err := assets.TrustAsset(DebtAsset.GetCode(), issuerPubkey, totalValue*2, recpSeed)
+	debtTrustHash, err := c.TrustAsset(debtAssetId, issuerPubkey, totalValue*2, recpSeed)
 	if err != nil {
 		return errors.Wrap(err, "Error while trusting debt asset")
 	}
-	log.Printf("Recipient Trusts Debt asset %s with txhash %s", DebtAsset.GetCode(), debtTrustHash)
+	log.Printf("Recipient Trusts Debt asset %s with txhash %s", debtAssetId, debtTrustHash)
 
-	_, recpDebtAssetHash, err := assets.SendAssetFromIssuer(DebtAsset.GetCode(), recipient.U.StellarWallet.PublicKey, totalValue, issuerSeed, issuerPubkey) // same amount as debt
+	recpDebtAssetHash, err := c.SendAsset(debtAssetId, issuerPubkey, recipientAddress, totalValue, issuerSeed, "") // same amount as debt
 	if err != nil {
 		return errors.Wrap(err, "Error while sending debt asset")
 	}
 
-	log.Printf("Sent DebtAsset to recipient %s with txhash %s\n", recipient.U.StellarWallet.PublicKey, recpDebtAssetHash)
-	recipient.ReceivedSolarProjects = append(recipient.ReceivedSolarProjects, DebtAsset.GetCode())
+	log.Printf("Sent DebtAsset to recipient %s with txhash %s\n", recipientAddress, recpDebtAssetHash)
+	recipient.ReceivedSolarProjects = append(recipient.ReceivedSolarProjects, debtAssetId)
 	recipient.ReceivedSolarProjectIndices = append(recipient.ReceivedSolarProjectIndices, projIndex)
 	err = recipient.Save()
 	if err != nil {
 		return errors.Wrap(err, "couldn't save recipient")
 	}
 
-	txhash, err := issuer.FreezeIssuer(issuerPath, projIndex, "blah")
+	txhash, err := c.FreezeIssuer(issuerPath, projIndex, consts.IssuerSeedPwd)
 	if err != nil {
 		return errors.Wrap(err, "Error while freezing issuer")
 	}
@@ -190,136 +202,316 @@ func sendPaymentNotif(recpIndex int, projIndex int, paybackPeriod int, email str
 
 // MunibondPayback is used by the recipient to pay the platform back. Here, we pay the
 // project escrow instead of the platform since it is responsible for redistribution of funds
-func MunibondPayback(issuerPath string, recpIndex int, amount float64, recipientSeed string, projIndex int,
-	assetName string, projectInvestors []int, totalValue float64, escrowPubkey string) (float64, error) {
+func MunibondPayback(c chain.Chain, issuerPath string, recpIndex int, amount float64, recipientSeed string, projIndex int,
+	assetName string, projectInvestors []int, totalValue float64, escrowPubkey string) (float64, string, error) {
 
 	recipient, err := RetrieveRecipient(recpIndex)
 	if err != nil {
-		return -1, errors.Wrap(err, "Error while retrieving recipient from database")
+		return -1, "", errors.Wrap(err, "Error while retrieving recipient from database")
 	}
 
-	issuerPubkey, _, err := wallet.RetrieveSeed(issuer.GetPath(issuerPath, projIndex), consts.IssuerSeedPwd)
+	issuerPubkey, _, err := c.IssuerSeed(issuerPath, projIndex, consts.IssuerSeedPwd)
 	if err != nil {
-		return -1, errors.Wrap(err, "Unable to retrieve issuer seed")
+		return -1, "", errors.Wrap(err, "Unable to retrieve issuer seed")
 	}
 
-	monthlyBill := oracle.MonthlyBill()
+	recipientAddress, err := c.Address(recipient.U.StellarWallet.PublicKey)
 	if err != nil {
-		return -1, errors.Wrap(err, "Unable to fetch oracle price, exiting")
+		return -1, "", errors.Wrap(err, "Unable to get address of recipient")
 	}
 
-	log.Println("Retrieved average price from oracle: ", monthlyBill)
+	// the recipient must at least pay for the energy they have been invoiced for
+	monthlyBill, err := AmountInvoiced(projIndex)
+	if err != nil {
+		return -1, "", errors.Wrap(err, "Unable to retrieve invoices, exiting")
+	}
+
+	log.Println("Amount invoiced for energy used: ", monthlyBill)
 
 	if amount < monthlyBill {
-		return -1, errors.New("amount paid is less than amount needed. Please refill your main account")
+		return -1, "", errors.New("amount paid is less than amount needed. Please refill your main account")
 	}
 
-	err = stablecoin.OfferExchange(recipient.U.StellarWallet.PublicKey, recipientSeed, amount)
+	err = c.BuyStablecoin(recipientSeed, amount)
 	if err != nil {
-		return -1, errors.Wrap(err, "Unable to offer xlm to STABLEUSD exchange for investor")
+		return -1, "", errors.Wrap(err, "Unable to offer xlm to STABLEUSD exchange for investor")
 	}
 
-	StableBalance, err := xlm.GetAssetBalance(recipient.U.StellarWallet.PublicKey, "STABLEUSD")
+	code, issuer := c.Stablecoin()
+	StableBalance, err := c.Balance(recipientAddress, code, issuer)
+	if err != nil {
+		return -1, "", errors.Wrap(err, "Unable to retrieve stablecoin balance of recipient")
+	}
 
-	if err != nil || (StableBalance < amount) {
-		return -1, errors.Wrap(err, "You do not have the required stablecoin balance, please refill")
+	if StableBalance < amount {
+		return -1, "", errors.New("You do not have the required stablecoin balance, please refill")
 	}
 
 	projIndexString, err := utils.ToString(projIndex)
 	if err != nil {
-		return -1, err
+		return -1, "", err
 	}
 
-	var stablecoinHash string
-	if !consts.Mainnet {
-		_, stablecoinHash, err = assets.SendAsset(consts.StablecoinCode, consts.StablecoinPublicKey, escrowPubkey, amount, recipientSeed, "Opensolar payback: "+projIndexString)
-		if err != nil {
-			return -1, errors.Wrap(err, "Error while sending STABLEUSD back")
-		}
-	} else {
-		_, stablecoinHash, err = assets.SendAsset(consts.AnchorUSDCode, consts.AnchorUSDAddress, escrowPubkey, amount, recipientSeed, "Opensolar payback: "+projIndexString)
-		if err != nil {
-			return -1, errors.Wrap(err, "Error while sending STABLEUSD back")
-		}
-	}
-
-	log.Println("Paid", amount, " back to platform in stableUSD, txhash", stablecoinHash)
-
-	_, debtPaybackHash, err := assets.SendAssetToIssuer(assetName, issuerPubkey, amount, recipientSeed)
+	// the stablecoin is paid into the escrow and the debt asset is burnt in the same transaction, so that a payback
+	// either goes through in full or leaves the recipient's funds where they are
+	payment := chain.Transfer{Code: code, Issuer: issuer, Dest: escrowPubkey, Amount: amount, Seed: recipientSeed}
+	debtPayback := chain.Transfer{Code: assetName, Issuer: issuerPubkey, Dest: issuerPubkey, Amount: amount, Seed: recipientSeed}
+	txhash, err := c.Swap(payment, debtPayback, "Opensolar payback: "+projIndexString)
 	if err != nil {
-		return -1, errors.Wrap(err, "Error while sending debt asset back")
+		return -1, "", errors.Wrap(err, "Error while paying back STABLEUSD and DebtAsset")
 	}
-	log.Println("Paid", amount, " back to platform in DebtAsset, txhash", debtPaybackHash)
+
+	log.Println("Paid", amount, " back to platform in stableUSD and DebtAsset, txhash", txhash)
 
 	ownershipAmt := amount - monthlyBill
 	ownershipPct := ownershipAmt / totalValue
 	if recipient.U.Notification {
-		notif.SendPaybackNotifToRecipient(projIndex, recipient.U.Email, stablecoinHash, debtPaybackHash)
+		notif.SendPaybackNotifToRecipient(projIndex, recipient.U.Email, txhash, txhash)
 	}
 
-	for _, i := range projectInvestors {
+	for _, i := range uniqueIndices(projectInvestors) {
 		investor, err := RetrieveInvestor(i)
 		if err != nil {
 			log.Println("Error while retrieving investor from list of investors", err)
 			continue
 		}
 		if investor.U.Notification {
-			notif.SendPaybackNotifToInvestor(projIndex, investor.U.Email, stablecoinHash, debtPaybackHash)
+			notif.SendPaybackNotifToInvestor(projIndex, investor.U.Email, txhash, txhash)
 		}
 	}
 
-	return ownershipPct, nil
+	return ownershipPct, txhash, nil
 }
 
-// SendUSDToPlatform sends STABLEUSD back to the platform
-func SendUSDToPlatform(invSeed string, invAmount float64, memo string) (string, error) {
-	// send stableusd to the platform (not the issuer) since the issuer will be locked
-	// and we can't use the funds. We also need ot be able to redeem the stablecoin for fiat
-	// so we can't burn them
-	var oldPlatformBalance float64
+// EquityInvest invests in a specific equity project. Investors receive shares out of the project's fixed
+// share count in proportion to the amount they invest
+func EquityInvest(c chain.Chain, issuerPath string, invIndex int, invSeed string, invAmount float64,
+	projIndex int, shareAssetCode string, totalValue float64, shareCount float64, seed bool) error {
+
 	var err error
-	var txhash string
 
-	if !consts.Mainnet {
-		oldPlatformBalance, err = xlm.GetAssetBalance(consts.PlatformPublicKey, consts.StablecoinCode)
+	if shareCount <= 0 {
+		return errors.New("share count of equity project not set, quitting")
+	}
+
+	investor, err := RetrieveInvestor(invIndex)
+	if err != nil {
+		return errors.Wrap(err, "Unable to retrieve investor from database")
+	}
+
+	err = c.BuyStablecoin(invSeed, invAmount)
+	if err != nil {
+		return errors.Wrap(err, "Unable to offer xlm to STABLEUSD excahnge for investor")
+	}
+
+	projIndexString, err := utils.ToString(projIndex)
+	if err != nil {
+		return err
+	}
+
+	stableTxHash, err := SendUSDToPlatform(c, invSeed, invAmount, "Opensolar investment: "+projIndexString)
+	if err != nil {
+		return errors.Wrap(err, "Unable to send STABLEUSD to platform")
+	}
+
+	issuerPubkey, issuerSeed, err := c.IssuerSeed(issuerPath, projIndex, consts.IssuerSeedPwd)
+	if err != nil {
+		return errors.Wrap(err, "Unable to retrieve seed")
+	}
+
+	investorAddress, err := c.Address(investor.U.StellarWallet.PublicKey)
+	if err != nil {
+		return errors.Wrap(err, "Unable to get address of investor")
+	}
+
+	shares := invAmount / totalValue * shareCount
+
+	_, err = c.IssueAsset(shareAssetCode, shareCount, issuerSeed)
+	if err != nil {
+		return errors.Wrap(err, "Error while issuing share asset")
+	}
+
+	shareTrustTxHash, err := c.TrustAsset(shareAssetCode, issuerPubkey, shareCount, invSeed)
+	if err != nil {
+		return errors.Wrap(err, "Error while trusting share asset")
+	}
+
+	log.Printf("Investor trusts ShareAsset %s with txhash %s", shareAssetCode, shareTrustTxHash)
+	shareAssetTxHash, err := c.SendAsset(shareAssetCode, issuerPubkey, investorAddress, shares, issuerSeed, "")
+	if err != nil {
+		return errors.Wrap(err, "Error while sending out share asset")
+	}
+
+	log.Printf("Sent %f shares of %s to investor %s with txhash %s", shares, shareAssetCode, investorAddress, shareAssetTxHash)
+
+	investor.AmountInvested += invAmount
+
+	if seed {
+		investor.SeedInvestedSolarProjects = append(investor.SeedInvestedSolarProjects, shareAssetCode)
+		investor.SeedInvestedSolarProjectsIndices = append(investor.SeedInvestedSolarProjectsIndices, projIndex)
+	} else {
+		investor.InvestedSolarProjects = append(investor.InvestedSolarProjects, shareAssetCode)
+		investor.InvestedSolarProjectsIndices = append(investor.InvestedSolarProjectsIndices, projIndex)
+	}
+
+	err = investor.Save()
+	if err != nil {
+		return err
+	}
+
+	if investor.U.Notification {
+		if seed {
+			notif.SendSeedInvestmentNotifToInvestor(projIndex, investor.U.Email, stableTxHash, shareTrustTxHash, shareAssetTxHash)
+		} else {
+			notif.SendInvestmentNotifToInvestor(projIndex, investor.U.Email, stableTxHash, shareTrustTxHash, shareAssetTxHash)
+		}
+	}
+	return nil
+}
+
+// EquityReceive hands over a funded equity project to the recipient. Unlike munibonds the recipient
+// doesn't receive debt or payback assets since shares are never redeemed. The issuer is frozen so that
+// no shares can be issued beyond the project's fixed share count.
+func EquityReceive(c chain.Chain, issuerPath string, recpIndex int, projIndex int) error {
+	recipient, err := RetrieveRecipient(recpIndex)
+	if err != nil {
+		return errors.Wrap(err, "Unable to retrieve recipient from database")
+	}
+
+	txhash, err := c.FreezeIssuer(issuerPath, projIndex, consts.IssuerSeedPwd)
+	if err != nil {
+		return errors.Wrap(err, "Error while freezing issuer")
+	}
+
+	log.Printf("Tx hash for freezing issuer is: %s", txhash)
+	log.Printf("PROJECT %d's INVESTMENT CONFIRMED!", projIndex)
+
+	recipient.ReceivedSolarProjectIndices = append(recipient.ReceivedSolarProjectIndices, projIndex)
+	err = recipient.Save()
+	if err != nil {
+		return errors.Wrap(err, "couldn't save recipient")
+	}
+
+	if recipient.U.Notification {
+		notif.SendEquityNotifToRecipient(projIndex, recipient.U.Email, txhash)
+	}
+	return nil
+}
+
+// EquityPayback is used by the recipient of an equity project to pay net revenue into the project escrow
+// so that it can be paid out as dividends
+func EquityPayback(c chain.Chain, recpIndex int, projIndex int, netRevenue float64, recipientSeed string, escrowPubkey string) (string, error) {
+	if netRevenue <= 0 {
+		return "", errors.New("net revenue must be positive to pay dividends")
+	}
+
+	recipient, err := RetrieveRecipient(recpIndex)
+	if err != nil {
+		return "", errors.Wrap(err, "Error while retrieving recipient from database")
+	}
+
+	projIndexString, err := utils.ToString(projIndex)
+	if err != nil {
+		return "", err
+	}
+
+	code, issuer := c.Stablecoin()
+	stablecoinHash, err := c.SendAsset(code, issuer, escrowPubkey, netRevenue, recipientSeed, "Opensolar dividends: "+projIndexString)
+	if err != nil {
+		return "", errors.Wrap(err, "Error while sending STABLEUSD to escrow")
+	}
+
+	log.Println("Paid", netRevenue, " of net revenue to escrow in stableUSD, txhash", stablecoinHash)
+
+	if recipient.U.Notification {
+		notif.SendDividendNotifToRecipient(projIndex, recipient.U.Email, stablecoinHash)
+	}
+	return stablecoinHash, nil
+}
+
+// EquityDistribute pays out dividends from the project escrow. The amount is split among shareholders in
+// proportion to the shares they hold
+func EquityDistribute(c chain.Chain, projIndex int, amount float64, recipientSeed string, escrowPubkey string,
+	shareAssetCode string, shareCount float64, projectInvestors []int) error {
+
+	if shareCount <= 0 {
+		return errors.New("share count of equity project not set, quitting")
+	}
+
+	issuerPubkey, _, err := c.IssuerSeed(consts.OpenSolarIssuerDir, projIndex, consts.IssuerSeedPwd)
+	if err != nil {
+		return errors.Wrap(err, "Unable to retrieve issuer seed")
+	}
+
+	// investors who invested more than once are paid once for all the shares they hold
+	for _, i := range uniqueIndices(projectInvestors) {
+		investor, err := RetrieveInvestor(i)
 		if err != nil {
-			log.Println(err)
-			// platform does not have stablecoin, shouldn't arrive here ideally
-			oldPlatformBalance = 0
+			log.Println("Error while retrieving investor from list of investors", err)
+			continue
 		}
 
-		_, txhash, err = assets.SendAsset(consts.StablecoinCode, consts.StablecoinPublicKey, consts.PlatformPublicKey, invAmount, invSeed, memo)
+		address, err := c.Address(investor.U.StellarWallet.PublicKey)
 		if err != nil {
-			return txhash, errors.Wrap(err, "sending stableusd to platform failed")
+			log.Println("Error while getting address of investor", err)
+			continue
 		}
-	} else {
-		oldPlatformBalance, err = xlm.GetAssetBalance(consts.PlatformPublicKey, consts.AnchorUSDCode)
+
+		shares, err := c.Balance(address, shareAssetCode, issuerPubkey)
 		if err != nil {
-			log.Println(err)
-			// platform does not have stablecoin, shouldn't arrive here ideally
-			oldPlatformBalance = 0
+			shares = 0
+		}
+		// shares listed on the secondary market are held by the platform but still belong to the investor
+		shares += ListedUnits(projIndex, i)
+		if shares == 0 {
+			continue
 		}
 
-		_, txhash, err = assets.SendAsset(consts.AnchorUSDCode, consts.AnchorUSDAddress, consts.PlatformPublicKey, invAmount, invSeed, memo)
+		dividend := shares / shareCount * amount
+		// here we send funds from the 2of2 multisig. Platform signs by default
+		_, err = c.SendFromEscrow(escrowPubkey, address, dividend, recipientSeed, consts.PlatformSeed, "dividends")
 		if err != nil {
-			return txhash, errors.Wrap(err, "sending stableusd to platform failed")
+			log.Println("Error with dividend to pubkey: ", address, err) // if there is an error with one payout, doesn't mean we should stop and wait for the others
+			continue
+		}
+
+		if investor.U.Notification {
+			notif.SendDividendNotifToInvestor(projIndex, investor.U.Email)
 		}
 	}
 
+	return nil
+}
+
+// SendUSDToPlatform sends STABLEUSD back to the platform
+func SendUSDToPlatform(c chain.Chain, invSeed string, invAmount float64, memo string) (string, error) {
+	// send stableusd to the platform (not the issuer) since the issuer will be locked
+	// and we can't use the funds. We also need ot be able to redeem the stablecoin for fiat
+	// so we can't burn them
+	platformAddress, err := c.PublicKey(consts.PlatformSeed)
+	if err != nil {
+		return "", errors.Wrap(err, "could not get address of platform")
+	}
+
+	code, issuer := c.Stablecoin()
+	oldPlatformBalance, err := c.Balance(platformAddress, code, issuer)
+	if err != nil {
+		log.Println(err)
+		// platform does not have stablecoin, shouldn't arrive here ideally
+		oldPlatformBalance = 0
+	}
+
+	txhash, err := c.SendAsset(code, issuer, platformAddress, invAmount, invSeed, memo)
+	if err != nil {
+		return txhash, errors.Wrap(err, "sending stableusd to platform failed")
+	}
+
 	log.Println("Sent USD to platform, confirmation: ", txhash)
-	time.Sleep(5 * time.Second) // wait for a block
+	time.Sleep(consts.BlockWait) // wait for a block
 
-	var newPlatformBalance float64
-	if !consts.Mainnet {
-		newPlatformBalance, err = xlm.GetAssetBalance(consts.PlatformPublicKey, consts.StablecoinCode)
-		if err != nil {
-			return txhash, errors.Wrap(err, "error while getting asset balance")
-		}
-	} else {
-		newPlatformBalance, err = xlm.GetAssetBalance(consts.PlatformPublicKey, consts.AnchorUSDCode)
-		if err != nil {
-			return txhash, errors.Wrap(err, "error while getting asset balance")
-		}
+	newPlatformBalance, err := c.Balance(platformAddress, code, issuer)
+	if err != nil {
+		return txhash, errors.Wrap(err, "error while getting asset balance")
 	}
 
 	if newPlatformBalance-oldPlatformBalance < invAmount-1 {
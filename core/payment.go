@@ -0,0 +1,138 @@
+package core
+
+import (
+	"github.com/pkg/errors"
+	"log"
+
+	utils "github.com/Varunram/essentials/utils"
+)
+
+// once a recipient's payback has gone through on chain the payback can't be undone or carried out again, so
+// the steps that follow the transfer must not fail it. Every payback that goes through is recorded as a Payment
+// along with how much of it has been applied to the project's invoices and whether it has been distributed
+// through the waterfall. The part of a payment that couldn't be applied, eg since it was made before its invoice
+// was issued, is applied by the billing and payback jobs. Distributing a payment out of the escrow needs the
+// recipient's signature, so a distribution that fails is carried out again the next time the recipient pays back.
+
+// Payment is a payback whose transfer has gone through
+type Payment struct {
+	Index             int     // the index of the payment
+	ProjectIndex      int     // the index of the project that was paid back towards
+	RecipientIndex    int     // the index of the recipient who paid
+	TxHash            string  // the hash of the transaction that carried the payment
+	Amount            float64 // the amount paid
+	Distributable     float64 // the amount the project's investment model wants to pay investors out of the payment
+	Timestamp         int64   // unix time at which the payment was made
+	Unapplied         float64 // the part of the payment that hasn't been applied to the project's invoices yet
+	Settled           bool    // whether the payment has been applied to the project's invoices in full
+	Distributed       bool    // whether the payment has been distributed through the waterfall
+	SettlementError   string  // the error that stopped the payment from being applied to invoices, if any
+	DistributionError string  // the error that stopped the payment from being distributed, if any
+}
+
+// recordPayment records a payback that has gone through. The payment is returned even if it couldn't be recorded
+// so that the steps after the payback can still be carried out
+func recordPayment(projIndex int, recpIndex int, txhash string, amount float64, distributable float64) (Payment, error) {
+	var payment Payment
+	payment.ProjectIndex = projIndex
+	payment.RecipientIndex = recpIndex
+	payment.TxHash = txhash
+	payment.Amount = amount
+	payment.Distributable = distributable
+	payment.Unapplied = amount
+	payment.Timestamp = utils.Unix()
+
+	payments, err := RetrieveAllPayments()
+	if err != nil {
+		return payment, errors.Wrap(err, "couldn't retrieve payments")
+	}
+
+	payment.Index = len(payments) + 1
+	return payment, payment.Save()
+}
+
+// settle applies the part of the payment that hasn't been applied yet to the project's invoices. What has been
+// applied is read off the invoices, so that an invoice saved before the payment isn't paid twice
+func (payment *Payment) settle() error {
+	if payment.Settled {
+		return nil
+	}
+
+	invoices, err := RetrieveInvoicesByTxHash(payment.TxHash)
+	if err != nil {
+		return errors.Wrap(err, "couldn't retrieve invoices")
+	}
+
+	unapplied := payment.Amount
+	for _, invoice := range invoices {
+		unapplied -= invoice.paidWith(payment.TxHash)
+	}
+
+	if unapplied >= scheduleEpsilon {
+		unapplied, err = settleInvoices(payment.ProjectIndex, unapplied, payment.TxHash)
+		if err != nil {
+			return errors.Wrap(err, "couldn't settle invoices")
+		}
+	}
+
+	payment.Unapplied = unapplied
+	payment.Settled = unapplied < scheduleEpsilon
+	return nil
+}
+
+// distribute distributes the payment through the waterfall
+func (payment *Payment) distribute(recipientSeed string) error {
+	if payment.Distributed {
+		return nil
+	}
+
+	_, err := DistributeWaterfall(payment.ProjectIndex, recipientSeed, payment.Amount, payment.Distributable)
+	if err != nil {
+		return errors.Wrap(err, "couldn't distribute payment")
+	}
+
+	payment.Distributed = true
+	return nil
+}
+
+// process carries out the steps on the payment that haven't been carried out yet and saves it. The payment is
+// only distributed if the recipient's seed is passed
+func (payment *Payment) process(recipientSeed string) {
+	payment.SettlementError = ""
+	err := payment.settle()
+	if err != nil {
+		log.Println("couldn't settle payment", payment.TxHash, "towards project", payment.ProjectIndex, err)
+		payment.SettlementError = err.Error()
+	}
+
+	if recipientSeed != "" {
+		payment.DistributionError = ""
+		err = payment.distribute(recipientSeed)
+		if err != nil {
+			log.Println("couldn't distribute payment", payment.TxHash, "towards project", payment.ProjectIndex, err)
+			payment.DistributionError = err.Error()
+		}
+	}
+
+	err = payment.Save()
+	if err != nil {
+		log.Println("couldn't save payment", payment.TxHash, err)
+	}
+}
+
+// processPayments carries out the steps left on the payments made towards a project. Payments are only
+// distributed if the recipient's seed is passed
+func processPayments(projIndex int, recipientSeed string) error {
+	payments, err := RetrieveProjectPayments(projIndex)
+	if err != nil {
+		return errors.Wrap(err, "couldn't retrieve payments")
+	}
+
+	for _, payment := range payments {
+		if payment.Settled && (payment.Distributed || recipientSeed == "") {
+			continue
+		}
+		payment.process(recipientSeed)
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package core
+
+import (
+	"testing"
+
+	consts "github.com/YaleOpenLab/opensolar/consts"
+)
+
+func TestPaybackWithKey(t *testing.T) {
+	m, teardown := setupMock(t)
+	defer teardown()
+
+	project, recipient, investors := modelProject(t, m, "munibond", 0)
+	recpSeed := testKey("recipient").Seed()
+	recpIndex := recipient.U.Index
+	modelAsset(t, m, project.DebtAssetCode, 1000, recpSeed)
+	err := m.Credit(recipient.U.StellarWallet.PublicKey, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	project.InvestorMap = map[string]float64{
+		investors[0].U.StellarWallet.PublicKey: 0.6,
+		investors[1].U.StellarWallet.PublicKey: 0.4,
+	}
+	project.EscrowLock = true
+	err = project.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := ClaimIdempotencyKey(recpIndex, "key1")
+	if err != nil || status != "" {
+		t.Fatalf("couldn't claim a new key: %q %v", status, err)
+	}
+
+	// the payment goes through although it can't be distributed out of the locked escrow
+	err = PaybackWithKey(recpIndex, project.Index, project.DebtAssetCode, 100, recpSeed, "key1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkStablecoin(t, m, project.EscrowPubkey, 100)
+	checkStablecoin(t, m, investors[0].U.StellarWallet.PublicKey, 0)
+
+	status, err = ClaimIdempotencyKey(recpIndex, "key1")
+	if err != nil || status != IdempotencyDone {
+		t.Fatalf("key of a payback that went through is %q, expected done: %v", status, err)
+	}
+
+	payments, err := RetrieveProjectPayments(project.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(payments) != 1 || payments[0].TxHash == "" || payments[0].Distributed || payments[0].DistributionError == "" {
+		t.Fatalf("unexpected payments %v", payments)
+	}
+
+	// the payment left in the escrow is distributed along with the next payback
+	project, err = RetrieveProject(project.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	project.EscrowLock = false
+	err = project.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = Payback(recpIndex, project.Index, project.DebtAssetCode, 100, recpSeed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkStablecoin(t, m, project.EscrowPubkey, 0)
+	checkStablecoin(t, m, investors[0].U.StellarWallet.PublicKey, 120)
+	checkStablecoin(t, m, investors[1].U.StellarWallet.PublicKey, 80)
+
+	payments, err = RetrieveProjectPayments(project.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(payments) != 2 {
+		t.Fatalf("expected two payments, got %v", payments)
+	}
+	for _, payment := range payments {
+		if !payment.Distributed || payment.DistributionError != "" {
+			t.Fatalf("payment not carried out %v", payment)
+		}
+	}
+
+	// a payback that doesn't go through releases nothing and isn't recorded
+	err = PaybackWithKey(recpIndex, project.Index, project.DebtAssetCode, 100, recpSeed, "key2")
+	if err == nil {
+		t.Fatalf("payback went through without the stablecoin to pay for it")
+	}
+	payments, err = RetrieveProjectPayments(project.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(payments) != 2 {
+		t.Fatalf("payback that didn't go through was recorded")
+	}
+
+	// a key that has been pending for too long is never carried out again
+	_, err = ClaimIdempotencyKey(recpIndex, "key3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	timeout := consts.IdempotencyPendingTimeout
+	consts.IdempotencyPendingTimeout = -1
+	defer func() { consts.IdempotencyPendingTimeout = timeout }()
+
+	status, err = ClaimIdempotencyKey(recpIndex, "key3")
+	if err != nil || status != IdempotencyStale {
+		t.Fatalf("key pending for too long is %q, expected stale: %v", status, err)
+	}
+}
+
+func TestSettlePayments(t *testing.T) {
+	_, teardown := setupMock(t)
+	defer teardown()
+
+	// a payment made before any invoice has been issued is kept as a credit towards the next invoices
+	payment, err := recordPayment(1, 1, "txhash", 100, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payment.process("")
+	if payment.Settled || payment.Unapplied != 100 || payment.SettlementError != "" {
+		t.Fatalf("payment applied without any invoices %v", payment)
+	}
+
+	invoice := Invoice{Index: 1, ProjectIndex: 1, Amount: 60, DueDate: 1}
+	err = invoice.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = processPayments(1, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	payments, err := RetrieveProjectPayments(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(payments) != 1 || payments[0].Settled || payments[0].Unapplied != 40 {
+		t.Fatalf("expected 40 of the payment left after the first invoice, got %v", payments)
+	}
+
+	// the rest goes towards the next invoice without paying the first one twice
+	invoice = Invoice{Index: 2, ProjectIndex: 1, PeriodStart: 1, Amount: 50, DueDate: 1}
+	err = invoice.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = processPayments(1, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	payments, err = RetrieveProjectPayments(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !payments[0].Settled || payments[0].Unapplied != 0 {
+		t.Fatalf("payment not applied in full %v", payments[0])
+	}
+
+	invoices, err := RetrieveProjectInvoices(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if invoices[0].Paid != 60 || invoices[1].Paid != 40 {
+		t.Fatalf("invoices paid %f and %f, expected 60 and 40", invoices[0].Paid, invoices[1].Paid)
+	}
+}
@@ -3,6 +3,8 @@ package core
 import (
 	// "log"
 	platforms "github.com/YaleOpenLab/openx/platforms"
+
+	chain "github.com/YaleOpenLab/opensolar/chain"
 )
 
 // Project defines the project investment structure in opensolar
@@ -38,6 +40,36 @@ type Project struct {
 	DateFunded    string // date that the project completed the stage 4-5 migration
 	DateLastPaid  int64  // int64 ie unix time since we need comparisons on this one
 
+	// FundingDeadline is the unix time by which the project must raise its total value, after which investors are refunded
+	FundingDeadline int64
+	// FundingRound is the number of funding rounds that have been refunded, the assets of every round get codes of their own
+	FundingRound int
+
+	// Define the payment schedule of the project
+	Schedule           []Installment // the installments the recipient has to pay, generated once the project is funded
+	BillingPeriodStart int64         // unix time at which the current billing period started, 0 if the project isn't billed yet
+	EnergyCP           float64       // the energy used in the current billing period in kWh
+	TotalEnergy        float64       // the energy used over all billed periods in kWh
+
+	// Define the actions taken when the recipient misses payments
+	BreachPolicy       []BreachRule // the rules followed when the recipient misses payments, DefaultBreachPolicy if empty
+	BreachRulesApplied []int        // the rules of the breach policy that have run during the current breach
+	Disconnected       bool         // set while power from the project is redirected towards the grid
+	Defaulted          bool         // set once the project has been declared in default
+
+	// Define the renewable energy certificates issued for the energy the project generates
+	RECAssetCode      string   // the code of the asset RECs of the project are issued in
+	RECCursor         int64    // unix time before which meter readings received by the platform have been counted towards RECs
+	RECPending        float64  // generation in kWh counted towards RECs that hasn't made up a whole REC yet
+	RECPendingStart   int64    // unix time of the first reading that counts towards the pending generation
+	RECPendingDevices []string // the devices that reported the pending generation
+
+	// Define the carbon the project avoids by displacing energy from the grid
+	CarbonCursor      int64              // unix time before which meter readings received by the platform have been counted towards avoided carbon
+	CarbonGeneration  float64            // the generation in kWh counted towards avoided carbon
+	CarbonAvoided     float64            // the carbon in tCO2e the project has avoided
+	CarbonAttribution map[string]float64 // publicKey: the avoided carbon in tCO2e attributed to the investor
+
 	// Define technical parameters
 	AuctionType           string  // the type of the auction in question. Default is blind auction unless explicitly mentioned
 	InvestmentType        string  // the type of investment - equity crowdfunding, municipal bond, normal crowdfunding, etc defined in models
@@ -54,6 +86,19 @@ type Project struct {
 	EscrowPubkey          string  // the publickey of the escrow we setup after project investment
 	EscrowLock            bool    // used to lock the escrow in case someting goes wrong
 
+	// Define parameters related to equity investments
+	ShareCount    float64 // the fixed number of shares issued to investors of an equity project
+	DividendsPaid float64 // the total net revenue paid out as dividends to shareholders
+
+	// Define parameters related to english and dutch auctions
+	OpenBids          []OpenBid // the bids placed on the project during an english or dutch auction
+	AuctionRound      int       // the current round of the english or dutch auction, 0 if no auction has been started
+	AuctionRoundEnd   int64     // unix time at which the current auction round closes
+	AuctionStartPrice float64   // the price at which an english auction opens or a dutch auction starts
+
+	// Define parameters related to scoring auctions
+	BidWeights BidWeights // the weights used to score contracts proposed towards the project
+
 	// Describe issuer of security and the broker dealer
 	SecurityIssuer string // the issuer of the security
 	BrokerDealer   string // the broker dealer associated with the project
@@ -63,6 +108,7 @@ type Project struct {
 	OriginatorIndex             int       // the originator of the project
 	GuarantorIndex              int       // the person guaranteeing the specific project in question
 	ContractorIndex             int       // the person with the proposed contract
+	ProposedTo                  int       // the originated project a stage 2 contract was proposed towards
 	MainDeveloperIndex          int       // the main developer of the project
 	BlendedCapitalInvestorIndex int       // the index of the blended capital investor
 	InvestorIndices             []int     // The various investors who have invested in the project
@@ -76,6 +122,15 @@ type Project struct {
 	DebtInvestor2               string    // debt investor index, if any
 	TaxEquityInvestor           string    // tax equity investor if any
 
+	// Define parameters related to the payback waterfall
+	ContractorFeePaid float64   // the part of the contractor fee that has been paid out of paybacks
+	OriginatorFeePaid float64   // the part of the originator fee that has been paid out of paybacks
+	DeveloperFeePaid  []float64 // the part of each developer fee that has been paid out of paybacks
+	DebtInvestor1Owed float64   // the senior debt still owed to DebtInvestor1
+	DebtInvestor2Owed float64   // the senior debt still owed to DebtInvestor2
+	LateFees          float64   // the late fees the recipient has paid, which are owed to the platform
+	LateFeesPaid      float64   // the part of the late fees that has been paid to the platform out of paybacks
+
 	// Define parameters that will not be defined directly but will be used for the backend flow
 	Lock            bool               // lock investment in order to wait for recipient's confirmation
 	LockPwd         string             // the recipient's seedpwd. Will be set to null as soon as we use it.
@@ -113,7 +168,7 @@ type Project struct {
 	FEText                map[string]interface{} // put all the fe text in here reading it from the relevant json file(s)
 	MapLink               string                 // the google maps link to the installation site
 
-	Chain string // the chain on which the project desires to be.
+	Chain string // the chain on which the project desires to be, one of the chains registered in package chain. Empty for stellar
 }
 
 // ExplorePageSummaryHelper defines the params that will appear on the frontend's explore page
@@ -220,12 +275,12 @@ type SustainabilityHelper struct {
 type Feedback struct {
 	Content string
 	// the content of the feedback, good / bad
-	// maybe we could have a rating system baked in? a star based rating system?
-	// would be nice, idk
 	From Entity
 	// who gave the feedback?
 	To Entity
 	// regarding whom is this feedback about
+	Rating float64
+	// a star rating out of 5 for the entity the feedback is about
 	Date string
 	// time at which this feedback was written
 	Contract []Project
@@ -242,14 +297,22 @@ type Stage struct {
 	BreachCondition []string // define breach conditions for a particular stage
 }
 
-// ContractAuction is an auction struct
+// AuctionContractor is a contractor who proposed a contract in an auction. Only what recipients need to see is
+// kept, since auctions are sent to them as is
+type AuctionContractor struct {
+	Index int
+	Name  string
+}
+
+// ContractAuction is an auction struct. It is stored with the index of the project that is being auctioned
+// so that recipients can look back at how the winning contract was chosen
 type ContractAuction struct {
-	// TODO: this struct isn't used yet as it needs handlers and stuff, but when
-	// we move off main.go for testing, this must be used in order to make stuff
-	// easier for us.
-	AllContracts    []Project
-	AllContractors  []Entity
-	WinningContract Project
+	Index           int                 // the index of the project that is being auctioned
+	AllContracts    []Project           // the contracts that were proposed towards the project
+	AllContractors  []AuctionContractor // the contractors who proposed the above contracts
+	WinningContract Project             // the contract that won the auction
+	Weights         BidWeights          // the weights that were used to score the contracts
+	Scores          []BidScore          // the scores of all the contracts, ranked from best to worst
 }
 
 const (
@@ -294,3 +357,23 @@ func InitializePlatform() error {
 func RefillPlatform(publicKey string) error {
 	return platforms.RefillPlatform(publicKey)
 }
+
+// chain returns the chain the project's assets are held on
+func (project Project) chain() (chain.Chain, error) {
+	return chain.Get(project.Chain)
+}
+
+// uniqueIndices returns indices with duplicates removed in the order they first appear. InvestorIndices has an
+// entry per investment, so investors who invested more than once appear in it more than once
+func uniqueIndices(indices []int) []int {
+	var arr []int
+	seen := make(map[int]bool)
+	for _, index := range indices {
+		if seen[index] {
+			continue
+		}
+		seen[index] = true
+		arr = append(arr, index)
+	}
+	return arr
+}
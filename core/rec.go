@@ -0,0 +1,465 @@
+package core
+
+import (
+	"github.com/pkg/errors"
+	"log"
+	"math"
+	"strings"
+
+	utils "github.com/Varunram/essentials/utils"
+
+	chain "github.com/YaleOpenLab/opensolar/chain"
+	consts "github.com/YaleOpenLab/opensolar/consts"
+)
+
+// renewable energy certificates (RECs) attest that a MWh of electricity was generated from a renewable source.
+// The REC job counts the generation reported by a project's meters once the readings have settled and issues a
+// REC for every RECUnit kWh, recording the period the energy was generated in (the vintage), where and by which
+// devices. The RECs of an issuance are allocated to the project's investors pro rata to InvestorMap and are
+// minted as a Stellar asset issued by the platform when an investor claims them. An investor who retires RECs
+// sends them back to the issuer, which takes them out of circulation, and a retirement record is kept.
+
+// RECAllocation is the share of an issuance allocated to an investor
+type RECAllocation struct {
+	InvestorIndex int
+	PublicKey     string
+	Units         float64 // the number of RECs allocated to the investor
+	Claimed       bool    // set once the RECs have been sent to the investor
+	TxHash        string  // the hash of the transaction the RECs were sent in
+	Retired       float64 // the number of RECs of this allocation that have been retired
+}
+
+// RECIssuance is a batch of RECs issued for the generation of a project
+type RECIssuance struct {
+	Index        int
+	ProjectIndex int
+	AssetCode    string
+	Issuer       string   // the public key of the account the RECs are issued from
+	Units        int      // the number of RECs issued
+	Generation   float64  // the generation in kWh the RECs stand for
+	VintageStart int64    // unix time of the first reading the RECs account for
+	VintageEnd   int64    // unix time of the last reading the RECs account for
+	Location     string   // where the project is installed
+	Devices      []string // the devices that reported the generation
+	Allocations  []RECAllocation
+	IssuedAt     int64
+}
+
+// RECVintage is the part of a retirement that comes from a single issuance
+type RECVintage struct {
+	IssuanceIndex int
+	VintageStart  int64
+	VintageEnd    int64
+	Units         float64
+}
+
+// RECRetirement records RECs retired by an investor
+type RECRetirement struct {
+	Index         int
+	ProjectIndex  int
+	AssetCode     string
+	InvestorIndex int
+	PublicKey     string
+	Units         float64
+	Beneficiary   string // the party the RECs are retired on behalf of
+	Reason        string // why the RECs are retired, eg the reporting year they are claimed in
+	Vintages      []RECVintage
+	TxHash        string // the hash of the transaction that sent the RECs back to the issuer
+	RetiredAt     int64
+}
+
+// RECHolding sums up the RECs of a project allocated to an investor
+type RECHolding struct {
+	ProjectIndex int
+	AssetCode    string
+	Allocated    float64 // RECs allocated to the investor
+	Claimed      float64 // RECs sent to the investor's account
+	Retired      float64 // RECs the investor has retired
+}
+
+// recEpsilon absorbs rounding errors when comparing amounts of RECs
+const recEpsilon = 1e-7
+
+// recChain returns the chain RECs are issued on, which is stellar whichever chain the project is on
+func recChain() (chain.Chain, error) {
+	return chain.Get(chain.StellarName)
+}
+
+// truncateUnits rounds an amount of RECs down to the precision of a Stellar asset
+func truncateUnits(units float64) float64 {
+	return math.Floor(units*1e7) / 1e7
+}
+
+// countRECGeneration adds the generation of the readings the platform received before end to the pending
+// generation and returns the time of the last reading counted
+func (project *Project) countRECGeneration(end int64) (int64, error) {
+	var last int64
+	if end <= project.RECCursor {
+		return last, nil
+	}
+
+	readings, err := RetrieveReceivedMeterReadings(project.Index, project.RECCursor, end)
+	if err != nil {
+		return last, errors.Wrap(err, "couldn't retrieve meter readings")
+	}
+
+	for _, reading := range readings {
+		if reading.GeneratedInterval <= 0 {
+			continue
+		}
+		project.RECPending += reading.GeneratedInterval
+		if project.RECPendingStart == 0 || reading.Timestamp < project.RECPendingStart {
+			project.RECPendingStart = reading.Timestamp
+		}
+		if reading.Timestamp > last {
+			last = reading.Timestamp
+		}
+		counted := false
+		for _, device := range project.RECPendingDevices {
+			if device == reading.DeviceId {
+				counted = true
+				break
+			}
+		}
+		if !counted {
+			project.RECPendingDevices = append(project.RECPendingDevices, reading.DeviceId)
+		}
+	}
+
+	project.RECCursor = end
+	return last, nil
+}
+
+// allocateRECs splits units pro rata to the project's InvestorMap
+func (project Project) allocateRECs(units int) ([]RECAllocation, error) {
+	var allocations []RECAllocation
+	investors, err := project.investorShares()
+	if err != nil {
+		return allocations, err
+	}
+
+	for _, investor := range investors {
+		allocations = append(allocations, RECAllocation{
+			InvestorIndex: investor.Index,
+			PublicKey:     investor.PublicKey,
+			Units:         truncateUnits(float64(units) * investor.Share),
+		})
+	}
+	return allocations, nil
+}
+
+// IssueRECs counts the generation of the readings the platform received before end and issues a REC for every RECUnit
+// kWh. It returns the issuance, or nil if there isn't enough generation for a REC yet
+func IssueRECs(projIndex int, end int64) (*RECIssuance, error) {
+	project, err := RetrieveProject(projIndex)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't retrieve project")
+	}
+
+	last, err := project.countRECGeneration(end)
+	if err != nil {
+		return nil, err
+	}
+
+	units := int(math.Floor(project.RECPending/consts.RECUnit + recEpsilon))
+	if units == 0 {
+		return nil, project.Save()
+	}
+
+	allocations, err := project.allocateRECs(units)
+	if err != nil {
+		// keep the generation pending so that it is issued on the next run
+		log.Println("couldn't allocate RECs of project", projIndex, err)
+		return nil, project.Save()
+	}
+
+	if project.RECAssetCode == "" {
+		c, err := recChain()
+		if err != nil {
+			return nil, err
+		}
+		project.RECAssetCode = c.AssetID(consts.RECAssetPrefix + project.Metadata)
+	}
+
+	issuances, err := RetrieveAllRECIssuances()
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't retrieve REC issuances")
+	}
+
+	issuance := RECIssuance{
+		Index:        len(issuances) + 1,
+		ProjectIndex: projIndex,
+		AssetCode:    project.RECAssetCode,
+		Issuer:       consts.PlatformPublicKey,
+		Units:        units,
+		Generation:   float64(units) * consts.RECUnit,
+		VintageStart: project.RECPendingStart,
+		VintageEnd:   last,
+		Location:     strings.Trim(project.State+", "+project.Country, ", "),
+		Devices:      project.RECPendingDevices,
+		Allocations:  allocations,
+		IssuedAt:     utils.Unix(),
+	}
+
+	project.RECPending -= issuance.Generation
+	if project.RECPending < recEpsilon {
+		project.RECPending = 0
+		project.RECPendingStart = 0
+		project.RECPendingDevices = nil
+	} else {
+		// the rest of the generation of the last reading carries over
+		project.RECPendingStart = last
+	}
+
+	// save the project first so that a failure can't issue the same generation twice
+	err = project.Save()
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't save project")
+	}
+	return &issuance, issuance.Save()
+}
+
+// runRECJob issues RECs for the generation of a project whose readings have settled
+func runRECJob(job *Job) error {
+	now := utils.Unix()
+	issuance, err := IssueRECs(job.ProjectIndex, now-consts.MeterSettleInterval)
+	if err != nil {
+		return err
+	}
+
+	if issuance != nil {
+		log.Println("issued", issuance.Units, "RECs for project", job.ProjectIndex)
+	}
+	job.NextRun = now + consts.RECInterval
+	return nil
+}
+
+// ClaimRECs sends the RECs of a project allocated to an investor to the investor's account. It returns the
+// number of RECs sent
+func ClaimRECs(projIndex int, invIndex int, invSeed string) (float64, error) {
+	investor, err := RetrieveInvestor(invIndex)
+	if err != nil {
+		return 0, errors.Wrap(err, "couldn't retrieve investor")
+	}
+
+	issuances, err := RetrieveProjectRECIssuances(projIndex)
+	if err != nil {
+		return 0, errors.Wrap(err, "couldn't retrieve REC issuances")
+	}
+
+	// mark the allocations as claimed before sending so that two claims can't send the same RECs
+	var units float64
+	var assetCode string
+	var claimed []*RECIssuance
+	for i := range issuances {
+		changed := false
+		for j := range issuances[i].Allocations {
+			allocation := &issuances[i].Allocations[j]
+			if allocation.InvestorIndex == invIndex && !allocation.Claimed {
+				allocation.Claimed = true
+				units += allocation.Units
+				assetCode = issuances[i].AssetCode
+				changed = true
+			}
+		}
+		if changed {
+			err = issuances[i].Save()
+			if err != nil {
+				return 0, errors.Wrap(err, "couldn't save REC issuance")
+			}
+			claimed = append(claimed, &issuances[i])
+		}
+	}
+
+	if units < recEpsilon {
+		return 0, errors.New("investor doesn't have RECs to claim")
+	}
+
+	release := func() {
+		for _, issuance := range claimed {
+			for j := range issuance.Allocations {
+				if issuance.Allocations[j].InvestorIndex == invIndex && issuance.Allocations[j].TxHash == "" {
+					issuance.Allocations[j].Claimed = false
+				}
+			}
+			err := issuance.Save()
+			if err != nil {
+				log.Println("couldn't release REC allocation of issuance", issuance.Index, err)
+			}
+		}
+	}
+
+	c, err := recChain()
+	if err != nil {
+		release()
+		return 0, err
+	}
+
+	_, err = c.TrustAsset(assetCode, consts.PlatformPublicKey, consts.RECTrustLimit, invSeed)
+	if err != nil {
+		release()
+		return 0, errors.Wrap(err, "couldn't trust RECs")
+	}
+
+	txhash, err := c.SendAsset(assetCode, consts.PlatformPublicKey, investor.U.StellarWallet.PublicKey, units,
+		consts.PlatformSeed, "opensolar rec claim")
+	if err != nil {
+		release()
+		return 0, errors.Wrap(err, "couldn't send RECs")
+	}
+
+	for _, issuance := range claimed {
+		for j := range issuance.Allocations {
+			if issuance.Allocations[j].InvestorIndex == invIndex && issuance.Allocations[j].TxHash == "" {
+				issuance.Allocations[j].TxHash = txhash
+			}
+		}
+		err = issuance.Save()
+		if err != nil {
+			log.Println("couldn't record REC claim on issuance", issuance.Index, err)
+		}
+	}
+
+	investor.RECsReceived += units
+	return units, investor.Save()
+}
+
+// RetireRECs retires RECs of a project claimed by an investor on behalf of a beneficiary. The RECs are sent back
+// to the issuer and taken from the oldest vintages first
+func RetireRECs(projIndex int, invIndex int, invSeed string, units float64, beneficiary string,
+	reason string) (RECRetirement, error) {
+	var retirement RECRetirement
+	if units <= 0 {
+		return retirement, errors.New("number of RECs to retire must be positive")
+	}
+	units = truncateUnits(units)
+
+	if beneficiary == "" {
+		return retirement, errors.New("RECs must be retired on behalf of a beneficiary")
+	}
+
+	investor, err := RetrieveInvestor(invIndex)
+	if err != nil {
+		return retirement, errors.Wrap(err, "couldn't retrieve investor")
+	}
+
+	issuances, err := RetrieveProjectRECIssuances(projIndex)
+	if err != nil {
+		return retirement, errors.Wrap(err, "couldn't retrieve REC issuances")
+	}
+
+	var available float64
+	var assetCode string
+	for _, issuance := range issuances {
+		for _, allocation := range issuance.Allocations {
+			if allocation.InvestorIndex == invIndex && allocation.Claimed && allocation.TxHash != "" {
+				available += allocation.Units - allocation.Retired
+				assetCode = issuance.AssetCode
+			}
+		}
+	}
+
+	if units > available+recEpsilon {
+		return retirement, errors.New("investor doesn't hold enough claimed RECs of the project")
+	}
+
+	c, err := recChain()
+	if err != nil {
+		return retirement, err
+	}
+
+	// payments into the issuer's account take the RECs out of circulation
+	txhash, err := c.SendAsset(assetCode, consts.PlatformPublicKey, consts.PlatformPublicKey, units, invSeed,
+		"opensolar rec retirement")
+	if err != nil {
+		return retirement, errors.Wrap(err, "couldn't send RECs back to issuer")
+	}
+
+	retirement = RECRetirement{
+		ProjectIndex:  projIndex,
+		AssetCode:     assetCode,
+		InvestorIndex: invIndex,
+		PublicKey:     investor.U.StellarWallet.PublicKey,
+		Units:         units,
+		Beneficiary:   beneficiary,
+		Reason:        reason,
+		TxHash:        txhash,
+		RetiredAt:     utils.Unix(),
+	}
+
+	left := units
+	for i := range issuances {
+		if left < recEpsilon {
+			break
+		}
+		changed := false
+		for j := range issuances[i].Allocations {
+			allocation := &issuances[i].Allocations[j]
+			if allocation.InvestorIndex != invIndex || !allocation.Claimed || allocation.TxHash == "" {
+				continue
+			}
+			x := math.Min(allocation.Units-allocation.Retired, left)
+			if x < recEpsilon {
+				continue
+			}
+			allocation.Retired += x
+			left -= x
+			changed = true
+			retirement.Vintages = append(retirement.Vintages, RECVintage{
+				IssuanceIndex: issuances[i].Index,
+				VintageStart:  issuances[i].VintageStart,
+				VintageEnd:    issuances[i].VintageEnd,
+				Units:         x,
+			})
+		}
+		if changed {
+			err = issuances[i].Save()
+			if err != nil {
+				log.Println("couldn't record REC retirement on issuance", issuances[i].Index, err)
+			}
+		}
+	}
+
+	retirements, err := RetrieveAllRECRetirements()
+	if err != nil {
+		return retirement, errors.Wrap(err, "couldn't retrieve REC retirements")
+	}
+	retirement.Index = len(retirements) + 1
+	err = retirement.Save()
+	if err != nil {
+		return retirement, errors.Wrap(err, "couldn't save REC retirement")
+	}
+
+	investor.RECsRetired += units
+	return retirement, investor.Save()
+}
+
+// RetrieveInvestorRECs sums up the RECs allocated to an investor for each project
+func RetrieveInvestorRECs(invIndex int) ([]RECHolding, error) {
+	var arr []RECHolding
+	issuances, err := RetrieveAllRECIssuances()
+	if err != nil {
+		return arr, errors.Wrap(err, "couldn't retrieve REC issuances")
+	}
+
+	holdings := make(map[int]int) // project index: position in arr
+	for _, issuance := range issuances {
+		for _, allocation := range issuance.Allocations {
+			if allocation.InvestorIndex != invIndex {
+				continue
+			}
+			i, exists := holdings[issuance.ProjectIndex]
+			if !exists {
+				i = len(arr)
+				holdings[issuance.ProjectIndex] = i
+				arr = append(arr, RECHolding{ProjectIndex: issuance.ProjectIndex, AssetCode: issuance.AssetCode})
+			}
+			arr[i].Allocated += allocation.Units
+			if allocation.Claimed && allocation.TxHash != "" {
+				arr[i].Claimed += allocation.Units
+			}
+			arr[i].Retired += allocation.Retired
+		}
+	}
+	return arr, nil
+}
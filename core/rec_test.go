@@ -0,0 +1,134 @@
+package core
+
+import (
+	"testing"
+
+	utils "github.com/Varunram/essentials/utils"
+
+	chain "github.com/YaleOpenLab/opensolar/chain"
+	consts "github.com/YaleOpenLab/opensolar/consts"
+)
+
+// recMock is a mock chain registered as stellar, which RECs are issued on whichever chain a project is on
+type recMock struct {
+	*chain.Mock
+}
+
+// Name returns the name of the stellar chain
+func (m recMock) Name() string {
+	return chain.StellarName
+}
+
+// checkRECs checks the RECs of a project held by an account
+func checkRECs(t *testing.T, m *chain.Mock, code string, address string, expected float64) {
+	balance, err := m.Balance(address, code, consts.PlatformPublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance != expected {
+		t.Fatalf("%s holds %f RECs, expected %f", address, balance, expected)
+	}
+}
+
+func TestClaimRetireRECs(t *testing.T) {
+	m, teardown := setupMock(t)
+	defer teardown()
+	chain.Register(recMock{m})
+	defer chain.Register(chain.Stellar{})
+
+	investor1, err := NewInvestor("investor1", testPwd, testSeedPwd, "Investor 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	investor2, err := NewInvestor("investor2", testPwd, testSeedPwd, "Investor 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	inv1Seed, inv2Seed := testKey("investor1").Seed(), testKey("investor2").Seed()
+	inv1Address := investor1.U.StellarWallet.PublicKey
+	m.CreateAccount(inv1Address)
+
+	project := Project{
+		Index:           1,
+		Metadata:        "rec",
+		RECPending:      4 * consts.RECUnit,
+		InvestorIndices: []int{investor1.U.Index, investor2.U.Index},
+		InvestorMap:     map[string]float64{inv1Address: 0.75, investor2.U.StellarWallet.PublicKey: 0.25},
+	}
+	err = project.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issuance, err := IssueRECs(project.Index, utils.Unix())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if issuance == nil || issuance.Units != 4 || len(issuance.Allocations) != 2 {
+		t.Fatalf("unexpected REC issuance %v", issuance)
+	}
+	code := issuance.AssetCode
+
+	_, err = ClaimRECs(project.Index, investor1.U.Index, inv1Seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRECs(t, m, code, inv1Address, 3)
+	_, err = ClaimRECs(project.Index, investor1.U.Index, inv1Seed)
+	if err == nil {
+		t.Fatalf("RECs claimed twice")
+	}
+
+	// a claim that fails on chain releases the allocation so that it can be claimed again
+	_, err = ClaimRECs(project.Index, investor2.U.Index, inv2Seed)
+	if err == nil {
+		t.Fatalf("RECs claimed by an investor without an account")
+	}
+	m.CreateAccount(investor2.U.StellarWallet.PublicKey)
+	units, err := ClaimRECs(project.Index, investor2.U.Index, inv2Seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if units != 1 {
+		t.Fatalf("investor 2 claimed %f RECs, expected 1", units)
+	}
+
+	_, err = RetireRECs(project.Index, investor1.U.Index, inv1Seed, 4, "beneficiary", "2026")
+	if err == nil {
+		t.Fatalf("retired more RECs than were claimed")
+	}
+	_, err = RetireRECs(project.Index, investor1.U.Index, inv1Seed, 2, "", "2026")
+	if err == nil {
+		t.Fatalf("retired RECs without a beneficiary")
+	}
+
+	retirement, err := RetireRECs(project.Index, investor1.U.Index, inv1Seed, 2, "beneficiary", "2026")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retirement.Units != 2 || len(retirement.Vintages) != 1 || retirement.Vintages[0].IssuanceIndex != issuance.Index {
+		t.Fatalf("unexpected REC retirement %v", retirement)
+	}
+	checkRECs(t, m, code, inv1Address, 1)
+
+	_, err = RetireRECs(project.Index, investor1.U.Index, inv1Seed, 2, "beneficiary", "2026")
+	if err == nil {
+		t.Fatalf("retired RECs that have been retired already")
+	}
+
+	holdings, err := RetrieveInvestorRECs(investor1.U.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(holdings) != 1 || holdings[0].Allocated != 3 || holdings[0].Claimed != 3 || holdings[0].Retired != 2 {
+		t.Fatalf("unexpected REC holdings %v", holdings)
+	}
+
+	investor1, err = RetrieveInvestor(investor1.U.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if investor1.RECsReceived != 3 || investor1.RECsRetired != 2 {
+		t.Fatalf("investor received %f and retired %f RECs", investor1.RECsReceived, investor1.RECsRetired)
+	}
+}
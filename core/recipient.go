@@ -18,6 +18,12 @@ type Recipient struct {
 	DeviceId string
 	// the device ID of the associated solar hub. We don't do much with it here,
 	// but we need it on the IoT Hub side to check login stuff
+	DevicePubkey string
+	// the hex encoded ed25519 public key of the device, used to verify readings and payments signed by it
+	PendingDeviceId string
+	// the device ID of a device that has been registered but not approved by the platform yet
+	PendingDevicePubkey string
+	// the public key of the pending device. It isn't trusted until the platform approves it
 	DeviceStarts []string
 	// the start time of the devices recorded for reference. We could monitor unscheduled
 	// closes on the platform level as well and send email notifications or similar
@@ -0,0 +1,266 @@
+package core
+
+import (
+	"github.com/pkg/errors"
+	"log"
+	"strconv"
+
+	utils "github.com/Varunram/essentials/utils"
+
+	chain "github.com/YaleOpenLab/opensolar/chain"
+	consts "github.com/YaleOpenLab/opensolar/consts"
+	notif "github.com/YaleOpenLab/opensolar/notif"
+)
+
+// investments are held by the platform until the recipient unlocks a fully funded project. If the project
+// doesn't raise its total value before its funding deadline or if the recipient doesn't unlock it within
+// LockInterval, investors are refunded and the project is reset so that a new funding round can be started.
+// The assets issued to an investor are taken back before they're refunded and the issuer of the round is frozen
+// once everyone has been refunded. The next round gets a new issuer and asset codes of its own, so that assets
+// left over from a refunded round are never counted towards an investment in the next one.
+
+// roundName returns name with the project's funding round appended, so that the assets of every round get codes
+// of their own. Assets of the first round keep the codes they had before projects were refunded
+func (project Project) roundName(name string) string {
+	if project.FundingRound == 0 {
+		return name
+	}
+	return name + strconv.Itoa(project.FundingRound)
+}
+
+// refundAmount returns the amount that should be refunded to the investor with the passed public key
+func (project Project) refundAmount(pubkey string) float64 {
+	if percentage, exists := project.InvestorMap[pubkey]; exists {
+		return percentage * project.TotalValue
+	}
+	return project.SeedInvestorMap[pubkey] * project.TotalValue
+}
+
+// takeBackAssets takes the assets of the project issued to an investor back to the project's issuer
+func (project Project) takeBackAssets(c chain.Chain, pubkey string) error {
+	if project.InvestorAssetCode == "" && project.SeedAssetCode == "" {
+		return nil
+	}
+
+	issuerPubkey, issuerSeed, err := c.IssuerSeed(consts.OpenSolarIssuerDir, project.Index, consts.IssuerSeedPwd)
+	if err != nil {
+		return errors.Wrap(err, "couldn't retrieve issuer")
+	}
+
+	address, err := c.Address(pubkey)
+	if err != nil {
+		return err
+	}
+
+	for _, code := range []string{project.InvestorAssetCode, project.SeedAssetCode} {
+		if code == "" {
+			continue
+		}
+		balance, err := c.Balance(address, code, issuerPubkey)
+		if err != nil || balance == 0 {
+			// the investor doesn't hold the asset, or it has already been taken back
+			continue
+		}
+		txhash, err := c.Clawback(code, issuerPubkey, address, balance, issuerSeed)
+		if err != nil {
+			return errors.Wrap(err, "couldn't take back "+code)
+		}
+		log.Println("took back", balance, code, "from", address, "txhash", txhash)
+	}
+	return nil
+}
+
+// refundInvestor takes back the assets issued to an investor and sends them amount in stablecoin
+func (project Project) refundInvestor(c chain.Chain, pubkey string, amount float64) (string, error) {
+	err := project.takeBackAssets(c, pubkey)
+	if err != nil {
+		return "", err
+	}
+	return sendRefund(c, pubkey, amount, project.Index)
+}
+
+// sendRefund sends amount in stablecoin from the platform back to an investor
+func sendRefund(c chain.Chain, pubkey string, amount float64, projIndex int) (string, error) {
+	projIndexString, err := utils.ToString(projIndex)
+	if err != nil {
+		return "", err
+	}
+
+	address, err := c.Address(pubkey)
+	if err != nil {
+		return "", err
+	}
+
+	code, issuer := c.Stablecoin()
+	return c.SendAsset(code, issuer, address, amount, consts.PlatformSeed, "Opensolar refund: "+projIndexString)
+}
+
+// RefundProject refunds every investor of a project whose funding round has failed and resets the project
+// so that it can be funded again. Investors who are refunded are removed from the project as the refund goes
+// on, so a refund that fails halfway can be retried without paying anyone twice. The issuer of the round is
+// frozen only once everyone has been refunded since it's needed to take back the assets of the investors.
+func RefundProject(projIndex int, reason string) error {
+	project, err := RetrieveProject(projIndex)
+	if err != nil {
+		return errors.Wrap(err, "couldn't retrieve project")
+	}
+
+	if project.EscrowPubkey != "" {
+		return errors.New("project funds have already been transferred to the escrow, can't refund")
+	}
+
+	c, err := project.chain()
+	if err != nil {
+		return err
+	}
+
+	var failed bool
+	for _, invIndex := range project.InvestorIndices {
+		investor, err := RetrieveInvestor(invIndex)
+		if err != nil {
+			log.Println("couldn't retrieve investor", err)
+			failed = true
+			continue
+		}
+
+		pubkey := investor.U.StellarWallet.PublicKey
+		_, invested := project.InvestorMap[pubkey]
+		_, seedInvested := project.SeedInvestorMap[pubkey]
+		if !invested && !seedInvested {
+			// already refunded, investors appear once per investment in InvestorIndices
+			continue
+		}
+
+		amount := project.refundAmount(pubkey)
+		txhash, err := project.refundInvestor(c, pubkey, amount)
+		if err != nil {
+			log.Println("couldn't refund investor", pubkey, err)
+			failed = true
+			continue
+		}
+
+		delete(project.InvestorMap, pubkey)
+		delete(project.SeedInvestorMap, pubkey)
+		err = project.Save()
+		if err != nil {
+			return errors.Wrap(err, "couldn't save project")
+		}
+
+		investor.AmountInvested -= amount
+		err = investor.Save()
+		if err != nil {
+			log.Println("couldn't save investor", err)
+		}
+
+		if investor.U.Notification {
+			notif.SendRefundNotifToInvestor(projIndex, investor.U.Email, reason, txhash)
+		}
+	}
+
+	if failed {
+		return errors.New("couldn't refund all investors, retry the refund")
+	}
+
+	// refund anyone left in the maps who isn't an investor on record any more
+	for _, pubkey := range append(mapKeys(project.InvestorMap), mapKeys(project.SeedInvestorMap)...) {
+		amount := project.refundAmount(pubkey)
+		if amount == 0 {
+			continue
+		}
+		_, err = project.refundInvestor(c, pubkey, amount)
+		if err != nil {
+			log.Println("couldn't refund investor", pubkey, err)
+			failed = true
+			continue
+		}
+		delete(project.InvestorMap, pubkey)
+		delete(project.SeedInvestorMap, pubkey)
+	}
+
+	if failed {
+		err = project.Save()
+		if err != nil {
+			return errors.Wrap(err, "couldn't save project")
+		}
+		return errors.New("couldn't refund all investors, retry the refund")
+	}
+
+	// freeze the issuer of the round so that it can't issue any more assets now that its assets have been taken back
+	if project.InvestorAssetCode != "" || project.SeedAssetCode != "" {
+		txhash, err := c.FreezeIssuer(consts.OpenSolarIssuerDir, projIndex, consts.IssuerSeedPwd)
+		if err != nil {
+			log.Println("couldn't freeze issuer, it might have been frozen already", err)
+		} else {
+			log.Println("froze issuer of refunded project", projIndex, "txhash", txhash)
+		}
+	}
+
+	err = project.resetFunding()
+	if err != nil {
+		return errors.Wrap(err, "couldn't reset project after refund")
+	}
+
+	recipient, err := RetrieveRecipient(project.RecipientIndex)
+	if err != nil {
+		log.Println("couldn't retrieve recipient", err)
+		return nil
+	}
+	notif.SendRefundNotifToRecipient(projIndex, recipient.U.Email, reason)
+	return nil
+}
+
+// mapKeys returns the keys of the passed map
+func mapKeys(m map[string]float64) []string {
+	var keys []string
+	for key := range m {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// resetFunding resets the funding parameters of a project after its investors have been refunded and moves it to
+// the next funding round. The next investment creates a new issuer and asset codes for the round
+func (project *Project) resetFunding() error {
+	project.FundingRound++
+	project.MoneyRaised = 0
+	project.SeedMoneyRaised = 0
+	project.InvestorIndices = nil
+	project.SeedInvestorIndices = nil
+	project.InvestorMap = nil
+	project.SeedInvestorMap = nil
+	project.InvestorAssetCode = ""
+	project.SeedAssetCode = ""
+	project.Lock = false
+	project.LockPwd = ""
+	project.FundingDeadline = 0
+	if project.Stage > Stage4.Number {
+		project.Stage = Stage4.Number
+	}
+	return project.Save()
+}
+
+// runFundingJob refunds investors if the project hasn't raised its total value by its funding deadline
+func runFundingJob(job *Job) error {
+	project, err := RetrieveProject(job.ProjectIndex)
+	if err != nil {
+		return errors.Wrap(err, "couldn't retrieve project")
+	}
+
+	if project.FundingDeadline == 0 || project.MoneyRaised >= project.TotalValue {
+		// the project has either been funded or refunded in the meantime
+		job.Status = JobDone
+		return nil
+	}
+
+	if utils.Unix() < project.FundingDeadline {
+		job.NextRun = project.FundingDeadline
+		return nil
+	}
+
+	err = RefundProject(job.ProjectIndex, "the project did not raise its total value before its funding deadline")
+	if err != nil {
+		return err
+	}
+	job.Status = JobDone
+	return nil
+}
@@ -0,0 +1,105 @@
+package core
+
+import (
+	"testing"
+
+	chain "github.com/YaleOpenLab/opensolar/chain"
+	consts "github.com/YaleOpenLab/opensolar/consts"
+)
+
+func TestRefundReinvest(t *testing.T) {
+	m, teardown := setupMock(t)
+	defer teardown()
+
+	var investors []Investor
+	for _, name := range []string{"investor1", "investor2"} {
+		investor, err := NewInvestor(name, testPwd, testSeedPwd, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.CreateAccount(investor.U.StellarWallet.PublicKey)
+		err = m.Credit(investor.U.StellarWallet.PublicKey, 1000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		investors = append(investors, investor)
+	}
+	pubkey1 := investors[0].U.StellarWallet.PublicKey
+	seed1 := testKey("investor1").Seed()
+
+	project := Project{
+		Index:          1,
+		Chain:          chain.MockName,
+		InvestmentType: "munibond",
+		Stage:          4,
+		TotalValue:     1000,
+		Metadata:       "refund test",
+	}
+	err := project.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = Invest(1, investors[0].U.Index, 300, seed1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Invest(1, investors[1].U.Index, 200, testKey("investor2").Seed())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	project, err = RetrieveProject(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := project.InvestorAssetCode
+	issuer, _, err := m.IssuerSeed(consts.OpenSolarIssuerDir, 1, consts.IssuerSeedPwd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = RefundProject(1, "the project did not raise its total value")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, investor := range investors {
+		address := investor.U.StellarWallet.PublicKey
+		checkStablecoin(t, m, address, 1000)
+		balance, err := m.Balance(address, code, issuer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if balance != 0 {
+			t.Fatalf("%s still holds %f of the refunded round's asset", address, balance)
+		}
+	}
+
+	project, err = RetrieveProject(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if project.FundingRound != 1 || project.InvestorAssetCode != "" || len(project.InvestorMap) != 0 {
+		t.Fatalf("project not reset after the refund, round %d code %s map %v", project.FundingRound,
+			project.InvestorAssetCode, project.InvestorMap)
+	}
+
+	// the next round is only counted towards what investors put into it
+	err = Invest(1, investors[0].U.Index, 100, seed1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	project, err = RetrieveProject(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if project.InvestorAssetCode == code {
+		t.Fatalf("next round issued the refunded round's asset %s", code)
+	}
+	if len(project.InvestorMap) != 1 || project.InvestorMap[pubkey1] != 0.1 {
+		t.Fatalf("investor map after reinvesting 100 is %v, expected 0.1", project.InvestorMap)
+	}
+	checkStablecoin(t, m, pubkey1, 900)
+}
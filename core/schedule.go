@@ -0,0 +1,157 @@
+package core
+
+import (
+	"github.com/pkg/errors"
+	"math"
+	"time"
+
+	consts "github.com/YaleOpenLab/opensolar/consts"
+)
+
+// a payment schedule lays out what the recipient of a munibond project owes and when. The amount
+// financed is amortized over EstimatedAcquisition years in equal installments, one every PaybackPeriod
+// weeks, at the project's annual InterestRate. Payments made by the recipient are applied to the
+// installments in order so that the payback job can tell how far behind the recipient is. Late fees charged
+// on an installment are settled first and kept apart from its interest, since they are owed to the platform
+// and not to investors.
+
+// scheduleEpsilon absorbs rounding errors when comparing amounts paid and owed on a schedule
+const scheduleEpsilon = 1e-7
+
+// Installment is a single row in a project's payment schedule
+type Installment struct {
+	Number      int     // the number of the installment, starting from 1
+	DueDate     int64   // unix time at which the installment is due
+	Payment     float64 // the total amount due in this installment
+	Principal   float64 // the part of the payment that goes towards the amount financed
+	Interest    float64 // the part of the payment that goes towards interest
+	Balance     float64 // the balance left to pay after this installment
+	LateFee     float64 // late fees charged on this installment by the project's breach policy
+	Paid        float64 // the amount that has been paid towards this installment, including late fees
+	LateFeePaid float64 // the part of Paid that went towards late fees
+}
+
+// scheduledPrincipal returns the amount that is amortized by the payment schedule. Seed investors are
+// promised SeedInvestmentFactor times their investment, so the premium they are owed is added to the
+// total value of the project.
+func (project Project) scheduledPrincipal() float64 {
+	principal := project.TotalValue
+	if project.SeedInvestmentFactor > 1 {
+		principal += project.SeedMoneyRaised
+	}
+	return principal
+}
+
+// GenerateSchedule returns the full payment schedule of the project with the first installment due one
+// payback period after start
+func (project Project) GenerateSchedule(start int64) ([]Installment, error) {
+	var schedule []Installment
+
+	if project.InvestmentType == "equity" {
+		return schedule, errors.New("equity projects pay dividends and don't have a payment schedule")
+	}
+
+	principal := project.scheduledPrincipal()
+	if principal <= 0 {
+		return schedule, errors.New("project total value must be positive")
+	}
+	if project.EstimatedAcquisition <= 0 {
+		return schedule, errors.New("project estimated acquisition must be positive")
+	}
+	if project.InterestRate < 0 {
+		return schedule, errors.New("project interest rate can't be negative")
+	}
+
+	period := project.PaybackPeriod
+	if period <= 0 {
+		period = consts.DefaultPaybackPeriod
+	}
+
+	periods := int(math.Ceil(float64(project.EstimatedAcquisition*52) / float64(period)))
+	rate := project.InterestRate * float64(period) / 52 // rate per payback period
+
+	var payment float64
+	if rate == 0 {
+		payment = principal / float64(periods)
+	} else {
+		payment = principal * rate / (1 - math.Pow(1+rate, -float64(periods)))
+	}
+
+	interval := int64(period) * int64(consts.OneWeekInSecond/time.Second)
+	balance := principal
+	for i := 1; i <= periods; i++ {
+		var installment Installment
+		installment.Number = i
+		installment.DueDate = start + int64(i)*interval
+		installment.Interest = balance * rate
+		installment.Principal = payment - installment.Interest
+		if i == periods {
+			// carry any rounding error over to the last installment
+			installment.Principal = balance
+		}
+		installment.Payment = installment.Principal + installment.Interest
+		balance -= installment.Principal
+		installment.Balance = balance
+		schedule = append(schedule, installment)
+	}
+
+	return schedule, nil
+}
+
+// SetSchedule generates the project's payment schedule starting at start and stores it with the project
+func (project *Project) SetSchedule(start int64) error {
+	schedule, err := project.GenerateSchedule(start)
+	if err != nil {
+		return errors.Wrap(err, "couldn't generate payment schedule")
+	}
+	project.Schedule = schedule
+	return project.Save()
+}
+
+// applySchedulePayment applies a payment to the project's installments in order and returns the
+// principal, interest and late fees that were paid. Any amount above what is left on the schedule is ignored.
+func (project *Project) applySchedulePayment(amount float64) (float64, float64, float64) {
+	var principal, interest, lateFees float64
+	for i := range project.Schedule {
+		if amount < scheduleEpsilon {
+			break
+		}
+		installment := &project.Schedule[i]
+		left := installment.Payment + installment.LateFee - installment.Paid
+		if left < scheduleEpsilon {
+			continue
+		}
+		pay := math.Min(amount, left)
+
+		// late fees on an installment are settled before its interest, and interest before its principal
+		feePaid := math.Min(pay, math.Max(installment.LateFee-installment.LateFeePaid, 0))
+		interestLeft := math.Max(installment.Interest-(installment.Paid-installment.LateFeePaid), 0)
+		interestPaid := math.Min(pay-feePaid, interestLeft)
+		lateFees += feePaid
+		interest += interestPaid
+		principal += pay - feePaid - interestPaid
+
+		installment.Paid += pay
+		installment.LateFeePaid += feePaid
+		amount -= pay
+	}
+	return principal, interest, lateFees
+}
+
+// AmountDue returns the amount due on the project's schedule at time now along with the number of
+// installments that are due and haven't been paid in full
+func (project Project) AmountDue(now int64) (float64, int) {
+	var due float64
+	var missed int
+	for _, installment := range project.Schedule {
+		if installment.DueDate > now {
+			break
+		}
+		left := installment.Payment + installment.LateFee - installment.Paid
+		if left >= scheduleEpsilon {
+			due += left
+			missed++
+		}
+	}
+	return due, missed
+}
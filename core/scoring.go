@@ -0,0 +1,183 @@
+package core
+
+import (
+	"github.com/pkg/errors"
+	"sort"
+)
+
+// a scoring auction ranks contracts on more than one dimension. Each criterion is normalized to
+// a score between 0 and 1 across all the contracts proposed and the weighted sum of these scores
+// decides the winner.
+
+// BidWeights are the weights given to each criterion while scoring contracts
+type BidWeights struct {
+	Price      float64 // weight of the price quoted, lower prices score higher
+	Time       float64 // weight of the completion time, shorter timelines score higher
+	Reputation float64 // weight of the contractor's reputation on the platform
+	Collateral float64 // weight of the collateral posted by the contractor
+	Feedback   float64 // weight of the average rating the contractor received in past feedback
+}
+
+// BidScore is the breakdown of the score of a specific contract
+type BidScore struct {
+	ProjectIndex    int     // the index of the scored contract
+	ContractorIndex int     // the index of the contractor who proposed the contract
+	Price           float64 // normalized price score
+	Time            float64 // normalized completion time score
+	Reputation      float64 // normalized reputation score
+	Collateral      float64 // normalized collateral score
+	Feedback        float64 // normalized feedback score
+	Total           float64 // weighted sum of the above scores
+}
+
+// DefaultBidWeights are the weights used when a project doesn't define its own
+var DefaultBidWeights = BidWeights{
+	Price:      0.4,
+	Time:       0.2,
+	Reputation: 0.2,
+	Collateral: 0.1,
+	Feedback:   0.1,
+}
+
+// SetBidWeights sets the weights used to score contracts proposed towards a project
+func (project *Project) SetBidWeights(weights BidWeights) error {
+	if weights.Price < 0 || weights.Time < 0 || weights.Reputation < 0 ||
+		weights.Collateral < 0 || weights.Feedback < 0 {
+		return errors.New("weights can't be negative")
+	}
+	if weights.Price+weights.Time+weights.Reputation+weights.Collateral+weights.Feedback == 0 {
+		return errors.New("at least one weight must be positive")
+	}
+	project.BidWeights = weights
+	return project.Save()
+}
+
+// normalize scales val between 0 and 1 given the lowest and highest values of the range. If lower
+// is set, lower values get a higher score
+func normalize(val float64, lo float64, hi float64, lower bool) float64 {
+	if hi == lo {
+		return 1
+	}
+	if lower {
+		return (hi - val) / (hi - lo)
+	}
+	return (val - lo) / (hi - lo)
+}
+
+// averageRating returns the average star rating given to an entity in past feedback
+func averageRating(entity Entity) float64 {
+	var sum float64
+	var count float64
+	for _, feedback := range entity.PastFeedback {
+		if feedback.Rating > 0 {
+			sum += feedback.Rating
+			count++
+		}
+	}
+	if count == 0 {
+		return 0
+	}
+	return sum / count
+}
+
+// ScoreContracts scores and ranks the passed contracts according to the given weights. The contract
+// with the highest score comes first.
+func ScoreContracts(arr []Project, contractors []Entity, weights BidWeights) ([]BidScore, error) {
+	var scores []BidScore
+	if len(arr) == 0 {
+		return scores, errors.New("Empty array passed!")
+	}
+	if len(arr) != len(contractors) {
+		return scores, errors.New("number of contracts and contractors don't match")
+	}
+
+	raw := make([][5]float64, len(arr))
+	var lo, hi [5]float64
+	for i := range arr {
+		raw[i] = [5]float64{
+			arr[i].TotalValue,
+			float64(arr[i].EstimatedAcquisition),
+			contractors[i].U.Reputation,
+			contractors[i].Collateral,
+			averageRating(contractors[i]),
+		}
+		for j := range raw[i] {
+			if i == 0 || raw[i][j] < lo[j] {
+				lo[j] = raw[i][j]
+			}
+			if i == 0 || raw[i][j] > hi[j] {
+				hi[j] = raw[i][j]
+			}
+		}
+	}
+
+	for i := range arr {
+		var score BidScore
+		score.ProjectIndex = arr[i].Index
+		score.ContractorIndex = arr[i].ContractorIndex
+		score.Price = normalize(raw[i][0], lo[0], hi[0], true)
+		score.Time = normalize(raw[i][1], lo[1], hi[1], true)
+		score.Reputation = normalize(raw[i][2], lo[2], hi[2], false)
+		score.Collateral = normalize(raw[i][3], lo[3], hi[3], false)
+		score.Feedback = normalize(raw[i][4], lo[4], hi[4], false)
+		score.Total = weights.Price*score.Price + weights.Time*score.Time + weights.Reputation*score.Reputation +
+			weights.Collateral*score.Collateral + weights.Feedback*score.Feedback
+		scores = append(scores, score)
+	}
+
+	sort.SliceStable(scores, func(i, j int) bool {
+		return scores[i].Total > scores[j].Total
+	})
+	return scores, nil
+}
+
+// SelectContractScore selects the winning contract towards the project at projIndex by scoring all the
+// passed contracts with the project's weights. The full ranking is stored as a ContractAuction so that
+// recipients can see why a particular contract won.
+func SelectContractScore(projIndex int, arr []Project) (ContractAuction, error) {
+	var auction ContractAuction
+
+	project, err := RetrieveProject(projIndex)
+	if err != nil {
+		return auction, errors.Wrap(err, "couldn't retrieve project")
+	}
+
+	if len(arr) == 0 {
+		return auction, errors.New("Empty array passed!")
+	}
+
+	var contractors []Entity
+	for _, elem := range arr {
+		contractor, err := RetrieveEntity(elem.ContractorIndex)
+		if err != nil {
+			return auction, errors.Wrap(err, "couldn't retrieve contractor")
+		}
+		contractors = append(contractors, contractor)
+	}
+
+	weights := project.BidWeights
+	if weights == (BidWeights{}) {
+		weights = DefaultBidWeights
+	}
+
+	scores, err := ScoreContracts(arr, contractors, weights)
+	if err != nil {
+		return auction, err
+	}
+
+	auction.Index = projIndex
+	auction.AllContracts = arr
+	for _, contractor := range contractors {
+		auction.AllContractors = append(auction.AllContractors, AuctionContractor{Index: contractor.U.Index, Name: contractor.U.Name})
+	}
+	auction.Weights = weights
+	auction.Scores = scores
+	for _, elem := range arr {
+		if elem.Index == scores[0].ProjectIndex {
+			auction.WinningContract = elem
+			break
+		}
+	}
+
+	return auction, auction.Save()
+}
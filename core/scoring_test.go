@@ -0,0 +1,70 @@
+package core
+
+import (
+	"testing"
+)
+
+func TestSelectContractScore(t *testing.T) {
+	teardown := setupPlatform(t)
+	defer teardown()
+
+	project := Project{Index: 1, Stage: 1}
+	err := project.SetBidWeights(BidWeights{Price: -1, Time: 1})
+	if err == nil {
+		t.Fatalf("negative weight accepted")
+	}
+	err = project.SetBidWeights(BidWeights{})
+	if err == nil {
+		t.Fatalf("weights that are all zero accepted")
+	}
+
+	// the cheaper contractor is slower and has less reputation and collateral
+	cheap, reputed := testContractor(t, "cheap"), testContractor(t, "reputed")
+	reputed.U.Reputation = 10
+	reputed.Collateral = 500
+	err = reputed.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+	contracts := []Project{
+		{Index: 2, ContractorIndex: cheap.U.Index, TotalValue: 900, EstimatedAcquisition: 12},
+		{Index: 3, ContractorIndex: reputed.U.Index, TotalValue: 1000, EstimatedAcquisition: 6},
+	}
+
+	// projects without weights of their own use the default weights, which favour the rest over the price
+	err = project.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+	auction, err := SelectContractScore(project.Index, contracts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if auction.Weights != DefaultBidWeights || auction.WinningContract.Index != 3 || len(auction.Scores) != 2 {
+		t.Fatalf("unexpected auction %v", auction)
+	}
+	score := auction.Scores[0]
+	if score.Price != 0 || score.Time != 1 || score.Reputation != 1 || score.Collateral != 1 || score.Feedback != 1 {
+		t.Fatalf("unexpected score %v", score)
+	}
+
+	err = project.SetBidWeights(BidWeights{Price: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	auction, err = SelectContractScore(project.Index, contracts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if auction.WinningContract.Index != 2 || auction.Scores[0].Total != 1 || auction.Scores[1].Total != 0 {
+		t.Fatalf("cheapest contract didn't win on price alone %v", auction.Scores)
+	}
+
+	stored, err := RetrieveContractAuction(project.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.WinningContract.Index != 2 || len(stored.AllContractors) != 2 {
+		t.Fatalf("ranking not stored %v", stored)
+	}
+}
@@ -0,0 +1,146 @@
+package core
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/pkg/errors"
+	"strconv"
+
+	utils "github.com/Varunram/essentials/utils"
+
+	consts "github.com/YaleOpenLab/opensolar/consts"
+)
+
+// sealed auctions let contractors bid on a project without showing their price to competitors. While the
+// auction is open a contractor only submits the hash of the price, timeline and a secret salt of random bytes.
+// Once bidding is over, contractors reveal their bids which are checked against the stored commitment before
+// the auction is closed and the winner is chosen using the auction's rule.
+
+// NewSealedBidSalt returns a hex encoded salt of random bytes for a sealed bid
+func NewSealedBidSalt() (string, error) {
+	salt := make([]byte, consts.SealedBidSaltLength)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", errors.Wrap(err, "couldn't generate salt")
+	}
+	return hex.EncodeToString(salt), nil
+}
+
+// checkSalt checks that a salt is hex encoded and at least SealedBidSaltLength bytes long. Short salts
+// would let anyone find the price of a sealed bid by hashing guesses against its commitment
+func checkSalt(salt string) error {
+	bytes, err := hex.DecodeString(salt)
+	if err != nil {
+		return errors.New("salt not hex encoded")
+	}
+	if len(bytes) < consts.SealedBidSaltLength {
+		return errors.New("salt shorter than " + strconv.Itoa(consts.SealedBidSaltLength) + " bytes")
+	}
+	return nil
+}
+
+// SealedBidCommitment returns the commitment for a sealed bid. Contractors should compute this
+// locally with a salt from NewSealedBidSalt and only ever send the resulting hash to the platform
+// before the reveal phase.
+func SealedBidCommitment(price float64, years int, salt string) (string, error) {
+	err := checkSalt(salt)
+	if err != nil {
+		return "", err
+	}
+	return utils.SHA3hash(strconv.FormatFloat(price, 'f', -1, 64) + ":" + strconv.Itoa(years) + ":" + salt), nil
+}
+
+// OpenSealedAuction opens a sealed auction on an originated project. Contractors commit to their bids for the
+// passed duration in seconds and have SealedBidRevealInterval seconds after that to reveal them, after which
+// the auction is closed using rule to pick the winner among the revealed bids
+func OpenSealedAuction(projIndex int, rule string, duration int64) (Auction, error) {
+	if duration <= 0 {
+		duration = consts.SealedBidCommitInterval
+	}
+	return openAuction(projIndex, rule, duration, true)
+}
+
+// CommitBid places a sealed bid on an open sealed auction. Only the commitment is stored, the price and the
+// timeline are left empty until the contractor reveals the bid.
+func (contractor *Entity) CommitBid(auctionIndex int, commitment string) (Bid, error) {
+	if len(commitment) != 128 {
+		return Bid{}, errors.New("commitment length not 128, quitting")
+	}
+
+	auction, err := RetrieveAuction(auctionIndex)
+	if err != nil {
+		return Bid{}, errors.Wrap(err, "couldn't retrieve auction")
+	}
+	if !auction.Sealed {
+		return Bid{}, errors.New("auction is not sealed")
+	}
+
+	bid, err := contractor.newBid(auction)
+	if err != nil {
+		return bid, err
+	}
+
+	bid.Commitment = commitment
+	return bid, bid.Save()
+}
+
+// RevealBid opens a sealed bid and checks it against its commitment once the auction has closed. Bids that are
+// revealed late, use a short salt or don't match their commitment are disqualified.
+func RevealBid(bidIndex int, contrIndex int, price float64, years int, salt string) (Bid, error) {
+	bid, err := RetrieveBid(bidIndex)
+	if err != nil {
+		return bid, errors.Wrap(err, "couldn't retrieve bid")
+	}
+	if bid.ContractorIndex != contrIndex {
+		return bid, errors.New("bid does not belong to contractor")
+	}
+	if bid.Commitment == "" {
+		return bid, errors.New("bid is not sealed")
+	}
+	if bid.Withdrawn {
+		return bid, errors.New("bid has been withdrawn")
+	}
+	if bid.Revealed || bid.Disqualified {
+		return bid, errors.New("sealed bid already revealed")
+	}
+
+	auction, err := RetrieveAuction(bid.AuctionIndex)
+	if err != nil {
+		return bid, errors.Wrap(err, "couldn't retrieve auction")
+	}
+
+	now := utils.Unix()
+	if now < auction.CloseTime {
+		return bid, errors.New("reveal phase has not started yet")
+	}
+
+	if auction.Closed || now >= auction.RevealTime {
+		bid.Disqualified = true
+		err = bid.Save()
+		if err != nil {
+			return bid, errors.Wrap(err, "couldn't save bid")
+		}
+		return bid, errors.New("reveal phase is over, sealed bid disqualified")
+	}
+
+	// the price of a bid committed with a short salt could have been found before the reveal phase, so such
+	// bids are disqualified as well
+	commitment, saltErr := SealedBidCommitment(price, years, salt)
+	if saltErr != nil || commitment != bid.Commitment {
+		bid.Disqualified = true
+		err = bid.Save()
+		if err != nil {
+			return bid, errors.Wrap(err, "couldn't save bid")
+		}
+		if saltErr != nil {
+			return bid, errors.Wrap(saltErr, "sealed bid disqualified")
+		}
+		return bid, errors.New("revealed bid does not match commitment, sealed bid disqualified")
+	}
+
+	bid.Price = price
+	bid.Years = years
+	bid.Revealed = true
+	bid.Timestamp = now
+	return bid, bid.Save()
+}
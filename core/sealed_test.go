@@ -0,0 +1,129 @@
+package core
+
+import (
+	"testing"
+
+	utils "github.com/Varunram/essentials/utils"
+)
+
+// commitBid commits a contractor to a sealed bid and returns the bid along with its salt
+func commitBid(t *testing.T, contractor Entity, auctionIndex int, price float64, years int) (Bid, string) {
+	salt, err := NewSealedBidSalt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	commitment, err := SealedBidCommitment(price, years, salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bid, err := contractor.CommitBid(auctionIndex, commitment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bid, salt
+}
+
+func TestSealedAuction(t *testing.T) {
+	teardown := setupPlatform(t)
+	defer teardown()
+
+	project := Project{Index: 1, Stage: 1, TotalValue: 1000}
+	err := project.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	auction, err := OpenSealedAuction(project.Index, "blind", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := auctionJob(t, project.Index)
+	if job.NextRun != auction.RevealTime {
+		t.Fatalf("sealed auction closing at %d scheduled for %d", auction.RevealTime, job.NextRun)
+	}
+
+	contractor1, contractor2 := testContractor(t, "contractor1"), testContractor(t, "contractor2")
+	contractor3 := testContractor(t, "contractor3")
+	_, err = contractor1.PlaceBid(auction.Index, 1000, 5, "open bid")
+	if err == nil {
+		t.Fatalf("open bid placed on a sealed auction")
+	}
+	_, err = contractor1.Propose("panels", 1000, "", 5, "proposal", 1, project.Index, "blind")
+	if err == nil {
+		t.Fatalf("proposal made around the auction on a project")
+	}
+
+	bid1, salt1 := commitBid(t, contractor1, auction.Index, 1000, 5)
+	bid2, salt2 := commitBid(t, contractor2, auction.Index, 900, 6)
+	bid3, salt3 := commitBid(t, contractor3, auction.Index, 800, 4)
+
+	_, err = RevealBid(bid2.Index, contractor2.U.Index, 900, 6, salt2)
+	if err == nil {
+		t.Fatalf("bid revealed while the auction is open")
+	}
+
+	auction.CloseTime = utils.Unix() - 1
+	err = auction.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = RevealBid(bid2.Index, contractor1.U.Index, 900, 6, salt2)
+	if err == nil {
+		t.Fatalf("bid revealed by another contractor")
+	}
+	_, err = RevealBid(bid2.Index, contractor2.U.Index, 900, 6, salt2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bid3, err = RevealBid(bid3.Index, contractor3.U.Index, 700, 4, salt3)
+	if err == nil || !bid3.Disqualified {
+		t.Fatalf("bid that doesn't match its commitment not disqualified")
+	}
+
+	// the auction isn't closed while bids can still be revealed
+	err = runAuctionJob(&job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != JobScheduled || job.NextRun != auction.RevealTime {
+		t.Fatalf("job closed a sealed auction during its reveal phase %v", job)
+	}
+
+	auction.RevealTime = utils.Unix() - 1
+	err = auction.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bid1, err = RevealBid(bid1.Index, contractor1.U.Index, 1000, 5, salt1)
+	if err == nil || !bid1.Disqualified {
+		t.Fatalf("bid revealed after the reveal phase not disqualified")
+	}
+
+	err = runAuctionJob(&job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auction, err = RetrieveAuction(auction.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !auction.Closed || auction.WinningBid != bid2.Index {
+		t.Fatalf("revealed bid didn't win the sealed auction %v", auction)
+	}
+	project, err = RetrieveProject(project.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if project.Stage != 4 || project.ContractorIndex != contractor2.U.Index || project.TotalValue != 900 {
+		t.Fatalf("winning sealed bid not assigned to project %v", project)
+	}
+
+	projects, err := RetrieveAllProjects()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(projects) != 1 {
+		t.Fatalf("sealed bids saved as %d projects", len(projects))
+	}
+}
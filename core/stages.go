@@ -337,3 +337,6 @@ func (a *Project) SetStage(number int) error {
 	a.Stage = number
 	return a.Save()
 }
+
+// stages lists the stages that a project goes through, indexed by their number
+var stages = []Stage{Stage0, Stage1, Stage2, Stage3, Stage4, Stage5, Stage6, Stage7, Stage8, Stage9}
@@ -0,0 +1,306 @@
+package core
+
+import (
+	"github.com/pkg/errors"
+	"log"
+	"sort"
+
+	utils "github.com/Varunram/essentials/utils"
+
+	chain "github.com/YaleOpenLab/opensolar/chain"
+	consts "github.com/YaleOpenLab/opensolar/consts"
+)
+
+// paybacks are paid into the project escrow and distributed from there in priority order. Each tier of the
+// waterfall is paid in full before the next one sees any money:
+// 1. operations and insurance accounts in the project's WaterfallMap
+// 2. developer, originator and contractor fees
+// 3. senior debt held by DebtInvestor1 and DebtInvestor2
+// 4. investor coupons, capped at what the project's investment model wants to pay investors
+// 5. late fees the recipient has paid, which go to the platform and not to investors
+// 6. whatever is left goes towards the recipient's ownership of the project and stays in the escrow
+// Every payment produces a Distribution that lists what was paid to whom.
+
+const (
+	// TierReserve pays the operations and insurance accounts of the project
+	TierReserve = "reserve"
+
+	// TierFees pays the fees of the entities involved in the project
+	TierFees = "fees"
+
+	// TierSeniorDebt pays the project's senior debt investors
+	TierSeniorDebt = "seniordebt"
+
+	// TierCoupon pays the project's investors
+	TierCoupon = "coupon"
+
+	// TierLateFee pays the late fees the recipient has paid to the platform
+	TierLateFee = "latefee"
+
+	// TierOwnership is the remainder that goes towards the recipient's ownership of the project
+	TierOwnership = "ownership"
+)
+
+// Distribution is the itemised record of how a single payback was distributed
+type Distribution struct {
+	Index        int                // the index of the distribution
+	ProjectIndex int                // the index of the project that was paid back towards
+	Amount       float64            // the amount paid back by the recipient
+	Timestamp    int64              // unix time at which the payback was distributed
+	Items        []DistributionItem // the payments made out of the payback in the order they were made
+}
+
+// DistributionItem is a single payment made out of a payback
+type DistributionItem struct {
+	Tier   string  // the tier of the waterfall the payment was made in
+	Payee  string  // the party that was paid
+	Amount float64 // the amount paid
+	Error  string  // the error that stopped the payment from going through, if any
+}
+
+// waterfall keeps track of a payback as it moves through the tiers
+type waterfall struct {
+	project       *Project
+	c             chain.Chain // the chain the project is on
+	recipientSeed string
+	remaining     float64
+	distribution  Distribution
+}
+
+// pay pays up to owed out of what is left of the payback to pubkey and returns the amount paid. Payments
+// that fail stay in the escrow and the amount is still taken out of the payback so that lower tiers don't
+// get paid before higher ones
+func (w *waterfall) pay(tier string, payee string, pubkey string, owed float64) float64 {
+	amount := owed
+	if w.remaining < amount {
+		amount = w.remaining
+	}
+	if amount <= 0 {
+		return 0
+	}
+	w.remaining -= amount
+
+	item := DistributionItem{Tier: tier, Payee: payee, Amount: amount}
+	address, err := w.c.Address(pubkey)
+	if err == nil {
+		_, err = w.c.SendFromEscrow(w.project.EscrowPubkey, address, amount, w.recipientSeed, consts.PlatformSeed, tier)
+	}
+	if err != nil {
+		log.Println("couldn't pay", payee, "out of escrow", err)
+		item.Error = err.Error()
+		w.distribution.Items = append(w.distribution.Items, item)
+		return 0
+	}
+
+	w.distribution.Items = append(w.distribution.Items, item)
+	return amount
+}
+
+// fail records a payment that couldn't be made since the payee couldn't be found
+func (w *waterfall) fail(tier string, payee string, err error) {
+	log.Println("couldn't pay", payee, err)
+	w.distribution.Items = append(w.distribution.Items, DistributionItem{Tier: tier, Payee: payee, Error: err.Error()})
+}
+
+// payReserve pays the operations and insurance accounts in the project's WaterfallMap
+func (w *waterfall) payReserve() {
+	var pubkeys []string
+	for pubkey := range w.project.WaterfallMap {
+		pubkeys = append(pubkeys, pubkey)
+	}
+	sort.Strings(pubkeys) // pay accounts in the same order every time
+
+	for _, pubkey := range pubkeys {
+		w.project.WaterfallMap[pubkey] -= w.pay(TierReserve, pubkey, pubkey, w.project.WaterfallMap[pubkey])
+	}
+}
+
+// payEntityFee pays the fee of an entity involved in the project and returns the amount paid
+func (w *waterfall) payEntityFee(entityIndex int, fee float64, paid float64) float64 {
+	if fee-paid <= 0 || w.remaining <= 0 {
+		return 0
+	}
+
+	entityIndexString, err := utils.ToString(entityIndex)
+	if err != nil {
+		return 0
+	}
+	payee := "entity " + entityIndexString
+
+	entity, err := RetrieveEntity(entityIndex)
+	if err != nil {
+		w.fail(TierFees, payee, err)
+		return 0
+	}
+	return w.pay(TierFees, payee, entity.U.StellarWallet.PublicKey, fee-paid)
+}
+
+// payFees pays the developer, originator and contractor fees of the project
+func (w *waterfall) payFees() {
+	project := w.project
+	for len(project.DeveloperFeePaid) < len(project.DeveloperFee) {
+		project.DeveloperFeePaid = append(project.DeveloperFeePaid, 0)
+	}
+
+	for i, fee := range project.DeveloperFee {
+		if i >= len(project.DeveloperIndices) {
+			log.Println("developer fee", i, "doesn't have a developer associated with it")
+			break
+		}
+		project.DeveloperFeePaid[i] += w.payEntityFee(project.DeveloperIndices[i], fee, project.DeveloperFeePaid[i])
+	}
+
+	project.OriginatorFeePaid += w.payEntityFee(project.OriginatorIndex, project.OriginatorFee, project.OriginatorFeePaid)
+	project.ContractorFeePaid += w.payEntityFee(project.ContractorIndex, project.ContractorFee, project.ContractorFeePaid)
+}
+
+// payDebtInvestor pays senior debt owed to a debt investor and returns the amount paid
+func (w *waterfall) payDebtInvestor(debtInvestor string, owed float64) float64 {
+	if debtInvestor == "" || owed <= 0 || w.remaining <= 0 {
+		return 0
+	}
+
+	invIndex, err := utils.ToInt(debtInvestor)
+	if err != nil {
+		w.fail(TierSeniorDebt, debtInvestor, errors.New("debt investor not registered on the platform"))
+		return 0
+	}
+
+	investor, err := RetrieveInvestor(invIndex)
+	if err != nil {
+		w.fail(TierSeniorDebt, debtInvestor, err)
+		return 0
+	}
+	return w.pay(TierSeniorDebt, debtInvestor, investor.U.StellarWallet.PublicKey, owed)
+}
+
+// paySeniorDebt pays the senior debt investors of the project in order
+func (w *waterfall) paySeniorDebt() {
+	project := w.project
+	project.DebtInvestor1Owed -= w.payDebtInvestor(project.DebtInvestor1, project.DebtInvestor1Owed)
+	project.DebtInvestor2Owed -= w.payDebtInvestor(project.DebtInvestor2, project.DebtInvestor2Owed)
+}
+
+// SetSeniorDebt records the senior debt of a project held by up to two investors, which is paid back ahead of
+// investor coupons. An investor index of zero means there is no debt investor. Only the project's originator can
+// record debt and only before the recipient starts paying back
+func SetSeniorDebt(projIndex int, entityIndex int, invIndex1 int, owed1 float64, invIndex2 int, owed2 float64) (Project, error) {
+	project, err := RetrieveProject(projIndex)
+	if err != nil {
+		return project, errors.Wrap(err, "couldn't retrieve project")
+	}
+
+	if project.OriginatorIndex != entityIndex {
+		return project, errors.New("only the project's originator can record its senior debt")
+	}
+
+	if project.DateLastPaid != 0 {
+		return project, errors.New("senior debt can't be recorded once the recipient has started paying back")
+	}
+
+	debtInvestor := func(invIndex int, owed float64) (string, error) {
+		if owed < 0 {
+			return "", errors.New("senior debt can't be negative")
+		}
+		if invIndex == 0 {
+			if owed != 0 {
+				return "", errors.New("senior debt must be held by an investor")
+			}
+			return "", nil
+		}
+		_, err := RetrieveInvestor(invIndex)
+		if err != nil {
+			return "", errors.Wrap(err, "couldn't retrieve debt investor")
+		}
+		return utils.ToString(invIndex)
+	}
+
+	project.DebtInvestor1, err = debtInvestor(invIndex1, owed1)
+	if err != nil {
+		return project, err
+	}
+
+	project.DebtInvestor2, err = debtInvestor(invIndex2, owed2)
+	if err != nil {
+		return project, err
+	}
+
+	project.DebtInvestor1Owed = owed1
+	project.DebtInvestor2Owed = owed2
+	return project, project.Save()
+}
+
+// payCoupons pays investors through the project's investment model
+func (w *waterfall) payCoupons(distributable float64) {
+	amount := distributable
+	if w.remaining < amount {
+		amount = w.remaining
+	}
+	if amount <= 0 {
+		return
+	}
+	w.remaining -= amount
+
+	item := DistributionItem{Tier: TierCoupon, Payee: "investors", Amount: amount}
+	err := DistributePayments(w.recipientSeed, w.project.EscrowPubkey, w.project.Index, amount)
+	if err != nil {
+		log.Println("couldn't pay investors", err)
+		item.Error = err.Error()
+	}
+	w.distribution.Items = append(w.distribution.Items, item)
+}
+
+// payLateFees pays the late fees the recipient has paid to the platform
+func (w *waterfall) payLateFees() {
+	w.project.LateFeesPaid += w.pay(TierLateFee, "platform", consts.PlatformPublicKey, w.project.LateFees-w.project.LateFeesPaid)
+}
+
+// DistributeWaterfall distributes a payback of amount towards the project through the waterfall. Investors
+// receive at most distributable, which is what the project's investment model wants to pay them out of the
+// payback. The itemised distribution is stored and returned
+func DistributeWaterfall(projIndex int, recipientSeed string, amount float64, distributable float64) (Distribution, error) {
+	var distribution Distribution
+	project, err := RetrieveProject(projIndex)
+	if err != nil {
+		return distribution, errors.Wrap(err, "couldn't retrieve project")
+	}
+
+	if project.EscrowLock {
+		log.Println("project", project.Index, "'s escrow locked, can't send funds")
+		return distribution, errors.New("project escrow locked, can't send funds")
+	}
+
+	distributions, err := RetrieveAllDistributions()
+	if err != nil {
+		return distribution, errors.Wrap(err, "couldn't retrieve distributions")
+	}
+
+	c, err := project.chain()
+	if err != nil {
+		return distribution, err
+	}
+
+	w := waterfall{project: &project, c: c, recipientSeed: recipientSeed, remaining: amount}
+	w.distribution.Index = len(distributions) + 1
+	w.distribution.ProjectIndex = projIndex
+	w.distribution.Amount = amount
+	w.distribution.Timestamp = utils.Unix()
+
+	w.payReserve()
+	w.payFees()
+	w.paySeniorDebt()
+	w.payCoupons(distributable)
+	w.payLateFees()
+
+	if w.remaining > 0 {
+		// the rest stays in the escrow and counts towards the recipient's ownership of the project
+		w.distribution.Items = append(w.distribution.Items, DistributionItem{Tier: TierOwnership, Payee: project.EscrowPubkey, Amount: w.remaining})
+	}
+
+	err = project.Save()
+	if err != nil {
+		return w.distribution, errors.Wrap(err, "couldn't save project")
+	}
+
+	return w.distribution, w.distribution.Save()
+}
@@ -0,0 +1,202 @@
+package core
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	utils "github.com/Varunram/essentials/utils"
+
+	chain "github.com/YaleOpenLab/opensolar/chain"
+	consts "github.com/YaleOpenLab/opensolar/consts"
+)
+
+func TestSeniorDebtPaidAheadOfCoupons(t *testing.T) {
+	m, teardown := setupMock(t)
+	defer teardown()
+
+	recipient, err := NewRecipient("recipient", testPwd, testSeedPwd, "Recipient")
+	if err != nil {
+		t.Fatal(err)
+	}
+	investor, err := NewInvestor("investor", testPwd, testSeedPwd, "Investor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	debtInvestor, err := NewInvestor("debtinvestor", testPwd, testSeedPwd, "Debt Investor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := NewUser("originator", utils.SHA3hash(testPwd), testSeedPwd, "Originator")
+	if err != nil {
+		t.Fatal(err)
+	}
+	originator := Entity{U: &user, Originator: true}
+	err = originator.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recpSeed := testKey("recipient").Seed()
+	m.CreateAccount(recipient.U.StellarWallet.PublicKey)
+	m.CreateAccount(investor.U.StellarWallet.PublicKey)
+	m.CreateAccount(debtInvestor.U.StellarWallet.PublicKey)
+
+	escrow, err := m.InitEscrow(1, testSeedPwd, recpSeed, consts.PlatformSeed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.Credit(escrow, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	project := Project{
+		Index:           1,
+		Chain:           chain.MockName,
+		InvestmentType:  "munibond",
+		RecipientIndex:  recipient.U.Index,
+		OriginatorIndex: originator.U.Index,
+		EscrowPubkey:    escrow,
+		InvestorIndices: []int{investor.U.Index},
+		InvestorMap:     map[string]float64{investor.U.StellarWallet.PublicKey: 1},
+	}
+	err = project.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = SetSeniorDebt(project.Index, investor.U.Index, debtInvestor.U.Index, 150, 0, 0)
+	if err == nil {
+		t.Fatal("senior debt recorded by someone other than the originator")
+	}
+
+	_, err = SetSeniorDebt(project.Index, originator.U.Index, 0, 150, 0, 0)
+	if err == nil {
+		t.Fatal("senior debt recorded without a debt investor")
+	}
+
+	project, err = SetSeniorDebt(project.Index, originator.U.Index, debtInvestor.U.Index, 150, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	debtPayee, err := utils.ToString(debtInvestor.U.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// each payback pays down the senior debt before investors see any coupons
+	paybacks := []struct {
+		items   []DistributionItem
+		owed    float64
+		debt    float64
+		coupons float64
+	}{
+		{[]DistributionItem{{Tier: TierSeniorDebt, Payee: debtPayee, Amount: 100}}, 50, 100, 0},
+		{[]DistributionItem{{Tier: TierSeniorDebt, Payee: debtPayee, Amount: 50}, {Tier: TierCoupon, Payee: "investors", Amount: 50}}, 0, 150, 50},
+		{[]DistributionItem{{Tier: TierCoupon, Payee: "investors", Amount: 100}}, 0, 150, 150},
+	}
+
+	for i, payback := range paybacks {
+		distribution, err := DistributeWaterfall(project.Index, recpSeed, 100, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(distribution.Items) != len(payback.items) {
+			t.Fatalf("payback %d distributed as %v, expected %v", i+1, distribution.Items, payback.items)
+		}
+		for j, item := range distribution.Items {
+			if item != payback.items[j] {
+				t.Fatalf("payback %d distributed as %v, expected %v", i+1, distribution.Items, payback.items)
+			}
+		}
+
+		project, err = RetrieveProject(project.Index)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if project.DebtInvestor1Owed != payback.owed {
+			t.Fatalf("senior debt owed after payback %d is %f, expected %f", i+1, project.DebtInvestor1Owed, payback.owed)
+		}
+
+		debt, err := m.Balance(debtInvestor.U.StellarWallet.PublicKey, chain.MockStablecoinCode, chain.MockStablecoinIssuer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		coupons, err := m.Balance(investor.U.StellarWallet.PublicKey, chain.MockStablecoinCode, chain.MockStablecoinIssuer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if debt != payback.debt || coupons != payback.coupons {
+			t.Fatalf("after payback %d the debt investor holds %f and the investor %f, expected %f and %f",
+				i+1, debt, coupons, payback.debt, payback.coupons)
+		}
+	}
+}
+
+func TestLateFeesPaidToPlatform(t *testing.T) {
+	m, teardown := setupMock(t)
+	defer teardown()
+
+	project, recipient, investors := modelProject(t, m, "munibond", 0)
+	recpSeed := testKey("recipient").Seed()
+	modelAsset(t, m, project.DebtAssetCode, 1000, recpSeed)
+
+	// the first installment is due and the recipient is charged a late fee of 10 on it
+	project.InterestRate = 0.05
+	project.InvestorMap = map[string]float64{
+		investors[0].U.StellarWallet.PublicKey: 0.6,
+		investors[1].U.StellarWallet.PublicKey: 0.4,
+	}
+	interval := int64(consts.DefaultPaybackPeriod) * int64(consts.OneWeekInSecond/time.Second)
+	err := project.SetSchedule(utils.Unix() - interval - 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = project.chargeLateFee(10, utils.Unix())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = project.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	installment := project.Schedule[0]
+	err = m.Credit(recipient.U.StellarWallet.PublicKey, installment.Payment+10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Payback(recipient.U.Index, project.Index, project.DebtAssetCode, installment.Payment+10, recpSeed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// investors are paid the installment's principal and interest while the late fee goes to the platform
+	balances := map[string]float64{
+		investors[0].U.StellarWallet.PublicKey: 0.6 * installment.Payment,
+		investors[1].U.StellarWallet.PublicKey: 0.4 * installment.Payment,
+		consts.PlatformPublicKey:               10,
+		project.EscrowPubkey:                   0,
+	}
+	for address, expected := range balances {
+		balance, err := m.Balance(address, chain.MockStablecoinCode, chain.MockStablecoinIssuer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(balance-expected) > scheduleEpsilon {
+			t.Fatalf("%s holds %f after the payback, expected %f", address, balance, expected)
+		}
+	}
+
+	project, err = RetrieveProject(project.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if project.LateFees != 10 || project.LateFeesPaid != 10 || project.Schedule[0].LateFeePaid != 10 {
+		t.Fatalf("late fees of %f paid %f, installment late fee paid %f", project.LateFees, project.LateFeesPaid,
+			project.Schedule[0].LateFeePaid)
+	}
+}
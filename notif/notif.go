@@ -356,3 +356,152 @@ func SendRecpNotFoundEmail(projIndex int, recpIndex int) error {
 
 	return email.SendMail(body, consts.AdminEmail)
 }
+
+// SendAuctionWonEmail sends an email to the contractor whose bid won the auction on a project
+func SendAuctionWonEmail(projIndex int, to string) error {
+	projIndexString, err := utils.ToString(projIndex)
+	if err != nil {
+		return err
+	}
+	body := "Greetings from the opensolar platform! \n\n" +
+		"We're writing to let you know that your bid on project number: " + projIndexString + " has won the auction.\n\n" +
+		"Please logon to the platform to review the project and proceed with the next steps.\n\n\n" +
+		footerString
+	return email.SendMail(body, to)
+}
+
+// SendAuctionLostEmail sends an email to a contractor whose bid did not win the auction on a project
+func SendAuctionLostEmail(projIndex int, to string) error {
+	projIndexString, err := utils.ToString(projIndex)
+	if err != nil {
+		return err
+	}
+	body := "Greetings from the opensolar platform! \n\n" +
+		"We're writing to let you know that the auction on project number: " + projIndexString + " has closed " +
+		"and your bid was not selected.\n\n" +
+		"Thank you for bidding on the project, we hope to see your bids on other projects on the platform.\n\n\n" +
+		footerString
+	return email.SendMail(body, to)
+}
+
+// SendEquityNotifToRecipient sends a notification to the recipient when their equity project has been
+// funded and handed over to them
+func SendEquityNotifToRecipient(projIndex int, to string, freezeHash string) error {
+	projIndexString, err := utils.ToString(projIndex)
+	if err != nil {
+		return err
+	}
+	body := "Greetings from the opensolar platform! \n\n" +
+		"We're writing to let you know that project number: " + projIndexString + " has been fully funded through equity crowdfunding.\n\n" +
+		"No further shares will be issued towards the project. Proof of the closed share issuance is attached below:  \n\n" +
+		"Share issuance hash is: https://testnet.steexp.com/tx/" + freezeHash + "\n\n" +
+		"Dividends are to be paid out of the project's net revenue and can be paid through the platform.\n\n\n" +
+		footerString
+	return email.SendMail(body, to)
+}
+
+// SendDividendNotifToRecipient sends a notification email to the recipient when they pay dividends
+// towards an equity project
+func SendDividendNotifToRecipient(projIndex int, to string, stableUSDHash string) error {
+	projIndexString, err := utils.ToString(projIndex)
+	if err != nil {
+		return err
+	}
+	body := "Greetings from the opensolar platform! \n\n" +
+		"We're writing to let you know have paid dividends towards project number: " + projIndexString + "\n\n" +
+		"Your proof of payment is attached below and may be used as future reference in case of discrepancies:  \n\n" +
+		"Stablecoin payment hash is: https://testnet.steexp.com/tx/" + stableUSDHash + "\n\n\n" +
+		footerString
+	return email.SendMail(body, to)
+}
+
+// SendDividendNotifToInvestor sends a notification email to a shareholder when the recipient pays
+// dividends towards an equity project
+func SendDividendNotifToInvestor(projIndex int, to string) error {
+	projIndexString, err := utils.ToString(projIndex)
+	if err != nil {
+		return err
+	}
+	body := "Greetings from the opensolar platform! \n\n" +
+		"We're writing to let you know that the recipient has paid dividends towards project number: " + projIndexString + "\n\n" +
+		"Your share of the dividends has been sent to your account in proportion to the shares you hold.\n\n\n" +
+		footerString
+	return email.SendMail(body, to)
+}
+
+// SendRefundNotifToInvestor sends a notification email to the investor when their investment in a
+// project is refunded
+func SendRefundNotifToInvestor(projIndex int, to string, reason string, refundHash string) error {
+	projIndexString, err := utils.ToString(projIndex)
+	if err != nil {
+		return err
+	}
+	body := "Greetings from the opensolar platform! \n\n" +
+		"We're writing to let you know that your investment in project number: " + projIndexString + " has been refunded since " + reason + ".\n\n" +
+		"The assets you received for this investment no longer carry any value. Your proof of refund is attached below:  \n\n" +
+		"Refund hash is: https://testnet.steexp.com/tx/" + refundHash + "\n\n\n" +
+		footerString
+	return email.SendMail(body, to)
+}
+
+// SendRefundNotifToRecipient sends a notification email to the recipient when the investors in their
+// project are refunded
+func SendRefundNotifToRecipient(projIndex int, to string, reason string) error {
+	projIndexString, err := utils.ToString(projIndex)
+	if err != nil {
+		return err
+	}
+	body := "Greetings from the opensolar platform! \n\n" +
+		"We're writing to let you know that the investors in project number: " + projIndexString + " have been refunded since " + reason + ".\n\n" +
+		"The project is open for investment again and you will be notified once it has been funded.\n\n\n" +
+		footerString
+	return email.SendMail(body, to)
+}
+
+// SendLateFeeEmail sends an email to the recipient when a late fee is charged on missed payments
+func SendLateFeeEmail(projIndex int, to string, fee float64) error {
+	projIndexString, err := utils.ToString(projIndex)
+	if err != nil {
+		return err
+	}
+	feeString, err := utils.ToString(fee)
+	if err != nil {
+		return err
+	}
+	body := "Greetings from the opensolar platform! \n\n" +
+		"We're writing to let you know that a late fee of " + feeString + " has been added to the amount due on project number: " + projIndexString +
+		" since payments towards it haven't been made.\n\n Please payback at the earliest to avoid further action.\n\n\n" +
+		footerString
+	return email.SendMail(body, to)
+}
+
+// SendDefaultEmail sends an email to the parties involved in a project when it is moved to default
+func SendDefaultEmail(projIndex int, to string) error {
+	projIndexString, err := utils.ToString(projIndex)
+	if err != nil {
+		return err
+	}
+	body := "Greetings from the opensolar platform! \n\n" +
+		"We're writing to let you know that project number: " + projIndexString + " has been declared in default since " +
+		"payments towards it haven't been made for an extended period of time.\n\n" +
+		"We will be reaching out to you in the coming days on how to proceed.\n\n\n" +
+		footerString
+	return email.SendMail(body, to)
+}
+
+// SendInvoiceEmail sends an email to the recipient when they are invoiced for the energy used in a billing period
+func SendInvoiceEmail(projIndex int, to string, amount float64) error {
+	projIndexString, err := utils.ToString(projIndex)
+	if err != nil {
+		return err
+	}
+	amountString, err := utils.ToString(amount)
+	if err != nil {
+		return err
+	}
+	body := "Greetings from the opensolar platform! \n\n" +
+		"We're writing to let you know that you have been invoiced " + amountString + " for the energy used by project number: " + projIndexString +
+		" in the last billing period.\n\n Please payback at the earliest.\n\n\n" +
+		footerString
+	return email.SendMail(body, to)
+}
@@ -11,19 +11,29 @@ import (
 	"github.com/spf13/viper"
 
 	erpc "github.com/Varunram/essentials/rpc"
+	chain "github.com/YaleOpenLab/opensolar/chain"
 	consts "github.com/YaleOpenLab/opensolar/consts"
+	core "github.com/YaleOpenLab/opensolar/core"
 	loader "github.com/YaleOpenLab/opensolar/loader"
+	oracle "github.com/YaleOpenLab/opensolar/oracle"
 	rpc "github.com/YaleOpenLab/opensolar/rpc"
-	// core "github.com/YaleOpenLab/opensolar/core"
+	store "github.com/YaleOpenLab/opensolar/store"
 
 	openxconsts "github.com/YaleOpenLab/openx/consts"
 	openxrpc "github.com/YaleOpenLab/openx/rpc"
 )
 
 var opts struct {
-	Insecure bool   `short:"i" description:"Start the API using http. Not recommended"`
-	Port     int    `short:"p" description:"The port on which the server runs on. Default: HTTPS/8081"`
-	OpenxURL string `short:"o" description:"The URL of the openx instance to connect to. Default: http://localhost:8080"`
+	Insecure  bool   `short:"i" description:"Start the API using http. Not recommended"`
+	Port      int    `short:"p" description:"The port on which the server runs on. Default: HTTPS/8081"`
+	OpenxURL  string `short:"o" description:"The URL of the openx instance to connect to. Default: http://localhost:8080"`
+	TariffCSV string `long:"tariffcsv" description:"The path to a CSV tariff schedule used to price electricity"`
+	TariffURL string `long:"tariffurl" description:"The URL of a utility rate feed used to price electricity"`
+	Emissions string `long:"emissions" description:"The path to a CSV file of grid emission factors by location used for carbon accounting"`
+	Store     string `long:"store" description:"The content store project documents are kept in: ipfs, fs or memory. Default: ipfs"`
+	StorePath string `long:"storepath" description:"The address of the ipfs api or the directory of the fs store"`
+	Algod     string `long:"algod" description:"The address of the algod node used for projects on algorand. Default: http://localhost:4001"`
+	AlgodKey  string `long:"algodtoken" description:"The api token of the algod node used for projects on algorand"`
 }
 
 // ParseConfig parses CLI parameters
@@ -39,6 +49,31 @@ func ParseConfig(args []string) (bool, int, error) {
 	if opts.OpenxURL != "" {
 		consts.OpenxURL = opts.OpenxURL
 	}
+	if opts.TariffCSV != "" {
+		oracle.SetProvider(oracle.CSVProvider{Path: opts.TariffCSV})
+	} else if opts.TariffURL != "" {
+		oracle.SetProvider(oracle.HTTPProvider{URL: opts.TariffURL})
+	}
+	if opts.Emissions != "" {
+		err = oracle.LoadEmissionFactors(opts.Emissions)
+		if err != nil {
+			return false, -1, err
+		}
+	}
+	if opts.Store != "" {
+		s, err := store.New(opts.Store, opts.StorePath)
+		if err != nil {
+			return false, -1, err
+		}
+		store.SetStore(s)
+	}
+	if opts.Algod != "" {
+		algorand, err := chain.NewAlgorand(opts.Algod, opts.AlgodKey)
+		if err != nil {
+			return false, -1, err
+		}
+		chain.Register(algorand)
+	}
 	return opts.Insecure, port, nil
 }
 
@@ -132,6 +167,7 @@ func main() {
 	// rpc.KillCode = "NUKE" // compile time nuclear code
 	// run this only when you need to monitor the tellers. Not required for local testing.
 	// go opensolar.MonitorTeller(1)
+	go core.RunScheduler() // run jobs that are due, including those that were due while the platform was down
 	fmt.Println(`
 		██████╗ ██████╗ ███████╗███╗   ██╗███████╗ ██████╗ ██╗      █████╗ ██████╗
 	 ██╔═══██╗██╔══██╗██╔════╝████╗  ██║██╔════╝██╔═══██╗██║     ██╔══██╗██╔══██╗
@@ -0,0 +1,86 @@
+package oracle
+
+import (
+	"encoding/csv"
+	"github.com/pkg/errors"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// the emission factor of a grid is the carbon dioxide equivalent emitted per MWh of electricity it supplies.
+// Every MWh a project generates displaces a MWh from the grid at its location, so the carbon it avoids is its
+// generation times the emission factor of that grid. Factors are kept in a table keyed by location like
+// tariffs, with the factor stored under an empty location used for locations that don't have one of their own.
+
+// DefaultEmissionFactor is the emission factor in tCO2e per MWh used for locations without a factor of their
+// own, the US average from EPA eGRID
+var DefaultEmissionFactor = 0.386
+
+var (
+	// emissionFactors maps locations to the emission factor of their grid in tCO2e per MWh
+	emissionFactors = map[string]float64{
+		"":            DefaultEmissionFactor,
+		"Puerto Rico": 0.741, // PRMS subregion of EPA eGRID, mostly oil and gas fired plants
+	}
+	// emissionFactorsLock guards emissionFactors
+	emissionFactorsLock sync.RWMutex
+)
+
+// SetEmissionFactor sets the emission factor in tCO2e per MWh of the grid at location
+func SetEmissionFactor(location string, factor float64) error {
+	if factor < 0 {
+		return errors.New("emission factor can't be negative")
+	}
+	emissionFactorsLock.Lock()
+	defer emissionFactorsLock.Unlock()
+	emissionFactors[location] = factor
+	return nil
+}
+
+// EmissionFactor returns the emission factor in tCO2e per MWh of the grid at location
+func EmissionFactor(location string) float64 {
+	emissionFactorsLock.RLock()
+	defer emissionFactorsLock.RUnlock()
+	if factor, exists := emissionFactors[location]; exists {
+		return factor
+	}
+	return emissionFactors[""]
+}
+
+// LoadEmissionFactors reads emission factors from a file in CSV format. Each row of the file is of the form
+// location,factor with the factor in tCO2e per MWh, and an empty location sets the default factor. Lines
+// starting with # are ignored
+func LoadEmissionFactors(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return errors.Wrap(err, "couldn't open emission factors")
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = 2
+	reader.TrimLeadingSpace = true
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return errors.Wrap(err, "couldn't read emission factors")
+	}
+
+	for _, row := range rows {
+		factor, err := strconv.ParseFloat(row[1], 64)
+		if err != nil {
+			return errors.Wrap(err, "emission factor not a float")
+		}
+		err = SetEmissionFactor(row[0], factor)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AvoidedEmissions returns the carbon in tCO2e avoided by generating energy kWh at location
+func AvoidedEmissions(location string, energy float64) float64 {
+	return energy / 1000 * EmissionFactor(location)
+}
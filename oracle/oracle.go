@@ -1,8 +1,80 @@
 package oracle
 
-// MonthlyBill returns the power tariffs for a month charged by the utility companies
+import (
+	"github.com/pkg/errors"
+	"sort"
+)
+
+// the oracle prices electricity for opensolar projects. Tariffs are fetched from a Provider, which can be a
+// static table, a CSV tariff schedule or a utility rate feed, and are looked up by the location of the project
+// and the time at which the energy was used so that past bills can be computed with the rates of the time.
+
+// DefaultRate is the flat rate in USD per kWh used by the default static provider
+var DefaultRate = 0.2
+
+// AverageConsumption is the energy in kWh consumed by an average recipient in a month
+var AverageConsumption = float64(600)
+
+// provider is the source of tariffs used by the oracle
+var provider Provider = StaticProvider{"": {{Rate: DefaultRate}}}
+
+// SetProvider sets the source of tariffs used by the oracle
+func SetProvider(p Provider) {
+	provider = p
+}
+
+// MonthlyBill returns the power tariffs for a month charged by the utility companies for an average
+// recipient. It is an estimate, bills for a project should be computed with Bill from the energy used
 func MonthlyBill() float64 {
-	priceOfElectricity := 0.2
-	averageConsumption := float64(600)
-	return priceOfElectricity * averageConsumption
+	return DefaultRate * AverageConsumption
+}
+
+// TariffAt returns the tariff that applied at location at unix time t. Locations that don't have tariffs of
+// their own use the default tariffs, which are stored with an empty location
+func TariffAt(location string, t int64) (Tariff, error) {
+	var tariff Tariff
+	tariffs, err := provider.Tariffs(location)
+	if err != nil {
+		return tariff, errors.Wrap(err, "couldn't fetch tariffs for location "+location)
+	}
+
+	if len(tariffs) == 0 && location != "" {
+		tariffs, err = provider.Tariffs("")
+		if err != nil {
+			return tariff, errors.Wrap(err, "couldn't fetch default tariffs")
+		}
+	}
+
+	sort.Slice(tariffs, func(i, j int) bool {
+		return tariffs[i].EffectiveFrom < tariffs[j].EffectiveFrom
+	})
+
+	found := false
+	for _, elem := range tariffs {
+		if elem.EffectiveFrom > t {
+			break
+		}
+		tariff = elem
+		found = true
+	}
+
+	if !found {
+		return tariff, errors.New("no tariff in effect at location " + location + " at the given time")
+	}
+	return tariff, nil
+}
+
+// Bill returns the bill for the energy readings of a billing period that starts at start. The tariff that
+// was in effect at location at the start of the period is used for the whole period
+func Bill(location string, start int64, readings []Reading) (float64, error) {
+	tariff, err := TariffAt(location, start)
+	if err != nil {
+		return 0, err
+	}
+	return tariff.Bill(readings)
+}
+
+// BillEnergy returns the bill for energy kWh used at location at unix time t
+func BillEnergy(location string, energy float64, t int64) (float64, error) {
+	return Bill(location, t, []Reading{{Timestamp: t, Energy: energy}})
 }
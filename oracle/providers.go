@@ -0,0 +1,155 @@
+package oracle
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	erpc "github.com/Varunram/essentials/rpc"
+)
+
+// Provider is a source of tariffs
+type Provider interface {
+	// Tariffs returns all tariffs, past and present, that apply at location
+	Tariffs(location string) ([]Tariff, error)
+}
+
+// StaticProvider is a fixed table of tariffs keyed by location
+type StaticProvider map[string][]Tariff
+
+// Tariffs returns the tariffs stored for location
+func (p StaticProvider) Tariffs(location string) ([]Tariff, error) {
+	return p[location], nil
+}
+
+// CSVProvider reads tariffs from a tariff schedule in CSV format. Each row of the schedule is of the form
+// location,effectivefrom,kind,from,to,rate where kind is one of
+// flat: the flat rate of the tariff is rate
+// tier: a tier up to to kWh charged at rate, to is left empty for an unbounded tier
+// tou: a time of use window from hour from to hour to charged at rate
+// offset: the offset of the location's time zone from UTC is from seconds
+// Rows with the same location and effectivefrom make up a single tariff. Lines starting with # are ignored.
+// The file is read on every lookup so that changes to the schedule are picked up without a restart
+type CSVProvider struct {
+	Path string // the path to the tariff schedule
+}
+
+// Tariffs returns the tariffs in the schedule that apply at location
+func (p CSVProvider) Tariffs(location string) ([]Tariff, error) {
+	var arr []Tariff
+
+	file, err := os.Open(p.Path)
+	if err != nil {
+		return arr, errors.Wrap(err, "couldn't open tariff schedule")
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = 6
+	reader.TrimLeadingSpace = true
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return arr, errors.Wrap(err, "couldn't read tariff schedule")
+	}
+
+	tariffs := make(map[int64]*Tariff)
+	var order []int64
+	for _, row := range rows {
+		if row[0] != location {
+			continue
+		}
+
+		effectiveFrom, err := strconv.ParseInt(row[1], 10, 64)
+		if err != nil {
+			return arr, errors.Wrap(err, "effective time not an integer")
+		}
+
+		tariff, exists := tariffs[effectiveFrom]
+		if !exists {
+			tariff = &Tariff{Location: location, EffectiveFrom: effectiveFrom}
+			tariffs[effectiveFrom] = tariff
+			order = append(order, effectiveFrom)
+		}
+
+		err = parseCSVRow(tariff, row[2], row[3], row[4], row[5])
+		if err != nil {
+			return arr, err
+		}
+	}
+
+	for _, effectiveFrom := range order {
+		arr = append(arr, *tariffs[effectiveFrom])
+	}
+	return arr, nil
+}
+
+// parseFloat parses a float field of the tariff schedule, empty fields are read as zero
+func parseFloat(field string) (float64, error) {
+	if field == "" {
+		return 0, nil
+	}
+	return strconv.ParseFloat(field, 64)
+}
+
+// parseCSVRow adds a row of the tariff schedule to tariff
+func parseCSVRow(tariff *Tariff, kind string, from string, to string, rateString string) error {
+	rate, err := parseFloat(rateString)
+	if err != nil {
+		return errors.Wrap(err, "rate not a float")
+	}
+
+	switch strings.ToLower(kind) {
+	case "flat":
+		tariff.Rate = rate
+	case "tier":
+		upTo, err := parseFloat(to)
+		if err != nil {
+			return errors.Wrap(err, "tier bound not a float")
+		}
+		tariff.Tiers = append(tariff.Tiers, Tier{UpTo: upTo, Rate: rate})
+	case "tou":
+		startHour, err := strconv.Atoi(from)
+		if err != nil {
+			return errors.Wrap(err, "start hour not an integer")
+		}
+		endHour, err := strconv.Atoi(to)
+		if err != nil {
+			return errors.Wrap(err, "end hour not an integer")
+		}
+		tariff.TimeOfUse = append(tariff.TimeOfUse, TimeOfUseRate{StartHour: startHour, EndHour: endHour, Rate: rate})
+	case "offset":
+		tariff.UTCOffset, err = strconv.ParseInt(from, 10, 64)
+		if err != nil {
+			return errors.Wrap(err, "offset not an integer")
+		}
+	default:
+		return errors.New("tariff kind " + kind + " not supported")
+	}
+	return nil
+}
+
+// HTTPProvider fetches tariffs from a utility rate feed. The feed is called with the location as a query
+// parameter and returns the tariffs that apply there as a json encoded list
+type HTTPProvider struct {
+	URL string // the url of the rate feed
+}
+
+// Tariffs fetches the tariffs that apply at location from the rate feed
+func (p HTTPProvider) Tariffs(location string) ([]Tariff, error) {
+	var arr []Tariff
+	data, err := erpc.GetRequest(p.URL + "?location=" + url.QueryEscape(location))
+	if err != nil {
+		return arr, errors.Wrap(err, "couldn't reach rate feed")
+	}
+
+	err = json.Unmarshal(data, &arr)
+	if err != nil {
+		return arr, errors.Wrap(err, "couldn't parse rate feed response")
+	}
+	return arr, nil
+}
@@ -0,0 +1,125 @@
+package oracle
+
+import (
+	"github.com/pkg/errors"
+	"math"
+)
+
+// Tariff is the rate charged for electricity at a location from a point in time onwards. A tariff charges a
+// flat rate per kWh, tiered rates on the energy used in a billing period or time of use rates depending on
+// the hour in which the energy was used. Time of use rates take precedence over tiers, and energy that is
+// not covered by a time of use window or a tier is charged the flat rate.
+type Tariff struct {
+	Location      string          // the location the tariff applies at, empty for the default tariff
+	EffectiveFrom int64           // unix time from which the tariff is in effect
+	Rate          float64         // the flat rate in USD per kWh
+	Tiers         []Tier          // tiered rates, ordered by their upper bound
+	TimeOfUse     []TimeOfUseRate // time of use rates
+	UTCOffset     int64           // the offset of the location's time zone from UTC in seconds, used for time of use rates
+}
+
+// Tier is a tiered rate that applies to the energy used in a billing period up to a bound
+type Tier struct {
+	UpTo float64 // the upper bound of the tier in kWh, 0 if the tier has no bound
+	Rate float64 // the rate in USD per kWh within the tier
+}
+
+// TimeOfUseRate is a rate that applies to energy used within a window of hours every day
+type TimeOfUseRate struct {
+	StartHour int     // the hour at which the window starts, from 0 to 23
+	EndHour   int     // the hour before which the window ends, from 1 to 24
+	Rate      float64 // the rate in USD per kWh within the window
+}
+
+// Reading is an energy reading reported for a project
+type Reading struct {
+	Timestamp int64   // unix time at which the energy was used
+	Energy    float64 // the energy used in kWh
+}
+
+// validate checks whether a tariff can be used for billing
+func (tariff Tariff) validate() error {
+	if tariff.Rate < 0 {
+		return errors.New("tariff rate can't be negative")
+	}
+
+	for i, tier := range tariff.Tiers {
+		if tier.Rate < 0 {
+			return errors.New("tier rate can't be negative")
+		}
+		if tier.UpTo == 0 && i != len(tariff.Tiers)-1 {
+			return errors.New("only the last tier can be unbounded")
+		}
+		if i > 0 && tier.UpTo != 0 && tier.UpTo <= tariff.Tiers[i-1].UpTo {
+			return errors.New("tiers must be ordered by their upper bound")
+		}
+	}
+
+	for _, window := range tariff.TimeOfUse {
+		if window.StartHour < 0 || window.EndHour > 24 || window.StartHour >= window.EndHour {
+			return errors.New("time of use window must lie within a day")
+		}
+		if window.Rate < 0 {
+			return errors.New("time of use rate can't be negative")
+		}
+	}
+	return nil
+}
+
+// timeOfUseRate returns the time of use rate that applies at unix time t, if any
+func (tariff Tariff) timeOfUseRate(t int64) (float64, bool) {
+	hour := int(((t+tariff.UTCOffset)%86400+86400)%86400) / 3600
+	for _, window := range tariff.TimeOfUse {
+		if hour >= window.StartHour && hour < window.EndHour {
+			return window.Rate, true
+		}
+	}
+	return 0, false
+}
+
+// tieredBill returns the bill for energy kWh used in a billing period
+func (tariff Tariff) tieredBill(energy float64) float64 {
+	if len(tariff.Tiers) == 0 {
+		return energy * tariff.Rate
+	}
+
+	var bill, lower float64
+	for _, tier := range tariff.Tiers {
+		if energy <= lower {
+			return bill
+		}
+		if tier.UpTo == 0 {
+			return bill + (energy-lower)*tier.Rate
+		}
+		bill += (math.Min(energy, tier.UpTo) - lower) * tier.Rate
+		lower = tier.UpTo
+	}
+
+	// energy above the last tier is charged the flat rate
+	if energy > lower {
+		bill += (energy - lower) * tariff.Rate
+	}
+	return bill
+}
+
+// Bill returns the bill for the energy readings of a billing period
+func (tariff Tariff) Bill(readings []Reading) (float64, error) {
+	err := tariff.validate()
+	if err != nil {
+		return 0, err
+	}
+
+	var bill, untimed float64
+	for _, reading := range readings {
+		if reading.Energy < 0 {
+			return 0, errors.New("energy readings can't be negative")
+		}
+		if rate, ok := tariff.timeOfUseRate(reading.Timestamp); ok {
+			bill += reading.Energy * rate
+			continue
+		}
+		untimed += reading.Energy
+	}
+
+	return bill + tariff.tieredBill(untimed), nil
+}
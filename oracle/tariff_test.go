@@ -0,0 +1,187 @@
+// +build all travis
+
+package oracle
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// day is midnight UTC of some day, time of use rates only depend on the hour within a day
+const day = int64(18000 * 86400)
+
+func TestTieredBill(t *testing.T) {
+	bounded := Tariff{Rate: 0.3, Tiers: []Tier{{UpTo: 100, Rate: 0.1}, {UpTo: 300, Rate: 0.2}}}
+	unbounded := Tariff{Rate: 0.5, Tiers: []Tier{{UpTo: 100, Rate: 0.1}, {Rate: 0.2}}}
+	flat := Tariff{Rate: 0.2}
+
+	cases := []struct {
+		name   string
+		tariff Tariff
+		energy float64
+		bill   float64
+	}{
+		{"no energy", bounded, 0, 0},
+		{"within the first tier", bounded, 50, 5},
+		{"at the first bound", bounded, 100, 10},
+		{"within the second tier", bounded, 150, 20},
+		{"at the last bound", bounded, 300, 50},
+		{"above the last bound at the flat rate", bounded, 400, 80},
+		{"within an unbounded tier", unbounded, 250, 40},
+		{"no tiers", flat, 100, 20},
+	}
+
+	for _, c := range cases {
+		bill := c.tariff.tieredBill(c.energy)
+		if math.Abs(bill-c.bill) > 1e-9 {
+			t.Fatalf("%s: bill is %f, expected %f", c.name, bill, c.bill)
+		}
+	}
+}
+
+func TestTimeOfUseRate(t *testing.T) {
+	windows := []TimeOfUseRate{{StartHour: 17, EndHour: 21, Rate: 0.4}, {StartHour: 0, EndHour: 6, Rate: 0.05}}
+	utc := Tariff{TimeOfUse: windows}
+	eastern := Tariff{TimeOfUse: windows, UTCOffset: -5 * 3600}
+	ahead := Tariff{TimeOfUse: windows, UTCOffset: 3600}
+
+	cases := []struct {
+		name   string
+		tariff Tariff
+		t      int64
+		rate   float64
+		ok     bool
+	}{
+		{"before a window starts", utc, day + 17*3600 - 1, 0, false},
+		{"when a window starts", utc, day + 17*3600, 0.4, true},
+		{"before a window ends", utc, day + 21*3600 - 1, 0.4, true},
+		{"when a window ends", utc, day + 21*3600, 0, false},
+		{"at midnight", utc, day, 0.05, true},
+		{"before a morning window ends", utc, day + 6*3600 - 1, 0.05, true},
+		{"when a morning window ends", utc, day + 6*3600, 0, false},
+		{"local time behind utc in a window", eastern, day + 22*3600, 0.4, true},
+		{"local time behind utc out of a window", eastern, day + 2*3600, 0, false},
+		{"before the epoch", utc, -3600, 0, false},
+		{"before the epoch with local time past midnight", ahead, -3600, 0.05, true},
+	}
+
+	for _, c := range cases {
+		rate, ok := c.tariff.timeOfUseRate(c.t)
+		if ok != c.ok || rate != c.rate {
+			t.Fatalf("%s: rate is %f (%t), expected %f (%t)", c.name, rate, ok, c.rate, c.ok)
+		}
+	}
+}
+
+func TestBill(t *testing.T) {
+	tariff := Tariff{
+		Rate:      0.3,
+		Tiers:     []Tier{{UpTo: 100, Rate: 0.1}},
+		TimeOfUse: []TimeOfUseRate{{StartHour: 17, EndHour: 21, Rate: 0.4}},
+	}
+
+	cases := []struct {
+		name     string
+		tariff   Tariff
+		readings []Reading
+		bill     float64
+		err      bool
+	}{
+		{"no readings", tariff, nil, 0, false},
+		{"time of use takes precedence over tiers", tariff, []Reading{{day + 18*3600, 50}}, 20, false},
+		{"tiers apply to the energy used out of windows", tariff,
+			[]Reading{{day + 8*3600, 80}, {day + 18*3600, 50}, {day + 22*3600, 40}}, 20 + 10 + 6, false},
+		{"negative energy", tariff, []Reading{{day, -1}}, 0, true},
+		{"negative rate", Tariff{Rate: -1}, nil, 0, true},
+		{"unbounded tier before the last", Tariff{Tiers: []Tier{{Rate: 0.1}, {UpTo: 100, Rate: 0.2}}}, nil, 0, true},
+		{"unordered tiers", Tariff{Tiers: []Tier{{UpTo: 100, Rate: 0.1}, {UpTo: 50, Rate: 0.2}}}, nil, 0, true},
+		{"window past midnight", Tariff{TimeOfUse: []TimeOfUseRate{{StartHour: 22, EndHour: 25, Rate: 0.1}}}, nil, 0, true},
+		{"empty window", Tariff{TimeOfUse: []TimeOfUseRate{{StartHour: 5, EndHour: 5, Rate: 0.1}}}, nil, 0, true},
+	}
+
+	for _, c := range cases {
+		bill, err := c.tariff.Bill(c.readings)
+		if c.err {
+			if err == nil {
+				t.Fatalf("%s: tariff billed although it should error out", c.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if math.Abs(bill-c.bill) > 1e-9 {
+			t.Fatalf("%s: bill is %f, expected %f", c.name, bill, c.bill)
+		}
+	}
+}
+
+func TestCSVProvider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "opensolar-oracle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	schedule := `# location,effectivefrom,kind,from,to,rate
+newhaven,1000,flat,,,0.2
+newhaven,1000,tier,,100,0.1
+newhaven,1000,tier,,,0.15
+boston,1000,flat,,,0.5
+newhaven,2000,flat,,,0.25
+newhaven,2000,tou,17,21,0.4
+newhaven,2000,offset,-18000,,
+`
+
+	cases := []struct {
+		name     string
+		schedule string
+		location string
+		tariffs  []Tariff
+		err      bool
+	}{
+		{"tariffs of a location", schedule, "newhaven", []Tariff{
+			{Location: "newhaven", EffectiveFrom: 1000, Rate: 0.2, Tiers: []Tier{{UpTo: 100, Rate: 0.1}, {Rate: 0.15}}},
+			{Location: "newhaven", EffectiveFrom: 2000, Rate: 0.25,
+				TimeOfUse: []TimeOfUseRate{{StartHour: 17, EndHour: 21, Rate: 0.4}}, UTCOffset: -18000},
+		}, false},
+		{"location not in the schedule", schedule, "hartford", nil, false},
+		{"unknown kind", "newhaven,1000,peak,,,0.2\n", "newhaven", nil, true},
+		{"missing fields", "newhaven,1000,flat,0.2\n", "newhaven", nil, true},
+		{"rate not a float", "newhaven,1000,flat,,,cheap\n", "newhaven", nil, true},
+		{"effective time not an integer", "newhaven,now,flat,,,0.2\n", "newhaven", nil, true},
+		{"start hour not an integer", "newhaven,1000,tou,five,21,0.4\n", "newhaven", nil, true},
+		{"tier bound not a float", "newhaven,1000,tier,,lots,0.1\n", "newhaven", nil, true},
+	}
+
+	for i, c := range cases {
+		path := filepath.Join(dir, "schedule"+string('a'+rune(i))+".csv")
+		err = ioutil.WriteFile(path, []byte(c.schedule), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tariffs, err := CSVProvider{Path: path}.Tariffs(c.location)
+		if c.err {
+			if err == nil {
+				t.Fatalf("%s: schedule parsed although it should error out", c.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if !reflect.DeepEqual(tariffs, c.tariffs) {
+			t.Fatalf("%s: tariffs are %v, expected %v", c.name, tariffs, c.tariffs)
+		}
+	}
+
+	_, err = CSVProvider{Path: filepath.Join(dir, "missing.csv")}.Tariffs("newhaven")
+	if err == nil {
+		t.Fatalf("missing schedule read without an error")
+	}
+}
@@ -0,0 +1,96 @@
+package rpc
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	erpc "github.com/Varunram/essentials/rpc"
+	utils "github.com/Varunram/essentials/utils"
+	openx "github.com/YaleOpenLab/openx/database"
+	openxrpc "github.com/YaleOpenLab/openx/rpc"
+
+	core "github.com/YaleOpenLab/opensolar/core"
+)
+
+// AdminRPC is a collection of all admin RPC endpoints and their required params
+var AdminRPC = map[int][]string{
+	1: []string{"/admin/device/approve", "recpIndex", "devicePubkey"},
+	2: []string{"/admin/device/revoke", "recpIndex"},
+}
+
+// adminHandlers sets up all RPCs that can only be called by the platform's admins
+func adminHandlers() {
+	approveDevice()
+	revokeDevice()
+}
+
+// adminValidateHelper validates a user and checks that they are an admin of the platform
+func adminValidateHelper(w http.ResponseWriter, r *http.Request, options []string) (openx.User, error) {
+	user, err := openxrpc.CheckReqdParams(w, r, options)
+	if err != nil {
+		return user, err
+	}
+	if !user.Admin {
+		return user, errors.New("user is not an admin")
+	}
+	return user, nil
+}
+
+// approveDevice approves the device key pending on a recipient so that its signatures are trusted
+func approveDevice() {
+	http.HandleFunc(AdminRPC[1][0], func(w http.ResponseWriter, r *http.Request) {
+		erpc.CheckGet(w, r)
+		erpc.CheckOrigin(w, r)
+		_, err := adminValidateHelper(w, r, AdminRPC[1][1:])
+		if err != nil {
+			log.Println("did not validate admin", err)
+			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
+			return
+		}
+
+		recpIndex, err := utils.ToInt(r.URL.Query()["recpIndex"][0])
+		if err != nil {
+			log.Println("did not parse to integer", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		recipient, err := core.ApproveDevice(recpIndex, r.URL.Query()["devicePubkey"][0])
+		if err != nil {
+			log.Println("did not approve device", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+		erpc.MarshalSend(w, recipient)
+	})
+}
+
+// revokeDevice revokes a recipient's device key, eg when the device has been lost or stolen
+func revokeDevice() {
+	http.HandleFunc(AdminRPC[2][0], func(w http.ResponseWriter, r *http.Request) {
+		erpc.CheckGet(w, r)
+		erpc.CheckOrigin(w, r)
+		_, err := adminValidateHelper(w, r, AdminRPC[2][1:])
+		if err != nil {
+			log.Println("did not validate admin", err)
+			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
+			return
+		}
+
+		recpIndex, err := utils.ToInt(r.URL.Query()["recpIndex"][0])
+		if err != nil {
+			log.Println("did not parse to integer", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		recipient, err := core.RevokeDevice(recpIndex)
+		if err != nil {
+			log.Println("did not revoke device", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+		erpc.MarshalSend(w, recipient)
+	})
+}
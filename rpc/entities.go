@@ -2,11 +2,13 @@ package rpc
 
 import (
 	"github.com/pkg/errors"
+	"io/ioutil"
 	"log"
 	"net/http"
 
 	erpc "github.com/Varunram/essentials/rpc"
 	utils "github.com/Varunram/essentials/utils"
+	consts "github.com/YaleOpenLab/opensolar/consts"
 	core "github.com/YaleOpenLab/opensolar/core"
 )
 
@@ -19,6 +21,16 @@ func setupEntityRPCs() {
 	addCollateral()
 	createOpensolarProject()
 	proposeOpensolarProject()
+	placeEnglishBid()
+	acceptDutchPrice()
+	commitSealedBid()
+	revealSealedBid()
+	placeAuctionBid()
+	amendAuctionBid()
+	withdrawAuctionBid()
+	setBreachPolicy()
+	addProjectDocument()
+	setSeniorDebt()
 }
 
 // EntityValidateHelper is a helper that helps validate an entity
@@ -247,7 +259,22 @@ func createOpensolarProject() {
 		x.BalLeft = x.TotalValue
 		x.Votes = 0
 		x.Reputation = x.TotalValue
-		x.InvestmentType = "munibond" // hardcode for now, expand if we have other investment models later down the road
+		x.InvestmentType = "munibond"
+		if r.URL.Query()["InvestmentType"] != nil && r.URL.Query()["InvestmentType"][0] == "equity" {
+			if r.URL.Query()["ShareCount"] == nil {
+				log.Println("share count required for equity projects, quitting!")
+				erpc.ResponseHandler(w, erpc.StatusBadRequest)
+				return
+			}
+			x.ShareCount, err = utils.ToFloat(r.URL.Query()["ShareCount"][0])
+			if err != nil || x.ShareCount <= 0 {
+				log.Println("share count not a positive float, quitting!")
+				erpc.ResponseHandler(w, erpc.StatusBadRequest)
+				return
+			}
+			x.InvestmentType = "equity"
+			x.BalLeft = 0 // shares are never redeemed so there is no balance to pay back
+		}
 		x.DateInitiated = utils.Timestamp()
 
 		err = x.Save()
@@ -311,3 +338,475 @@ func proposeOpensolarProject() {
 		erpc.MarshalSend(w, x)
 	})
 }
+
+// placeEnglishBid places a contractor's bid on a project which is being auctioned through an english auction
+func placeEnglishBid() {
+	http.HandleFunc("/entity/auction/english/bid", func(w http.ResponseWriter, r *http.Request) {
+		erpc.CheckGet(w, r)
+		erpc.CheckOrigin(w, r)
+
+		prepEntity, err := EntityValidateHelper(w, r)
+		if err != nil {
+			log.Println("Error while validating entity", err)
+			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
+			return
+		}
+
+		if r.URL.Query()["projIndex"] == nil || r.URL.Query()["price"] == nil {
+			log.Println("missing required params, quitting!")
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		projIndex, err := utils.ToInt(r.URL.Query()["projIndex"][0])
+		if err != nil {
+			log.Println("project index not int, quitting!")
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		price, err := utils.ToFloat(r.URL.Query()["price"][0])
+		if err != nil {
+			log.Println("price passed not float, quitting!")
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		err = core.PlaceEnglishBid(projIndex, prepEntity.U.Index, price)
+		if err != nil {
+			log.Println("Error while placing bid", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		erpc.ResponseHandler(w, erpc.StatusOK)
+	})
+}
+
+// acceptDutchPrice accepts the price currently offered on a project which is being auctioned through a dutch auction
+func acceptDutchPrice() {
+	http.HandleFunc("/entity/auction/dutch/accept", func(w http.ResponseWriter, r *http.Request) {
+		erpc.CheckGet(w, r)
+		erpc.CheckOrigin(w, r)
+
+		prepEntity, err := EntityValidateHelper(w, r)
+		if err != nil {
+			log.Println("Error while validating entity", err)
+			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
+			return
+		}
+
+		if r.URL.Query()["projIndex"] == nil {
+			log.Println("missing required params, quitting!")
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		projIndex, err := utils.ToInt(r.URL.Query()["projIndex"][0])
+		if err != nil {
+			log.Println("project index not int, quitting!")
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		err = core.AcceptDutchPrice(projIndex, prepEntity.U.Index)
+		if err != nil {
+			log.Println("Error while accepting price", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		erpc.ResponseHandler(w, erpc.StatusOK)
+	})
+}
+
+// commitSealedBid places a sealed bid on a sealed auction. Only the commitment is sent to the platform,
+// the price and timeline are revealed once the auction has closed.
+func commitSealedBid() {
+	http.HandleFunc("/entity/sealedbid/commit", func(w http.ResponseWriter, r *http.Request) {
+		erpc.CheckGet(w, r)
+		erpc.CheckOrigin(w, r)
+
+		prepEntity, err := EntityValidateHelper(w, r)
+		if err != nil {
+			log.Println("Error while validating entity", err)
+			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
+			return
+		}
+
+		if r.URL.Query()["auctionIndex"] == nil || r.URL.Query()["commitment"] == nil {
+			log.Println("missing required params, quitting!")
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		auctionIndex, err := utils.ToInt(r.URL.Query()["auctionIndex"][0])
+		if err != nil {
+			log.Println("auction index not int, quitting!")
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		x, err := prepEntity.CommitBid(auctionIndex, r.URL.Query()["commitment"][0])
+		if err != nil {
+			log.Println("Error while committing sealed bid", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		erpc.MarshalSend(w, x)
+	})
+}
+
+// revealSealedBid reveals a sealed bid that was committed on a sealed auction
+func revealSealedBid() {
+	http.HandleFunc("/entity/sealedbid/reveal", func(w http.ResponseWriter, r *http.Request) {
+		erpc.CheckGet(w, r)
+		erpc.CheckOrigin(w, r)
+
+		prepEntity, err := EntityValidateHelper(w, r)
+		if err != nil {
+			log.Println("Error while validating entity", err)
+			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
+			return
+		}
+
+		if r.URL.Query()["bidIndex"] == nil || r.URL.Query()["price"] == nil ||
+			r.URL.Query()["years"] == nil || r.URL.Query()["salt"] == nil {
+			log.Println("missing required params, quitting!")
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		bidIndex, err := utils.ToInt(r.URL.Query()["bidIndex"][0])
+		if err != nil {
+			log.Println("bid index not int, quitting!")
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		price, err := utils.ToFloat(r.URL.Query()["price"][0])
+		if err != nil {
+			log.Println("price passed not float, quitting!")
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		years, err := utils.ToInt(r.URL.Query()["years"][0])
+		if err != nil {
+			log.Println("years passed not int, quitting!")
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		x, err := core.RevealBid(bidIndex, prepEntity.U.Index, price, years, r.URL.Query()["salt"][0])
+		if err != nil {
+			log.Println("Error while revealing sealed bid", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		erpc.MarshalSend(w, x)
+	})
+}
+
+// placeAuctionBid places a contractor's bid on an auction that is open on an originated project
+func placeAuctionBid() {
+	http.HandleFunc("/entity/auction/bid", func(w http.ResponseWriter, r *http.Request) {
+		erpc.CheckGet(w, r)
+		erpc.CheckOrigin(w, r)
+
+		prepEntity, err := EntityValidateHelper(w, r)
+		if err != nil {
+			log.Println("Error while validating entity", err)
+			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
+			return
+		}
+
+		if r.URL.Query()["auctionIndex"] == nil || r.URL.Query()["price"] == nil ||
+			r.URL.Query()["years"] == nil || r.URL.Query()["metadata"] == nil {
+			log.Println("missing required params, quitting!")
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		auctionIndex, err := utils.ToInt(r.URL.Query()["auctionIndex"][0])
+		if err != nil {
+			log.Println("auction index not int, quitting!")
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		price, err := utils.ToFloat(r.URL.Query()["price"][0])
+		if err != nil {
+			log.Println("price passed not float, quitting!")
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		years, err := utils.ToInt(r.URL.Query()["years"][0])
+		if err != nil {
+			log.Println("years passed not int, quitting!")
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		x, err := prepEntity.PlaceBid(auctionIndex, price, years, r.URL.Query()["metadata"][0])
+		if err != nil {
+			log.Println("Error while placing bid", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		erpc.MarshalSend(w, x)
+	})
+}
+
+// amendAuctionBid changes the price and timeline of a contractor's bid before the auction closes
+func amendAuctionBid() {
+	http.HandleFunc("/entity/auction/bid/amend", func(w http.ResponseWriter, r *http.Request) {
+		erpc.CheckGet(w, r)
+		erpc.CheckOrigin(w, r)
+
+		prepEntity, err := EntityValidateHelper(w, r)
+		if err != nil {
+			log.Println("Error while validating entity", err)
+			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
+			return
+		}
+
+		if r.URL.Query()["bidIndex"] == nil || r.URL.Query()["price"] == nil ||
+			r.URL.Query()["years"] == nil {
+			log.Println("missing required params, quitting!")
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		bidIndex, err := utils.ToInt(r.URL.Query()["bidIndex"][0])
+		if err != nil {
+			log.Println("bid index not int, quitting!")
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		price, err := utils.ToFloat(r.URL.Query()["price"][0])
+		if err != nil {
+			log.Println("price passed not float, quitting!")
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		years, err := utils.ToInt(r.URL.Query()["years"][0])
+		if err != nil {
+			log.Println("years passed not int, quitting!")
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		x, err := core.AmendBid(bidIndex, prepEntity.U.Index, price, years)
+		if err != nil {
+			log.Println("Error while amending bid", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		erpc.MarshalSend(w, x)
+	})
+}
+
+// withdrawAuctionBid withdraws a contractor's bid before the auction closes
+func withdrawAuctionBid() {
+	http.HandleFunc("/entity/auction/bid/withdraw", func(w http.ResponseWriter, r *http.Request) {
+		erpc.CheckGet(w, r)
+		erpc.CheckOrigin(w, r)
+
+		prepEntity, err := EntityValidateHelper(w, r)
+		if err != nil {
+			log.Println("Error while validating entity", err)
+			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
+			return
+		}
+
+		if r.URL.Query()["bidIndex"] == nil {
+			log.Println("missing required params, quitting!")
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		bidIndex, err := utils.ToInt(r.URL.Query()["bidIndex"][0])
+		if err != nil {
+			log.Println("bid index not int, quitting!")
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		err = core.WithdrawBid(bidIndex, prepEntity.U.Index)
+		if err != nil {
+			log.Println("Error while withdrawing bid", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		erpc.ResponseHandler(w, erpc.StatusOK)
+	})
+}
+
+// setBreachPolicy sets the rules that are followed when the recipient of a project misses payments. The
+// policy is passed as a json encoded list of rules, an empty policy reverts to the default one
+func setBreachPolicy() {
+	http.HandleFunc("/entity/breach/policy", func(w http.ResponseWriter, r *http.Request) {
+		erpc.CheckGet(w, r)
+		erpc.CheckOrigin(w, r)
+
+		prepEntity, err := EntityValidateHelper(w, r)
+		if err != nil {
+			log.Println("Error while validating entity", err)
+			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
+			return
+		}
+
+		if r.URL.Query()["projIndex"] == nil {
+			log.Println("missing required params, quitting!")
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		projIndex, err := utils.ToInt(r.URL.Query()["projIndex"][0])
+		if err != nil {
+			log.Println("project index not int, quitting!")
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		var policy string
+		if r.URL.Query()["policy"] != nil {
+			policy = r.URL.Query()["policy"][0]
+		}
+
+		x, err := core.SetBreachPolicy(projIndex, prepEntity.U.Index, policy)
+		if err != nil {
+			log.Println("Error while setting breach policy", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		erpc.MarshalSend(w, x)
+	})
+}
+
+// addProjectDocument adds a document of a project to the content store. The document is sent in the body of
+// the request and the hash it is stored under is returned
+func addProjectDocument() {
+	http.HandleFunc("/entity/project/document", func(w http.ResponseWriter, r *http.Request) {
+		erpc.CheckPost(w, r)
+		erpc.CheckOrigin(w, r)
+
+		if r.URL.Query()["username"] == nil || r.URL.Query()["pwhash"] == nil ||
+			r.URL.Query()["projIndex"] == nil || r.URL.Query()["kind"] == nil {
+			log.Println("missing required params, quitting!")
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		prepEntity, err := core.ValidateEntity(r.URL.Query()["username"][0], r.URL.Query()["pwhash"][0])
+		if err != nil {
+			log.Println("Error while validating entity", err)
+			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
+			return
+		}
+
+		projIndex, err := utils.ToInt(r.URL.Query()["projIndex"][0])
+		if err != nil {
+			log.Println("project index not int, quitting!")
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		defer r.Body.Close()
+		data, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, int64(consts.MaxDocumentSize)))
+		if err != nil {
+			log.Println("did not read request body", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		hash, err := core.AddProjectDocument(projIndex, prepEntity.U.Index, r.URL.Query()["kind"][0], data)
+		if err != nil {
+			log.Println("Error while adding project document", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		erpc.MarshalSend(w, hash)
+	})
+}
+
+// setSeniorDebt records the senior debt of a project, which is paid back ahead of investor coupons
+func setSeniorDebt() {
+	http.HandleFunc("/entity/seniordebt", func(w http.ResponseWriter, r *http.Request) {
+		erpc.CheckGet(w, r)
+		erpc.CheckOrigin(w, r)
+
+		prepEntity, err := EntityValidateHelper(w, r)
+		if err != nil {
+			log.Println("Error while validating entity", err)
+			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
+			return
+		}
+
+		if r.URL.Query()["projIndex"] == nil || r.URL.Query()["debtInvestor1"] == nil || r.URL.Query()["owed1"] == nil {
+			log.Println("missing required params, quitting!")
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		projIndex, err := utils.ToInt(r.URL.Query()["projIndex"][0])
+		if err != nil {
+			log.Println("project index not int, quitting!")
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		invIndex1, err := utils.ToInt(r.URL.Query()["debtInvestor1"][0])
+		if err != nil {
+			log.Println("debt investor index not int, quitting!")
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		owed1, err := utils.ToFloat(r.URL.Query()["owed1"][0])
+		if err != nil {
+			log.Println("owed amount not float, quitting!")
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		// the second debt investor is optional
+		var invIndex2 int
+		var owed2 float64
+		if r.URL.Query()["debtInvestor2"] != nil && r.URL.Query()["owed2"] != nil {
+			invIndex2, err = utils.ToInt(r.URL.Query()["debtInvestor2"][0])
+			if err != nil {
+				log.Println("debt investor index not int, quitting!")
+				erpc.ResponseHandler(w, erpc.StatusBadRequest)
+				return
+			}
+
+			owed2, err = utils.ToFloat(r.URL.Query()["owed2"][0])
+			if err != nil {
+				log.Println("owed amount not float, quitting!")
+				erpc.ResponseHandler(w, erpc.StatusBadRequest)
+				return
+			}
+		}
+
+		x, err := core.SetSeniorDebt(projIndex, prepEntity.U.Index, invIndex1, owed1, invIndex2, owed2)
+		if err != nil {
+			log.Println("Error while recording senior debt", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		erpc.MarshalSend(w, x)
+	})
+}
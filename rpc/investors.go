@@ -18,14 +18,21 @@ import (
 
 // InvRPC contains a list of all investor related endpoints
 var InvRPC = map[int][]string{
-	1: []string{"/investor/register"},
-	2: []string{"/investor/validate"},
-	3: []string{"/investor/all"},
-	4: []string{"/investor/invest", "seedpwd", "projIndex", "amount"},
-	5: []string{"/investor/vote", "votes", "projIndex"},
-	6: []string{"/investor/localasset", "assetName"},
-	7: []string{"/investor/sendlocalasset", "assetName", "seedpwd", "destination", "amount"},
-	8: []string{"/investor/sendemail", "message", "to"},
+	1:  []string{"/investor/register"},
+	2:  []string{"/investor/validate"},
+	3:  []string{"/investor/all"},
+	4:  []string{"/investor/invest", "seedpwd", "projIndex", "amount"},
+	5:  []string{"/investor/vote", "votes", "projIndex"},
+	6:  []string{"/investor/localasset", "assetName"},
+	7:  []string{"/investor/sendlocalasset", "assetName", "seedpwd", "destination", "amount"},
+	8:  []string{"/investor/sendemail", "message", "to"},
+	9:  []string{"/investor/recs"},
+	10: []string{"/investor/recs/claim", "seedpwd", "projIndex"},
+	11: []string{"/investor/recs/retire", "seedpwd", "projIndex", "units", "beneficiary"},
+	12: []string{"/investor/carbon"},
+	13: []string{"/investor/market/sell", "seedpwd", "projIndex", "units", "price"},
+	14: []string{"/investor/market/cancel", "offerIndex"},
+	15: []string{"/investor/market/buy", "seedpwd", "offerIndex", "units"},
 }
 
 // setupInvestorRPCs sets up all investor related RPCs
@@ -38,6 +45,13 @@ func setupInvestorRPCs() {
 	addLocalAssetInv()
 	invAssetInv()
 	sendEmail()
+	getInvestorRECs()
+	claimRECs()
+	retireRECs()
+	getInvestorCarbon()
+	sellInvestorAssets()
+	cancelOffer()
+	buyInvestorAssets()
 }
 
 // InvValidateHelper is a helper used to validate an investor on the platform
@@ -340,3 +354,249 @@ func sendEmail() {
 		erpc.ResponseHandler(w, erpc.StatusOK)
 	})
 }
+
+// getInvestorRECs gets the RECs allocated to the investor for each project
+func getInvestorRECs() {
+	http.HandleFunc(InvRPC[9][0], func(w http.ResponseWriter, r *http.Request) {
+		erpc.CheckGet(w, r)
+		erpc.CheckOrigin(w, r)
+
+		prepInvestor, err := InvValidateHelper(w, r, InvRPC[9][1:])
+		if err != nil {
+			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
+			return
+		}
+
+		holdings, err := core.RetrieveInvestorRECs(prepInvestor.U.Index)
+		if err != nil {
+			log.Println("did not retrieve investor RECs", err)
+			erpc.ResponseHandler(w, erpc.StatusInternalServerError)
+			return
+		}
+		erpc.MarshalSend(w, holdings)
+	})
+}
+
+// claimRECs sends the RECs of a project allocated to the investor to the investor's account
+func claimRECs() {
+	http.HandleFunc(InvRPC[10][0], func(w http.ResponseWriter, r *http.Request) {
+		erpc.CheckGet(w, r)
+		erpc.CheckOrigin(w, r)
+
+		prepInvestor, err := InvValidateHelper(w, r, InvRPC[10][1:])
+		if err != nil {
+			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
+			return
+		}
+
+		seed, err := wallet.DecryptSeed(prepInvestor.U.StellarWallet.EncryptedSeed, r.URL.Query()["seedpwd"][0])
+		if err != nil {
+			log.Println("did not decrypt seed", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		projIndex, err := utils.ToInt(r.URL.Query()["projIndex"][0])
+		if err != nil {
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		units, err := core.ClaimRECs(projIndex, prepInvestor.U.Index, seed)
+		if err != nil {
+			log.Println("did not claim RECs", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+		erpc.MarshalSend(w, units)
+	})
+}
+
+// retireRECs retires RECs of a project held by the investor on behalf of a beneficiary. An optional reason
+// can be recorded with the retirement
+func retireRECs() {
+	http.HandleFunc(InvRPC[11][0], func(w http.ResponseWriter, r *http.Request) {
+		erpc.CheckGet(w, r)
+		erpc.CheckOrigin(w, r)
+
+		prepInvestor, err := InvValidateHelper(w, r, InvRPC[11][1:])
+		if err != nil {
+			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
+			return
+		}
+
+		seed, err := wallet.DecryptSeed(prepInvestor.U.StellarWallet.EncryptedSeed, r.URL.Query()["seedpwd"][0])
+		if err != nil {
+			log.Println("did not decrypt seed", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		projIndex, err := utils.ToInt(r.URL.Query()["projIndex"][0])
+		if err != nil {
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		units, err := utils.ToFloat(r.URL.Query()["units"][0])
+		if err != nil {
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		var reason string
+		if r.URL.Query()["reason"] != nil {
+			reason = r.URL.Query()["reason"][0]
+		}
+
+		retirement, err := core.RetireRECs(projIndex, prepInvestor.U.Index, seed, units,
+			r.URL.Query()["beneficiary"][0], reason)
+		if err != nil {
+			log.Println("did not retire RECs", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+		erpc.MarshalSend(w, retirement)
+	})
+}
+
+// getInvestorCarbon gets the carbon avoided by the projects the investor has invested in attributed to the investor
+func getInvestorCarbon() {
+	http.HandleFunc(InvRPC[12][0], func(w http.ResponseWriter, r *http.Request) {
+		erpc.CheckGet(w, r)
+		erpc.CheckOrigin(w, r)
+
+		prepInvestor, err := InvValidateHelper(w, r, InvRPC[12][1:])
+		if err != nil {
+			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
+			return
+		}
+
+		x, err := core.RetrieveInvestorCarbon(prepInvestor.U.Index)
+		if err != nil {
+			log.Println("did not retrieve avoided carbon", err)
+			erpc.ResponseHandler(w, erpc.StatusInternalServerError)
+			return
+		}
+		erpc.MarshalSend(w, x)
+	})
+}
+
+// sellInvestorAssets lists investor assets of a project held by the investor for sale on the secondary market
+func sellInvestorAssets() {
+	http.HandleFunc(InvRPC[13][0], func(w http.ResponseWriter, r *http.Request) {
+		erpc.CheckGet(w, r)
+		erpc.CheckOrigin(w, r)
+
+		prepInvestor, err := InvValidateHelper(w, r, InvRPC[13][1:])
+		if err != nil {
+			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
+			return
+		}
+
+		seed, err := wallet.DecryptSeed(prepInvestor.U.StellarWallet.EncryptedSeed, r.URL.Query()["seedpwd"][0])
+		if err != nil {
+			log.Println("did not decrypt seed", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		projIndex, err := utils.ToInt(r.URL.Query()["projIndex"][0])
+		if err != nil {
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		units, err := utils.ToFloat(r.URL.Query()["units"][0])
+		if err != nil {
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		price, err := utils.ToFloat(r.URL.Query()["price"][0])
+		if err != nil {
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		offer, err := core.ListOffer(projIndex, prepInvestor.U.Index, seed, units, price)
+		if err != nil {
+			log.Println("did not list offer", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+		erpc.MarshalSend(w, offer)
+	})
+}
+
+// cancelOffer cancels an open offer of the investor and returns the assets that haven't been sold
+func cancelOffer() {
+	http.HandleFunc(InvRPC[14][0], func(w http.ResponseWriter, r *http.Request) {
+		erpc.CheckGet(w, r)
+		erpc.CheckOrigin(w, r)
+
+		prepInvestor, err := InvValidateHelper(w, r, InvRPC[14][1:])
+		if err != nil {
+			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
+			return
+		}
+
+		offerIndex, err := utils.ToInt(r.URL.Query()["offerIndex"][0])
+		if err != nil {
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		offer, err := core.CancelOffer(offerIndex, prepInvestor.U.Index)
+		if err != nil {
+			log.Println("did not cancel offer", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+		erpc.MarshalSend(w, offer)
+	})
+}
+
+// buyInvestorAssets buys investor assets listed on the secondary market. A trade that has been paid for but
+// whose assets couldn't be delivered yet is returned as well since its delivery is retried
+func buyInvestorAssets() {
+	http.HandleFunc(InvRPC[15][0], func(w http.ResponseWriter, r *http.Request) {
+		erpc.CheckGet(w, r)
+		erpc.CheckOrigin(w, r)
+
+		prepInvestor, err := InvValidateHelper(w, r, InvRPC[15][1:])
+		if err != nil {
+			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
+			return
+		}
+
+		seed, err := wallet.DecryptSeed(prepInvestor.U.StellarWallet.EncryptedSeed, r.URL.Query()["seedpwd"][0])
+		if err != nil {
+			log.Println("did not decrypt seed", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		offerIndex, err := utils.ToInt(r.URL.Query()["offerIndex"][0])
+		if err != nil {
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		units, err := utils.ToFloat(r.URL.Query()["units"][0])
+		if err != nil {
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		trade, err := core.BuyOffer(offerIndex, prepInvestor.U.Index, seed, units)
+		if err != nil {
+			log.Println("did not settle trade", err)
+			if trade.Status != core.TradeSettled {
+				erpc.ResponseHandler(w, erpc.StatusBadRequest)
+				return
+			}
+		}
+		erpc.MarshalSend(w, trade)
+	})
+}
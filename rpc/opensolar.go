@@ -17,6 +17,10 @@ func setupProjectRPCs() {
 	getProject()
 	getAllProjects()
 	getProjectsAtIndex()
+	getProjectSchedule()
+	getProjectJobs()
+	getProjectBreaches()
+	getProjectDistributions()
 }
 
 // parseProject is a helper that is used to validate POST data. This returns a project struct
@@ -155,3 +159,110 @@ func getProjectsAtIndex() {
 		projectHandler(w, r, index)
 	})
 }
+
+// getProjectSchedule gets the payment schedule of a specific project. Projects that haven't been funded
+// yet don't have a schedule, so a projected schedule starting now is returned for them
+func getProjectSchedule() {
+	http.HandleFunc("/project/schedule", func(w http.ResponseWriter, r *http.Request) {
+		erpc.CheckGet(w, r)
+		erpc.CheckOrigin(w, r)
+		if r.URL.Query()["index"] == nil {
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+		uKey, err := utils.ToInt(r.URL.Query()["index"][0])
+		if err != nil {
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+		project, err := core.RetrieveProject(uKey)
+		if err != nil {
+			log.Println("did not retrieve project", err)
+			erpc.ResponseHandler(w, erpc.StatusInternalServerError)
+			return
+		}
+		if len(project.Schedule) != 0 {
+			erpc.MarshalSend(w, project.Schedule)
+			return
+		}
+		schedule, err := project.GenerateSchedule(utils.Unix())
+		if err != nil {
+			log.Println("did not generate schedule", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+		erpc.MarshalSend(w, schedule)
+	})
+}
+
+// getProjectJobs gets the jobs that have been scheduled for a specific project along with their status
+func getProjectJobs() {
+	http.HandleFunc("/project/jobs", func(w http.ResponseWriter, r *http.Request) {
+		erpc.CheckGet(w, r)
+		erpc.CheckOrigin(w, r)
+		if r.URL.Query()["index"] == nil {
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+		uKey, err := utils.ToInt(r.URL.Query()["index"][0])
+		if err != nil {
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+		jobs, err := core.RetrieveProjectJobs(uKey)
+		if err != nil {
+			log.Println("did not retrieve project jobs", err)
+			erpc.ResponseHandler(w, erpc.StatusInternalServerError)
+			return
+		}
+		erpc.MarshalSend(w, jobs)
+	})
+}
+
+// getProjectBreaches gets the actions that have been taken by the breach policy of a specific project
+func getProjectBreaches() {
+	http.HandleFunc("/project/breaches", func(w http.ResponseWriter, r *http.Request) {
+		erpc.CheckGet(w, r)
+		erpc.CheckOrigin(w, r)
+		if r.URL.Query()["index"] == nil {
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+		uKey, err := utils.ToInt(r.URL.Query()["index"][0])
+		if err != nil {
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+		records, err := core.RetrieveProjectBreachRecords(uKey)
+		if err != nil {
+			log.Println("did not retrieve breach records", err)
+			erpc.ResponseHandler(w, erpc.StatusInternalServerError)
+			return
+		}
+		erpc.MarshalSend(w, records)
+	})
+}
+
+// getProjectDistributions gets the itemised distributions of all paybacks towards a specific project
+func getProjectDistributions() {
+	http.HandleFunc("/project/distributions", func(w http.ResponseWriter, r *http.Request) {
+		erpc.CheckGet(w, r)
+		erpc.CheckOrigin(w, r)
+		if r.URL.Query()["index"] == nil {
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+		uKey, err := utils.ToInt(r.URL.Query()["index"][0])
+		if err != nil {
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+		distributions, err := core.RetrieveProjectDistributions(uKey)
+		if err != nil {
+			log.Println("did not retrieve distributions", err)
+			erpc.ResponseHandler(w, erpc.StatusInternalServerError)
+			return
+		}
+		erpc.MarshalSend(w, distributions)
+	})
+}
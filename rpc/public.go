@@ -5,7 +5,9 @@ import (
 	"net/http"
 
 	erpc "github.com/Varunram/essentials/rpc"
+	utils "github.com/Varunram/essentials/utils"
 	core "github.com/YaleOpenLab/opensolar/core"
+	oracle "github.com/YaleOpenLab/opensolar/oracle"
 )
 
 // SnInvestor defines a sanitized investor
@@ -39,6 +41,12 @@ func setupPublicRoutes() {
 	getAllRecipientsPublic()
 	getInvTopReputationPublic()
 	getRecpTopReputationPublic()
+	getTariffPublic()
+	getProjectDocumentPublic()
+	getProjectRECsPublic()
+	getProjectCarbonPublic()
+	getMarketOffersPublic()
+	getMarketTradesPublic()
 }
 
 // sanitizeInvestor removes sensitive fields from the investor struct
@@ -143,3 +151,191 @@ func getInvTopReputationPublic() {
 		erpc.MarshalSend(w, sInvestors)
 	})
 }
+
+// getTariffPublic gets the tariff in effect at a location. An optional unix time can be passed to look up
+// the tariff that was in effect in the past
+func getTariffPublic() {
+	http.HandleFunc("/public/tariff", func(w http.ResponseWriter, r *http.Request) {
+		erpc.CheckGet(w, r)
+		erpc.CheckOrigin(w, r)
+		if r.URL.Query()["location"] == nil {
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		t := utils.Unix()
+		if r.URL.Query()["time"] != nil {
+			x, err := utils.ToInt(r.URL.Query()["time"][0])
+			if err != nil {
+				erpc.ResponseHandler(w, erpc.StatusBadRequest)
+				return
+			}
+			t = int64(x)
+		}
+
+		tariff, err := oracle.TariffAt(r.URL.Query()["location"][0], t)
+		if err != nil {
+			log.Println("did not retrieve tariff", err)
+			erpc.ResponseHandler(w, erpc.StatusNotFound)
+			return
+		}
+		erpc.MarshalSend(w, tariff)
+	})
+}
+
+// getProjectDocumentPublic gets a document of a project from the content store. The hash of the document is
+// sent in the Etag header so that it can be checked against the one on the project documents page
+func getProjectDocumentPublic() {
+	http.HandleFunc("/public/project/document", func(w http.ResponseWriter, r *http.Request) {
+		erpc.CheckGet(w, r)
+		erpc.CheckOrigin(w, r)
+		if r.URL.Query()["projIndex"] == nil || r.URL.Query()["kind"] == nil {
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		projIndex, err := utils.ToInt(r.URL.Query()["projIndex"][0])
+		if err != nil {
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		data, hash, err := core.RetrieveProjectDocument(projIndex, r.URL.Query()["kind"][0])
+		if err != nil {
+			log.Println("did not retrieve project document", err)
+			erpc.ResponseHandler(w, erpc.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", http.DetectContentType(data))
+		w.Header().Set("Etag", "\""+hash+"\"")
+		w.Write(data)
+	})
+}
+
+// ProjectRECs are the RECs issued for a project and the retirements of those RECs
+type ProjectRECs struct {
+	Issuances   []core.RECIssuance
+	Retirements []core.RECRetirement
+}
+
+// getProjectRECsPublic gets the RECs issued for a project along with their provenance and retirements
+func getProjectRECsPublic() {
+	http.HandleFunc("/public/project/recs", func(w http.ResponseWriter, r *http.Request) {
+		erpc.CheckGet(w, r)
+		erpc.CheckOrigin(w, r)
+		if r.URL.Query()["projIndex"] == nil {
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		projIndex, err := utils.ToInt(r.URL.Query()["projIndex"][0])
+		if err != nil {
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		var x ProjectRECs
+		x.Issuances, err = core.RetrieveProjectRECIssuances(projIndex)
+		if err != nil {
+			log.Println("did not retrieve REC issuances", err)
+			erpc.ResponseHandler(w, erpc.StatusInternalServerError)
+			return
+		}
+
+		x.Retirements, err = core.RetrieveProjectRECRetirements(projIndex)
+		if err != nil {
+			log.Println("did not retrieve REC retirements", err)
+			erpc.ResponseHandler(w, erpc.StatusInternalServerError)
+			return
+		}
+		erpc.MarshalSend(w, x)
+	})
+}
+
+// getProjectCarbonPublic gets the carbon a project has avoided and its attribution to the project's investors
+func getProjectCarbonPublic() {
+	http.HandleFunc("/public/project/carbon", func(w http.ResponseWriter, r *http.Request) {
+		erpc.CheckGet(w, r)
+		erpc.CheckOrigin(w, r)
+		if r.URL.Query()["projIndex"] == nil {
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		projIndex, err := utils.ToInt(r.URL.Query()["projIndex"][0])
+		if err != nil {
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		report, err := core.RetrieveCarbonReport(projIndex)
+		if err != nil {
+			log.Println("did not retrieve carbon report", err)
+			erpc.ResponseHandler(w, erpc.StatusNotFound)
+			return
+		}
+		erpc.MarshalSend(w, report)
+	})
+}
+
+// getMarketOffersPublic gets the open offers of the secondary market, optionally only those of a single project
+func getMarketOffersPublic() {
+	http.HandleFunc("/public/market/offers", func(w http.ResponseWriter, r *http.Request) {
+		erpc.CheckGet(w, r)
+		erpc.CheckOrigin(w, r)
+
+		var offers []core.Offer
+		var err error
+		if r.URL.Query()["projIndex"] != nil {
+			var projIndex int
+			projIndex, err = utils.ToInt(r.URL.Query()["projIndex"][0])
+			if err != nil {
+				erpc.ResponseHandler(w, erpc.StatusBadRequest)
+				return
+			}
+			offers, err = core.RetrieveProjectOffers(projIndex)
+		} else {
+			offers, err = core.RetrieveAllOffers()
+		}
+		if err != nil {
+			log.Println("did not retrieve offers", err)
+			erpc.ResponseHandler(w, erpc.StatusInternalServerError)
+			return
+		}
+
+		var open []core.Offer
+		for _, offer := range offers {
+			if offer.Status == core.OfferOpen {
+				open = append(open, offer)
+			}
+		}
+		erpc.MarshalSend(w, open)
+	})
+}
+
+// getMarketTradesPublic gets the trades of the investor assets of a project made on the secondary market
+func getMarketTradesPublic() {
+	http.HandleFunc("/public/market/trades", func(w http.ResponseWriter, r *http.Request) {
+		erpc.CheckGet(w, r)
+		erpc.CheckOrigin(w, r)
+		if r.URL.Query()["projIndex"] == nil {
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		projIndex, err := utils.ToInt(r.URL.Query()["projIndex"][0])
+		if err != nil {
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		trades, err := core.RetrieveProjectTrades(projIndex)
+		if err != nil {
+			log.Println("did not retrieve trades", err)
+			erpc.ResponseHandler(w, erpc.StatusInternalServerError)
+			return
+		}
+		erpc.MarshalSend(w, trades)
+	})
+}
@@ -2,7 +2,9 @@ package rpc
 
 import (
 	"errors"
+	"io/ioutil"
 	"log"
+	"math"
 	"net/http"
 
 	erpc "github.com/Varunram/essentials/rpc"
@@ -20,7 +22,7 @@ var RecpRPC = map[int][]string{
 	2:  []string{"/recipient/register"},
 	3:  []string{"/recipient/validate"},
 	4:  []string{"/recipient/payback", "assetName", "amount", "seedpwd", "projIndex"},
-	5:  []string{"/recipient/deviceId", "deviceId"},
+	5:  []string{"/recipient/deviceId", "deviceId", "devicePubkey"},
 	6:  []string{"/recipient/startdevice", "start"},
 	7:  []string{"/recipient/storelocation", "location"},
 	8:  []string{"/recipient/auction/choose/blind"},
@@ -31,7 +33,24 @@ var RecpRPC = map[int][]string{
 	13: []string{"/recipient/finalize", "projIndex"},
 	14: []string{"/recipient/originate", "projIndex"},
 	15: []string{"/recipient/trustlimit", "assetName"},
-	16: []string{"/recipient/ssh", "hash"},
+	16: []string{"/recipient/ssh", "hash", "deviceId", "timestamp", "signature"},
+	17: []string{"/recipient/auction/start", "projIndex", "price"},
+	18: []string{"/recipient/auction/choose/english", "projIndex"},
+	19: []string{"/recipient/auction/choose/dutch", "projIndex"},
+	20: []string{"/recipient/auction/sealed/open", "projIndex", "rule", "duration"},
+	21: []string{"/recipient/auction/weights", "projIndex", "price", "time", "reputation", "collateral", "feedback"},
+	22: []string{"/recipient/auction/choose/score", "projIndex"},
+	23: []string{"/recipient/auction/result", "projIndex"},
+	24: []string{"/recipient/auction/open", "projIndex", "rule", "duration"},
+	25: []string{"/recipient/auction/bids", "auctionIndex"},
+	26: []string{"/recipient/dividends", "amount", "seedpwd", "projIndex"},
+	27: []string{"/recipient/energy", "projIndex", "energy", "deviceId", "timestamp", "signature"},
+	28: []string{"/recipient/invoices", "projIndex"},
+	29: []string{"/recipient/invoice", "invoiceIndex"},
+	30: []string{"/recipient/statement", "projIndex"},
+	31: []string{"/recipient/meter/readings", "projIndex", "deviceId", "signature"},
+	32: []string{"/recipient/meter", "projIndex"},
+	33: []string{"/recipient/device/rotate", "newDeviceId", "devicePubkey", "timestamp", "signature"},
 }
 
 // setupRecipientRPCs sets up all RPCs related to the recipient
@@ -53,6 +72,23 @@ func setupRecipientRPCs() {
 	calculateTrustLimit()
 	// unlockCBond()
 	storeStateHash()
+	startOpenAuction()
+	chooseEnglishAuction()
+	chooseDutchAuction()
+	openSealedAuction()
+	setBidWeights()
+	chooseScoreAuction()
+	getAuctionResult()
+	openAuction()
+	getAuctionBids()
+	payDividends()
+	reportEnergy()
+	getInvoices()
+	getInvoice()
+	getStatement()
+	postMeterReadings()
+	getMeterReadings()
+	rotateDevice()
 }
 
 // RecpValidateHelper is a helper that helps validates recipients in routes
@@ -84,6 +120,21 @@ func RecpValidateHelper(w http.ResponseWriter, r *http.Request, options []string
 	return prepRecipient, nil
 }
 
+// verifyDeviceRequest checks that a request made by the teller was signed by the recipient's registered device.
+// The signature covers params and the timestamp of the request
+func verifyDeviceRequest(recipient core.Recipient, r *http.Request, params ...string) error {
+	if r.URL.Query()["deviceId"] == nil || r.URL.Query()["timestamp"] == nil || r.URL.Query()["signature"] == nil {
+		return errors.New("required params: deviceId, timestamp and signature not specified, quitting")
+	}
+
+	timestamp, err := utils.ToInt(r.URL.Query()["timestamp"][0])
+	if err != nil {
+		return err
+	}
+
+	return recipient.VerifyDeviceRequest(r.URL.Query()["deviceId"][0], int64(timestamp), r.URL.Query()["signature"][0], params...)
+}
+
 // getAllRecipients gets a list of all the recipients who have registered on the platform
 func getAllRecipients() {
 	http.HandleFunc(RecpRPC[1][0], func(w http.ResponseWriter, r *http.Request) {
@@ -206,6 +257,28 @@ func payback() {
 			return
 		}
 
+		var idempotencyKey string
+		if r.URL.Query()["idempotencyKey"] != nil {
+			idempotencyKey = r.URL.Query()["idempotencyKey"][0]
+		}
+
+		if prepRecipient.DevicePubkey != "" || r.URL.Query()["deviceId"] != nil {
+			// recipients with a registered device pay back through it, so paybacks have to be signed by the device.
+			// The signature covers the idempotency key, so a captured request that is sent again is only paid once
+			if idempotencyKey == "" {
+				log.Println("device signed payback without an idempotency key")
+				erpc.ResponseHandler(w, erpc.StatusBadRequest)
+				return
+			}
+			params := []string{r.URL.Query()["projIndex"][0], assetName, r.URL.Query()["amount"][0], idempotencyKey}
+			err = verifyDeviceRequest(prepRecipient, r, params...)
+			if err != nil {
+				log.Println("did not verify device signature", err)
+				erpc.ResponseHandler(w, erpc.StatusUnauthorized)
+				return
+			}
+		}
+
 		recipientSeed, err := wallet.DecryptSeed(prepRecipient.U.StellarWallet.EncryptedSeed, seedpwd)
 		if err != nil {
 			log.Println("did not decrypt seed", err)
@@ -213,57 +286,88 @@ func payback() {
 			return
 		}
 
+		if idempotencyKey != "" {
+			// paybacks sent again by the teller after it lost connectivity must only be paid once
+			status, err := core.ClaimIdempotencyKey(recpIndex, idempotencyKey)
+			if err != nil {
+				log.Println("did not claim idempotency key", err)
+				erpc.ResponseHandler(w, erpc.StatusInternalServerError)
+				return
+			}
+			if status == core.IdempotencyDone {
+				erpc.ResponseHandler(w, erpc.StatusOK)
+				return
+			}
+			if status == core.IdempotencyPending {
+				log.Println("payback with idempotency key", idempotencyKey, "is still being carried out")
+				erpc.ResponseHandler(w, erpc.StatusInternalServerError)
+				return
+			}
+			if status == core.IdempotencyStale {
+				// the payback may have gone through before the platform went down, so it isn't carried out again
+				log.Println("payback with idempotency key", idempotencyKey, "never finished and needs reconciliation")
+				erpc.ResponseHandler(w, erpc.StatusBadRequest)
+				return
+			}
+		}
+
 		log.Println(recpIndex, projIndex, assetName, amount, recipientSeed)
-		err = core.Payback(recpIndex, projIndex, assetName, amount, recipientSeed)
+		if idempotencyKey != "" {
+			err = core.PaybackWithKey(recpIndex, projIndex, assetName, amount, recipientSeed, idempotencyKey)
+		} else {
+			err = core.Payback(recpIndex, projIndex, assetName, amount, recipientSeed)
+		}
 		if err != nil {
+			// payback only errors out if the payment didn't go through, so the key can be retried
 			log.Println("did not payback", err)
+			if idempotencyKey != "" {
+				err = core.ReleaseIdempotencyKey(recpIndex, idempotencyKey)
+				if err != nil {
+					log.Println("did not release idempotency key", err)
+				}
+			}
 			erpc.ResponseHandler(w, erpc.StatusInternalServerError)
 			return
 		}
+
 		erpc.ResponseHandler(w, erpc.StatusOK)
 	})
 }
 
-// storeDeviceId stores the recipient's device id from the teller. Called by the teller
-func storeDeviceId() {
-	http.HandleFunc(RecpRPC[5][0], func(w http.ResponseWriter, r *http.Request) {
-		// first validate the recipient or anyone would be able to set device ids
+// payDividends pays out the net revenue of an equity project as dividends to its shareholders
+func payDividends() {
+	http.HandleFunc(RecpRPC[26][0], func(w http.ResponseWriter, r *http.Request) {
 		erpc.CheckGet(w, r)
 		erpc.CheckOrigin(w, r)
-		prepRecipient, err := RecpValidateHelper(w, r, RecpRPC[5][1:])
+
+		prepRecipient, err := RecpValidateHelper(w, r, RecpRPC[26][1:])
 		if err != nil {
 			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
 			return
 		}
-		// we have the recipient ready. Now set the device id
-		prepRecipient.DeviceId = r.URL.Query()["deviceId"][0]
-		err = prepRecipient.Save()
+
+		projIndex, err := utils.ToInt(r.URL.Query()["projIndex"][0])
 		if err != nil {
-			log.Println("did not save recipient", err)
-			erpc.ResponseHandler(w, erpc.StatusInternalServerError)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+		seedpwd := r.URL.Query()["seedpwd"][0]
+		amount, err := utils.ToFloat(r.URL.Query()["amount"][0])
+		if err != nil {
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
 			return
 		}
-		erpc.ResponseHandler(w, erpc.StatusOK)
-	})
-}
-
-// storeStartTime stores the start time of the remote device installed as part of an
-// invested project. Called by the teller
-func storeStartTime() {
-	http.HandleFunc(RecpRPC[6][0], func(w http.ResponseWriter, r *http.Request) {
-		erpc.CheckGet(w, r)
-		erpc.CheckOrigin(w, r)
 
-		prepRecipient, err := RecpValidateHelper(w, r, RecpRPC[6][1:])
+		recipientSeed, err := wallet.DecryptSeed(prepRecipient.U.StellarWallet.EncryptedSeed, seedpwd)
 		if err != nil {
-			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
+			log.Println("did not decrypt seed", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
 			return
 		}
 
-		prepRecipient.DeviceStarts = append(prepRecipient.DeviceStarts, r.URL.Query()["start"][0])
-		err = prepRecipient.Save()
+		err = core.PayDividends(prepRecipient.U.Index, projIndex, amount, recipientSeed)
 		if err != nil {
-			log.Println("did not save recipient", err)
+			log.Println("did not pay dividends", err)
 			erpc.ResponseHandler(w, erpc.StatusInternalServerError)
 			return
 		}
@@ -271,201 +375,207 @@ func storeStartTime() {
 	})
 }
 
-// storeDeviceLocation stores the location of the remote device when it starts up. Called by the teller
-func storeDeviceLocation() {
-	http.HandleFunc(RecpRPC[7][0], func(w http.ResponseWriter, r *http.Request) {
+// reportEnergy records the energy used by a project in its current billing period. Called by the teller,
+// which signs the request with its device key at the time the energy was used
+func reportEnergy() {
+	http.HandleFunc(RecpRPC[27][0], func(w http.ResponseWriter, r *http.Request) {
 		erpc.CheckGet(w, r)
 		erpc.CheckOrigin(w, r)
 
-		prepRecipient, err := RecpValidateHelper(w, r, RecpRPC[7][1:])
+		prepRecipient, err := RecpValidateHelper(w, r, RecpRPC[27][1:])
 		if err != nil {
 			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
 			return
 		}
 
-		prepRecipient.DeviceLocation = r.URL.Query()["location"][0]
-		err = prepRecipient.Save()
+		projIndex, err := utils.ToInt(r.URL.Query()["projIndex"][0])
 		if err != nil {
-			log.Println("did not save recipient", err)
-			erpc.ResponseHandler(w, erpc.StatusInternalServerError)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
 			return
 		}
-		erpc.ResponseHandler(w, erpc.StatusOK)
-	})
-}
-
-// chooseBlindAuction chooses a blind auction method to choose for the winner. Also commonly
-// known as a 1st price auction.
-func chooseBlindAuction() {
-	http.HandleFunc(RecpRPC[8][0], func(w http.ResponseWriter, r *http.Request) {
-		erpc.CheckGet(w, r)
-		erpc.CheckOrigin(w, r)
-		recipient, err := RecpValidateHelper(w, r, RecpRPC[8][1:])
+		energy, err := utils.ToFloat(r.URL.Query()["energy"][0])
 		if err != nil {
-			log.Println("did not validate recipient", err)
-			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
 			return
 		}
-
-		allContracts, err := core.RetrieveRecipientProjects(core.Stage2.Number, recipient.U.Index)
+		timestamp, err := utils.ToInt(r.URL.Query()["timestamp"][0])
 		if err != nil {
-			log.Println("did not validate recipient projects", err)
-			erpc.ResponseHandler(w, erpc.StatusInternalServerError)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
 			return
 		}
 
-		bestContract, err := core.SelectContractBlind(allContracts)
+		err = verifyDeviceRequest(prepRecipient, r, r.URL.Query()["projIndex"][0], r.URL.Query()["energy"][0])
 		if err != nil {
-			log.Println("did not select contract", err)
-			erpc.ResponseHandler(w, erpc.StatusInternalServerError)
+			log.Println("did not verify device signature", err)
+			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
 			return
 		}
 
-		err = bestContract.SetStage(4)
+		reading, err := core.ReportEnergy(projIndex, prepRecipient.U.Index, energy, int64(timestamp))
 		if err != nil {
-			log.Println("did not set final project", err)
-			erpc.ResponseHandler(w, erpc.StatusInternalServerError)
+			log.Println("did not report energy", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
 			return
 		}
-
-		erpc.ResponseHandler(w, erpc.StatusOK)
+		erpc.MarshalSend(w, reading)
 	})
 }
 
-// chooseVickreyAuction chooses a vickrey auction method to choose the winning contractor.
-// also known as a second price auction
-func chooseVickreyAuction() {
-	http.HandleFunc(RecpRPC[9][0], func(w http.ResponseWriter, r *http.Request) {
+// getInvoices returns the invoices issued for the energy used by one of the recipient's projects
+func getInvoices() {
+	http.HandleFunc(RecpRPC[28][0], func(w http.ResponseWriter, r *http.Request) {
 		erpc.CheckGet(w, r)
 		erpc.CheckOrigin(w, r)
-		recipient, err := RecpValidateHelper(w, r, RecpRPC[9][1:])
+
+		prepRecipient, err := RecpValidateHelper(w, r, RecpRPC[28][1:])
 		if err != nil {
-			log.Println("did not validate recipient", err)
 			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
 			return
 		}
 
-		allContracts, err := core.RetrieveRecipientProjects(core.Stage2.Number, recipient.U.Index)
+		projIndex, err := utils.ToInt(r.URL.Query()["projIndex"][0])
 		if err != nil {
-			log.Println("did not retrieve recipient projects", err)
-			erpc.ResponseHandler(w, erpc.StatusInternalServerError)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
 			return
 		}
 
-		bestContract, err := core.SelectContractVickrey(allContracts)
+		project, err := core.RetrieveProject(projIndex)
 		if err != nil {
-			log.Println("did not select contract", err)
-			erpc.ResponseHandler(w, erpc.StatusInternalServerError)
+			log.Println("did not retrieve project", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
 			return
 		}
 
-		err = bestContract.SetStage(4)
+		if project.RecipientIndex != prepRecipient.U.Index {
+			log.Println("recipient not associated with project")
+			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
+			return
+		}
+
+		invoices, err := core.RetrieveRecipientInvoices(projIndex, prepRecipient.U.Index)
 		if err != nil {
-			log.Println("did not set final project", err)
+			log.Println("did not retrieve invoices", err)
 			erpc.ResponseHandler(w, erpc.StatusInternalServerError)
 			return
 		}
-
-		erpc.ResponseHandler(w, erpc.StatusOK)
+		erpc.MarshalSend(w, invoices)
 	})
 }
 
-// chooseTimeAuction chooses the winning contractor based on least completion time
-func chooseTimeAuction() {
-	http.HandleFunc(RecpRPC[10][0], func(w http.ResponseWriter, r *http.Request) {
+// getInvoice gets a single invoice issued to the recipient along with the payments made towards it
+func getInvoice() {
+	http.HandleFunc(RecpRPC[29][0], func(w http.ResponseWriter, r *http.Request) {
 		erpc.CheckGet(w, r)
 		erpc.CheckOrigin(w, r)
-		recipient, err := RecpValidateHelper(w, r, RecpRPC[10][1:])
+
+		prepRecipient, err := RecpValidateHelper(w, r, RecpRPC[29][1:])
 		if err != nil {
-			log.Println("did not validate recipient", err)
 			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
 			return
 		}
 
-		allContracts, err := core.RetrieveRecipientProjects(core.Stage2.Number, recipient.U.Index)
+		invoiceIndex, err := utils.ToInt(r.URL.Query()["invoiceIndex"][0])
 		if err != nil {
-			log.Println("did not retrieve recipient projects", err)
-			erpc.ResponseHandler(w, erpc.StatusInternalServerError)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
 			return
 		}
 
-		bestContract, err := core.SelectContractTime(allContracts)
+		invoice, err := core.RetrieveInvoice(invoiceIndex)
 		if err != nil {
-			log.Println("did not select contract", err)
-			erpc.ResponseHandler(w, erpc.StatusInternalServerError)
+			log.Println("did not retrieve invoice", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
 			return
 		}
 
-		err = bestContract.SetStage(4)
-		if err != nil {
-			log.Println("did not set final project", err)
-			erpc.ResponseHandler(w, erpc.StatusInternalServerError)
+		if invoice.RecipientIndex != prepRecipient.U.Index {
+			log.Println("invoice not issued to recipient")
+			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
 			return
 		}
 
-		erpc.ResponseHandler(w, erpc.StatusOK)
+		invoice.UpdateStatus(utils.Unix())
+		erpc.MarshalSend(w, invoice)
 	})
 }
 
-// unlockOpenSolar unlocks a project which has just been invested in, signalling that the recipient
-// has accepted the investment.
-func unlockOpenSolar() {
-	http.HandleFunc(RecpRPC[11][0], func(w http.ResponseWriter, r *http.Request) {
+// getStatement downloads the recipient's billing statement for a project in CSV format
+func getStatement() {
+	http.HandleFunc(RecpRPC[30][0], func(w http.ResponseWriter, r *http.Request) {
 		erpc.CheckGet(w, r)
 		erpc.CheckOrigin(w, r)
-		recipient, err := RecpValidateHelper(w, r, RecpRPC[11][1:])
+
+		prepRecipient, err := RecpValidateHelper(w, r, RecpRPC[30][1:])
 		if err != nil {
 			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
 			return
 		}
 
-		seedpwd := r.URL.Query()["seedpwd"][0]
-		projIndex, err := utils.ToInt(r.URL.Query()["projIndex"][0])
+		projIndexString := r.URL.Query()["projIndex"][0]
+		projIndex, err := utils.ToInt(projIndexString)
 		if err != nil {
-			log.Println("did not parse to integer", err)
 			erpc.ResponseHandler(w, erpc.StatusBadRequest)
 			return
 		}
 
-		err = core.UnlockProject(recipient.U.Username, recipient.U.Pwhash, projIndex, seedpwd)
+		statement, err := core.Statement(projIndex, prepRecipient.U.Index)
 		if err != nil {
-			log.Println("did not unlock project", err)
+			log.Println("did not generate statement", err)
 			erpc.ResponseHandler(w, erpc.StatusInternalServerError)
 			return
 		}
 
-		erpc.ResponseHandler(w, erpc.StatusOK)
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", "attachment; filename=statement-"+projIndexString+".csv")
+		w.Write(statement)
 	})
 }
 
-// addEmail adds an email address to the recipient's profile
-func addEmail() {
-	http.HandleFunc(RecpRPC[12][0], func(w http.ResponseWriter, r *http.Request) {
-		erpc.CheckGet(w, r)
+// postMeterReadings takes a batch of meter readings from the teller. The readings are posted as a json encoded
+// list in the body of the request, signed by the teller's device key. Called by the teller
+func postMeterReadings() {
+	http.HandleFunc(RecpRPC[31][0], func(w http.ResponseWriter, r *http.Request) {
+		erpc.CheckPost(w, r)
 		erpc.CheckOrigin(w, r)
-		recipient, err := RecpValidateHelper(w, r, RecpRPC[12][1:])
+
+		prepRecipient, err := RecpValidateHelper(w, r, RecpRPC[31][1:])
 		if err != nil {
 			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
 			return
 		}
 
-		email := r.URL.Query()["email"][0]
-		err = recipient.U.AddEmail(email)
+		projIndex, err := utils.ToInt(r.URL.Query()["projIndex"][0])
 		if err != nil {
-			log.Println("did not add email", err)
 			erpc.ResponseHandler(w, erpc.StatusBadRequest)
 			return
 		}
-		erpc.ResponseHandler(w, erpc.StatusOK)
+
+		defer r.Body.Close()
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			log.Println("did not read request body", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		result, err := core.IngestMeterReadings(projIndex, prepRecipient.U.Index, r.URL.Query()["deviceId"][0], data,
+			r.URL.Query()["signature"][0])
+		if err != nil {
+			log.Println("did not ingest meter readings", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+		erpc.MarshalSend(w, result)
 	})
 }
 
-// finalizeProject finalizes (ie moves from stage 2 to 3) a specific project
-func finalizeProject() {
-	http.HandleFunc(RecpRPC[13][0], func(w http.ResponseWriter, r *http.Request) {
+// getMeterReadings gets the meter readings of one of the recipient's projects. The readings can be limited to
+// a device and to those taken between start and end
+func getMeterReadings() {
+	http.HandleFunc(RecpRPC[32][0], func(w http.ResponseWriter, r *http.Request) {
 		erpc.CheckGet(w, r)
 		erpc.CheckOrigin(w, r)
-		_, err := RecpValidateHelper(w, r, RecpRPC[13][1:])
+
+		prepRecipient, err := RecpValidateHelper(w, r, RecpRPC[32][1:])
 		if err != nil {
 			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
 			return
@@ -473,7 +583,6 @@ func finalizeProject() {
 
 		projIndex, err := utils.ToInt(r.URL.Query()["projIndex"][0])
 		if err != nil {
-			log.Println("did not parse to integer", err)
 			erpc.ResponseHandler(w, erpc.StatusBadRequest)
 			return
 		}
@@ -485,83 +594,135 @@ func finalizeProject() {
 			return
 		}
 
-		err = project.SetStage(4)
+		if project.RecipientIndex != prepRecipient.U.Index {
+			log.Println("recipient not associated with project")
+			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
+			return
+		}
+
+		start, end := int64(0), int64(math.MaxInt64)
+		if r.URL.Query()["start"] != nil {
+			x, err := utils.ToInt(r.URL.Query()["start"][0])
+			if err != nil {
+				erpc.ResponseHandler(w, erpc.StatusBadRequest)
+				return
+			}
+			start = int64(x)
+		}
+		if r.URL.Query()["end"] != nil {
+			x, err := utils.ToInt(r.URL.Query()["end"][0])
+			if err != nil {
+				erpc.ResponseHandler(w, erpc.StatusBadRequest)
+				return
+			}
+			end = int64(x)
+		}
+
+		var readings []core.MeterReading
+		if r.URL.Query()["deviceId"] != nil {
+			readings, err = core.RetrieveMeterReadings(projIndex, r.URL.Query()["deviceId"][0], start, end)
+		} else {
+			readings, err = core.RetrieveProjectMeterReadings(projIndex, start, end)
+		}
 		if err != nil {
-			log.Println("did not set final project", err)
+			log.Println("did not retrieve meter readings", err)
 			erpc.ResponseHandler(w, erpc.StatusInternalServerError)
 			return
 		}
-
-		erpc.ResponseHandler(w, erpc.StatusOK)
+		erpc.MarshalSend(w, readings)
 	})
 }
 
-// originateProject originates (ie moves from stage 0 to 1) a project
-func originateProject() {
-	http.HandleFunc(RecpRPC[14][0], func(w http.ResponseWriter, r *http.Request) {
+// storeDeviceId stores the recipient's device id from the teller. The first device registered has to be
+// approved by an admin before its signatures are trusted. Called by the teller
+func storeDeviceId() {
+	http.HandleFunc(RecpRPC[5][0], func(w http.ResponseWriter, r *http.Request) {
+		// first validate the recipient or anyone would be able to set device ids
 		erpc.CheckGet(w, r)
 		erpc.CheckOrigin(w, r)
-		recipient, err := RecpValidateHelper(w, r, RecpRPC[14][1:])
+		prepRecipient, err := RecpValidateHelper(w, r, RecpRPC[5][1:])
 		if err != nil {
 			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
 			return
 		}
-
-		projIndex, err := utils.ToInt(r.URL.Query()["projIndex"][0])
+		// we have the recipient ready. Now bind the device and its key to the recipient
+		err = prepRecipient.RegisterDevice(r.URL.Query()["deviceId"][0], r.URL.Query()["devicePubkey"][0])
 		if err != nil {
-			log.Println("did not parse to integer", err)
+			log.Println("did not register device", err)
 			erpc.ResponseHandler(w, erpc.StatusBadRequest)
 			return
 		}
-
-		err = core.RecipientAuthorize(projIndex, recipient.U.Index)
-		if err != nil {
-			log.Println("did not authorize project", err)
-			erpc.ResponseHandler(w, erpc.StatusInternalServerError)
-			return
-		}
-
 		erpc.ResponseHandler(w, erpc.StatusOK)
 	})
 }
 
-// calculateTrustLimit calculates the trust limit associated with a specific asset.
-func calculateTrustLimit() {
-	http.HandleFunc(RecpRPC[15][0], func(w http.ResponseWriter, r *http.Request) {
+// rotateDevice replaces the recipient's device key with a new one. The request has to be signed by the device
+// holding the key that is being replaced
+func rotateDevice() {
+	http.HandleFunc(RecpRPC[33][0], func(w http.ResponseWriter, r *http.Request) {
 		erpc.CheckGet(w, r)
 		erpc.CheckOrigin(w, r)
-		recipient, err := RecpValidateHelper(w, r, RecpRPC[15][1:])
+		prepRecipient, err := RecpValidateHelper(w, r, RecpRPC[33][1:])
 		if err != nil {
 			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
 			return
 		}
 
-		assetName := r.URL.Query()["assetName"][0]
-		trustLimit, err := xlm.GetAssetTrustLimit(recipient.U.StellarWallet.PublicKey, assetName)
+		timestamp, err := utils.ToInt(r.URL.Query()["timestamp"][0])
 		if err != nil {
-			log.Println("did not get trust limit", err)
-			erpc.ResponseHandler(w, erpc.StatusInternalServerError)
+			log.Println("timestamp not int", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
 			return
 		}
 
-		erpc.MarshalSend(w, trustLimit)
+		err = prepRecipient.RotateDevice(r.URL.Query()["newDeviceId"][0], r.URL.Query()["devicePubkey"][0],
+			int64(timestamp), r.URL.Query()["signature"][0])
+		if err != nil {
+			log.Println("did not rotate device", err)
+			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
+			return
+		}
+		erpc.ResponseHandler(w, erpc.StatusOK)
 	})
 }
 
-// storeStateHash stores the start time of the remote device installed as part of an invested project.
-// Called by the teller
-func storeStateHash() {
-	http.HandleFunc(RecpRPC[16][0], func(w http.ResponseWriter, r *http.Request) {
+// storeStartTime stores the start time of the remote device installed as part of an
+// invested project. Called by the teller
+func storeStartTime() {
+	http.HandleFunc(RecpRPC[6][0], func(w http.ResponseWriter, r *http.Request) {
 		erpc.CheckGet(w, r)
 		erpc.CheckOrigin(w, r)
-		// first validate the recipient or anyone would be able to set device ids
-		prepRecipient, err := RecpValidateHelper(w, r, RecpRPC[16][1:])
+
+		prepRecipient, err := RecpValidateHelper(w, r, RecpRPC[6][1:])
 		if err != nil {
 			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
 			return
 		}
 
-		prepRecipient.StateHashes = append(prepRecipient.StateHashes, r.URL.Query()["hash"][0])
+		prepRecipient.DeviceStarts = append(prepRecipient.DeviceStarts, r.URL.Query()["start"][0])
+		err = prepRecipient.Save()
+		if err != nil {
+			log.Println("did not save recipient", err)
+			erpc.ResponseHandler(w, erpc.StatusInternalServerError)
+			return
+		}
+		erpc.ResponseHandler(w, erpc.StatusOK)
+	})
+}
+
+// storeDeviceLocation stores the location of the remote device when it starts up. Called by the teller
+func storeDeviceLocation() {
+	http.HandleFunc(RecpRPC[7][0], func(w http.ResponseWriter, r *http.Request) {
+		erpc.CheckGet(w, r)
+		erpc.CheckOrigin(w, r)
+
+		prepRecipient, err := RecpValidateHelper(w, r, RecpRPC[7][1:])
+		if err != nil {
+			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
+			return
+		}
+
+		prepRecipient.DeviceLocation = r.URL.Query()["location"][0]
 		err = prepRecipient.Save()
 		if err != nil {
 			log.Println("did not save recipient", err)
@@ -571,3 +732,768 @@ func storeStateHash() {
 		erpc.ResponseHandler(w, erpc.StatusOK)
 	})
 }
+
+// chooseBlindAuction chooses a blind auction method to choose for the winner. Also commonly
+// known as a 1st price auction.
+func chooseBlindAuction() {
+	http.HandleFunc(RecpRPC[8][0], func(w http.ResponseWriter, r *http.Request) {
+		erpc.CheckGet(w, r)
+		erpc.CheckOrigin(w, r)
+		recipient, err := RecpValidateHelper(w, r, RecpRPC[8][1:])
+		if err != nil {
+			log.Println("did not validate recipient", err)
+			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
+			return
+		}
+
+		allContracts, err := core.RetrieveRecipientProjects(core.Stage2.Number, recipient.U.Index)
+		if err != nil {
+			log.Println("did not validate recipient projects", err)
+			erpc.ResponseHandler(w, erpc.StatusInternalServerError)
+			return
+		}
+
+		bestContract, err := core.SelectContractBlind(allContracts)
+		if err != nil {
+			log.Println("did not select contract", err)
+			erpc.ResponseHandler(w, erpc.StatusInternalServerError)
+			return
+		}
+
+		err = bestContract.SetStage(4)
+		if err != nil {
+			log.Println("did not set final project", err)
+			erpc.ResponseHandler(w, erpc.StatusInternalServerError)
+			return
+		}
+
+		erpc.ResponseHandler(w, erpc.StatusOK)
+	})
+}
+
+// chooseVickreyAuction chooses a vickrey auction method to choose the winning contractor.
+// also known as a second price auction
+func chooseVickreyAuction() {
+	http.HandleFunc(RecpRPC[9][0], func(w http.ResponseWriter, r *http.Request) {
+		erpc.CheckGet(w, r)
+		erpc.CheckOrigin(w, r)
+		recipient, err := RecpValidateHelper(w, r, RecpRPC[9][1:])
+		if err != nil {
+			log.Println("did not validate recipient", err)
+			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
+			return
+		}
+
+		allContracts, err := core.RetrieveRecipientProjects(core.Stage2.Number, recipient.U.Index)
+		if err != nil {
+			log.Println("did not retrieve recipient projects", err)
+			erpc.ResponseHandler(w, erpc.StatusInternalServerError)
+			return
+		}
+
+		bestContract, err := core.SelectContractVickrey(allContracts)
+		if err != nil {
+			log.Println("did not select contract", err)
+			erpc.ResponseHandler(w, erpc.StatusInternalServerError)
+			return
+		}
+
+		err = bestContract.SetStage(4)
+		if err != nil {
+			log.Println("did not set final project", err)
+			erpc.ResponseHandler(w, erpc.StatusInternalServerError)
+			return
+		}
+
+		erpc.ResponseHandler(w, erpc.StatusOK)
+	})
+}
+
+// chooseTimeAuction chooses the winning contractor based on least completion time
+func chooseTimeAuction() {
+	http.HandleFunc(RecpRPC[10][0], func(w http.ResponseWriter, r *http.Request) {
+		erpc.CheckGet(w, r)
+		erpc.CheckOrigin(w, r)
+		recipient, err := RecpValidateHelper(w, r, RecpRPC[10][1:])
+		if err != nil {
+			log.Println("did not validate recipient", err)
+			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
+			return
+		}
+
+		allContracts, err := core.RetrieveRecipientProjects(core.Stage2.Number, recipient.U.Index)
+		if err != nil {
+			log.Println("did not retrieve recipient projects", err)
+			erpc.ResponseHandler(w, erpc.StatusInternalServerError)
+			return
+		}
+
+		bestContract, err := core.SelectContractTime(allContracts)
+		if err != nil {
+			log.Println("did not select contract", err)
+			erpc.ResponseHandler(w, erpc.StatusInternalServerError)
+			return
+		}
+
+		err = bestContract.SetStage(4)
+		if err != nil {
+			log.Println("did not set final project", err)
+			erpc.ResponseHandler(w, erpc.StatusInternalServerError)
+			return
+		}
+
+		erpc.ResponseHandler(w, erpc.StatusOK)
+	})
+}
+
+// unlockOpenSolar unlocks a project which has just been invested in, signalling that the recipient
+// has accepted the investment.
+func unlockOpenSolar() {
+	http.HandleFunc(RecpRPC[11][0], func(w http.ResponseWriter, r *http.Request) {
+		erpc.CheckGet(w, r)
+		erpc.CheckOrigin(w, r)
+		recipient, err := RecpValidateHelper(w, r, RecpRPC[11][1:])
+		if err != nil {
+			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
+			return
+		}
+
+		seedpwd := r.URL.Query()["seedpwd"][0]
+		projIndex, err := utils.ToInt(r.URL.Query()["projIndex"][0])
+		if err != nil {
+			log.Println("did not parse to integer", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		err = core.UnlockProject(recipient.U.Username, recipient.U.Pwhash, projIndex, seedpwd)
+		if err != nil {
+			log.Println("did not unlock project", err)
+			erpc.ResponseHandler(w, erpc.StatusInternalServerError)
+			return
+		}
+
+		erpc.ResponseHandler(w, erpc.StatusOK)
+	})
+}
+
+// addEmail adds an email address to the recipient's profile
+func addEmail() {
+	http.HandleFunc(RecpRPC[12][0], func(w http.ResponseWriter, r *http.Request) {
+		erpc.CheckGet(w, r)
+		erpc.CheckOrigin(w, r)
+		recipient, err := RecpValidateHelper(w, r, RecpRPC[12][1:])
+		if err != nil {
+			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
+			return
+		}
+
+		email := r.URL.Query()["email"][0]
+		err = recipient.U.AddEmail(email)
+		if err != nil {
+			log.Println("did not add email", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+		erpc.ResponseHandler(w, erpc.StatusOK)
+	})
+}
+
+// finalizeProject finalizes (ie moves from stage 2 to 3) a specific project
+func finalizeProject() {
+	http.HandleFunc(RecpRPC[13][0], func(w http.ResponseWriter, r *http.Request) {
+		erpc.CheckGet(w, r)
+		erpc.CheckOrigin(w, r)
+		_, err := RecpValidateHelper(w, r, RecpRPC[13][1:])
+		if err != nil {
+			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
+			return
+		}
+
+		projIndex, err := utils.ToInt(r.URL.Query()["projIndex"][0])
+		if err != nil {
+			log.Println("did not parse to integer", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		project, err := core.RetrieveProject(projIndex)
+		if err != nil {
+			log.Println("did not retrieve project", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		err = project.SetStage(4)
+		if err != nil {
+			log.Println("did not set final project", err)
+			erpc.ResponseHandler(w, erpc.StatusInternalServerError)
+			return
+		}
+
+		erpc.ResponseHandler(w, erpc.StatusOK)
+	})
+}
+
+// originateProject originates (ie moves from stage 0 to 1) a project
+func originateProject() {
+	http.HandleFunc(RecpRPC[14][0], func(w http.ResponseWriter, r *http.Request) {
+		erpc.CheckGet(w, r)
+		erpc.CheckOrigin(w, r)
+		recipient, err := RecpValidateHelper(w, r, RecpRPC[14][1:])
+		if err != nil {
+			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
+			return
+		}
+
+		projIndex, err := utils.ToInt(r.URL.Query()["projIndex"][0])
+		if err != nil {
+			log.Println("did not parse to integer", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		err = core.RecipientAuthorize(projIndex, recipient.U.Index)
+		if err != nil {
+			log.Println("did not authorize project", err)
+			erpc.ResponseHandler(w, erpc.StatusInternalServerError)
+			return
+		}
+
+		erpc.ResponseHandler(w, erpc.StatusOK)
+	})
+}
+
+// calculateTrustLimit calculates the trust limit associated with a specific asset.
+func calculateTrustLimit() {
+	http.HandleFunc(RecpRPC[15][0], func(w http.ResponseWriter, r *http.Request) {
+		erpc.CheckGet(w, r)
+		erpc.CheckOrigin(w, r)
+		recipient, err := RecpValidateHelper(w, r, RecpRPC[15][1:])
+		if err != nil {
+			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
+			return
+		}
+
+		assetName := r.URL.Query()["assetName"][0]
+		trustLimit, err := xlm.GetAssetTrustLimit(recipient.U.StellarWallet.PublicKey, assetName)
+		if err != nil {
+			log.Println("did not get trust limit", err)
+			erpc.ResponseHandler(w, erpc.StatusInternalServerError)
+			return
+		}
+
+		erpc.MarshalSend(w, trustLimit)
+	})
+}
+
+// storeStateHash stores the start time of the remote device installed as part of an invested project.
+// Called by the teller
+func storeStateHash() {
+	http.HandleFunc(RecpRPC[16][0], func(w http.ResponseWriter, r *http.Request) {
+		erpc.CheckGet(w, r)
+		erpc.CheckOrigin(w, r)
+		// first validate the recipient or anyone would be able to set device ids
+		prepRecipient, err := RecpValidateHelper(w, r, RecpRPC[16][1:])
+		if err != nil {
+			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
+			return
+		}
+
+		err = verifyDeviceRequest(prepRecipient, r, r.URL.Query()["hash"][0])
+		if err != nil {
+			log.Println("did not verify device signature", err)
+			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
+			return
+		}
+
+		for _, hash := range prepRecipient.StateHashes {
+			if hash == r.URL.Query()["hash"][0] {
+				// the teller sent the hash again after losing connectivity
+				erpc.ResponseHandler(w, erpc.StatusOK)
+				return
+			}
+		}
+
+		prepRecipient.StateHashes = append(prepRecipient.StateHashes, r.URL.Query()["hash"][0])
+		err = prepRecipient.Save()
+		if err != nil {
+			log.Println("did not save recipient", err)
+			erpc.ResponseHandler(w, erpc.StatusInternalServerError)
+			return
+		}
+		erpc.ResponseHandler(w, erpc.StatusOK)
+	})
+}
+
+// startOpenAuction starts an english or dutch auction on one of the recipient's proposed projects
+func startOpenAuction() {
+	http.HandleFunc(RecpRPC[17][0], func(w http.ResponseWriter, r *http.Request) {
+		erpc.CheckGet(w, r)
+		erpc.CheckOrigin(w, r)
+		recipient, err := RecpValidateHelper(w, r, RecpRPC[17][1:])
+		if err != nil {
+			log.Println("did not validate recipient", err)
+			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
+			return
+		}
+
+		projIndex, err := utils.ToInt(r.URL.Query()["projIndex"][0])
+		if err != nil {
+			log.Println("did not parse to integer", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		price, err := utils.ToFloat(r.URL.Query()["price"][0])
+		if err != nil {
+			log.Println("did not parse to float", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		project, err := core.RetrieveProject(projIndex)
+		if err != nil {
+			log.Println("did not retrieve project", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		if project.RecipientIndex != recipient.U.Index {
+			log.Println("recipient not associated with project")
+			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
+			return
+		}
+
+		err = project.StartOpenAuction(price)
+		if err != nil {
+			log.Println("did not start auction", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		erpc.ResponseHandler(w, erpc.StatusOK)
+	})
+}
+
+// chooseEnglishAuction closes an english auction and picks the contractor with the lowest
+// standing bid. Also known as an open descending price auction when contractors compete.
+func chooseEnglishAuction() {
+	http.HandleFunc(RecpRPC[18][0], func(w http.ResponseWriter, r *http.Request) {
+		erpc.CheckGet(w, r)
+		erpc.CheckOrigin(w, r)
+		recipient, err := RecpValidateHelper(w, r, RecpRPC[18][1:])
+		if err != nil {
+			log.Println("did not validate recipient", err)
+			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
+			return
+		}
+
+		projIndex, err := utils.ToInt(r.URL.Query()["projIndex"][0])
+		if err != nil {
+			log.Println("did not parse to integer", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		project, err := core.RetrieveProject(projIndex)
+		if err != nil {
+			log.Println("did not retrieve project", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		if project.RecipientIndex != recipient.U.Index {
+			log.Println("recipient not associated with project")
+			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
+			return
+		}
+
+		bestContract, err := core.SelectContractEnglish(projIndex)
+		if err != nil {
+			log.Println("did not select contract", err)
+			erpc.ResponseHandler(w, erpc.StatusInternalServerError)
+			return
+		}
+
+		err = bestContract.SetStage(4)
+		if err != nil {
+			log.Println("did not set final project", err)
+			erpc.ResponseHandler(w, erpc.StatusInternalServerError)
+			return
+		}
+
+		erpc.ResponseHandler(w, erpc.StatusOK)
+	})
+}
+
+// chooseDutchAuction picks the contractor who accepted the offered price in a dutch auction
+func chooseDutchAuction() {
+	http.HandleFunc(RecpRPC[19][0], func(w http.ResponseWriter, r *http.Request) {
+		erpc.CheckGet(w, r)
+		erpc.CheckOrigin(w, r)
+		recipient, err := RecpValidateHelper(w, r, RecpRPC[19][1:])
+		if err != nil {
+			log.Println("did not validate recipient", err)
+			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
+			return
+		}
+
+		projIndex, err := utils.ToInt(r.URL.Query()["projIndex"][0])
+		if err != nil {
+			log.Println("did not parse to integer", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		project, err := core.RetrieveProject(projIndex)
+		if err != nil {
+			log.Println("did not retrieve project", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		if project.RecipientIndex != recipient.U.Index {
+			log.Println("recipient not associated with project")
+			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
+			return
+		}
+
+		bestContract, err := core.SelectContractDutch(projIndex)
+		if err != nil {
+			log.Println("did not select contract", err)
+			erpc.ResponseHandler(w, erpc.StatusInternalServerError)
+			return
+		}
+
+		err = bestContract.SetStage(4)
+		if err != nil {
+			log.Println("did not set final project", err)
+			erpc.ResponseHandler(w, erpc.StatusInternalServerError)
+			return
+		}
+
+		erpc.ResponseHandler(w, erpc.StatusOK)
+	})
+}
+
+// openSealedAuction opens a sealed auction on one of the recipient's originated projects
+func openSealedAuction() {
+	http.HandleFunc(RecpRPC[20][0], func(w http.ResponseWriter, r *http.Request) {
+		erpc.CheckGet(w, r)
+		erpc.CheckOrigin(w, r)
+		recipient, err := RecpValidateHelper(w, r, RecpRPC[20][1:])
+		if err != nil {
+			log.Println("did not validate recipient", err)
+			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
+			return
+		}
+
+		projIndex, err := utils.ToInt(r.URL.Query()["projIndex"][0])
+		if err != nil {
+			log.Println("did not parse to integer", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		duration, err := utils.ToInt(r.URL.Query()["duration"][0])
+		if err != nil {
+			log.Println("did not parse to integer", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		project, err := core.RetrieveProject(projIndex)
+		if err != nil {
+			log.Println("did not retrieve project", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		if project.RecipientIndex != recipient.U.Index {
+			log.Println("recipient not associated with project")
+			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
+			return
+		}
+
+		auction, err := core.OpenSealedAuction(projIndex, r.URL.Query()["rule"][0], int64(duration))
+		if err != nil {
+			log.Println("did not open sealed auction", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		erpc.MarshalSend(w, auction)
+	})
+}
+
+// setBidWeights sets the weights used to score contracts proposed towards one of the recipient's projects
+func setBidWeights() {
+	http.HandleFunc(RecpRPC[21][0], func(w http.ResponseWriter, r *http.Request) {
+		erpc.CheckGet(w, r)
+		erpc.CheckOrigin(w, r)
+		recipient, err := RecpValidateHelper(w, r, RecpRPC[21][1:])
+		if err != nil {
+			log.Println("did not validate recipient", err)
+			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
+			return
+		}
+
+		projIndex, err := utils.ToInt(r.URL.Query()["projIndex"][0])
+		if err != nil {
+			log.Println("did not parse to integer", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		var weights core.BidWeights
+		weights.Price, err = utils.ToFloat(r.URL.Query()["price"][0])
+		if err != nil {
+			log.Println("did not parse to float", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+		weights.Time, err = utils.ToFloat(r.URL.Query()["time"][0])
+		if err != nil {
+			log.Println("did not parse to float", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+		weights.Reputation, err = utils.ToFloat(r.URL.Query()["reputation"][0])
+		if err != nil {
+			log.Println("did not parse to float", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+		weights.Collateral, err = utils.ToFloat(r.URL.Query()["collateral"][0])
+		if err != nil {
+			log.Println("did not parse to float", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+		weights.Feedback, err = utils.ToFloat(r.URL.Query()["feedback"][0])
+		if err != nil {
+			log.Println("did not parse to float", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		project, err := core.RetrieveProject(projIndex)
+		if err != nil {
+			log.Println("did not retrieve project", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		if project.RecipientIndex != recipient.U.Index {
+			log.Println("recipient not associated with project")
+			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
+			return
+		}
+
+		err = project.SetBidWeights(weights)
+		if err != nil {
+			log.Println("did not set bid weights", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		erpc.ResponseHandler(w, erpc.StatusOK)
+	})
+}
+
+// chooseScoreAuction scores the contracts proposed towards the passed project using its weights and chooses
+// the contract with the highest score
+func chooseScoreAuction() {
+	http.HandleFunc(RecpRPC[22][0], func(w http.ResponseWriter, r *http.Request) {
+		erpc.CheckGet(w, r)
+		erpc.CheckOrigin(w, r)
+		recipient, err := RecpValidateHelper(w, r, RecpRPC[22][1:])
+		if err != nil {
+			log.Println("did not validate recipient", err)
+			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
+			return
+		}
+
+		projIndex, err := utils.ToInt(r.URL.Query()["projIndex"][0])
+		if err != nil {
+			log.Println("did not parse to integer", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		project, err := core.RetrieveProject(projIndex)
+		if err != nil {
+			log.Println("did not retrieve project", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		if project.RecipientIndex != recipient.U.Index {
+			log.Println("recipient not associated with project")
+			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
+			return
+		}
+
+		allContracts, err := core.RetrieveRecipientProjects(core.Stage2.Number, recipient.U.Index)
+		if err != nil {
+			log.Println("did not retrieve recipient projects", err)
+			erpc.ResponseHandler(w, erpc.StatusInternalServerError)
+			return
+		}
+
+		// the recipient may have contracts proposed towards other projects as well, only score those for this one
+		var contracts []core.Project
+		for _, contract := range allContracts {
+			if contract.ProposedTo == projIndex {
+				contracts = append(contracts, contract)
+			}
+		}
+
+		auction, err := core.SelectContractScore(projIndex, contracts)
+		if err != nil {
+			log.Println("did not select contract", err)
+			erpc.ResponseHandler(w, erpc.StatusInternalServerError)
+			return
+		}
+
+		err = auction.WinningContract.SetStage(4)
+		if err != nil {
+			log.Println("did not set final project", err)
+			erpc.ResponseHandler(w, erpc.StatusInternalServerError)
+			return
+		}
+
+		erpc.MarshalSend(w, auction)
+	})
+}
+
+// getAuctionResult returns the ranked result of the scoring auction held for one of the recipient's projects
+func getAuctionResult() {
+	http.HandleFunc(RecpRPC[23][0], func(w http.ResponseWriter, r *http.Request) {
+		erpc.CheckGet(w, r)
+		erpc.CheckOrigin(w, r)
+		recipient, err := RecpValidateHelper(w, r, RecpRPC[23][1:])
+		if err != nil {
+			log.Println("did not validate recipient", err)
+			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
+			return
+		}
+
+		projIndex, err := utils.ToInt(r.URL.Query()["projIndex"][0])
+		if err != nil {
+			log.Println("did not parse to integer", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		auction, err := core.RetrieveContractAuction(projIndex)
+		if err != nil {
+			log.Println("did not retrieve auction", err)
+			erpc.ResponseHandler(w, erpc.StatusInternalServerError)
+			return
+		}
+
+		if auction.Index == 0 || auction.WinningContract.RecipientIndex != recipient.U.Index {
+			log.Println("recipient not associated with auction")
+			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
+			return
+		}
+
+		erpc.MarshalSend(w, auction)
+	})
+}
+
+// openAuction opens an auction with a bidding window on one of the recipient's originated projects.
+// The auction is closed automatically once duration seconds have passed
+func openAuction() {
+	http.HandleFunc(RecpRPC[24][0], func(w http.ResponseWriter, r *http.Request) {
+		erpc.CheckGet(w, r)
+		erpc.CheckOrigin(w, r)
+		recipient, err := RecpValidateHelper(w, r, RecpRPC[24][1:])
+		if err != nil {
+			log.Println("did not validate recipient", err)
+			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
+			return
+		}
+
+		projIndex, err := utils.ToInt(r.URL.Query()["projIndex"][0])
+		if err != nil {
+			log.Println("did not parse to integer", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		duration, err := utils.ToInt(r.URL.Query()["duration"][0])
+		if err != nil {
+			log.Println("did not parse to integer", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		project, err := core.RetrieveProject(projIndex)
+		if err != nil {
+			log.Println("did not retrieve project", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		if project.RecipientIndex != recipient.U.Index {
+			log.Println("recipient not associated with project")
+			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
+			return
+		}
+
+		auction, err := core.OpenAuction(projIndex, r.URL.Query()["rule"][0], int64(duration))
+		if err != nil {
+			log.Println("did not open auction", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		erpc.MarshalSend(w, auction)
+	})
+}
+
+// getAuctionBids returns the bids placed on an auction held on one of the recipient's projects
+func getAuctionBids() {
+	http.HandleFunc(RecpRPC[25][0], func(w http.ResponseWriter, r *http.Request) {
+		erpc.CheckGet(w, r)
+		erpc.CheckOrigin(w, r)
+		recipient, err := RecpValidateHelper(w, r, RecpRPC[25][1:])
+		if err != nil {
+			log.Println("did not validate recipient", err)
+			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
+			return
+		}
+
+		auctionIndex, err := utils.ToInt(r.URL.Query()["auctionIndex"][0])
+		if err != nil {
+			log.Println("did not parse to integer", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		auction, err := core.RetrieveAuction(auctionIndex)
+		if err != nil {
+			log.Println("did not retrieve auction", err)
+			erpc.ResponseHandler(w, erpc.StatusBadRequest)
+			return
+		}
+
+		if auction.RecipientIndex != recipient.U.Index {
+			log.Println("recipient not associated with auction")
+			erpc.ResponseHandler(w, erpc.StatusUnauthorized)
+			return
+		}
+
+		bids, err := core.RetrieveAuctionBids(auctionIndex)
+		if err != nil {
+			log.Println("did not retrieve bids", err)
+			erpc.ResponseHandler(w, erpc.StatusInternalServerError)
+			return
+		}
+
+		erpc.MarshalSend(w, bids)
+	})
+}
@@ -47,7 +47,7 @@ func StartServer(portx int, insecure bool) {
 	setupParticleHandlers()
 	setupSwytchApis()
 	setupStagesHandlers()
-	// adminHandlers()
+	adminHandlers()
 
 	port, err := utils.ToString(portx)
 	if err != nil {
@@ -0,0 +1,397 @@
+package simnet
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stellar/go/amount"
+)
+
+// the resources below are the subset of horizon's resources the platform reads. Field names follow horizon so
+// that horizon clients can decode them
+
+// problem is the body of horizon's error responses
+type problem struct {
+	Type   string                 `json:"type"`
+	Title  string                 `json:"title"`
+	Status int                    `json:"status"`
+	Detail string                 `json:"detail"`
+	Extras map[string]interface{} `json:"extras,omitempty"`
+}
+
+// rootResource is the root of horizon
+type rootResource struct {
+	HorizonVersion      string `json:"horizon_version"`
+	CoreVersion         string `json:"core_version"`
+	HistoryLatestLedger int32  `json:"history_latest_ledger"`
+	CoreLatestLedger    int32  `json:"core_latest_ledger"`
+	NetworkPassphrase   string `json:"network_passphrase"`
+}
+
+// thresholdsResource holds the thresholds of an account
+type thresholdsResource struct {
+	LowThreshold  byte `json:"low_threshold"`
+	MedThreshold  byte `json:"med_threshold"`
+	HighThreshold byte `json:"high_threshold"`
+}
+
+// balanceResource is an account's balance of lumens or of an asset
+type balanceResource struct {
+	Balance            string `json:"balance"`
+	Limit              string `json:"limit,omitempty"`
+	BuyingLiabilities  string `json:"buying_liabilities"`
+	SellingLiabilities string `json:"selling_liabilities"`
+	AssetType          string `json:"asset_type"`
+	AssetCode          string `json:"asset_code,omitempty"`
+	AssetIssuer        string `json:"asset_issuer,omitempty"`
+}
+
+// signerResource is a key that can sign for an account
+type signerResource struct {
+	Weight int32  `json:"weight"`
+	Key    string `json:"key"`
+	Type   string `json:"type"`
+}
+
+// accountResource is an account
+type accountResource struct {
+	ID            string             `json:"id"`
+	AccountID     string             `json:"account_id"`
+	Sequence      string             `json:"sequence"`
+	SubentryCount int32              `json:"subentry_count"`
+	Thresholds    thresholdsResource `json:"thresholds"`
+	Balances      []balanceResource  `json:"balances"`
+	Signers       []signerResource   `json:"signers"`
+	Data          map[string]string  `json:"data"`
+	PagingToken   string             `json:"paging_token"`
+}
+
+// transactionResource is a transaction
+type transactionResource struct {
+	ID             string    `json:"id"`
+	PagingToken    string    `json:"paging_token"`
+	Successful     bool      `json:"successful"`
+	Hash           string    `json:"hash"`
+	Ledger         int32     `json:"ledger"`
+	CreatedAt      time.Time `json:"created_at"`
+	SourceAccount  string    `json:"source_account"`
+	OperationCount int32     `json:"operation_count"`
+	EnvelopeXdr    string    `json:"envelope_xdr"`
+	MemoType       string    `json:"memo_type"`
+	Memo           string    `json:"memo,omitempty"`
+}
+
+// paymentResource is a create account or payment operation
+type paymentResource struct {
+	ID                    string    `json:"id"`
+	PagingToken           string    `json:"paging_token"`
+	TransactionSuccessful bool      `json:"transaction_successful"`
+	SourceAccount         string    `json:"source_account"`
+	Type                  string    `json:"type"`
+	CreatedAt             time.Time `json:"created_at"`
+	TransactionHash       string    `json:"transaction_hash"`
+	From                  string    `json:"from,omitempty"`
+	To                    string    `json:"to,omitempty"`
+	AssetType             string    `json:"asset_type,omitempty"`
+	AssetCode             string    `json:"asset_code,omitempty"`
+	AssetIssuer           string    `json:"asset_issuer,omitempty"`
+	Amount                string    `json:"amount,omitempty"`
+	Funder                string    `json:"funder,omitempty"`
+	Account               string    `json:"account,omitempty"`
+	StartingBalance       string    `json:"starting_balance,omitempty"`
+}
+
+// page is a list of records
+type page struct {
+	Embedded struct {
+		Records interface{} `json:"records"`
+	} `json:"_embedded"`
+}
+
+// ServeHTTP serves the parts of horizon's API that the platform uses, along with friendbot:
+//
+//	GET  /                            the network's passphrase and latest ledger
+//	GET  /accounts/{id}               an account's sequence number, balances, thresholds and signers
+//	GET  /accounts/{id}/transactions  the transactions an account took part in
+//	GET  /accounts/{id}/payments      the payments an account took part in
+//	POST /transactions                submits the transaction envelope passed as tx
+//	GET  /transactions/{hash}         a transaction
+//	GET  /friendbot?addr=             funds a new account
+func (n *Network) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case r.URL.Path == "/":
+		n.mu.Lock()
+		root := rootResource{HorizonVersion: "simnet", CoreVersion: "simnet", HistoryLatestLedger: n.ledger,
+			CoreLatestLedger: n.ledger, NetworkPassphrase: Passphrase}
+		n.mu.Unlock()
+		writeJSON(w, http.StatusOK, root)
+	case parts[0] == "friendbot":
+		n.serveFriendbot(w, r)
+	case parts[0] == "accounts" && len(parts) == 2:
+		n.serveAccount(w, parts[1])
+	case parts[0] == "accounts" && len(parts) == 3 && parts[2] == "transactions":
+		n.serveAccountTransactions(w, parts[1])
+	case parts[0] == "accounts" && len(parts) == 3 && parts[2] == "payments":
+		n.serveAccountPayments(w, parts[1])
+	case parts[0] == "transactions" && len(parts) == 1 && r.Method == http.MethodPost:
+		n.serveSubmit(w, r)
+	case parts[0] == "transactions" && len(parts) == 2:
+		n.serveTransaction(w, parts[1])
+	default:
+		notFound(w)
+	}
+}
+
+// assetType returns the type horizon gives assets with the passed code
+func assetType(code string) string {
+	if len(code) > 4 {
+		return "credit_alphanum12"
+	}
+	return "credit_alphanum4"
+}
+
+// writeJSON writes v with the passed status
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/hal+json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// notFound writes horizon's response for resources that don't exist
+func notFound(w http.ResponseWriter) {
+	writeJSON(w, http.StatusNotFound, problem{
+		Type:   "https://stellar.org/horizon-errors/not_found",
+		Title:  "Resource Missing",
+		Status: http.StatusNotFound,
+		Detail: "The resource at the url requested was not found.",
+	})
+}
+
+// writeTxError writes horizon's response for transactions that couldn't be submitted
+func writeTxError(w http.ResponseWriter, envelope string, err error) {
+	txErr, ok := err.(*TxError)
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, problem{
+			Type:   "https://stellar.org/horizon-errors/transaction_malformed",
+			Title:  "Transaction Malformed",
+			Status: http.StatusBadRequest,
+			Detail: err.Error(),
+			Extras: map[string]interface{}{"envelope_xdr": envelope},
+		})
+		return
+	}
+
+	codes := map[string]interface{}{"transaction": txErr.Transaction}
+	if len(txErr.Operations) != 0 {
+		codes["operations"] = txErr.Operations
+	}
+	writeJSON(w, http.StatusBadRequest, problem{
+		Type:   "https://stellar.org/horizon-errors/transaction_failed",
+		Title:  "Transaction Failed",
+		Status: http.StatusBadRequest,
+		Detail: txErr.Error(),
+		Extras: map[string]interface{}{"envelope_xdr": envelope, "result_codes": codes},
+	})
+}
+
+// resource returns the horizon resource of a transaction
+func (tx Transaction) resource() transactionResource {
+	memoType := "none"
+	if tx.Memo != "" {
+		memoType = "text"
+	}
+	return transactionResource{
+		ID:             tx.Hash,
+		PagingToken:    strconv.FormatInt(int64(tx.Ledger)<<32, 10),
+		Successful:     tx.Successful,
+		Hash:           tx.Hash,
+		Ledger:         tx.Ledger,
+		CreatedAt:      tx.CreatedAt,
+		SourceAccount:  tx.Source,
+		OperationCount: int32(tx.Operations),
+		EnvelopeXdr:    tx.Envelope,
+		MemoType:       memoType,
+		Memo:           tx.Memo,
+	}
+}
+
+// serveFriendbot funds the account passed as addr
+func (n *Network) serveFriendbot(w http.ResponseWriter, r *http.Request) {
+	address := r.URL.Query().Get("addr")
+	tx, err := n.Fund(address)
+	if err != nil {
+		writeTxError(w, "", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, tx.resource())
+}
+
+// serveSubmit submits the transaction envelope passed as tx
+func (n *Network) serveSubmit(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		writeTxError(w, "", err)
+		return
+	}
+
+	envelope := r.PostForm.Get("tx")
+	tx, err := n.Submit(envelope)
+	if err != nil {
+		writeTxError(w, envelope, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, tx.resource())
+}
+
+// serveTransaction serves a transaction by its hash
+func (n *Network) serveTransaction(w http.ResponseWriter, hash string) {
+	for _, tx := range n.Transactions() {
+		if tx.Hash == hash {
+			writeJSON(w, http.StatusOK, tx.resource())
+			return
+		}
+	}
+	notFound(w)
+}
+
+// serveAccount serves an account along with its balances and signers
+func (n *Network) serveAccount(w http.ResponseWriter, address string) {
+	n.mu.Lock()
+	acc, exists := n.accounts[address]
+	if !exists {
+		n.mu.Unlock()
+		notFound(w)
+		return
+	}
+	acc = acc.copy()
+	n.mu.Unlock()
+
+	resource := accountResource{
+		ID:            address,
+		AccountID:     address,
+		Sequence:      strconv.FormatInt(acc.sequence, 10),
+		SubentryCount: int32(len(acc.lines) + len(acc.signers)),
+		Thresholds: thresholdsResource{
+			LowThreshold:  byte(acc.thresholds[0]),
+			MedThreshold:  byte(acc.thresholds[1]),
+			HighThreshold: byte(acc.thresholds[2]),
+		},
+		Data:        map[string]string{},
+		PagingToken: address,
+	}
+
+	var assets []string
+	for asset := range acc.lines {
+		assets = append(assets, asset)
+	}
+	sort.Strings(assets) // list balances in the same order every time
+
+	for _, asset := range assets {
+		line := acc.lines[asset]
+		code := strings.Split(asset, ":")[0]
+		resource.Balances = append(resource.Balances, balanceResource{
+			Balance:            amount.StringFromInt64(line.balance),
+			Limit:              amount.StringFromInt64(line.limit),
+			BuyingLiabilities:  "0.0000000",
+			SellingLiabilities: "0.0000000",
+			AssetType:          assetType(code),
+			AssetCode:          code,
+			AssetIssuer:        strings.Split(asset, ":")[1],
+		})
+	}
+	resource.Balances = append(resource.Balances, balanceResource{
+		Balance:            amount.StringFromInt64(acc.balance),
+		BuyingLiabilities:  "0.0000000",
+		SellingLiabilities: "0.0000000",
+		AssetType:          "native",
+	})
+
+	var signers []string
+	for key := range acc.signers {
+		signers = append(signers, key)
+	}
+	sort.Strings(signers)
+
+	for _, key := range signers {
+		resource.Signers = append(resource.Signers, signerResource{Weight: int32(acc.signers[key]), Key: key, Type: "ed25519_public_key"})
+	}
+	resource.Signers = append(resource.Signers, signerResource{Weight: int32(acc.masterWeight), Key: address, Type: "ed25519_public_key"})
+
+	writeJSON(w, http.StatusOK, resource)
+}
+
+// involves checks whether a transaction was sent by or moved funds in or out of an account
+func (tx Transaction) involves(address string) bool {
+	if tx.Source == address {
+		return true
+	}
+	for _, payment := range tx.Payments {
+		if payment.From == address || payment.To == address {
+			return true
+		}
+	}
+	return false
+}
+
+// serveAccountTransactions serves the transactions an account took part in, oldest first
+func (n *Network) serveAccountTransactions(w http.ResponseWriter, address string) {
+	records := []transactionResource{}
+	for _, tx := range n.Transactions() {
+		if tx.involves(address) {
+			records = append(records, tx.resource())
+		}
+	}
+
+	var p page
+	p.Embedded.Records = records
+	writeJSON(w, http.StatusOK, p)
+}
+
+// serveAccountPayments serves the payments an account took part in, oldest first
+func (n *Network) serveAccountPayments(w http.ResponseWriter, address string) {
+	records := []paymentResource{}
+	for _, tx := range n.Transactions() {
+		for i, payment := range tx.Payments {
+			if payment.From != address && payment.To != address {
+				continue
+			}
+
+			id := strconv.FormatInt(int64(tx.Ledger)<<32|int64(i+1), 10)
+			record := paymentResource{
+				ID:                    id,
+				PagingToken:           id,
+				TransactionSuccessful: tx.Successful,
+				SourceAccount:         payment.From,
+				Type:                  payment.Type,
+				CreatedAt:             tx.CreatedAt,
+				TransactionHash:       tx.Hash,
+			}
+
+			if payment.Type == "create_account" {
+				record.Funder = payment.From
+				record.Account = payment.To
+				record.StartingBalance = amount.StringFromInt64(payment.Amount)
+			} else {
+				record.From = payment.From
+				record.To = payment.To
+				record.Amount = amount.StringFromInt64(payment.Amount)
+				record.AssetType = "native"
+				if payment.Code != "" {
+					record.AssetType = assetType(payment.Code)
+					record.AssetCode = payment.Code
+					record.AssetIssuer = payment.Issuer
+				}
+			}
+			records = append(records, record)
+		}
+	}
+
+	var p page
+	p.Embedded.Records = records
+	writeJSON(w, http.StatusOK, p)
+}
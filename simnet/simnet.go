@@ -0,0 +1,535 @@
+package simnet
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/pkg/errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stellar/go/amount"
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/network"
+	"github.com/stellar/go/strkey"
+	"github.com/stellar/go/xdr"
+)
+
+// package simnet is a stellar network that runs in process so that the contract flow can be tested end to end
+// without testnet, friendbot or openx. It keeps accounts, trustlines and signers in memory, applies transactions
+// submitted as XDR the way stellar-core would and serves the parts of horizon's API that the platform uses.
+// Every transaction closes a ledger of its own and the network's clock starts at StartTime and moves forward by
+// LedgerInterval every ledger, so the same transactions always give the same ledgers. Time bounds of transactions
+// aren't checked since they're set from the wall clock. Only the operations the platform uses are supported:
+// create account, payment, change trust and set options.
+
+// Passphrase is the passphrase of the simulated network
+const Passphrase = "Opensolar Simulated Network"
+
+// LedgerInterval is the time between two ledgers of the simulated network
+const LedgerInterval = 5 * time.Second
+
+// BaseFee is the fee in stroops paid for every operation of a transaction
+const BaseFee = 100
+
+// BaseReserve is the balance in stroops an account must keep for itself and for each of its trustlines and signers
+const BaseReserve = 5000000
+
+// FriendbotAmount is the balance in stroops friendbot creates accounts with
+const FriendbotAmount = 10000 * amount.One
+
+// rootBalance is the balance in stroops of the root account of the network, which holds all lumens
+const rootBalance = 100000000000 * amount.One
+
+// StartTime is the time at which the first ledger of the simulated network closes
+var StartTime = time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Transaction is a transaction applied to the simulated network
+type Transaction struct {
+	Hash       string    // the hex encoded hash of the transaction
+	Ledger     int32     // the ledger the transaction was applied in
+	CreatedAt  time.Time // the close time of the ledger
+	Source     string    // the source account of the transaction
+	Memo       string    // the text memo of the transaction, if any
+	Envelope   string    // the transaction envelope as submitted, empty for friendbot transactions
+	Operations int       // the number of operations in the transaction
+	Successful bool      // whether the operations of the transaction were applied
+	Payments   []Payment // the lumens and assets moved by the transaction
+}
+
+// Payment is a movement of lumens or of an asset made by a transaction
+type Payment struct {
+	Type   string // create_account or payment
+	From   string
+	To     string
+	Code   string // empty for lumens
+	Issuer string // empty for lumens
+	Amount int64  // in stroops
+}
+
+// TxError is returned for transactions that aren't applied. It carries the result codes horizon returns
+type TxError struct {
+	Transaction string   // the result code of the transaction
+	Operations  []string // the result codes of the operations up to the one that failed
+}
+
+// Error returns the result codes of the transaction
+func (e *TxError) Error() string {
+	if len(e.Operations) == 0 {
+		return "transaction failed: " + e.Transaction
+	}
+	return "transaction failed: " + e.Transaction + " (" + strings.Join(e.Operations, ", ") + ")"
+}
+
+// trustline is an account's trustline towards an asset
+type trustline struct {
+	balance int64
+	limit   int64
+}
+
+// account is an account on the simulated network
+type account struct {
+	sequence     int64
+	balance      int64 // lumens held in stroops
+	masterWeight uint32
+	thresholds   [3]uint32             // the low, medium and high thresholds
+	signers      map[string]uint32     // the weights of the account's other signers keyed by public key
+	lines        map[string]*trustline // trustlines keyed by code:issuer
+}
+
+// newAccount returns an account holding balance stroops that's controlled by its own key
+func newAccount(balance int64, sequence int64) *account {
+	return &account{
+		sequence:     sequence,
+		balance:      balance,
+		masterWeight: 1,
+		signers:      make(map[string]uint32),
+		lines:        make(map[string]*trustline),
+	}
+}
+
+// minBalance returns the balance the account must keep to cover its reserve
+func (a *account) minBalance() int64 {
+	return int64(2+len(a.lines)+len(a.signers)) * BaseReserve
+}
+
+// copy returns a deep copy of the account
+func (a *account) copy() *account {
+	b := *a
+	b.signers = make(map[string]uint32, len(a.signers))
+	for key, weight := range a.signers {
+		b.signers[key] = weight
+	}
+	b.lines = make(map[string]*trustline, len(a.lines))
+	for key, line := range a.lines {
+		copied := *line
+		b.lines[key] = &copied
+	}
+	return &b
+}
+
+// Network is a stellar network kept in memory
+type Network struct {
+	mu       sync.Mutex
+	root     *keypair.Full
+	accounts map[string]*account
+	txs      []Transaction
+	ledger   int32
+}
+
+// New returns a network whose lumens are all held by its root account
+func New() *Network {
+	root := keypair.Master(Passphrase).(*keypair.Full)
+	n := &Network{
+		root:     root,
+		accounts: make(map[string]*account),
+	}
+	n.accounts[root.Address()] = newAccount(rootBalance, 0)
+	return n
+}
+
+// Root returns the key of the root account
+func (n *Network) Root() *keypair.Full {
+	return n.root
+}
+
+// Transactions returns the transactions applied to the network in the order they were applied
+func (n *Network) Transactions() []Transaction {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]Transaction(nil), n.txs...)
+}
+
+// closeLedger closes the next ledger and returns its number and close time. Callers hold the lock
+func (n *Network) closeLedger() (int32, time.Time) {
+	n.ledger++
+	return n.ledger, StartTime.Add(time.Duration(n.ledger-1) * LedgerInterval)
+}
+
+// Fund creates an account holding FriendbotAmount out of the root account, which is what friendbot does on testnet
+func (n *Network) Fund(address string) (Transaction, error) {
+	var tx Transaction
+	_, err := strkey.Decode(strkey.VersionByteAccountID, address)
+	if err != nil {
+		return tx, errors.Wrap(err, "invalid address")
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if _, exists := n.accounts[address]; exists {
+		return tx, &TxError{Transaction: "tx_failed", Operations: []string{"op_already_exists"}}
+	}
+
+	root := n.accounts[n.root.Address()]
+	root.sequence++
+	root.balance -= FriendbotAmount + BaseFee
+
+	tx.Ledger, tx.CreatedAt = n.closeLedger()
+	n.accounts[address] = newAccount(FriendbotAmount, int64(tx.Ledger)<<32)
+
+	hash := sha256.Sum256([]byte(Passphrase + " friendbot " + address))
+	tx.Hash = hex.EncodeToString(hash[:])
+	tx.Source = n.root.Address()
+	tx.Operations = 1
+	tx.Successful = true
+	tx.Payments = []Payment{{Type: "create_account", From: tx.Source, To: address, Amount: FriendbotAmount}}
+	n.txs = append(n.txs, tx)
+	return tx, nil
+}
+
+// Submit applies a transaction envelope encoded as base64 XDR. Transactions are checked the way stellar-core
+// checks them before they make it into a ledger and the ones that don't pass return a TxError without being
+// recorded. Transactions that fail in one of their operations are recorded as failed and are still charged
+// their fee
+func (n *Network) Submit(envelope string) (Transaction, error) {
+	var tx Transaction
+	var env xdr.TransactionEnvelope
+	err := xdr.SafeUnmarshalBase64(envelope, &env)
+	if err != nil {
+		return tx, errors.Wrap(err, "could not decode transaction envelope")
+	}
+
+	hash, err := network.HashTransaction(&env.Tx, Passphrase)
+	if err != nil {
+		return tx, errors.Wrap(err, "could not hash transaction")
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	source := env.Tx.SourceAccount.Address()
+	src, exists := n.accounts[source]
+	if !exists {
+		return tx, &TxError{Transaction: "tx_no_source_account"}
+	}
+
+	ops := env.Tx.Operations
+	if len(ops) == 0 {
+		return tx, &TxError{Transaction: "tx_missing_operation"}
+	}
+
+	if int64(env.Tx.SeqNum) != src.sequence+1 {
+		return tx, &TxError{Transaction: "tx_bad_seq"}
+	}
+
+	fee := int64(BaseFee * len(ops))
+	if int64(env.Tx.Fee) < fee {
+		return tx, &TxError{Transaction: "tx_insufficient_fee"}
+	}
+	if src.balance < fee {
+		return tx, &TxError{Transaction: "tx_insufficient_balance"}
+	}
+
+	signed := n.signedBy(hash, env.Signatures, source, ops)
+	if !n.authorized(source, signed, 0) {
+		return tx, &TxError{Transaction: "tx_bad_auth"}
+	}
+
+	codes := make([]string, len(ops))
+	authorized := true
+	for i, op := range ops {
+		codes[i] = "op_success"
+		if !n.authorized(opSource(op, source), signed, threshold(op)) {
+			codes[i] = "op_bad_auth"
+			authorized = false
+		}
+	}
+	if !authorized {
+		return tx, &TxError{Transaction: "tx_failed", Operations: codes}
+	}
+
+	// the fee is charged and the sequence number used up even if an operation fails
+	src.sequence = int64(env.Tx.SeqNum)
+	src.balance -= fee
+
+	tx.Hash = hex.EncodeToString(hash[:])
+	tx.Ledger, tx.CreatedAt = n.closeLedger()
+	tx.Source = source
+	tx.Envelope = envelope
+	tx.Operations = len(ops)
+	if text, ok := env.Tx.Memo.GetText(); ok {
+		tx.Memo = text
+	}
+
+	// operations are applied to a copy of the accounts so that a failed operation leaves no trace
+	state := make(ledger, len(n.accounts))
+	for address, acc := range n.accounts {
+		state[address] = acc.copy()
+	}
+
+	var payments []Payment
+	for i, op := range ops {
+		var payment *Payment
+		payment, codes[i] = state.apply(opSource(op, source), op, int64(tx.Ledger)<<32)
+		if codes[i] != "op_success" {
+			n.txs = append(n.txs, tx)
+			return tx, &TxError{Transaction: "tx_failed", Operations: codes[:i+1]}
+		}
+		if payment != nil {
+			payments = append(payments, *payment)
+		}
+	}
+
+	n.accounts = state
+	tx.Successful = true
+	tx.Payments = payments
+	n.txs = append(n.txs, tx)
+	return tx, nil
+}
+
+// opSource returns the source account of an operation, which is the transaction's unless the operation sets one
+func opSource(op xdr.Operation, txSource string) string {
+	if op.SourceAccount != nil {
+		return op.SourceAccount.Address()
+	}
+	return txSource
+}
+
+// threshold returns the threshold an operation needs to be signed with, 0 for low, 1 for medium and 2 for high
+func threshold(op xdr.Operation) int {
+	if op.Body.Type == xdr.OperationTypeSetOptions {
+		body := op.Body.MustSetOptionsOp()
+		if body.MasterWeight != nil || body.LowThreshold != nil || body.MedThreshold != nil ||
+			body.HighThreshold != nil || body.Signer != nil {
+			return 2
+		}
+	}
+	return 1
+}
+
+// signedBy returns the keys of the accounts involved in a transaction that signed it. Callers hold the lock
+func (n *Network) signedBy(hash [32]byte, sigs []xdr.DecoratedSignature, source string, ops []xdr.Operation) map[string]bool {
+	var keys []string
+	involved := map[string]bool{source: true}
+	for _, op := range ops {
+		involved[opSource(op, source)] = true
+	}
+	for address := range involved {
+		keys = append(keys, address)
+		if acc, exists := n.accounts[address]; exists {
+			for key := range acc.signers {
+				keys = append(keys, key)
+			}
+		}
+	}
+
+	signed := make(map[string]bool)
+	for _, key := range keys {
+		kp, err := keypair.Parse(key)
+		if err != nil {
+			continue
+		}
+		for _, sig := range sigs {
+			if [4]byte(sig.Hint) == kp.Hint() && kp.Verify(hash[:], sig.Signature) == nil {
+				signed[key] = true
+			}
+		}
+	}
+	return signed
+}
+
+// authorized checks whether the keys that signed a transaction carry enough weight to meet the passed threshold
+// of an account. Callers hold the lock
+func (n *Network) authorized(address string, signed map[string]bool, level int) bool {
+	acc, exists := n.accounts[address]
+	if !exists {
+		return false
+	}
+
+	var weight uint32
+	if signed[address] {
+		weight += acc.masterWeight
+	}
+	for key, w := range acc.signers {
+		if signed[key] {
+			weight += w
+		}
+	}
+	// at least one signer with a weight needs to have signed, even if the threshold is zero
+	return weight > 0 && weight >= acc.thresholds[level]
+}
+
+// ledger is the state of the accounts of the network operations are applied to
+type ledger map[string]*account
+
+// assetOf returns the code and issuer of an asset, which are empty for lumens
+func assetOf(asset xdr.Asset) (string, string, error) {
+	var assetType xdr.AssetType
+	var code, issuer string
+	err := asset.Extract(&assetType, &code, &issuer)
+	return code, issuer, err
+}
+
+// apply applies an operation and returns its result code along with the payment it made, if any
+func (l ledger) apply(source string, op xdr.Operation, sequence int64) (*Payment, string) {
+	src, exists := l[source]
+	if !exists {
+		return nil, "op_no_source_account"
+	}
+
+	switch op.Body.Type {
+	case xdr.OperationTypeCreateAccount:
+		body := op.Body.MustCreateAccountOp()
+		dest := body.Destination.Address()
+		amt := int64(body.StartingBalance)
+		if amt <= 0 {
+			return nil, "op_malformed"
+		}
+		if _, exists := l[dest]; exists {
+			return nil, "op_already_exists"
+		}
+		if amt < 2*BaseReserve {
+			return nil, "op_low_reserve"
+		}
+		if src.balance-amt < src.minBalance() {
+			return nil, "op_underfunded"
+		}
+		src.balance -= amt
+		l[dest] = newAccount(amt, sequence)
+		return &Payment{Type: "create_account", From: source, To: dest, Amount: amt}, "op_success"
+
+	case xdr.OperationTypePayment:
+		body := op.Body.MustPaymentOp()
+		dest := body.Destination.Address()
+		amt := int64(body.Amount)
+		code, issuer, err := assetOf(body.Asset)
+		if err != nil || amt <= 0 {
+			return nil, "op_malformed"
+		}
+		to, exists := l[dest]
+		if !exists {
+			return nil, "op_no_destination"
+		}
+		payment := &Payment{Type: "payment", From: source, To: dest, Code: code, Issuer: issuer, Amount: amt}
+
+		if code == "" {
+			if src.balance-amt < src.minBalance() {
+				return nil, "op_underfunded"
+			}
+			src.balance -= amt
+			to.balance += amt
+			return payment, "op_success"
+		}
+
+		if _, exists := l[issuer]; !exists {
+			return nil, "op_no_issuer"
+		}
+		asset := code + ":" + issuer
+		// payments out of the issuer's account issue the asset and payments into it burn the asset
+		if source != issuer {
+			line, trusts := src.lines[asset]
+			if !trusts {
+				return nil, "op_src_no_trust"
+			}
+			if line.balance < amt {
+				return nil, "op_underfunded"
+			}
+		}
+		if dest != issuer {
+			line, trusts := to.lines[asset]
+			if !trusts {
+				return nil, "op_no_trust"
+			}
+			if line.balance+amt > line.limit {
+				return nil, "op_line_full"
+			}
+		}
+		if source != issuer {
+			src.lines[asset].balance -= amt
+		}
+		if dest != issuer {
+			to.lines[asset].balance += amt
+		}
+		return payment, "op_success"
+
+	case xdr.OperationTypeChangeTrust:
+		body := op.Body.MustChangeTrustOp()
+		code, issuer, err := assetOf(body.Line)
+		limit := int64(body.Limit)
+		if err != nil || code == "" || limit < 0 || issuer == source {
+			return nil, "op_malformed"
+		}
+		if _, exists := l[issuer]; !exists {
+			return nil, "op_no_issuer"
+		}
+
+		asset := code + ":" + issuer
+		line, trusts := src.lines[asset]
+		switch {
+		case !trusts && limit == 0:
+			return nil, "op_invalid_limit"
+		case !trusts:
+			if src.balance < src.minBalance()+BaseReserve {
+				return nil, "op_low_reserve"
+			}
+			src.lines[asset] = &trustline{limit: limit}
+		case limit < line.balance:
+			return nil, "op_invalid_limit"
+		case limit == 0:
+			delete(src.lines, asset)
+		default:
+			line.limit = limit
+		}
+		return nil, "op_success"
+
+	case xdr.OperationTypeSetOptions:
+		body := op.Body.MustSetOptionsOp()
+		weights := []*xdr.Uint32{body.MasterWeight, body.LowThreshold, body.MedThreshold, body.HighThreshold}
+		for _, weight := range weights {
+			if weight != nil && *weight > 255 {
+				return nil, "op_threshold_out_of_range"
+			}
+		}
+
+		if body.Signer != nil {
+			if body.Signer.Key.Type != xdr.SignerKeyTypeSignerKeyTypeEd25519 || body.Signer.Weight > 255 {
+				return nil, "op_bad_signer"
+			}
+			key := body.Signer.Key.Address()
+			if key == source {
+				return nil, "op_bad_signer"
+			}
+			_, exists := src.signers[key]
+			switch {
+			case body.Signer.Weight == 0:
+				delete(src.signers, key)
+			case !exists && src.balance < src.minBalance()+BaseReserve:
+				return nil, "op_low_reserve"
+			default:
+				src.signers[key] = uint32(body.Signer.Weight)
+			}
+		}
+
+		if body.MasterWeight != nil {
+			src.masterWeight = uint32(*body.MasterWeight)
+		}
+		for i, weight := range weights[1:] {
+			if weight != nil {
+				src.thresholds[i] = uint32(*weight)
+			}
+		}
+		return nil, "op_success"
+	}
+
+	return nil, "op_not_supported"
+}
@@ -0,0 +1,139 @@
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"math/big"
+)
+
+// the filesystem and memory stores hash content the way ipfs add does with its defaults: the content is split
+// into chunks of 256KiB, each chunk becomes a unixfs file leaf, and the leaves are linked by a balanced tree of
+// dag-pb nodes with at most 174 links each. The CID is the base58 encoded sha256 multihash (CIDv0) of the root
+
+const (
+	// chunkSize is the size of the chunks content is split into
+	chunkSize = 256 * 1024
+
+	// maxLinks is the maximum number of links of a dag-pb node
+	maxLinks = 174
+)
+
+// dagNode is a node of the dag built from some content
+type dagNode struct {
+	data     []byte // the serialized node
+	hash     []byte // the multihash of the serialized node
+	fileSize uint64 // the size of the content below the node
+	dagSize  uint64 // the size of the serialized node and all nodes below it
+}
+
+// appendVarint appends a protobuf varint
+func appendVarint(buf []byte, x uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], x)
+	return append(buf, tmp[:n]...)
+}
+
+// appendBytesField appends a protobuf length delimited field
+func appendBytesField(buf []byte, field int, data []byte) []byte {
+	buf = appendVarint(buf, uint64(field<<3|2))
+	buf = appendVarint(buf, uint64(len(data)))
+	return append(buf, data...)
+}
+
+// appendVarintField appends a protobuf varint field
+func appendVarintField(buf []byte, field int, x uint64) []byte {
+	buf = appendVarint(buf, uint64(field<<3))
+	return appendVarint(buf, x)
+}
+
+// multihash returns the sha256 multihash of data
+func multihash(data []byte) []byte {
+	digest := sha256.Sum256(data)
+	return append([]byte{0x12, 0x20}, digest[:]...)
+}
+
+// newDagNode serializes a dag-pb node with a unixfs file as its data
+func newDagNode(content []byte, children []dagNode) dagNode {
+	var node dagNode
+	// unixfs Data message: Type = File, Data, filesize, blocksizes
+	unixfs := appendVarintField(nil, 1, 2)
+	if len(content) > 0 {
+		unixfs = appendBytesField(unixfs, 2, content)
+	}
+	node.fileSize = uint64(len(content))
+	for _, child := range children {
+		node.fileSize += child.fileSize
+	}
+	unixfs = appendVarintField(unixfs, 3, node.fileSize)
+	for _, child := range children {
+		unixfs = appendVarintField(unixfs, 4, child.fileSize)
+	}
+
+	// dag-pb PBNode: Links come before Data
+	for _, child := range children {
+		link := appendBytesField(nil, 1, child.hash)
+		link = appendBytesField(link, 2, nil)
+		link = appendVarintField(link, 3, child.dagSize)
+		node.data = appendBytesField(node.data, 2, link)
+		node.dagSize += child.dagSize
+	}
+	node.data = appendBytesField(node.data, 1, unixfs)
+	node.dagSize += uint64(len(node.data))
+	node.hash = multihash(node.data)
+	return node
+}
+
+// base58Alphabet is the bitcoin base58 alphabet used by CIDv0
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// base58 encodes data in base58
+func base58(data []byte) string {
+	x := new(big.Int).SetBytes(data)
+	base := big.NewInt(58)
+	mod := new(big.Int)
+	var out []byte
+	for x.Sign() > 0 {
+		x.DivMod(x, base, mod)
+		out = append(out, base58Alphabet[mod.Int64()])
+	}
+	for _, b := range data {
+		if b != 0 {
+			break
+		}
+		out = append(out, base58Alphabet[0])
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
+
+// CID returns the CIDv0 ipfs add gives data with its default settings
+func CID(data []byte) string {
+	var nodes []dagNode
+	for start := 0; start < len(data) || start == 0; start += chunkSize {
+		end := start + chunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		nodes = append(nodes, newDagNode(data[start:end], nil))
+		if end == len(data) {
+			break
+		}
+	}
+
+	// the balanced layout fills each node with as many full subtrees as it can hold, which is the same as
+	// grouping the nodes of each level from the left
+	for len(nodes) > 1 {
+		var parents []dagNode
+		for start := 0; start < len(nodes); start += maxLinks {
+			end := start + maxLinks
+			if end > len(nodes) {
+				end = len(nodes)
+			}
+			parents = append(parents, newDagNode(nil, nodes[start:end]))
+		}
+		nodes = parents
+	}
+	return base58(nodes[0].hash)
+}
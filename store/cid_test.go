@@ -0,0 +1,65 @@
+package store
+
+import (
+	"testing"
+)
+
+// testContent returns size bytes of content that differs from chunk to chunk
+func testContent(size int) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	return data
+}
+
+func TestCIDVectors(t *testing.T) {
+	// CIDs given by ipfs add with its default settings
+	vectors := []struct {
+		data string
+		cid  string
+	}{
+		{"", "QmbFMke1KXqnYyBBWxB74N4c5SBnJMVAiMNRcGu6x1AwQH"},
+		{"hello world", "Qmf412jQZiuVUtdgnB36FXFX7xg5V6KEbSJ4dpQuhkLyfD"},
+		{"hello world\n", "QmT78zSuBmuS4z925WZfrqQ1qHaJ56DQaTfyMUF7F8ff5o"},
+	}
+
+	for _, vector := range vectors {
+		if cid := CID([]byte(vector.data)); cid != vector.cid {
+			t.Fatalf("CID of %q is %s, expected %s", vector.data, cid, vector.cid)
+		}
+	}
+}
+
+func TestCIDMultiChunk(t *testing.T) {
+	data := testContent(2*chunkSize + 10)
+	leaves := []dagNode{
+		newDagNode(data[:chunkSize], nil),
+		newDagNode(data[chunkSize:2*chunkSize], nil),
+		newDagNode(data[2*chunkSize:], nil),
+	}
+
+	// content that fits in a chunk is a single leaf
+	if CID(data[:chunkSize]) != base58(leaves[0].hash) {
+		t.Fatalf("CID of a single chunk isn't the hash of its leaf")
+	}
+
+	root := newDagNode(nil, leaves)
+	if root.fileSize != uint64(len(data)) {
+		t.Fatalf("root holds %d bytes, expected %d", root.fileSize, len(data))
+	}
+	if cid := CID(data); cid != base58(root.hash) {
+		t.Fatalf("CID of three chunks is %s, expected the root linking their leaves %s", cid, base58(root.hash))
+	}
+
+	// one more chunk than a node can link to needs another level
+	data = testContent((maxLinks + 1) * chunkSize)
+	var level []dagNode
+	for i := 0; i <= maxLinks; i++ {
+		level = append(level, newDagNode(data[i*chunkSize:(i+1)*chunkSize], nil))
+	}
+	root = newDagNode(nil, []dagNode{newDagNode(nil, level[:maxLinks]), newDagNode(nil, level[maxLinks:])})
+	if cid := CID(data); cid != base58(root.hash) {
+		t.Fatalf("CID of %d chunks is %s, expected %s", maxLinks+1, cid, base58(root.hash))
+	}
+}
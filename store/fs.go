@@ -0,0 +1,73 @@
+package store
+
+import (
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FSStore stores content in files named by their CID, for sites that don't run an ipfs node
+type FSStore struct {
+	dir string
+}
+
+// NewFSStore returns a store that keeps content in dir
+func NewFSStore(dir string) (*FSStore, error) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create store directory")
+	}
+	return &FSStore{dir: dir}, nil
+}
+
+// path returns the file a CID is stored in
+func (s *FSStore) path(hash string) (string, error) {
+	if hash == "" || strings.ContainsAny(hash, "/\\.") {
+		return "", errors.New("invalid hash " + hash)
+	}
+	return filepath.Join(s.dir, hash), nil
+}
+
+// Add writes data to the file named by its CID
+func (s *FSStore) Add(data []byte) (string, error) {
+	hash := CID(data)
+	path, err := s.path(hash)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		return hash, nil
+	}
+
+	// write to a temporary file first so that a crash doesn't leave a partial file under the hash
+	tmp := path + ".tmp"
+	err = ioutil.WriteFile(tmp, data, 0600)
+	if err != nil {
+		return "", errors.Wrap(err, "could not write "+hash)
+	}
+	err = os.Rename(tmp, path)
+	if err != nil {
+		return "", errors.Wrap(err, "could not write "+hash)
+	}
+	return hash, nil
+}
+
+// Get reads the file named by a CID and checks that its content still matches the CID
+func (s *FSStore) Get(hash string) ([]byte, error) {
+	path, err := s.path(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read "+hash)
+	}
+	if CID(data) != hash {
+		return nil, errors.New("content stored under " + hash + " has been changed")
+	}
+	return data, nil
+}
@@ -0,0 +1,43 @@
+package store
+
+import (
+	"bytes"
+	"github.com/pkg/errors"
+	"io/ioutil"
+
+	shell "github.com/ipfs/go-ipfs-api"
+)
+
+// IPFSStore stores content on an ipfs node
+type IPFSStore struct {
+	sh *shell.Shell
+}
+
+// NewIPFSStore returns a store that talks to the ipfs node whose api listens at api
+func NewIPFSStore(api string) *IPFSStore {
+	return &IPFSStore{sh: shell.NewShell(api)}
+}
+
+// Add adds data to ipfs
+func (s *IPFSStore) Add(data []byte) (string, error) {
+	hash, err := s.sh.Add(bytes.NewReader(data))
+	if err != nil {
+		return "", errors.Wrap(err, "could not add data to ipfs")
+	}
+	return hash, nil
+}
+
+// Get reads data from ipfs
+func (s *IPFSStore) Get(hash string) ([]byte, error) {
+	reader, err := s.sh.Cat(hash)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get "+hash+" from ipfs")
+	}
+	defer reader.Close()
+
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read "+hash+" from ipfs")
+	}
+	return data, nil
+}
@@ -0,0 +1,37 @@
+package store
+
+import (
+	"github.com/pkg/errors"
+	"sync"
+)
+
+// MemoryStore keeps content in memory. It is meant for tests
+type MemoryStore struct {
+	sync.RWMutex
+	content map[string][]byte
+}
+
+// NewMemoryStore returns an empty memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{content: make(map[string][]byte)}
+}
+
+// Add keeps a copy of data under its CID
+func (s *MemoryStore) Add(data []byte) (string, error) {
+	hash := CID(data)
+	s.Lock()
+	defer s.Unlock()
+	s.content[hash] = append([]byte(nil), data...)
+	return hash, nil
+}
+
+// Get returns a copy of the data kept under a CID
+func (s *MemoryStore) Get(hash string) ([]byte, error) {
+	s.RLock()
+	defer s.RUnlock()
+	data, exists := s.content[hash]
+	if !exists {
+		return nil, errors.New(hash + " not found")
+	}
+	return append([]byte(nil), data...), nil
+}
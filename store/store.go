@@ -0,0 +1,70 @@
+package store
+
+import (
+	"github.com/pkg/errors"
+)
+
+// the store keeps content like teller state, hashchain blocks and project documents addressed by hash. The
+// hashes are ipfs CIDs no matter which backend is used, so content added to the filesystem or memory store can
+// be moved to ipfs later and keep its hash. The ipfs backend is used unless another is set with SetStore.
+
+// Store stores content addressed by its CID
+type Store interface {
+	// Add stores data and returns its CID
+	Add(data []byte) (string, error)
+	// Get returns the data stored under a CID
+	Get(hash string) ([]byte, error)
+}
+
+// DefaultIPFSAPI is the address of the api of the ipfs node used by default
+var DefaultIPFSAPI = "localhost:5001"
+
+// store is the store used by the package level functions
+var store Store = NewIPFSStore(DefaultIPFSAPI)
+
+// SetStore sets the store used by the package level functions
+func SetStore(s Store) {
+	store = s
+}
+
+// New returns a store with the given backend. location is the address of the ipfs api for the ipfs backend and
+// the directory content is stored in for the fs backend, the memory backend doesn't need one
+func New(backend string, location string) (Store, error) {
+	switch backend {
+	case "", "ipfs":
+		if location == "" {
+			location = DefaultIPFSAPI
+		}
+		return NewIPFSStore(location), nil
+	case "fs":
+		if location == "" {
+			return nil, errors.New("fs store needs a directory")
+		}
+		return NewFSStore(location)
+	case "memory":
+		return NewMemoryStore(), nil
+	default:
+		return nil, errors.New("store backend " + backend + " not supported")
+	}
+}
+
+// Add stores data and returns its CID
+func Add(data []byte) (string, error) {
+	return store.Add(data)
+}
+
+// AddString stores a string and returns its CID
+func AddString(data string) (string, error) {
+	return store.Add([]byte(data))
+}
+
+// Get returns the data stored under a CID
+func Get(hash string) ([]byte, error) {
+	return store.Get(hash)
+}
+
+// GetString returns the string stored under a CID
+func GetString(hash string) (string, error) {
+	data, err := store.Get(hash)
+	return string(data), err
+}
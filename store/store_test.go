@@ -0,0 +1,102 @@
+package store
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testRoundTrip adds content to a store and checks that it is returned as it was added
+func testRoundTrip(t *testing.T, s Store) {
+	for _, data := range [][]byte{[]byte("hello world\n"), testContent(chunkSize + 1), {}} {
+		hash, err := s.Add(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hash != CID(data) {
+			t.Fatalf("content stored under %s, expected its CID %s", hash, CID(data))
+		}
+
+		// adding the same content again returns the same hash
+		again, err := s.Add(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if again != hash {
+			t.Fatalf("same content stored under %s and %s", hash, again)
+		}
+
+		stored, err := s.Get(hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(stored, data) {
+			t.Fatalf("content stored under %s changed", hash)
+		}
+	}
+
+	_, err := s.Get("QmbFMke1KXqnYyBBWxB74N4c5SBnJMVAiMNRcGu6x1AwQX")
+	if err == nil {
+		t.Fatalf("store returned content that was never added")
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	s := NewMemoryStore()
+	testRoundTrip(t, s)
+
+	// callers can't change the content kept by the store
+	data := []byte("hello world\n")
+	hash, err := s.Add(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[0] = 'j'
+	stored, err := s.Get(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored[1] = 'a'
+	stored, err = s.Get(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(stored) != "hello world\n" {
+		t.Fatalf("content kept by the memory store changed to %q", stored)
+	}
+}
+
+func TestFSStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "opensolar-store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := NewFSStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testRoundTrip(t, s)
+
+	_, err = s.Get("../" + CID(nil))
+	if err == nil {
+		t.Fatalf("fs store read a file outside its directory")
+	}
+
+	// content changed on disk doesn't match its CID anymore
+	hash, err := s.Add([]byte("hello world\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, hash), []byte("jello world\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.Get(hash)
+	if err == nil {
+		t.Fatalf("fs store returned content that was changed on disk")
+	}
+}
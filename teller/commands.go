@@ -39,7 +39,7 @@ func ParseInput(input []string) {
 		// each time we start the teller
 		log.Fatal("qq emergency exit")
 	case "help":
-		fmt.Println("List of commands: ping, receive, display, info, update")
+		fmt.Println("List of commands: ping, receive, display, info, update, hh, verify")
 	case "ping":
 		err := PingRpc()
 		if err != nil {
@@ -127,5 +127,16 @@ func ParseInput(input []string) {
 			return
 		}
 		log.Println("HASHCHAIN HEADER: ", HashChainHeader)
+	case "verify":
+		// walks the hashchain back from the header served on /hash
+		if len(input) > 2 {
+			fmt.Println("USAGE: verify <teller url or ipfs hash>")
+			return
+		}
+		target := HashChainHeader
+		if len(input) == 2 {
+			target = input[1]
+		}
+		verifyHashChain(target)
 	}
 }
@@ -8,6 +8,8 @@ import (
 	utils "github.com/Varunram/essentials/utils"
 
 	wallet "github.com/YaleOpenLab/openx/chains/xlm/wallet"
+
+	store "github.com/YaleOpenLab/opensolar/store"
 )
 
 // StartTeller starts the teller
@@ -104,6 +106,20 @@ func StartTeller() error {
 		return errors.Wrap(err, "could not get device id from local storage")
 	}
 
+	// the content store the teller's state and hashchain are kept in, flags take precedence over the config
+	if opts.Store == "" && viper.IsSet("store") {
+		err = setStore(viper.GetString("store"), viper.GetString("storepath"))
+		if err != nil {
+			return errors.Wrap(err, "could not set up content store")
+		}
+	}
+
+	// open the queue of requests that haven't reached the platform or the blockchain yet
+	err = OpenQueue()
+	if err != nil {
+		return errors.Wrap(err, "could not open queue")
+	}
+
 	err = StoreStartTime()
 	if err != nil {
 		return errors.Wrap(err, "could not store start time locally")
@@ -122,6 +138,23 @@ func StartTeller() error {
 		return errors.Wrap(err, "could not store platform email")
 	}
 
+	// connect to the meter with the driver picked in the config
+	err = LoadMeter()
+	if err != nil {
+		return errors.Wrap(err, "could not load meter")
+	}
+
 	DeviceInfo = "Raspberry Pi3 Model B+"
 	return nil
 }
+
+// setStore sets the content store the teller keeps its state and hashchain in
+func setStore(backend string, location string) error {
+	s, err := store.New(backend, location)
+	if err != nil {
+		return err
+	}
+	store.SetStore(s)
+	ColorOutput("USING CONTENT STORE: "+backend, GreenColor)
+	return nil
+}
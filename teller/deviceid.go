@@ -1,17 +1,27 @@
 package main
 
 import (
+	"crypto/ed25519"
 	"crypto/rand"
 	"encoding/hex"
 	"github.com/pkg/errors"
+	"io/ioutil"
 	"log"
 	"os"
 	"strings"
 
+	utils "github.com/Varunram/essentials/utils"
+
 	consts "github.com/YaleOpenLab/opensolar/consts"
+	core "github.com/YaleOpenLab/opensolar/core"
 )
 
-// deviceid sets the deviceid and stores it in a retrievable location
+// deviceid sets the deviceid and stores it in a retrievable location along with the device's signing key.
+// The platform binds the public key to the recipient when the device id is set and only accepts readings
+// and payments from the teller that are signed with the key
+
+// DeviceKey is the private key the teller signs its readings and payments with
+var DeviceKey ed25519.PrivateKey
 
 // GenerateRandomString generates a random string of length _n_
 func GenerateRandomString(n int) (string, error) {
@@ -57,12 +67,66 @@ func CheckDeviceID() error {
 			return errors.Wrap(err, "could not write device id to file")
 		}
 		file.Close()
-		err = SetDeviceId(LocalRecipient.U.Username, LocalRecipient.U.Pwhash, deviceId)
+	}
+
+	deviceId, err := GetDeviceID()
+	if err != nil {
+		return errors.Wrap(err, "could not read device id")
+	}
+
+	// tellers set up before devices had keys generate one now
+	DeviceKey, err = LoadDeviceKey()
+	if err != nil {
+		return errors.Wrap(err, "could not load device key")
+	}
+
+	pubkey := hex.EncodeToString(DeviceKey.Public().(ed25519.PublicKey))
+	err = SetDeviceId(LocalRecipient.U.Username, LocalRecipient.U.Pwhash, deviceId, pubkey)
+	if err != nil {
+		return errors.Wrap(err, "could not store device id in remote platform")
+	}
+	return nil
+}
+
+// LoadDeviceKey reads the device's signing key from storage and generates one if there is none
+func LoadDeviceKey() (ed25519.PrivateKey, error) {
+	path := consts.TellerHomeDir + "/devicekey.hex"
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not generate device key")
+		}
+		err = ioutil.WriteFile(path, []byte(hex.EncodeToString(key)), 0600)
 		if err != nil {
-			return errors.Wrap(err, "could not store device id in remote platform")
+			return nil, errors.Wrap(err, "could not write device key to file")
 		}
+		ColorOutput("GENERATED DEVICE KEY", GreenColor)
+		return key, nil
 	}
-	return nil
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read device key file")
+	}
+
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != ed25519.PrivateKeySize {
+		return nil, errors.New("device key file is corrupted")
+	}
+	return ed25519.PrivateKey(key), nil
+}
+
+// SignMessage signs a message with the device key and returns the hex encoded signature
+func SignMessage(message []byte) string {
+	return hex.EncodeToString(ed25519.Sign(DeviceKey, message))
+}
+
+// SignRequest signs the params of a request made at unix time timestamp with the device key
+func SignRequest(timestamp int64, params ...string) (string, error) {
+	timestampString, err := utils.ToString(timestamp)
+	if err != nil {
+		return "", err
+	}
+	return SignMessage(core.DeviceMessage(append(params, timestampString)...)), nil
 }
 
 // GetDeviceID retrieves the deviceId from storage
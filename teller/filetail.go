@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bufio"
+	"github.com/pkg/errors"
+	"github.com/tarm/serial"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	opensolar "github.com/YaleOpenLab/opensolar/core"
+)
+
+// lineDriver reads a meter that writes one reading per line, either to a serial line or to a file that the
+// teller tails. Lines are in the json or csv form accepted by parseMeterPayload
+
+type lineDriver struct {
+	source  io.ReadCloser
+	reader  *bufio.Reader
+	partial string
+	tail    bool
+}
+
+// newSerialDriver opens the serial line the meter writes its readings to
+func newSerialDriver(config MeterConfig) (MeterDriver, error) {
+	port, err := serial.OpenPort(&serial.Config{Name: config.Address, Baud: config.BaudRate})
+	if err != nil {
+		return nil, errors.Wrap(err, "could not open serial port")
+	}
+	return &lineDriver{source: port, reader: bufio.NewReader(port)}, nil
+}
+
+// newFileDriver opens the file the meter's readings are appended to. Only readings written after the teller
+// starts are read
+func newFileDriver(config MeterConfig) (MeterDriver, error) {
+	file, err := os.Open(config.Path)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not open meter file")
+	}
+
+	_, err = file.Seek(0, io.SeekEnd)
+	if err != nil {
+		file.Close()
+		return nil, errors.Wrap(err, "could not seek to the end of the meter file")
+	}
+	return &lineDriver{source: file, reader: bufio.NewReader(file), tail: true}, nil
+}
+
+// Read waits for the next line and parses it
+func (d *lineDriver) Read() (opensolar.MeterReading, error) {
+	for {
+		line, err := d.reader.ReadString('\n')
+		d.partial += line
+		if err == io.EOF && d.tail {
+			// wait for the meter to write more
+			time.Sleep(time.Second)
+			continue
+		}
+		if err != nil {
+			return opensolar.MeterReading{}, errors.Wrap(err, "could not read meter")
+		}
+
+		line, d.partial = d.partial, ""
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		return parseMeterPayload([]byte(line))
+	}
+}
+
+// Close closes the serial line or file
+func (d *lineDriver) Close() error {
+	return d.source.Close()
+}
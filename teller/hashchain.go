@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"strconv"
+
+	utils "github.com/Varunram/essentials/utils"
+
+	consts "github.com/YaleOpenLab/opensolar/consts"
+	store "github.com/YaleOpenLab/opensolar/store"
+)
+
+// the data the teller reads off the meter is kept in a hash chain of blocks stored in the content store. The block being
+// written to lives in data.txt in the teller's home directory and is made up of lines:
+// 1. a header {"type":"header","version":1,"seq":n,"prev":"<hash>","device":"<device id>","start":<unix>}
+//    where seq counts blocks from 0 and prev is the ipfs hash of block n-1, empty for the first block
+// 2. one line per record, each a json encoded meter reading
+// 3. once the block is full or the teller shuts down, a footer
+//    {"type":"footer","seq":n,"records":<count>,"sha256":"<hex>","end":<unix>}
+//    where sha256 is the hash of the record lines including their newlines
+// The sealed block is added to the store and its hash becomes the HashChainHeader served on /hash, which lets
+// anyone walk the chain back to the first block and check that nothing was left out or changed.
+
+// hashChainVersion is the version of the block format
+const hashChainVersion = 1
+
+// BlockHeader is the first line of a block
+type BlockHeader struct {
+	Type    string `json:"type"`
+	Version int    `json:"version"`
+	Seq     uint64 `json:"seq"`
+	Prev    string `json:"prev"`
+	Device  string `json:"device"`
+	Start   int64  `json:"start"`
+}
+
+// BlockFooter is the last line of a sealed block
+type BlockFooter struct {
+	Type        string `json:"type"`
+	Seq         uint64 `json:"seq"`
+	Records     int    `json:"records"`
+	ContentHash string `json:"sha256"`
+	End         int64  `json:"end"`
+}
+
+// Block is a block of the hash chain split into its parts
+type Block struct {
+	Header  BlockHeader
+	Records [][]byte
+	Footer  *BlockFooter
+}
+
+// dataPath returns the path of the block being written to
+func dataPath() string {
+	return consts.TellerHomeDir + "/data.txt"
+}
+
+// contentHash returns the hash of the record lines of a block
+func contentHash(records [][]byte) string {
+	h := sha256.New()
+	for _, record := range records {
+		h.Write(record)
+		h.Write([]byte("\n"))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ParseBlock splits a block into its header, records and footer. The footer is nil if the block hasn't been
+// sealed yet
+func ParseBlock(data []byte) (Block, error) {
+	var block Block
+	var lines [][]byte
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := make([]byte, len(scanner.Bytes()))
+		copy(line, scanner.Bytes())
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return block, errors.Wrap(err, "could not read block")
+	}
+
+	if len(lines) == 0 {
+		return block, errors.New("block is empty")
+	}
+
+	err := json.Unmarshal(lines[0], &block.Header)
+	if err != nil || block.Header.Type != "header" {
+		return block, errors.New("block doesn't start with a header")
+	}
+	if block.Header.Version != hashChainVersion {
+		return block, errors.New("block version " + strconv.Itoa(block.Header.Version) + " not supported")
+	}
+
+	lines = lines[1:]
+	if len(lines) > 0 {
+		var footer BlockFooter
+		err = json.Unmarshal(lines[len(lines)-1], &footer)
+		if err == nil && footer.Type == "footer" {
+			block.Footer = &footer
+			lines = lines[:len(lines)-1]
+		}
+	}
+	block.Records = lines
+	return block, nil
+}
+
+// newBlock starts a new block with sequence number seq that links to the block with hash prev
+func newBlock(seq uint64, prev string) error {
+	header, err := json.Marshal(BlockHeader{
+		Type:    "header",
+		Version: hashChainVersion,
+		Seq:     seq,
+		Prev:    prev,
+		Device:  DeviceId,
+		Start:   utils.Unix(),
+	})
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(dataPath(), append(header, '\n'), 0600)
+	if err != nil {
+		return errors.Wrap(err, "could not start new block")
+	}
+	HashChainHeader = prev
+	return nil
+}
+
+// openDataLocal opens the block being written to. A block left behind by an earlier run is picked up where
+// it stopped, and data in the old format starts a new chain
+func openDataLocal() error {
+	data, err := ioutil.ReadFile(dataPath())
+	if err != nil && !os.IsNotExist(err) {
+		// don't start the teller if we can't read the last known hash since this would break continuity
+		return errors.Wrap(err, "could not read data file")
+	}
+
+	if err == nil {
+		block, err := ParseBlock(data)
+		switch {
+		case err != nil:
+			// keep data we can't continue from around for whoever wants to audit it
+			err = os.Rename(dataPath(), dataPath()+"."+strconv.FormatInt(utils.Unix(), 10)+".old")
+			if err != nil {
+				return errors.Wrap(err, "could not move old data file")
+			}
+			err = newBlock(0, "")
+		case block.Footer != nil:
+			// sealed by hand or by an older teller but not added to the store
+			_, err = sealBlock()
+			return err
+		default:
+			HashChainHeader = block.Header.Prev
+		}
+		if err != nil {
+			return err
+		}
+	} else {
+		err = newBlock(0, "")
+		if err != nil {
+			return err
+		}
+	}
+
+	dataFile, err = os.OpenFile(dataPath(), os.O_APPEND|os.O_WRONLY, 0600)
+	return err
+}
+
+// sealBlock writes the footer of the block being written to, adds it to the store and starts the next block. It
+// returns the hash of the sealed block
+func sealBlock() (string, error) {
+	if dataFile != nil {
+		dataFile.Close()
+		dataFile = nil
+	}
+
+	data, err := ioutil.ReadFile(dataPath())
+	if err != nil {
+		return "", errors.Wrap(err, "could not read block")
+	}
+
+	block, err := ParseBlock(data)
+	if err != nil {
+		return "", err
+	}
+
+	if block.Footer == nil {
+		footer, err := json.Marshal(BlockFooter{
+			Type:        "footer",
+			Seq:         block.Header.Seq,
+			Records:     len(block.Records),
+			ContentHash: contentHash(block.Records),
+			End:         utils.Unix(),
+		})
+		if err != nil {
+			return "", err
+		}
+		data = append(data, append(footer, '\n')...)
+	}
+
+	hash, err := store.Add(data)
+	if err != nil {
+		// keep writing to the block and try to seal it again once more data comes in
+		var ferr error
+		dataFile, ferr = os.OpenFile(dataPath(), os.O_APPEND|os.O_WRONLY, 0600)
+		if ferr != nil {
+			dataFile = nil
+		}
+		return "", errors.Wrap(err, "could not add block to store")
+	}
+
+	err = newBlock(block.Header.Seq+1, hash)
+	if err != nil {
+		return hash, err
+	}
+
+	dataFile, err = os.OpenFile(dataPath(), os.O_APPEND|os.O_WRONLY, 0600)
+	return hash, err
+}
+
+// BlockReport is the result of verifying a block of the hash chain
+type BlockReport struct {
+	Hash     string
+	Seq      uint64
+	Records  int
+	Problems []string
+}
+
+// ChainReport is the result of verifying a hash chain from its head back to the first block
+type ChainReport struct {
+	Head     string
+	Blocks   []BlockReport // the blocks that could be read, newest first
+	Problems []string      // gaps and broken links between blocks
+}
+
+// Ok checks whether the chain is complete and none of its blocks have been tampered with
+func (report ChainReport) Ok() bool {
+	if len(report.Problems) != 0 {
+		return false
+	}
+	for _, block := range report.Blocks {
+		if len(block.Problems) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// verifyBlock checks that a block is sealed and that its records match its footer
+func verifyBlock(block Block) []string {
+	var problems []string
+	for i, record := range block.Records {
+		if !json.Valid(record) {
+			problems = append(problems, "record "+strconv.Itoa(i)+" isn't valid json")
+		}
+	}
+
+	footer := block.Footer
+	if footer == nil {
+		return append(problems, "block isn't sealed")
+	}
+	if footer.Seq != block.Header.Seq {
+		problems = append(problems, "footer seq "+strconv.FormatUint(footer.Seq, 10)+" doesn't match header")
+	}
+	if footer.Records != len(block.Records) {
+		problems = append(problems, "footer counts "+strconv.Itoa(footer.Records)+" records but block has "+
+			strconv.Itoa(len(block.Records)))
+	}
+	if footer.ContentHash != contentHash(block.Records) {
+		problems = append(problems, "records don't match the hash in the footer")
+	}
+	if footer.End < block.Header.Start {
+		problems = append(problems, "block ends before it starts")
+	}
+	return problems
+}
+
+// VerifyHashChain walks the hash chain back from head using fetch to read blocks and reports gaps in the
+// sequence numbers, broken links and blocks whose records have been changed
+func VerifyHashChain(head string, fetch func(hash string) ([]byte, error)) ChainReport {
+	report := ChainReport{Head: head}
+	if head == "" {
+		report.Problems = append(report.Problems, "no blocks have been sealed yet")
+		return report
+	}
+
+	seen := make(map[string]bool)
+	var later *Block
+	for hash := head; hash != ""; {
+		if seen[hash] {
+			report.Problems = append(report.Problems, "block "+hash+" links back to a later block")
+			break
+		}
+		seen[hash] = true
+
+		data, err := fetch(hash)
+		if err != nil {
+			report.Problems = append(report.Problems, "could not fetch block "+hash+", blocks before it can't be verified: "+
+				err.Error())
+			break
+		}
+
+		block, err := ParseBlock(data)
+		if err != nil {
+			report.Problems = append(report.Problems, "block "+hash+" isn't a hashchain block: "+err.Error())
+			break
+		}
+
+		blockReport := BlockReport{Hash: hash, Seq: block.Header.Seq, Records: len(block.Records)}
+		blockReport.Problems = verifyBlock(block)
+
+		if later != nil {
+			if block.Header.Seq+1 != later.Header.Seq {
+				report.Problems = append(report.Problems, "gap between block "+strconv.FormatUint(block.Header.Seq, 10)+
+					" and block "+strconv.FormatUint(later.Header.Seq, 10))
+			}
+			if block.Header.Device != later.Header.Device {
+				report.Problems = append(report.Problems, "device changes from "+block.Header.Device+" to "+
+					later.Header.Device+" after block "+strconv.FormatUint(block.Header.Seq, 10))
+			}
+			if block.Footer != nil && later.Header.Start < block.Footer.End {
+				report.Problems = append(report.Problems, "block "+strconv.FormatUint(later.Header.Seq, 10)+
+					" starts before the block before it ends")
+			}
+		}
+
+		if block.Header.Prev == "" && block.Header.Seq != 0 {
+			report.Problems = append(report.Problems, "chain starts at block "+strconv.FormatUint(block.Header.Seq, 10)+
+				", earlier blocks are missing")
+		}
+
+		report.Blocks = append(report.Blocks, blockReport)
+		later = &block
+		hash = block.Header.Prev
+	}
+	return report
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// testBlock returns a block with sequence number seq that links to prev and holds two records. The block
+// starts at 100*seq and ends 50 seconds later
+func testBlock(t *testing.T, seq uint64, prev string, sealed bool) []byte {
+	header, err := json.Marshal(BlockHeader{Type: "header", Version: hashChainVersion, Seq: seq, Prev: prev,
+		Device: "TESTDEVICE", Start: int64(seq) * 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var records [][]byte
+	for i := 0; i < 2; i++ {
+		records = append(records, []byte(`{"seq":`+strconv.FormatUint(seq, 10)+`,"energy":10}`))
+	}
+
+	data := append(header, '\n')
+	for _, record := range records {
+		data = append(data, append(record, '\n')...)
+	}
+	if !sealed {
+		return data
+	}
+
+	footer, err := json.Marshal(BlockFooter{Type: "footer", Seq: seq, Records: len(records),
+		ContentHash: contentHash(records), End: int64(seq)*100 + 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(data, append(footer, '\n')...)
+}
+
+// testFetch returns a fetch function for VerifyHashChain that serves blocks stored as b0, b1 and so on
+func testFetch(blocks ...[]byte) func(hash string) ([]byte, error) {
+	return func(hash string) ([]byte, error) {
+		for i, block := range blocks {
+			if hash == "b"+strconv.Itoa(i) {
+				return block, nil
+			}
+		}
+		return nil, errors.New("block not found")
+	}
+}
+
+func TestParseBlock(t *testing.T) {
+	wrongVersion, err := json.Marshal(BlockHeader{Type: "header", Version: hashChainVersion + 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name    string
+		data    []byte
+		records int
+		sealed  bool
+		err     bool
+	}{
+		{"sealed block", testBlock(t, 1, "b0", true), 2, true, false},
+		{"unsealed block", testBlock(t, 1, "b0", false), 2, false, false},
+		{"empty block", nil, 0, false, true},
+		{"no header", []byte(`{"seq":1,"energy":10}` + "\n"), 0, false, true},
+		{"unsupported version", append(wrongVersion, '\n'), 0, false, true},
+	}
+
+	for _, c := range cases {
+		block, err := ParseBlock(c.data)
+		if c.err {
+			if err == nil {
+				t.Fatalf("%s: block parsed although it should error out", c.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if len(block.Records) != c.records || (block.Footer != nil) != c.sealed {
+			t.Fatalf("%s: block has %d records and sealed %t, expected %d and %t", c.name, len(block.Records),
+				block.Footer != nil, c.records, c.sealed)
+		}
+	}
+}
+
+func TestVerifyHashChain(t *testing.T) {
+	b0 := testBlock(t, 0, "", true)
+	b1 := testBlock(t, 1, "b0", true)
+	b2 := testBlock(t, 2, "b1", true)
+	tampered := bytes.Replace(b1, []byte(`"energy":10`), []byte(`"energy":99`), 1)
+
+	cases := []struct {
+		name    string
+		fetch   func(hash string) ([]byte, error)
+		problem string // a problem the report must contain, empty if the chain is intact
+	}{
+		{"intact chain", testFetch(b0, b1, b2), ""},
+		{"tampered record", testFetch(b0, tampered, b2), "records don't match the hash in the footer"},
+		{"gap in the sequence", testFetch(b0, b1, testBlock(t, 3, "b1", true)), "gap between block 1 and block 3"},
+		{"broken link", testFetch(b0, b1, testBlock(t, 2, "b9", true)), "could not fetch block b9"},
+		{"unsealed head", testFetch(b0, b1, testBlock(t, 2, "b1", false)), "block isn't sealed"},
+	}
+
+	for _, c := range cases {
+		report := VerifyHashChain("b2", c.fetch)
+		if c.problem == "" {
+			if !report.Ok() || len(report.Blocks) != 3 {
+				t.Fatalf("%s: chain not verified: %v", c.name, report)
+			}
+			continue
+		}
+
+		if report.Ok() {
+			t.Fatalf("%s: chain verified although it shouldn't be", c.name)
+		}
+		problems := report.Problems
+		for _, block := range report.Blocks {
+			problems = append(problems, block.Problems...)
+		}
+		found := false
+		for _, problem := range problems {
+			if strings.Contains(problem, c.problem) {
+				found = true
+			}
+		}
+		if !found {
+			t.Fatalf("%s: problems %v don't include %q", c.name, problems, c.problem)
+		}
+	}
+
+	report := VerifyHashChain("", testFetch())
+	if report.Ok() {
+		t.Fatalf("chain without sealed blocks verified")
+	}
+}
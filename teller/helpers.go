@@ -1,22 +1,20 @@
 package main
 
 import (
-	"bufio"
 	//"bytes"
-	"io/ioutil"
+	"github.com/pkg/errors"
 	"log"
-	"net/http"
 	"os"
 	"time"
 	//"encoding/json"
 
-	ipfs "github.com/Varunram/essentials/ipfs"
 	utils "github.com/Varunram/essentials/utils"
 	xlm "github.com/YaleOpenLab/openx/chains/xlm"
 	//	rpc "github.com/YaleOpenLab/openx/rpc"
 
 	consts "github.com/YaleOpenLab/opensolar/consts"
-	oracle "github.com/YaleOpenLab/opensolar/oracle"
+	opensolar "github.com/YaleOpenLab/opensolar/core"
+	store "github.com/YaleOpenLab/opensolar/store"
 )
 
 // BlockStamp gets the latest block hash
@@ -56,7 +54,7 @@ func endHandler() error {
 		"Ipfs HashChainHeader: " + HashChainHeader
 	// note that we don't commit the latest hash chain header's hash here because this gives us a tighter timeline
 	// to audit what really happened
-	ipfsHash, err := ipfs.IpfsAddString(hashString)
+	ipfsHash, err := store.AddString(hashString)
 	if err != nil {
 		log.Println(err)
 	}
@@ -72,6 +70,13 @@ func endHandler() error {
 		log.Println(err)
 	}
 
+	if Meter != nil {
+		err = Meter.Close()
+		if err != nil {
+			log.Println(err)
+		}
+	}
+
 	commitDataShutdown()
 	// save last known state of the system in the recipient's list of known hashes
 	// Call this last since there would still be data that we want ot measure when the above commands
@@ -102,13 +107,33 @@ func splitAndSend2Tx(memo string) (string, string, error) {
 func checkPayback() {
 	for {
 		log.Println("Paybck interval reached. Paying back automatically")
-		assetName := LocalProject.DebtAssetCode
-		amount := oracle.MonthlyBill() // TODO: consumption data must be accumulated from zigbee in the future
-
-		err := ProjectPayback(assetName, amount)
+		// pick up whether the project has been disconnected for missed payments. Payments go on while it is
+		// disconnected since catching up on them reconnects the project
+		project, err := GetLocalProjectDetails(LocalProjIndex)
 		if err != nil {
-			log.Println("Error while paying amount back", err)
-			SendDevicePaybackFailedEmail()
+			log.Println("Error while retrieving project", err)
+		} else {
+			LocalProject = project
+			setDisconnected(project.Disconnected)
+		}
+
+		assetName := LocalProject.DebtAssetCode
+		// pay the invoices issued by the platform, which bill the energy used by the recipient and the installments
+		// due on the project's schedule. A payment that is still waiting to go through would be counted twice, so
+		// wait for it before paying again
+		if QueueLength(QueuePayment) > 0 {
+			log.Println("Previous payment hasn't gone through yet, not paying again")
+		} else {
+			amount, err := GetAmountInvoiced()
+			if err != nil {
+				log.Println("Error while retrieving invoices", err)
+			} else if amount > 0 {
+				err = Enqueue(QueuePayment, PaymentPayload{AssetName: assetName, Amount: amount})
+				if err != nil {
+					log.Println("Error while queueing payment", err)
+					SendDevicePaybackFailedEmail()
+				}
+			}
 		}
 		time.Sleep(time.Duration(time.Duration(LocalProject.PaybackPeriod) * consts.OneWeekInSecond))
 	}
@@ -117,13 +142,25 @@ func checkPayback() {
 // updateState hashes the current state of the teller into ipfs and commits the ipfs hash
 // to the blockchain
 func updateState() {
+	var last opensolar.MeterReading
 	for {
-		subcommand := "Energy production data for this cycle: " + "100" + "W"
+		// report the energy generated since the last update, as read off the meter
+		reading := LatestReading()
+		var generated float64
+		if last.Timestamp != 0 {
+			generated = reading.Generated - last.Generated
+		}
+		last = reading
+
+		generatedString, err := utils.ToString(generated)
+		if err != nil {
+			log.Println(err)
+		}
+		subcommand := "Energy production data for this cycle: " + generatedString + "kWh"
 		// no spaces since this won't allow us to send in a requerst which has strings in it
-		// TODO: replace this with real data rather than fake data that we have here
 		// use rest api for ipfs since this may be too heavy to load on a pi. If not, we can shift
 		// this to the pi as well to achieve a s tate of good decentralization of information.
-		ipfsHash, err := ipfs.IpfsAddString("Device ID: " + DeviceId + " UPDATESTATE" + subcommand)
+		ipfsHash, err := store.AddString("Device ID: " + DeviceId + " UPDATESTATE" + subcommand)
 		if err != nil {
 			log.Println("Error while fetching ipfs hash", err)
 			time.Sleep(consts.TellerPollInterval)
@@ -143,154 +180,89 @@ func updateState() {
 		// But we do need to track this somehow, so maybe hash the device id and "STATUPS: "
 		// so we can track if but others viewing the blockchain can't (since the deviceId is assumed
 		// to be unique)
-		_, hash1, err := xlm.SendXLM(RecpPublicKey, float64(utils.Unix()), RecpSeed, ipfsHash[:28])
-		if err != nil {
-			log.Println(err)
-		}
-
-		_, hash2, err := xlm.SendXLM(RecpPublicKey, float64(utils.Unix()), RecpSeed, ipfsHash[29:])
+		// the commitment is queued so that it isn't lost when horizon can't be reached
+		// send email to the platform for this?  maybe overkill
+		// TODO: Define structures on the backend that would keep track of this state change
+		err = Enqueue(QueueCommitment, CommitmentPayload{Memo1: ipfsHash[:28], Memo2: ipfsHash[29:]})
 		if err != nil {
 			log.Println(err)
 		}
-
-		// we updated state as hash1 and hash2
-		// send email to the platform for this?  maybe overkill
-		// TODO: Define structures on the backend that would keep track of this state change
-		ColorOutput("Updated State: "+hash1+" "+hash2, MagentaColor)
 		time.Sleep(consts.TellerPollInterval)
 	}
 }
 
+// commitMemo sends a transaction to ourselves carrying memo and returns its hash
+func commitMemo(memo string) (string, error) {
+	_, hash, err := xlm.SendXLM(RecpPublicKey, float64(utils.Unix()), RecpSeed, memo)
+	return hash, err
+}
+
 // TODO and MWTODO: think upon this problem and arrive at a solution. Might be useful to do
 // we don't want all data to be public - figure out which parts need to be private and which public
-// stream data from the pilot particle instance and write to a file name data.txt
-// one can run verify.sh to get a list of all the ipfs hashes in the hashchain (we can make this hashchain header
-// public or available to all t he entities involved in the workflow)
-
-// storeDataLocal stores the data we observe in real time to a file and st ores the hashchain header
-func storeDataLocal() {
-	path := consts.TellerHomeDir + "/data.txt"
-
-	transport := &http.Transport{
-		MaxIdleConns:       10,
-		IdleConnTimeout:    30 * time.Second,
-		DisableCompression: true,
-	}
-	client := &http.Client{Transport: transport}
-
-	body := "https://api.particle.io/v1/devices/events?access_token=3f7d69aa99956fd77c5466f3f52eb6132f500210"
-	resp, err := client.Get(body)
-	if err != nil {
-		log.Println("error while reading from streaming endpoint: ", err)
-		return
-	}
-	defer resp.Body.Close()
-
-	reader := bufio.NewReader(resp.Body)
-	x := make([]byte, 200)
-	// open and write to file
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		_, err = os.Create(path)
+// write the data read off the meter to a file named data.txt
+// one can run verify from the teller's shell or teller --verify to walk and check all the blocks in the hashchain (we
+// can make this hashchain header public or available to all t he entities involved in the workflow). The block format
+// is described in hashchain.go
+
+// dataFile is the file that the records of the current block of the hashchain are written to
+var dataFile *os.File
+
+// storeDataLocal appends a record to the current block of the hashchain and seals the block once it's full
+func storeDataLocal(data []byte) {
+	if dataFile == nil {
+		err := openDataLocal()
 		if err != nil {
 			log.Println("error while opening file", err)
 			return
 		}
-	} else {
-		data, err := ioutil.ReadFile(path)
-		if err != nil {
-			// don't start the teller if we can't read the last known hash since this would break continuity
-			log.Fatal(err)
-		}
-		HashChainHeader = string(data)
 	}
 
-	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, os.ModeAppend)
+	_, err := dataFile.Write(data)
 	if err != nil {
-		log.Println("error while opening file", err)
+		log.Println("error while writing to file", err)
 		return
 	}
-
-	log.Println("starting to stream data from particle board: ")
-	// this loop waits for inputs (in this case from the particle API) and c ontinually
-	// writes it to a data stream
-	for {
-		_, err = reader.Read(x)
-		if err != nil {
-			log.Println(err)
-			continue
-		}
-		//log.Println("streaming data from particle board: ", string(x))
-		_, err = file.Write(x)
-		if err != nil {
-			log.Println("error while writing to file", err)
-			continue
-		}
-		size, err := file.Stat()
+	size, err := dataFile.Stat()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	// comment since this would fill console out and we can't read anything
+	// log.Println("File size is: ", size.Size())
+	if size.Size() >= int64(consts.TellerMaxLocalStorageSize) {
+		// store the block and start a new one that links to it, so that the blocks form a
+		// blockchain within a blockchain that anyone with the last hash can verify
+		_, err = sealBlock()
 		if err != nil {
-			log.Println(err)
-			continue
-		}
-		// comment since this would fill console out and we can't read anything
-		// log.Println("File size is: ", size.Size())
-		if size.Size() >= int64(consts.TellerMaxLocalStorageSize) {
-			// close the file, store in ipfs, get hash, delete file and create same file again
-			// with the previous file's hash (so people can verify)
-			// we need to store this in ipfs, delete this file and then commit the ipfs hash as
-			// the first line in a new file. This whole construction is like a blockchain so we could say
-			// we have a blockchain within a blockchain
-			// log.Println("size limit reached, taking action")
-			file.Close()
-			fileHash, err := ipfs.IpfsAddBytes([]byte(path))
-			if err != nil {
-				log.Println("Couldn't hash file: ", err)
-			}
-			HashChainHeader = fileHash
-			fileHash = "IPFSHASHCHAIN: " + fileHash + "\n" // the header of the ipfs hashchain that we form
-			// log.Println("HashChainHeader: ", HashChainHeader)
-			os.Remove(path)
-			_, err = os.Create(path)
-			if err != nil {
-				log.Println("error while opening file", err)
-				return
-			}
-
-			file, err = os.OpenFile(path, os.O_APPEND|os.O_WRONLY, os.ModeAppend)
-			if err != nil {
-				log.Println("error while opening file", err)
-				return
-			}
-			file.Write([]byte(fileHash))
+			log.Println("could not seal block", err)
 		}
 	}
 }
 
 // commitDataShutdown is called when the teller errors out and goes down
 func commitDataShutdown() {
-	// retrieve data from local storage
-	path := consts.TellerHomeDir + "/data.txt"
-
-	fileHash, err := ipfs.IpfsAddBytes([]byte(path))
-	if err != nil {
-		log.Println("Couldn't hash file: ", err)
+	if dataFile == nil {
+		err := openDataLocal()
+		if err != nil {
+			log.Println("error while opening file", err)
+			return
+		}
 	}
 
-	os.Remove(path)
-	_, err = os.Create(path)
+	fileHash, err := sealBlock()
 	if err != nil {
-		log.Println("error while opening file", err)
+		log.Println("could not seal block", err)
 		return
 	}
 
-	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, os.ModeAppend)
-	if err != nil {
-		log.Println("error while opening file", err)
-		return
+	if dataFile != nil {
+		dataFile.Close()
+		dataFile = nil
 	}
-	file.Write([]byte(fileHash))
-	file.Close()
 
-	err = StoreStateHistory(fileHash)
+	// queued so that the hash reaches the platform once the teller is back up if it can't be reached now
+	err = Enqueue(QueueStateHash, fileHash)
 	if err != nil {
-		return
+		log.Println(err)
 	}
 }
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	utils "github.com/Varunram/essentials/utils"
+	"github.com/spf13/viper"
+
+	consts "github.com/YaleOpenLab/opensolar/consts"
+	opensolar "github.com/YaleOpenLab/opensolar/core"
+)
+
+// the teller reads energy data off the meter installed at the site through a driver. Sites use different
+// hardware, so the driver and its settings are picked in the meter section of the teller config. Every driver
+// returns readings of the meter's counters of energy generated, consumed and exported in kWh, which are
+// written to the hashchain and posted to the platform in signed batches.
+
+// MeterDriver reads the meter installed at the site
+type MeterDriver interface {
+	// Read blocks until the meter has a new reading and returns it
+	Read() (opensolar.MeterReading, error)
+	// Close releases the connection to the meter
+	Close() error
+}
+
+// PowerSwitch is implemented by drivers of meters that can switch the recipient's supply between the project
+// and the grid
+type PowerSwitch interface {
+	// SetConnected supplies the recipient from the project if connected is set and from the grid otherwise
+	SetConnected(connected bool) error
+}
+
+// MeterConfig is the meter section of the teller config
+type MeterConfig struct {
+	Driver       string // one of modbus-tcp, modbus-rtu, mqtt, serial, file or particle
+	PollInterval int    // seconds between two readings for drivers that poll the meter
+	BatchSize    int    // the number of readings posted to the platform at once
+
+	Address           string  // host:port of a modbus tcp meter, or the serial device of a modbus rtu or serial meter
+	BaudRate          int     // the baud rate of a serial line
+	SlaveId           int     // the modbus slave id of the meter
+	GeneratedRegister int     // the holding register the generation counter starts at, -1 if the meter has none
+	ConsumedRegister  int     // the holding register the consumption counter starts at, -1 if the meter has none
+	ExportedRegister  int     // the holding register the export counter starts at, -1 if the meter has none
+	Scale             float64 // multiplies raw register values to get kWh
+	RelayCoil         int     // the coil that supplies the recipient from the project when set, -1 if the meter has none
+
+	Broker   string // the url of the mqtt broker
+	Topic    string // the mqtt topic the meter publishes readings on
+	ClientId string // the mqtt client id of the teller
+	Username string // the username used to connect to the broker
+	Password string // the password used to connect to the broker
+
+	Path string // the file a file driver tails
+
+	URL         string // the url of the particle event stream
+	AccessToken string // the particle access token
+	Event       string // the name of the particle event carrying readings, empty for all events
+}
+
+// meterDrivers is the registry of meter drivers keyed by the name they are selected with in the config
+var meterDrivers = map[string]func(MeterConfig) (MeterDriver, error){
+	"modbus-tcp": newModbusTCPDriver,
+	"modbus-rtu": newModbusRTUDriver,
+	"mqtt":       newMQTTDriver,
+	"serial":     newSerialDriver,
+	"file":       newFileDriver,
+	"particle":   newParticleDriver,
+}
+
+var (
+	// Meter is the driver of the meter installed at the site, nil if the config doesn't have a meter section
+	Meter MeterDriver
+	// meterConfig holds the settings of the meter
+	meterConfig MeterConfig
+	// latestReading is the last reading taken off the meter
+	latestReading opensolar.MeterReading
+	// latestReadingLock guards latestReading
+	latestReadingLock sync.Mutex
+	// Disconnected is set while the platform has disconnected the project for missed payments
+	Disconnected bool
+	// disconnectedLock guards Disconnected
+	disconnectedLock sync.Mutex
+)
+
+// LoadMeter reads the meter section of the teller config and connects to the meter with the driver selected there
+func LoadMeter() error {
+	if !viper.IsSet("meter") {
+		log.Println("no meter configured, the teller won't report energy data")
+		return nil
+	}
+
+	config := MeterConfig{
+		PollInterval:      60,
+		BatchSize:         10,
+		BaudRate:          9600,
+		SlaveId:           1,
+		GeneratedRegister: -1,
+		ConsumedRegister:  -1,
+		ExportedRegister:  -1,
+		Scale:             1,
+		RelayCoil:         -1,
+		ClientId:          "teller",
+		URL:               "https://api.particle.io/v1/devices/events",
+	}
+	err := viper.UnmarshalKey("meter", &config)
+	if err != nil {
+		return errors.Wrap(err, "could not parse meter config")
+	}
+
+	newDriver, exists := meterDrivers[config.Driver]
+	if !exists {
+		return errors.New("meter driver " + config.Driver + " not supported")
+	}
+
+	if config.BatchSize <= 0 || config.BatchSize > consts.MaxMeterBatch {
+		return errors.New("meter batch size must be between 1 and " + strconv.Itoa(consts.MaxMeterBatch))
+	}
+
+	Meter, err = newDriver(config)
+	if err != nil {
+		return errors.Wrap(err, "could not connect to meter")
+	}
+	meterConfig = config
+	ColorOutput("CONNECTED TO METER USING DRIVER: "+config.Driver, GreenColor)
+	return nil
+}
+
+// LatestReading returns the last reading taken off the meter
+func LatestReading() opensolar.MeterReading {
+	latestReadingLock.Lock()
+	defer latestReadingLock.Unlock()
+	return latestReading
+}
+
+// meterPayload is the json form of a reading published by a meter
+type meterPayload struct {
+	Timestamp int64   `json:"timestamp"`
+	Generated float64 `json:"generated"`
+	Consumed  float64 `json:"consumed"`
+	Exported  float64 `json:"exported"`
+}
+
+// parseMeterPayload parses a reading published by a meter. Readings are either json objects with the fields
+// timestamp, generated, consumed and exported or lines of the form timestamp,generated,consumed,exported.
+// Readings without a timestamp are taken to be from now
+func parseMeterPayload(data []byte) (opensolar.MeterReading, error) {
+	var reading opensolar.MeterReading
+	line := strings.TrimSpace(string(data))
+	if line == "" {
+		return reading, errors.New("empty meter reading")
+	}
+
+	var payload meterPayload
+	if strings.HasPrefix(line, "{") {
+		err := json.Unmarshal([]byte(line), &payload)
+		if err != nil {
+			return reading, errors.Wrap(err, "could not parse meter reading")
+		}
+	} else {
+		fields := strings.Split(line, ",")
+		if len(fields) != 4 {
+			return reading, errors.New("meter reading must have four fields")
+		}
+		var values [4]float64
+		for i, field := range fields {
+			field = strings.TrimSpace(field)
+			if field == "" {
+				continue
+			}
+			x, err := strconv.ParseFloat(field, 64)
+			if err != nil {
+				return reading, errors.Wrap(err, "could not parse meter reading")
+			}
+			values[i] = x
+		}
+		payload = meterPayload{Timestamp: int64(values[0]), Generated: values[1], Consumed: values[2], Exported: values[3]}
+	}
+
+	reading.Timestamp = payload.Timestamp
+	if reading.Timestamp == 0 {
+		reading.Timestamp = utils.Unix()
+	}
+	reading.Generated = payload.Generated
+	reading.Consumed = payload.Consumed
+	reading.Exported = payload.Exported
+	return reading, nil
+}
+
+// runMeter takes readings off the meter, writes them to the hashchain and queues them to be posted to the
+// platform in batches
+func runMeter() {
+	var batch []opensolar.MeterReading
+	for {
+		reading, err := Meter.Read()
+		if err != nil {
+			log.Println("could not read meter", err)
+			time.Sleep(time.Duration(meterConfig.PollInterval) * time.Second)
+			continue
+		}
+
+		latestReadingLock.Lock()
+		latestReading = reading
+		latestReadingLock.Unlock()
+
+		data, err := json.Marshal(reading)
+		if err != nil {
+			log.Println("could not marshal meter reading", err)
+			continue
+		}
+		storeDataLocal(append(data, '\n'))
+
+		batch = append(batch, reading)
+		if len(batch) >= meterConfig.BatchSize {
+			err = Enqueue(QueueReadings, batch)
+			if err != nil {
+				// the readings are still on the hashchain
+				log.Println("could not queue meter readings", err)
+			}
+			batch = nil
+		}
+	}
+}
+
+// setDisconnected enforces the connection state the platform holds for the project. While the project is
+// disconnected its power goes to the grid, so the recipient is switched over to the grid if the meter can do it
+func setDisconnected(disconnected bool) {
+	disconnectedLock.Lock()
+	defer disconnectedLock.Unlock()
+	if disconnected == Disconnected {
+		return
+	}
+	Disconnected = disconnected
+
+	if disconnected {
+		ColorOutput("PROJECT DISCONNECTED FOR MISSED PAYMENTS, POWER IS REDIRECTED TO THE GRID", RedColor)
+	} else {
+		ColorOutput("PROJECT RECONNECTED", GreenColor)
+	}
+
+	powerSwitch, ok := Meter.(PowerSwitch)
+	if !ok {
+		log.Println("meter can't switch the recipient's supply, the project has to be switched over by hand")
+		return
+	}
+	err := powerSwitch.SetConnected(!disconnected)
+	if err != nil {
+		log.Println("could not switch the recipient's supply", err)
+		// try again on the next update from the platform
+		Disconnected = !disconnected
+	}
+}
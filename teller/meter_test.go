@@ -0,0 +1,153 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	utils "github.com/Varunram/essentials/utils"
+
+	opensolar "github.com/YaleOpenLab/opensolar/core"
+)
+
+// testSwitch is a meter driver with a relay that records the supply it was switched to
+type testSwitch struct {
+	connected bool
+	fail      bool
+}
+
+func (s *testSwitch) Read() (opensolar.MeterReading, error) {
+	return opensolar.MeterReading{}, errors.New("no readings")
+}
+
+func (s *testSwitch) Close() error {
+	return nil
+}
+
+func (s *testSwitch) SetConnected(connected bool) error {
+	if s.fail {
+		return errors.New("relay stuck")
+	}
+	s.connected = connected
+	return nil
+}
+
+func TestParseMeterPayload(t *testing.T) {
+	reading, err := parseMeterPayload([]byte(`{"timestamp": 100, "generated": 1.5, "consumed": 2, "exported": 0.5}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reading.Timestamp != 100 || reading.Generated != 1.5 || reading.Consumed != 2 || reading.Exported != 0.5 {
+		t.Fatalf("unexpected reading %v", reading)
+	}
+
+	reading, err = parseMeterPayload([]byte("100, 1.5, , 0.5\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reading.Timestamp != 100 || reading.Generated != 1.5 || reading.Consumed != 0 || reading.Exported != 0.5 {
+		t.Fatalf("unexpected reading %v", reading)
+	}
+
+	// readings without a timestamp are from now
+	now := utils.Unix()
+	reading, err = parseMeterPayload([]byte(",1,2,3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reading.Timestamp < now {
+		t.Fatalf("reading without a timestamp taken at %d", reading.Timestamp)
+	}
+
+	for _, payload := range []string{"", "  \n", "1,2,3", "100,x,2,3", `{"generated": "x"}`} {
+		_, err = parseMeterPayload([]byte(payload))
+		if err == nil {
+			t.Fatalf("malformed reading %q parsed", payload)
+		}
+	}
+}
+
+func TestFileDriver(t *testing.T) {
+	dir, err := ioutil.TempDir("", "opensolar-teller")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// readings written before the teller started aren't read
+	path := filepath.Join(dir, "meter.log")
+	err = ioutil.WriteFile(path, []byte("50,1,1,1\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	driver, err := newFileDriver(MeterConfig{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer driver.Close()
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	_, err = file.WriteString("100,1,2,3\n\n" + `{"timestamp": 200, "generated": 4}` + "\n300,5,")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, timestamp := range []int64{100, 200} {
+		reading, err := driver.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reading.Timestamp != timestamp {
+			t.Fatalf("read reading taken at %d, expected %d", reading.Timestamp, timestamp)
+		}
+	}
+
+	// a line the meter is still writing is read once it is complete
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		file.WriteString("6,7\n")
+	}()
+	reading, err := driver.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reading.Timestamp != 300 || reading.Generated != 5 || reading.Consumed != 6 || reading.Exported != 7 {
+		t.Fatalf("unexpected reading %v", reading)
+	}
+}
+
+func TestSetDisconnected(t *testing.T) {
+	meter, disconnected := Meter, Disconnected
+	defer func() {
+		Meter, Disconnected = meter, disconnected
+	}()
+
+	relay := &testSwitch{connected: true}
+	Meter, Disconnected = relay, false
+
+	setDisconnected(true)
+	if relay.connected || !Disconnected {
+		t.Fatalf("recipient not switched to the grid")
+	}
+
+	// a switch that fails is tried again on the next update
+	relay.fail = true
+	setDisconnected(false)
+	if !Disconnected {
+		t.Fatalf("failed switch recorded as reconnected")
+	}
+	relay.fail = false
+	setDisconnected(false)
+	if !relay.connected || Disconnected {
+		t.Fatalf("recipient not switched back to the project")
+	}
+}
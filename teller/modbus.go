@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/binary"
+	"github.com/goburrow/modbus"
+	"github.com/pkg/errors"
+	"sync"
+	"time"
+
+	utils "github.com/Varunram/essentials/utils"
+
+	opensolar "github.com/YaleOpenLab/opensolar/core"
+)
+
+// modbusDriver polls an inverter or meter over modbus. Each counter is a 32 bit unsigned integer stored big
+// endian in two consecutive holding registers, and is multiplied by the configured scale to get kWh. Meters with a
+// relay switch the recipient's supply between the project and the grid through a coil
+
+type modbusDriver struct {
+	handler  modbus.ClientHandler
+	client   modbus.Client
+	config   MeterConfig
+	lastRead time.Time
+	mu       sync.Mutex // guards the connection, which is shared by readings and the relay
+}
+
+// closer is implemented by the modbus handlers that hold a connection
+type closer interface {
+	Close() error
+}
+
+// newModbusTCPDriver connects to a meter over modbus tcp
+func newModbusTCPDriver(config MeterConfig) (MeterDriver, error) {
+	handler := modbus.NewTCPClientHandler(config.Address)
+	handler.SlaveId = byte(config.SlaveId)
+	handler.Timeout = 10 * time.Second
+	err := handler.Connect()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not connect to modbus tcp meter")
+	}
+	return &modbusDriver{handler: handler, client: modbus.NewClient(handler), config: config}, nil
+}
+
+// newModbusRTUDriver connects to a meter over modbus rtu on a serial line
+func newModbusRTUDriver(config MeterConfig) (MeterDriver, error) {
+	handler := modbus.NewRTUClientHandler(config.Address)
+	handler.BaudRate = config.BaudRate
+	handler.DataBits = 8
+	handler.Parity = "N"
+	handler.StopBits = 1
+	handler.SlaveId = byte(config.SlaveId)
+	handler.Timeout = 10 * time.Second
+	err := handler.Connect()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not connect to modbus rtu meter")
+	}
+	return &modbusDriver{handler: handler, client: modbus.NewClient(handler), config: config}, nil
+}
+
+// readCounter reads a counter starting at register, registers below zero are read as zero
+func (d *modbusDriver) readCounter(register int) (float64, error) {
+	if register < 0 {
+		return 0, nil
+	}
+
+	d.mu.Lock()
+	data, err := d.client.ReadHoldingRegisters(uint16(register), 2)
+	d.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	if len(data) != 4 {
+		return 0, errors.New("meter returned a malformed register value")
+	}
+	return float64(binary.BigEndian.Uint32(data)) * d.config.Scale, nil
+}
+
+// Read waits for the poll interval to pass and reads the meter's counters
+func (d *modbusDriver) Read() (opensolar.MeterReading, error) {
+	var reading opensolar.MeterReading
+	wait := time.Duration(d.config.PollInterval)*time.Second - time.Since(d.lastRead)
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+	d.lastRead = time.Now()
+
+	var err error
+	reading.Timestamp = utils.Unix()
+	reading.Generated, err = d.readCounter(d.config.GeneratedRegister)
+	if err != nil {
+		return reading, errors.Wrap(err, "could not read generation counter")
+	}
+	reading.Consumed, err = d.readCounter(d.config.ConsumedRegister)
+	if err != nil {
+		return reading, errors.Wrap(err, "could not read consumption counter")
+	}
+	reading.Exported, err = d.readCounter(d.config.ExportedRegister)
+	if err != nil {
+		return reading, errors.Wrap(err, "could not read export counter")
+	}
+	return reading, nil
+}
+
+// SetConnected sets the relay coil to supply the recipient from the project or clears it to supply them from the grid
+func (d *modbusDriver) SetConnected(connected bool) error {
+	if d.config.RelayCoil < 0 {
+		return errors.New("meter doesn't have a relay")
+	}
+
+	value := uint16(0x0000)
+	if connected {
+		value = 0xFF00
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, err := d.client.WriteSingleCoil(uint16(d.config.RelayCoil), value)
+	if err != nil {
+		return errors.Wrap(err, "could not write relay coil")
+	}
+	return nil
+}
+
+// Close closes the connection to the meter
+func (d *modbusDriver) Close() error {
+	if c, ok := d.handler.(closer); ok {
+		return c.Close()
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/pkg/errors"
+	"log"
+
+	opensolar "github.com/YaleOpenLab/opensolar/core"
+)
+
+// mqttDriver subscribes to the topic a meter publishes its readings on
+
+type mqttDriver struct {
+	client   mqtt.Client
+	messages chan []byte
+}
+
+// newMQTTDriver connects to the broker and subscribes to the meter's topic
+func newMQTTDriver(config MeterConfig) (MeterDriver, error) {
+	if config.Broker == "" || config.Topic == "" {
+		return nil, errors.New("mqtt driver needs a broker and a topic")
+	}
+
+	d := &mqttDriver{messages: make(chan []byte, 100)}
+	opts := mqtt.NewClientOptions().AddBroker(config.Broker).SetClientID(config.ClientId).SetAutoReconnect(true)
+	if config.Username != "" {
+		opts.SetUsername(config.Username)
+		opts.SetPassword(config.Password)
+	}
+	// subscribe again whenever the connection to the broker is restored
+	opts.SetOnConnectHandler(func(client mqtt.Client) {
+		token := client.Subscribe(config.Topic, 1, d.handle)
+		if token.Wait() && token.Error() != nil {
+			log.Println("could not subscribe to meter topic", token.Error())
+		}
+	})
+
+	d.client = mqtt.NewClient(opts)
+	token := d.client.Connect()
+	if token.Wait() && token.Error() != nil {
+		return nil, errors.Wrap(token.Error(), "could not connect to mqtt broker")
+	}
+	return d, nil
+}
+
+// handle queues a message published on the meter's topic
+func (d *mqttDriver) handle(client mqtt.Client, msg mqtt.Message) {
+	select {
+	case d.messages <- msg.Payload():
+	default:
+		log.Println("meter readings are arriving faster than they can be processed, dropping one")
+	}
+}
+
+// Read waits for the meter to publish a reading
+func (d *mqttDriver) Read() (opensolar.MeterReading, error) {
+	return parseMeterPayload(<-d.messages)
+}
+
+// Close disconnects from the broker
+func (d *mqttDriver) Close() error {
+	d.client.Disconnect(250)
+	return nil
+}
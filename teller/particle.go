@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	opensolar "github.com/YaleOpenLab/opensolar/core"
+)
+
+// particleDriver reads the server sent event stream of a particle board. Each event carries a reading in the
+// json or csv form accepted by parseMeterPayload in its data field
+
+type particleDriver struct {
+	config MeterConfig
+	client *http.Client
+	body   *http.Response
+	reader *bufio.Reader
+	event  string
+}
+
+// particleEvent is the data of an event published on the particle stream
+type particleEvent struct {
+	Data        string `json:"data"`
+	TTL         int    `json:"ttl"`
+	PublishedAt string `json:"published_at"`
+	CoreId      string `json:"coreid"`
+}
+
+// newParticleDriver connects to the particle event stream
+func newParticleDriver(config MeterConfig) (MeterDriver, error) {
+	if config.AccessToken == "" {
+		return nil, errors.New("particle driver needs an access token")
+	}
+
+	transport := &http.Transport{
+		MaxIdleConns:       10,
+		IdleConnTimeout:    30 * time.Second,
+		DisableCompression: true,
+	}
+	d := &particleDriver{config: config, client: &http.Client{Transport: transport}}
+	return d, d.connect()
+}
+
+// connect opens the event stream
+func (d *particleDriver) connect() error {
+	if d.body != nil {
+		d.body.Body.Close()
+	}
+
+	resp, err := d.client.Get(d.config.URL + "?access_token=" + url.QueryEscape(d.config.AccessToken))
+	if err != nil {
+		return errors.Wrap(err, "could not connect to particle event stream")
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return errors.New("particle event stream returned " + resp.Status)
+	}
+
+	d.body = resp
+	d.reader = bufio.NewReader(resp.Body)
+	return nil
+}
+
+// Read waits for the next event that carries a reading
+func (d *particleDriver) Read() (opensolar.MeterReading, error) {
+	for {
+		line, err := d.reader.ReadString('\n')
+		if err != nil {
+			// the stream was closed, reconnect so that the next read picks up from there
+			if cerr := d.connect(); cerr != nil {
+				return opensolar.MeterReading{}, cerr
+			}
+			return opensolar.MeterReading{}, errors.Wrap(err, "particle event stream closed")
+		}
+
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "event:"):
+			d.event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			if d.config.Event != "" && d.event != d.config.Event {
+				continue
+			}
+			var event particleEvent
+			err = json.Unmarshal([]byte(strings.TrimSpace(strings.TrimPrefix(line, "data:"))), &event)
+			if err != nil {
+				return opensolar.MeterReading{}, errors.Wrap(err, "could not parse particle event")
+			}
+			return parseMeterPayload([]byte(event.Data))
+		}
+	}
+}
+
+// Close closes the event stream
+func (d *particleDriver) Close() error {
+	if d.body != nil {
+		return d.body.Body.Close()
+	}
+	return nil
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+	"log"
+	"time"
+
+	utils "github.com/Varunram/essentials/utils"
+
+	consts "github.com/YaleOpenLab/opensolar/consts"
+	opensolar "github.com/YaleOpenLab/opensolar/core"
+)
+
+// sites can lose connectivity to the platform and to horizon for days, so the teller doesn't send payments,
+// readings or state commitments straight away. They're written to a queue on disk first and a worker for each
+// kind sends them in the order they were queued, retrying with backoff until they go through. Every item
+// carries an idempotency key that the platform uses to carry out a payment only once even if the teller sends
+// it again because the response got lost.
+
+const (
+	// QueuePayment is a payback towards the project
+	QueuePayment = "payment"
+
+	// QueueReadings is a batch of meter readings
+	QueueReadings = "readings"
+
+	// QueueStateHash is the hash of the teller's state stored on the platform
+	QueueStateHash = "statehash"
+
+	// QueueCommitment is a state hash committed to the blockchain in the memos of two transactions
+	QueueCommitment = "commitment"
+)
+
+// QueueItem is a request waiting to be sent
+type QueueItem struct {
+	Seq       uint64          // the position of the item in its queue
+	Kind      string          // the kind of request
+	Key       string          // the idempotency key of the request
+	Payload   json.RawMessage // the data needed to make the request
+	CreatedAt int64           // unix time at which the item was queued
+	Attempts  int             // the number of times sending the item failed
+	LastError string          // the error the last attempt failed with
+}
+
+// PaymentPayload is the payload of a queued payment
+type PaymentPayload struct {
+	AssetName string
+	Amount    float64
+}
+
+// CommitmentPayload is the payload of a queued state commitment. The hashes of the transactions are stored as
+// they go through so that a half sent commitment isn't sent again
+type CommitmentPayload struct {
+	Memo1 string // the memo of the first transaction
+	Memo2 string // the memo of the second transaction
+	Tx1   string // the hash of the first transaction once it has been sent
+	Tx2   string // the hash of the second transaction once it has been sent
+}
+
+// transientError is an error that goes away if the request is retried later, like a network error
+type transientError struct {
+	error
+}
+
+// transient marks an error as one that goes away if the request is retried later
+func transient(err error) error {
+	if err == nil {
+		return nil
+	}
+	return transientError{err}
+}
+
+// isTransient checks whether an error goes away if the request is retried later
+func isTransient(err error) bool {
+	_, ok := errors.Cause(err).(transientError)
+	return ok
+}
+
+// queueHandlers send the items of each kind
+var queueHandlers = map[string]func(*QueueItem) error{
+	QueuePayment:    sendQueuedPayment,
+	QueueReadings:   sendQueuedReadings,
+	QueueStateHash:  sendQueuedStateHash,
+	QueueCommitment: sendQueuedCommitment,
+}
+
+var (
+	// queueDb is the database the queue is stored in
+	queueDb *bolt.DB
+	// queueSignals wakes up the worker of a kind when an item is queued
+	queueSignals = make(map[string]chan struct{})
+)
+
+// OpenQueue opens the queue stored in the teller's home directory
+func OpenQueue() error {
+	var err error
+	queueDb, err = bolt.Open(consts.TellerHomeDir+"/queue.db", 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return errors.Wrap(err, "could not open queue")
+	}
+
+	return queueDb.Update(func(tx *bolt.Tx) error {
+		for kind := range queueHandlers {
+			_, err := tx.CreateBucketIfNotExists([]byte(kind))
+			if err != nil {
+				return err
+			}
+			queueSignals[kind] = make(chan struct{}, 1)
+		}
+		return nil
+	})
+}
+
+// seqKey returns the key an item is stored at. Keys sort in the order the items were queued
+func seqKey(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key
+}
+
+// Enqueue queues a request of the given kind
+func Enqueue(kind string, payload interface{}) error {
+	if queueHandlers[kind] == nil {
+		return errors.New("queue kind " + kind + " not supported")
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return errors.Wrap(err, "could not marshal payload")
+	}
+
+	key, err := GenerateRandomString(16)
+	if err != nil {
+		return errors.Wrap(err, "could not generate idempotency key")
+	}
+
+	err = queueDb.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(kind))
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		item := QueueItem{Seq: seq, Kind: kind, Key: key, Payload: data, CreatedAt: utils.Unix()}
+		value, err := json.Marshal(item)
+		if err != nil {
+			return err
+		}
+		return b.Put(seqKey(seq), value)
+	})
+	if err != nil {
+		return errors.Wrap(err, "could not queue "+kind)
+	}
+
+	select {
+	case queueSignals[kind] <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// QueueLength returns the number of items of a kind waiting to be sent
+func QueueLength(kind string) int {
+	var length int
+	err := queueDb.View(func(tx *bolt.Tx) error {
+		length = tx.Bucket([]byte(kind)).Stats().KeyN
+		return nil
+	})
+	if err != nil {
+		log.Println(err)
+	}
+	return length
+}
+
+// peekQueue returns the oldest item of a kind, nil if there is none
+func peekQueue(kind string) (*QueueItem, error) {
+	var item *QueueItem
+	err := queueDb.View(func(tx *bolt.Tx) error {
+		_, value := tx.Bucket([]byte(kind)).Cursor().First()
+		if value == nil {
+			return nil
+		}
+		item = &QueueItem{}
+		return json.Unmarshal(value, item)
+	})
+	return item, err
+}
+
+// updateQueueItem stores the progress made on an item
+func updateQueueItem(item *QueueItem) error {
+	return queueDb.Update(func(tx *bolt.Tx) error {
+		value, err := json.Marshal(item)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket([]byte(item.Kind)).Put(seqKey(item.Seq), value)
+	})
+}
+
+// removeQueueItem removes an item that has been sent
+func removeQueueItem(item *QueueItem) error {
+	return queueDb.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(item.Kind)).Delete(seqKey(item.Seq))
+	})
+}
+
+// queueBackoff returns how long to wait before an item that failed attempts times is sent again
+func queueBackoff(attempts int) time.Duration {
+	backoff := consts.TellerQueueRetryInterval
+	for i := 1; i < attempts && backoff < consts.TellerQueueMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > consts.TellerQueueMaxBackoff {
+		backoff = consts.TellerQueueMaxBackoff
+	}
+	return backoff
+}
+
+// runQueue sends the items of a kind in order. An item that fails with a transient error is retried with backoff
+// and holds back the items after it, items that fail otherwise are dropped since sending them again won't help
+func runQueue(kind string) {
+	handler := queueHandlers[kind]
+	for {
+		item, err := peekQueue(kind)
+		if err != nil {
+			log.Println("could not read queue", kind, err)
+			time.Sleep(consts.TellerQueueRetryInterval)
+			continue
+		}
+
+		if item == nil {
+			// wait for an item to be queued
+			<-queueSignals[kind]
+			continue
+		}
+
+		err = handler(item)
+		if err == nil {
+			err = removeQueueItem(item)
+			if err != nil {
+				log.Println("could not remove sent item from queue", kind, err)
+			}
+			continue
+		}
+
+		if !isTransient(err) {
+			log.Println("dropping queued", kind, "queued at", item.CreatedAt, "since it failed:", err)
+			err = removeQueueItem(item)
+			if err != nil {
+				log.Println("could not remove item from queue", kind, err)
+			}
+			continue
+		}
+
+		item.Attempts++
+		item.LastError = err.Error()
+		log.Println("could not send queued", kind, "attempt", item.Attempts, err)
+		err = updateQueueItem(item)
+		if err != nil {
+			log.Println("could not update queued", kind, err)
+		}
+		time.Sleep(queueBackoff(item.Attempts))
+	}
+}
+
+// RunQueues starts a worker for every kind of queued request
+func RunQueues() {
+	for kind := range queueHandlers {
+		go runQueue(kind)
+	}
+}
+
+// sendQueuedPayment pays back towards the project
+func sendQueuedPayment(item *QueueItem) error {
+	var payload PaymentPayload
+	err := json.Unmarshal(item.Payload, &payload)
+	if err != nil {
+		return err
+	}
+
+	err = ProjectPayback(payload.AssetName, payload.Amount, item.Key)
+	if err != nil && item.Attempts == 0 {
+		// let the recipient and the platform know the first time a payment doesn't go through
+		SendDevicePaybackFailedEmail()
+	}
+	return err
+}
+
+// sendQueuedReadings posts a batch of meter readings to the platform
+func sendQueuedReadings(item *QueueItem) error {
+	var readings []opensolar.MeterReading
+	err := json.Unmarshal(item.Payload, &readings)
+	if err != nil {
+		return err
+	}
+
+	result, err := PostMeterReadings(readings)
+	if err != nil {
+		return err
+	}
+	for _, rejected := range result.Rejected {
+		log.Println("platform rejected meter reading at", rejected.Timestamp, rejected.Reason)
+	}
+	setDisconnected(result.Disconnected)
+	return nil
+}
+
+// sendQueuedStateHash stores a state hash on the platform
+func sendQueuedStateHash(item *QueueItem) error {
+	var hash string
+	err := json.Unmarshal(item.Payload, &hash)
+	if err != nil {
+		return err
+	}
+	return StoreStateHistory(hash)
+}
+
+// sendQueuedCommitment commits a state hash to the blockchain. Each half of the hash is sent in a transaction
+// of its own and the item is updated after each one so that a retry picks up where the last attempt stopped
+func sendQueuedCommitment(item *QueueItem) error {
+	var payload CommitmentPayload
+	err := json.Unmarshal(item.Payload, &payload)
+	if err != nil {
+		return err
+	}
+
+	save := func() error {
+		item.Payload, err = json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		return updateQueueItem(item)
+	}
+
+	if payload.Tx1 == "" {
+		payload.Tx1, err = commitMemo(payload.Memo1)
+		if err != nil {
+			return transient(err)
+		}
+		err = save()
+		if err != nil {
+			return transient(err)
+		}
+	}
+
+	if payload.Tx2 == "" {
+		payload.Tx2, err = commitMemo(payload.Memo2)
+		if err != nil {
+			return transient(err)
+		}
+		err = save()
+		if err != nil {
+			return transient(err)
+		}
+	}
+
+	ColorOutput("Updated State: "+payload.Tx1+" "+payload.Tx2, MagentaColor)
+	return nil
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	consts "github.com/YaleOpenLab/opensolar/consts"
+)
+
+// setupQueue opens a queue in a temporary home directory. The returned function closes the queue and
+// restores the teller's home directory
+func setupQueue(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "opensolar-teller")
+	if err != nil {
+		t.Fatal(err)
+	}
+	homeDir := consts.TellerHomeDir
+	consts.TellerHomeDir = dir
+
+	err = OpenQueue()
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return func() {
+		queueDb.Close()
+		os.RemoveAll(dir)
+		consts.TellerHomeDir = homeDir
+	}
+}
+
+func TestQueueSurvivesRestart(t *testing.T) {
+	teardown := setupQueue(t)
+	defer teardown()
+
+	err := Enqueue("unknown", "payload")
+	if err == nil {
+		t.Fatalf("item of an unknown kind queued")
+	}
+
+	for _, amount := range []float64{10, 20} {
+		err = Enqueue(QueuePayment, PaymentPayload{AssetName: "DEBTASSET", Amount: amount})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = Enqueue(QueueStateHash, "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the queue is read back in order after the teller restarts
+	queueDb.Close()
+	err = OpenQueue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if QueueLength(QueuePayment) != 2 || QueueLength(QueueStateHash) != 1 {
+		t.Fatalf("queue lost items over a restart")
+	}
+
+	item, err := peekQueue(QueuePayment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var payload PaymentPayload
+	err = json.Unmarshal(item.Payload, &payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.Seq != 1 || item.Key == "" || payload.Amount != 10 {
+		t.Fatalf("unexpected first item %v", item)
+	}
+
+	err = removeQueueItem(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, err := peekQueue(QueuePayment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.Seq != 2 || next.Key == item.Key {
+		t.Fatalf("unexpected second item %v", next)
+	}
+}
+
+func TestRunQueue(t *testing.T) {
+	sent := make(chan string, 10)
+	queueHandlers["test"] = func(item *QueueItem) error {
+		var payload string
+		err := json.Unmarshal(item.Payload, &payload)
+		if err != nil {
+			return err
+		}
+		sent <- payload
+		switch {
+		case payload == "transient" && item.Attempts == 0:
+			return transient(errors.New("network down"))
+		case payload == "fail":
+			return errors.Wrap(errors.New("rejected"), "could not send")
+		}
+		return nil
+	}
+	defer delete(queueHandlers, "test")
+
+	retryInterval := consts.TellerQueueRetryInterval
+	consts.TellerQueueRetryInterval = time.Millisecond
+	defer func() {
+		consts.TellerQueueRetryInterval = retryInterval
+	}()
+
+	teardown := setupQueue(t)
+	defer teardown()
+
+	for _, payload := range []string{"first", "transient", "fail", "last"} {
+		err := Enqueue("test", payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// items that fail for a while hold back the rest, items that can't be sent are dropped
+	go runQueue("test")
+	for _, expected := range []string{"first", "transient", "transient", "fail", "last"} {
+		select {
+		case payload := <-sent:
+			if payload != expected {
+				t.Fatalf("sent %s, expected %s", payload, expected)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("queue stalled before sending %s", expected)
+		}
+	}
+
+	for i := 0; QueueLength("test") != 0; i++ {
+		if i == 100 {
+			t.Fatalf("sent items left in the queue")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestQueueBackoff(t *testing.T) {
+	cases := []struct {
+		attempts int
+		backoff  time.Duration
+	}{
+		{1, consts.TellerQueueRetryInterval},
+		{2, 2 * consts.TellerQueueRetryInterval},
+		{3, 4 * consts.TellerQueueRetryInterval},
+		{100, consts.TellerQueueMaxBackoff},
+	}
+	for _, c := range cases {
+		if backoff := queueBackoff(c.attempts); backoff != c.backoff {
+			t.Fatalf("backoff after %d attempts is %s, expected %s", c.attempts, backoff, c.backoff)
+		}
+	}
+
+	if !isTransient(errors.Wrap(transient(errors.New("timeout")), "could not send")) {
+		t.Fatalf("wrapped transient error not retried")
+	}
+	if isTransient(errors.New("rejected")) {
+		t.Fatalf("error retried that won't go away")
+	}
+}
@@ -1,10 +1,13 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"github.com/pkg/errors"
+	"io/ioutil"
 	"log"
+	"net/http"
 
 	geo "github.com/martinlindhe/google-geolocate"
 
@@ -88,39 +91,55 @@ func LoginToPlatform(username string, pwhash string) error {
 	return nil
 }
 
-// ProjectPayback pays back to the platform
-func ProjectPayback(assetName string, amountx float64) error {
+// ProjectPayback pays back to the platform. The payment is signed with the device key and carries an idempotency
+// key so that the platform pays it only once if it is sent again
+func ProjectPayback(assetName string, amountx float64, idempotencyKey string) error {
 	amount, err := utils.ToString(amountx)
 	if err != nil {
 		return err
 	}
+	timestamp := utils.Unix()
+	timestampString, err := utils.ToString(timestamp)
+	if err != nil {
+		return err
+	}
+	signature, err := SignRequest(timestamp, LocalProjIndex, LocalProject.DebtAssetCode, amount, idempotencyKey)
+	if err != nil {
+		return err
+	}
 	// retrieve project index
 	log.Println("PAYMENT BODY: ", ApiUrl+"/recipient/payback?"+"username="+LocalRecipient.U.Username+
 		"&pwhash="+LocalRecipient.U.Pwhash+"&projIndex="+LocalProjIndex+"&assetName="+LocalProject.DebtAssetCode+"&seedpwd="+
 		LocalSeedPwd+"&amount="+amount)
 	data, err := erpc.GetRequest(ApiUrl + "/recipient/payback?" + "username=" + LocalRecipient.U.Username +
 		"&pwhash=" + LocalRecipient.U.Pwhash + "&projIndex=" + LocalProjIndex + "&assetName=" + LocalProject.DebtAssetCode + "&seedpwd=" +
-		LocalSeedPwd + "&amount=" + amount)
+		LocalSeedPwd + "&amount=" + amount + "&deviceId=" + DeviceId + "&timestamp=" + timestampString + "&signature=" + signature +
+		"&idempotencyKey=" + idempotencyKey)
 	if err != nil {
-		return err
+		return transient(err)
 	}
 	var x erpc.StatusResponse
 	err = json.Unmarshal(data, &x)
 	if err != nil {
-		return err
+		return transient(err)
 	}
 	log.Println("PAYBACK RESPONSE: ", x)
 	if x.Code == 200 {
 		ColorOutput("PAID!", GreenColor)
 		return nil
 	}
-	return errors.New("Errored out")
+	if x.Code >= 400 && x.Code < 500 {
+		// the platform rejected the payment, eg since its signature didn't check out. Sending it again won't help
+		return errors.New(fmt.Sprint("platform rejected payment with status ", x.Code))
+	}
+	// the platform couldn't carry out the payment right now, eg since the recipient's balance is too low
+	return transient(errors.New("Errored out"))
 }
 
-// SetDeviceId sets the device id of the teller
-func SetDeviceId(username string, pwhash string, deviceId string) error {
+// SetDeviceId sets the device id of the teller and registers the public key of the device with the platform
+func SetDeviceId(username string, pwhash string, deviceId string, pubkey string) error {
 	data, err := erpc.GetRequest(ApiUrl + "/recipient/deviceId?" + "username=" + username +
-		"&pwhash=" + pwhash + "&deviceid=" + deviceId)
+		"&pwhash=" + pwhash + "&deviceId=" + deviceId + "&devicePubkey=" + pubkey)
 	if err != nil {
 		return err
 	}
@@ -130,7 +149,7 @@ func SetDeviceId(username string, pwhash string, deviceId string) error {
 		return err
 	}
 	if x.Code == 200 {
-		ColorOutput("PAID!", GreenColor)
+		ColorOutput("REGISTERED DEVICE!", GreenColor)
 		return nil
 	}
 	return errors.New("Errored out, didn't receive 200")
@@ -254,6 +273,27 @@ func GetLocalProjectDetails(projIndex string) (opensolar.Project, error) {
 	return x, nil
 }
 
+// GetAmountInvoiced gets the amount due on the invoices of the teller's project that haven't been settled
+func GetAmountInvoiced() (float64, error) {
+	data, err := erpc.GetRequest(ApiUrl + "/recipient/invoices?" + "username=" + LocalRecipient.U.Username +
+		"&pwhash=" + LocalRecipient.U.Pwhash + "&projIndex=" + LocalProjIndex)
+	if err != nil {
+		return 0, err
+	}
+
+	var x []opensolar.Invoice
+	err = json.Unmarshal(data, &x)
+	if err != nil {
+		return 0, err
+	}
+
+	var due float64
+	for _, invoice := range x {
+		due += invoice.Due()
+	}
+	return due, nil
+}
+
 // SendDevicePaybackFailedEmail sends a notification if the payback routine breaks in its execution
 func SendDevicePaybackFailedEmail() error {
 
@@ -278,25 +318,71 @@ func SendDevicePaybackFailedEmail() error {
 
 // StoreStateHistory stores state history in the data file
 func StoreStateHistory(hash string) error {
+	timestamp := utils.Unix()
+	timestampString, err := utils.ToString(timestamp)
+	if err != nil {
+		return err
+	}
+	signature, err := SignRequest(timestamp, hash)
+	if err != nil {
+		return err
+	}
+
 	data, err := erpc.GetRequest(ApiUrl + "/recipient/ssh?" + "username=" + LocalRecipient.U.Username +
-		"&pwhash=" + LocalRecipient.U.Pwhash + "&hash=" + hash)
+		"&pwhash=" + LocalRecipient.U.Pwhash + "&hash=" + hash + "&deviceId=" + DeviceId + "&timestamp=" + timestampString +
+		"&signature=" + signature)
 	if err != nil {
 		log.Println(err)
-		return err
+		return transient(err)
 	}
 
 	var x erpc.StatusResponse
 	err = json.Unmarshal(data, &x)
 	if err != nil {
-		return err
+		return transient(err)
 	}
 	if x.Code == 200 {
-		ColorOutput("SENT FAILED PAYBACK EMAIL", RedColor)
+		ColorOutput("STORED STATE HASH", GreenColor)
 		return nil
 	}
+	if x.Code >= 500 {
+		return transient(errors.New("Errored out, didn't receive 200"))
+	}
 	return errors.New("Errored out, didn't receive 200")
 }
 
+// PostMeterReadings posts a batch of meter readings to the platform, signed with the device key
+func PostMeterReadings(readings []opensolar.MeterReading) (opensolar.MeterIngestResult, error) {
+	var x opensolar.MeterIngestResult
+	batch, err := json.Marshal(readings)
+	if err != nil {
+		return x, err
+	}
+
+	resp, err := http.Post(ApiUrl+"/recipient/meter/readings?"+"username="+LocalRecipient.U.Username+
+		"&pwhash="+LocalRecipient.U.Pwhash+"&projIndex="+LocalProjIndex+"&deviceId="+DeviceId+
+		"&signature="+SignMessage(batch), "application/json", bytes.NewReader(batch))
+	if err != nil {
+		return x, transient(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 500 {
+		return x, transient(errors.New("platform couldn't take meter readings, status: " + resp.Status))
+	}
+	if resp.StatusCode != http.StatusOK {
+		return x, errors.New("platform didn't accept meter readings, status: " + resp.Status)
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return x, transient(err)
+	}
+
+	err = json.Unmarshal(data, &x)
+	return x, err
+}
+
 // testSwytch tests whether the swytch workflow works correctly
 func testSwytch() {
 	body := ApiUrl + ApiUrl + "swytch/accessToken?" +
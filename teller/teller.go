@@ -38,9 +38,12 @@ import (
 // on the platform
 
 var opts struct {
-	Daemon     bool `short:"d" description:"Run the teller in daemon mode"`
-	Port       int  `short:"p" description:"The port on which the teller runs on (default: 443)"`
-	TestSwytch bool `long:"ts" description:"Test swytch API workflow"`
+	Daemon     bool   `short:"d" description:"Run the teller in daemon mode"`
+	Port       int    `short:"p" description:"The port on which the teller runs on (default: 443)"`
+	TestSwytch bool   `long:"ts" description:"Test swytch API workflow"`
+	Verify     string `long:"verify" description:"Verify the hashchain of the teller at the given url or starting at the given ipfs hash and exit"`
+	Store      string `long:"store" description:"The content store to use: ipfs, fs or memory (default: the one in the config, else ipfs)"`
+	StorePath  string `long:"storepath" description:"The address of the ipfs api or the directory of the fs store"`
 }
 
 var (
@@ -98,7 +101,9 @@ func autoComplete() readline.AutoCompleter {
 			readline.PcItem("update"),
 			readline.PcItem("qq"),
 			readline.PcItem("hh"),
+			readline.PcItem("verify"),
 		),
+		readline.PcItem("verify"),
 		readline.PcItem("display",
 			readline.PcItem("balance",
 				readline.PcItem("xlm"),
@@ -121,6 +126,19 @@ func main() {
 	if opts.TestSwytch {
 		testSwytch()
 	}
+	if opts.Store != "" {
+		err = setStore(opts.Store, opts.StorePath)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if opts.Verify != "" {
+		// verifying a teller's data doesn't need its credentials, so don't start the teller
+		if !verifyHashChain(opts.Verify) {
+			os.Exit(1)
+		}
+		return
+	}
 
 	log.Println("---------------WELCOME TO THE TELLER INTERFACE---------------")
 	defer recoverPanic() // catch any panics that may occur during the teller's runtime
@@ -142,9 +160,12 @@ func main() {
 		log.Fatal(err)
 	}
 	// run goroutines in the background to routinely check for payback, state updates and stuff
+	RunQueues()
 	go checkPayback()
-	// go updateState()
-	// go storeDataLocal()
+	if Meter != nil {
+		go runMeter()
+		// go updateState()
+	}
 
 	if opts.Daemon {
 		log.Println("Running teller in daemon mode")
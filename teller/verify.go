@@ -0,0 +1,79 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	store "github.com/YaleOpenLab/opensolar/store"
+)
+
+// fetchHashChainHeader gets the head of the hash chain from the /hash endpoint of a teller
+func fetchHashChainHeader(url string) (string, error) {
+	// tellers serve self signed certificates, the blocks themselves are checked against their ipfs hashes
+	client := &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+	}
+
+	resp, err := client.Get(strings.TrimSuffix(url, "/") + "/hash")
+	if err != nil {
+		return "", errors.Wrap(err, "could not reach teller")
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", errors.Wrap(err, "could not read response")
+	}
+
+	var x HCHeaderResponse
+	err = json.Unmarshal(data, &x)
+	if err != nil {
+		return "", errors.Wrap(err, "could not unmarshal response")
+	}
+	return x.Hash, nil
+}
+
+// verifyHashChain verifies the hash chain of the teller at target, which is either the url of the teller or
+// the ipfs hash of the block to start from, and prints what it finds. It returns whether the chain is intact
+func verifyHashChain(target string) bool {
+	head := target
+	if strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://") {
+		var err error
+		head, err = fetchHashChainHeader(target)
+		if err != nil {
+			fmt.Println("could not get hashchain header:", err)
+			return false
+		}
+	}
+
+	report := VerifyHashChain(head, store.Get)
+	fmt.Println("HASHCHAIN HEADER:", report.Head)
+	for _, block := range report.Blocks {
+		status := "OK"
+		if len(block.Problems) != 0 {
+			status = "TAMPERED"
+		}
+		fmt.Println("  block", block.Seq, block.Hash, strconv.Itoa(block.Records)+" records", status)
+		for _, problem := range block.Problems {
+			fmt.Println("    -", problem)
+		}
+	}
+	for _, problem := range report.Problems {
+		fmt.Println("  -", problem)
+	}
+
+	if report.Ok() {
+		ColorOutput("HASHCHAIN VERIFIED: "+strconv.Itoa(len(report.Blocks))+" blocks", GreenColor)
+		return true
+	}
+	ColorOutput("HASHCHAIN COULD NOT BE VERIFIED", RedColor)
+	return false
+}
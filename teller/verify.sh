@@ -1,12 +1,13 @@
 #!/bin/bash
+# lists the ipfs hashes of the blocks in a teller's hashchain. Use teller --verify to check the blocks as well
 echo "Enter the hash received from the teller: "
 read input
 hash=$input # get this value from the user
-echo "\n"
+echo ""
 while [ "$hash" != "" ]
 do
-  temp=$(ipfs cat $hash |  grep -a IPFSHASHCHAIN)
-  set -- junk $temp ; shift # to split the above into separate fields organized by space
-  echo "found hash: $2"
-  hash=$2
+  header=$(ipfs cat $hash | head -n 1)
+  seq=$(echo "$header" | jq -r .seq)
+  echo "found block $seq: $hash"
+  hash=$(echo "$header" | jq -r '.prev // empty')
 done